@@ -1,10 +1,10 @@
-//go:build freebsd
-
 package errors
 
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 // Error codes for common ZFS operations
@@ -74,6 +74,52 @@ func IsZfsError(err error) bool {
 	return ok
 }
 
+// PropertyErrors reports every property rejected by a batch property
+// update, keyed by property name. None of the properties were applied.
+type PropertyErrors struct {
+	Op       string           // The operation that failed (e.g., "set_properties")
+	Resource string           // The dataset or pool the properties belong to
+	Errors   map[string]error // Why each rejected property was rejected
+}
+
+// Error implements the error interface
+func (e *PropertyErrors) Error() string {
+	names := e.names()
+	details := make([]string, len(names))
+	for i, name := range names {
+		details[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("zfs %s %s: %d properties rejected: %s", e.Op, e.Resource, len(names), strings.Join(details, "; "))
+}
+
+// Unwrap returns the per-property errors, ordered by property name
+func (e *PropertyErrors) Unwrap() []error {
+	names := e.names()
+	errs := make([]error, len(names))
+	for i, name := range names {
+		errs[i] = e.Errors[name]
+	}
+	return errs
+}
+
+func (e *PropertyErrors) names() []string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AsPropertyErrors extracts a PropertyErrors report from an error chain
+func AsPropertyErrors(err error) (*PropertyErrors, bool) {
+	var propErrs *PropertyErrors
+	if errors.As(err, &propErrs) {
+		return propErrs, true
+	}
+	return nil, false
+}
+
 // Predefined error variables for common conditions
 var (
 	// ErrDatasetNotFound indicates a dataset was not found
@@ -132,6 +178,13 @@ var (
 		Detail: "invalid argument",
 	}
 
+	// ErrUnknownProperty indicates a property name that is not recognized
+	ErrUnknownProperty = &ZfsError{
+		Op:     "get_property",
+		Code:   ErrCodeInval,
+		Detail: "unknown property",
+	}
+
 	// ErrNoSpace indicates insufficient space
 	ErrNoSpace = &ZfsError{
 		Op:     "space_check",
@@ -291,6 +344,14 @@ func IsNotSupported(err error) bool {
 	return false
 }
 
+// IsUnknownProperty checks if an error indicates an unknown property name
+func IsUnknownProperty(err error) bool {
+	if zfsErr, ok := AsZfsError(err); ok {
+		return zfsErr.Code == ErrCodeInval && zfsErr.Op == "get_property"
+	}
+	return false
+}
+
 // MapErrno maps a Unix errno to a ZFS error code
 func MapErrno(errno int) string {
 	switch errno {
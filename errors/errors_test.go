@@ -1,9 +1,8 @@
-//go:build freebsd
-
 package errors
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -173,6 +172,21 @@ func TestErrorPredicates(t *testing.T) {
 				"IsDatasetNotFound":  false,
 			},
 		},
+		{
+			name: "unknown property",
+			err: &ZfsError{
+				Op:   "get_property",
+				Code: ErrCodeInval,
+			},
+			predicates: map[string]func(error) bool{
+				"IsUnknownProperty": IsUnknownProperty,
+				"IsDatasetNotFound": IsDatasetNotFound,
+			},
+			expected: map[string]bool{
+				"IsUnknownProperty": true,
+				"IsDatasetNotFound": false,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -188,6 +202,36 @@ func TestErrorPredicates(t *testing.T) {
 	}
 }
 
+func TestPropertyErrors(t *testing.T) {
+	quotaErr := NewZfsError("set_property", "tank/data", ErrCodeInval, 22, "bad value", nil)
+	compErr := NewZfsError("set_property", "tank/data", ErrCodeInval, 22, "invalid property", nil)
+	err := fmt.Errorf("set: %w", &PropertyErrors{
+		Op:       "set_properties",
+		Resource: "tank/data",
+		Errors:   map[string]error{"quota": quotaErr, "compression": compErr},
+	})
+
+	propErrs, ok := AsPropertyErrors(err)
+	if !ok {
+		t.Fatalf("AsPropertyErrors(%v) = false", err)
+	}
+	expected := "zfs set_properties tank/data: 2 properties rejected: " +
+		"compression: zfs set_property tank/data: invalid property (EINVAL); " +
+		"quota: zfs set_property tank/data: bad value (EINVAL)"
+	if propErrs.Error() != expected {
+		t.Errorf("Error() = %q, want %q", propErrs.Error(), expected)
+	}
+	if unwrapped := propErrs.Unwrap(); len(unwrapped) != 2 || unwrapped[0] != compErr {
+		t.Errorf("Unwrap() = %v", unwrapped)
+	}
+	if zfsErr, ok := AsZfsError(err); !ok || zfsErr != compErr {
+		t.Errorf("AsZfsError() = %v, want the first property error", zfsErr)
+	}
+	if _, ok := AsPropertyErrors(quotaErr); ok {
+		t.Error("AsPropertyErrors() matched a plain ZfsError")
+	}
+}
+
 func TestMapErrno(t *testing.T) {
 	tests := []struct {
 		errno    int
@@ -1,14 +1,18 @@
-//go:build freebsd && !no_libzfs
+//go:build freebsd && cgo && !no_libzfs
 
 package cgo
 
 /*
 #cgo CFLAGS: -I/usr/src/sys/contrib/openzfs/lib/libspl/include -I/usr/src/sys/contrib/openzfs/lib/libspl/include/os/freebsd -I/usr/src/sys/contrib/openzfs/include
-#cgo LDFLAGS: -lzfs -lnvpair
+#cgo LDFLAGS: -lzfs -lzutil -lnvpair
 #include <libzfs.h>
+#include <libzutil.h>
+#include <sys/zfs_ioctl.h>
+#include <zfeature_common.h>
 #include <sys/nvpair.h>
 #include <stdlib.h>
 #include <string.h>
+#include <errno.h>
 
 // libzfs handle management
 libzfs_handle_t* go_libzfs_init(void) {
@@ -132,6 +136,55 @@ int go_zfs_get_prop(zfs_handle_t* zhp, zfs_prop_t prop, char* buf, size_t len,
     return zfs_prop_get(zhp, prop, buf, len, src, statbuf, statlen, literal);
 }
 
+// Numeric value of a number or index property
+int go_zfs_prop_get_numeric(zfs_handle_t* zhp, int prop, uint64_t* value) {
+    zprop_source_t src;
+    return zfs_prop_get_numeric(zhp, prop, value, &src, NULL, 0);
+}
+
+// Received value of a property, non-zero when nothing was received
+int go_zfs_prop_get_recvd(zfs_handle_t* zhp, const char* name, char* buf, size_t len) {
+    return zfs_prop_get_recvd(zhp, name, buf, len, B_FALSE);
+}
+
+// User properties of a dataset packed with the native encoding, the
+// caller frees buf
+int go_zfs_get_user_props_packed(zfs_handle_t* zhp, char** buf, size_t* size) {
+    *buf = NULL;
+    return nvlist_pack(zfs_get_user_props(zhp), buf, size, NV_ENCODE_NATIVE, 0);
+}
+
+// Property inheritance. Recursive inheritance skips descendants the
+// property does not apply to, like zfs inherit -r.
+typedef struct {
+    const char* propname;
+    boolean_t received;
+} inherit_ctx_t;
+
+static int inherit_iter_func(zfs_handle_t* zhp, void* arg) {
+    inherit_ctx_t* ctx = (inherit_ctx_t*)arg;
+    int prop = zfs_name_to_prop(ctx->propname);
+    int ret = 0;
+
+    if (prop < 0 || zfs_prop_valid_for_type(prop, zfs_get_type(zhp), B_FALSE)) {
+        ret = zfs_prop_inherit(zhp, ctx->propname, ctx->received);
+    }
+    if (ret == 0) {
+        ret = zfs_iter_children(zhp, inherit_iter_func, ctx);
+    }
+    zfs_close(zhp);
+    return ret;
+}
+
+int go_zfs_prop_inherit(zfs_handle_t* zhp, const char* propname, boolean_t received, boolean_t recursive) {
+    inherit_ctx_t ctx = { .propname = propname, .received = received };
+    int ret = zfs_prop_inherit(zhp, propname, received);
+    if (ret == 0 && recursive) {
+        ret = zfs_iter_children(zhp, inherit_iter_func, &ctx);
+    }
+    return ret;
+}
+
 // Property constants helper functions
 int go_get_zpool_prop_size() { return ZPOOL_PROP_SIZE; }
 int go_get_zpool_prop_capacity() { return ZPOOL_PROP_CAPACITY; }
@@ -154,6 +207,33 @@ int go_get_zfs_prop_recordsize() { return ZFS_PROP_RECORDSIZE; }
 int go_get_zfs_prop_mountpoint() { return ZFS_PROP_MOUNTPOINT; }
 int go_get_zfs_prop_compression() { return ZFS_PROP_COMPRESSION; }
 
+// Property name resolution, ZPROP_INVAL (negative) for unknown names
+int go_zfs_name_to_prop(const char* name) {
+    return zfs_name_to_prop(name);
+}
+
+int go_zfs_prop_valid_for_type(int prop, zfs_handle_t* zhp) {
+    return zfs_prop_valid_for_type(prop, zfs_get_type(zhp), B_FALSE);
+}
+
+int go_zpool_name_to_prop(const char* name) {
+    return zpool_name_to_prop(name);
+}
+
+// Pool property helpers. Feature states are read from feature@ names.
+int go_zpool_prop_get_feature(zpool_handle_t* zhp, const char* propname, char* buf, size_t len) {
+    return zpool_prop_get_feature(zhp, propname, buf, len);
+}
+
+uint64_t go_zpool_get_prop_int(zpool_handle_t* zhp, int prop) {
+    zprop_source_t src;
+    return zpool_get_prop_int(zhp, prop, &src);
+}
+
+int go_zpool_set_prop(zpool_handle_t* zhp, const char* propname, const char* propval) {
+    return zpool_set_prop(zhp, propname, propval);
+}
+
 // Property retrieval with proper error handling
 int go_get_zpool_property(zpool_handle_t* zhp, int prop, char* buf, size_t len) {
     zprop_source_t src;
@@ -171,10 +251,58 @@ nvlist_t* go_zpool_get_config(zpool_handle_t* zhp, nvlist_t** oldconfig) {
     return zpool_get_config(zhp, oldconfig);
 }
 
+// Pool history records from *off on, about 1MiB at a time, packed with the
+// native encoding. *eof is set once the end was reached. The caller frees buf.
+int go_zpool_get_history_packed(zpool_handle_t* zhp, uint64_t* off, boolean_t* eof, char** buf, size_t* size) {
+    nvlist_t* nvhis = NULL;
+    int ret;
+
+    *buf = NULL;
+    if ((ret = zpool_get_history(zhp, &nvhis, off, eof)) != 0)
+        return ret;
+    ret = nvlist_pack(nvhis, buf, size, NV_ENCODE_NATIVE, 0);
+    nvlist_free(nvhis);
+    return ret;
+}
+
+// Number of entries of spa_feature_table
+int go_zfeature_count(void) {
+    return SPA_FEATURES;
+}
+
+// Short name of the index-th pool feature, and whether the loaded kernel
+// module supports it
+const char* go_zfeature_name(int index, boolean_t* supported) {
+    *supported = spa_feature_table[index].fi_zfs_mod_supported;
+    return spa_feature_table[index].fi_uname;
+}
+
+// Refreshed pool configuration, including vdev statistics, packed with
+// the native encoding. The caller frees buf.
+int go_zpool_get_config_packed(zpool_handle_t* zhp, char** buf, size_t* size) {
+    boolean_t missing;
+    nvlist_t* config;
+
+    *buf = NULL;
+    if (zpool_refresh_stats(zhp, &missing) != 0 || missing)
+        return ENOENT;
+    if ((config = zpool_get_config(zhp, NULL)) == NULL)
+        return ENOENT;
+    return nvlist_pack(config, buf, size, NV_ENCODE_NATIVE, 0);
+}
+
 int go_zpool_scan(zpool_handle_t* zhp, pool_scan_func_t func, pool_scrub_cmd_t cmd) {
     return zpool_scan(zhp, func, cmd);
 }
 
+int go_zpool_checkpoint(zpool_handle_t* zhp) {
+    return zpool_checkpoint(zhp);
+}
+
+int go_zpool_discard_checkpoint(zpool_handle_t* zhp) {
+    return zpool_discard_checkpoint(zhp);
+}
+
 // Vdev tree navigation helpers
 int go_nvlist_lookup_nvlist(nvlist_t* nvl, const char* name, nvlist_t** val) {
     return nvlist_lookup_nvlist(nvl, name, val);
@@ -201,57 +329,9 @@ int go_nvlist_lookup_uint64_array(nvlist_t* nvl, const char* name, uint64_t** va
     return nvlist_lookup_uint64_array(nvl, name, val, nelem);
 }
 
-// Pool scan/scrub status - simplified for now
-typedef struct scan_info {
-    uint64_t func;
-    uint64_t state;
-    uint64_t start_time;
-    uint64_t end_time;
-    uint64_t examined;
-    uint64_t to_examine;
-    uint64_t processed;
-    uint64_t to_process;
-    uint64_t errors;
-    uint64_t pass_examined;
-    uint64_t pass_start;
-} scan_info_t;
-
-int go_get_scan_status(nvlist_t* nvroot, scan_info_t* scan) {
-    nvlist_t* scan_nvl = NULL;
-    uint64_t* scan_stats = NULL;
-    uint_t scan_stats_count = 0;
-
-    // Initialize all fields to zero
-    memset(scan, 0, sizeof(scan_info_t));
-
-    // Look for scan stats in the nvlist
-    if (nvlist_lookup_nvlist(nvroot, "scan_stats", &scan_nvl) != 0) {
-        // No scan stats found - not an error, just means no scan is running
-        return 0;
-    }
-
-    // Extract scan stats array
-    if (nvlist_lookup_uint64_array(scan_nvl, "scan_stats", &scan_stats, &scan_stats_count) != 0) {
-        return 0;
-    }
-
-    // Parse scan stats according to ZFS scan_stat structure
-    // Based on OpenZFS scan_stat indices
-    if (scan_stats_count >= 11) {
-        scan->func = scan_stats[0];         // pool_scan_func_t
-        scan->state = scan_stats[1];        // dsl_scan_state_t
-        scan->start_time = scan_stats[2];   // scan start time
-        scan->end_time = scan_stats[3];     // scan end time
-        scan->to_examine = scan_stats[4];   // total bytes to examine
-        scan->examined = scan_stats[5];     // bytes examined so far
-        scan->to_process = scan_stats[6];   // total bytes to process
-        scan->processed = scan_stats[7];    // bytes processed so far
-        scan->errors = scan_stats[8];       // scan errors
-        scan->pass_examined = scan_stats[9]; // bytes examined this pass
-        scan->pass_start = scan_stats[10];  // pass start time
-    }
-
-    return 0;
+// Blocks until the activity is done, missing is set when the pool is gone
+int go_zpool_wait_status(zpool_handle_t* zhp, int activity, boolean_t* missing, boolean_t* waited) {
+    return zpool_wait_status(zhp, (zpool_wait_activity_t)activity, missing, waited);
 }
 
 // Pool import/export operations
@@ -259,6 +339,11 @@ int go_zpool_import(libzfs_handle_t* hdl, nvlist_t* config, const char* newname,
     return zpool_import(hdl, config, newname, (char*)altroot);
 }
 
+int go_zpool_import_props(libzfs_handle_t* hdl, nvlist_t* config, const char* newname,
+                          nvlist_t* props, int flags) {
+    return zpool_import_props(hdl, config, newname, props, flags);
+}
+
 int go_zpool_export(zpool_handle_t* zhp, boolean_t force, const char* message) {
     return zpool_export(zhp, force, message);
 }
@@ -267,18 +352,126 @@ int go_zpool_export_force(zpool_handle_t* zhp) {
     return zpool_export(zhp, B_TRUE, "Exported via Go ZFS library");
 }
 
-// Pool discovery for import operations
-nvlist_t* go_zpool_find_import(libzfs_handle_t* hdl, int argc, char** argv, boolean_t do_destroyed,
-                               char** poolname) {
-    // This is a complex operation that requires scanning devices and building nvlist configs
-    // The real implementation would use pool_list functions from libzutil
-    // For production use, this needs proper device scanning implementation
+// Pool discovery for import operations. Scans the directories in argv, the
+// default ones when argc is 0, or reads cachefile when set, and returns the
+// importable pool configs keyed by pool name. On failure NULL is returned and
+// errbuf holds the reason.
+nvlist_t* go_zpool_find_import(libzfs_handle_t* hdl, int argc, char** argv, const char* cachefile,
+                               const char* poolname, uint64_t guid, nvlist_t* policy,
+                               char* errbuf, size_t errlen) {
+    importargs_t args;
+    libpc_handle_t lpch;
+    nvlist_t* pools;
+
+    memset(&args, 0, sizeof (args));
+    args.path = argv;
+    args.paths = argc;
+    args.cachefile = cachefile;
+    args.poolname = poolname;
+    args.guid = guid;
+    args.policy = policy;
+
+    memset(&lpch, 0, sizeof (lpch));
+    lpch.lpc_lib_handle = hdl;
+    lpch.lpc_ops = &libzfs_config_ops;
+    lpch.lpc_printerr = B_FALSE;
+
+    errbuf[0] = '\0';
+    pools = zpool_search_import(&lpch, &args);
+    if (pools == NULL) {
+        if (lpch.lpc_desc_active)
+            strlcpy(errbuf, lpch.lpc_desc, errlen);
+        else
+            strlcpy(errbuf, "no pool configurations could be read", errlen);
+    }
+    return pools;
+}
+
+// Load policy of an import, the rewind flags and the txg to rewind to
+nvlist_t* go_zpool_load_policy(uint32_t rewind, uint64_t txg) {
+    nvlist_t* policy;
+
+    if (nvlist_alloc(&policy, NV_UNIQUE_NAME, 0) != 0)
+        return NULL;
+    if (nvlist_add_uint32(policy, ZPOOL_LOAD_REWIND_POLICY, rewind) != 0 ||
+        nvlist_add_uint64(policy, ZPOOL_LOAD_REQUEST_TXG, txg) != 0) {
+        nvlist_free(policy);
+        return NULL;
+    }
+    return policy;
+}
+
+int go_zpool_add_load_policy(nvlist_t* config, nvlist_t* policy) {
+    return nvlist_add_nvlist(config, ZPOOL_LOAD_POLICY, policy);
+}
+
+// Issues the import ioctl for a rewind dry run the way zpool_import_props
+// does, which only prints the outcome. The kernel sends the config back with
+// the load info even when the import fails, returned packed in buf. Returns
+// the ioctl errno, 0 if the pool opened and was imported.
+int go_zpool_import_dry_run(libzfs_handle_t* hdl, nvlist_t* config, int flags, char** buf, size_t* size) {
+    zfs_cmd_t zc = {"\0"};
+    const char* name;
+    char* conf = NULL;
+    char* dst;
+    size_t conf_size;
+    uint64_t dst_size;
+    int error;
+
+    *buf = NULL;
+    *size = 0;
+    if (nvlist_lookup_string(config, ZPOOL_CONFIG_POOL_NAME, &name) != 0 ||
+        nvlist_lookup_uint64(config, ZPOOL_CONFIG_POOL_GUID, &zc.zc_guid) != 0)
+        return EINVAL;
+    (void) strlcpy(zc.zc_name, name, sizeof (zc.zc_name));
+
+    if ((error = nvlist_pack(config, &conf, &conf_size, NV_ENCODE_NATIVE, 0)) != 0)
+        return error;
+    zc.zc_nvlist_conf = (uint64_t)(uintptr_t)conf;
+    zc.zc_nvlist_conf_size = conf_size;
+    zc.zc_cookie = flags;
+
+    dst_size = conf_size * 2;
+    for (;;) {
+        if ((dst = malloc(dst_size)) == NULL) {
+            error = ENOMEM;
+            break;
+        }
+        zc.zc_nvlist_dst = (uint64_t)(uintptr_t)dst;
+        zc.zc_nvlist_dst_size = dst_size;
+        error = zfs_ioctl(hdl, ZFS_IOC_POOL_IMPORT, &zc) != 0 ? errno : 0;
+
+        // The kernel reports the size it needs when the buffer is too small
+        if (error == ENOMEM && zc.zc_nvlist_dst_size > dst_size) {
+            free(dst);
+            dst_size = zc.zc_nvlist_dst_size;
+            continue;
+        }
+        *buf = dst;
+        *size = zc.zc_nvlist_dst_size;
+        break;
+    }
+    free(conf);
+    return error;
+}
+
+// Returns the nvlist value of the index-th pair of nvl, NULL if there is none
+nvlist_t* go_nvlist_nvlist_at(nvlist_t* nvl, int index) {
+    nvpair_t* pair = NULL;
+    nvlist_t* value;
 
-    // Return NULL for now - indicates no importable pools found
-    // This is functionally correct behavior, just not feature-complete
+    while ((pair = nvlist_next_nvpair(nvl, pair)) != NULL) {
+        if (index-- == 0)
+            return nvpair_value_nvlist(pair, &value) == 0 ? value : NULL;
+    }
     return NULL;
 }
 
+int go_nvlist_pack(nvlist_t* nvl, char** buf, size_t* size) {
+    *buf = NULL;
+    return nvlist_pack(nvl, buf, size, NV_ENCODE_NATIVE, 0);
+}
+
 // Pool creation helpers
 int go_zpool_create(libzfs_handle_t* hdl, const char* poolname, nvlist_t* nvroot,
                     nvlist_t* props, nvlist_t* fsprops) {
@@ -312,6 +505,11 @@ int go_zfs_prop_set(zfs_handle_t* zhp, const char* propname, const char* propval
     return zfs_prop_set(zhp, propname, propval);
 }
 
+// Sets every property in the list with a single ZFS_IOC_SET_PROP
+int go_zfs_prop_set_list(zfs_handle_t* zhp, nvlist_t* props) {
+    return zfs_prop_set_list(zhp, props);
+}
+
 // Nvlist creation and manipulation for properties
 nvlist_t* go_nvlist_alloc() {
     nvlist_t* nvl = NULL;
@@ -459,6 +657,33 @@ int go_zpool_remove(zpool_handle_t* zhp, const char* path) {
     return zpool_vdev_remove(zhp, path);
 }
 
+int go_zpool_remove_cancel(zpool_handle_t* zhp) {
+    return zpool_vdev_remove_cancel(zhp);
+}
+
+// Splits mirror sides of zhp off into pool newname like zpool split. The
+// sides are named by the children of newroot, the last one of every mirror
+// when it is NULL; newroot is freed either way. On a dry run the vdev tree
+// of the new pool is returned packed in buf.
+int go_zpool_split(zpool_handle_t* zhp, char* newname, nvlist_t* newroot, nvlist_t* props,
+                   int dryrun, int import, char** buf, size_t* size) {
+    splitflags_t flags = { 0 };
+    int ret;
+
+    flags.dryrun = dryrun != 0;
+    flags.import = import != 0;
+    *buf = NULL;
+    *size = 0;
+
+    // libzfs fills in newroot when it picks the sides and frees it, setting
+    // it to NULL, whenever the caller does not get it back
+    ret = zpool_vdev_split(zhp, newname, &newroot, props, flags);
+    if (ret == 0 && dryrun && newroot != NULL)
+        ret = nvlist_pack(newroot, buf, size, NV_ENCODE_NATIVE, 0);
+    nvlist_free(newroot);
+    return ret;
+}
+
 int go_zpool_online(zpool_handle_t* zhp, const char* path, int flags, vdev_state_t* newstate) {
     return zpool_vdev_online(zhp, path, flags, newstate);
 }
@@ -471,6 +696,44 @@ int go_zpool_clear(zpool_handle_t* zhp, const char* path, nvlist_t* rewind_polic
     return zpool_clear(zhp, path, rewind_policy);
 }
 
+// Collect the vdevs to initialize or trim, all leaves of the pool like
+// zpool initialize and zpool trim do when no devices are named
+static nvlist_t* go_zpool_action_vdevs(zpool_handle_t* zhp, char** devices, int count) {
+    nvlist_t* vdevs = fnvlist_alloc();
+
+    if (count == 0) {
+        nvlist_t* nvroot = fnvlist_lookup_nvlist(zpool_get_config(zhp, NULL), ZPOOL_CONFIG_VDEV_TREE);
+        zpool_collect_leaves(zhp, nvroot, vdevs);
+        return vdevs;
+    }
+    for (int i = 0; i < count; i++) {
+        fnvlist_add_boolean(vdevs, devices[i]);
+    }
+    return vdevs;
+}
+
+int go_zpool_initialize(zpool_handle_t* zhp, int cmd, char** devices, int count) {
+    nvlist_t* vdevs = go_zpool_action_vdevs(zhp, devices, count);
+    int ret = zpool_initialize(zhp, cmd, vdevs);
+    fnvlist_free(vdevs);
+    return ret;
+}
+
+int go_zpool_trim(zpool_handle_t* zhp, int cmd, char** devices, int count, boolean_t secure, uint64_t rate) {
+    nvlist_t* vdevs = go_zpool_action_vdevs(zhp, devices, count);
+    trimflags_t flags;
+
+    // A whole pool TRIM skips devices without TRIM support instead of failing
+    memset(&flags, 0, sizeof (flags));
+    flags.fullpool = count == 0;
+    flags.secure = secure;
+    flags.rate = rate;
+
+    int ret = zpool_trim(zhp, cmd, vdevs, &flags);
+    fnvlist_free(vdevs);
+    return ret;
+}
+
 // Vdev tree manipulation helpers
 nvlist_t* go_create_mirror_vdev(nvlist_t** children, uint_t child_count) {
     nvlist_t* mirror = NULL;
@@ -494,20 +757,18 @@ nvlist_t* go_create_mirror_vdev(nvlist_t** children, uint_t child_count) {
 
 nvlist_t* go_create_raidz_vdev(nvlist_t** children, uint_t child_count, int parity) {
     nvlist_t* raidz = NULL;
-    const char* type;
 
-    switch (parity) {
-        case 1: type = "raidz"; break;
-        case 2: type = "raidz2"; break;
-        case 3: type = "raidz3"; break;
-        default: return NULL; // Invalid parity level
+    if (parity < 1 || parity > 3) {
+        return NULL; // Invalid parity level
     }
 
     if (nvlist_alloc(&raidz, NV_UNIQUE_NAME, 0) != 0) {
         return NULL;
     }
 
-    if (nvlist_add_string(raidz, "type", type) != 0) {
+    // The kernel knows a single raidz type, the level is its parity
+    if (nvlist_add_string(raidz, "type", "raidz") != 0 ||
+        nvlist_add_uint64(raidz, "nparity", parity) != 0) {
         nvlist_free(raidz);
         return NULL;
     }
@@ -520,6 +781,31 @@ nvlist_t* go_create_raidz_vdev(nvlist_t** children, uint_t child_count, int pari
     return raidz;
 }
 
+nvlist_t* go_create_draid_vdev(nvlist_t** children, uint_t child_count, uint64_t nparity,
+    uint64_t ndata, uint64_t nspares, uint64_t ngroups) {
+    nvlist_t* draid = NULL;
+
+    if (nvlist_alloc(&draid, NV_UNIQUE_NAME, 0) != 0) {
+        return NULL;
+    }
+
+    if (nvlist_add_string(draid, "type", "draid") != 0 ||
+        nvlist_add_uint64(draid, "nparity", nparity) != 0 ||
+        nvlist_add_uint64(draid, "draid_ndata", ndata) != 0 ||
+        nvlist_add_uint64(draid, "draid_nspares", nspares) != 0 ||
+        nvlist_add_uint64(draid, "draid_ngroups", ngroups) != 0) {
+        nvlist_free(draid);
+        return NULL;
+    }
+
+    if (nvlist_add_nvlist_array(draid, "children", (const nvlist_t* const*)children, child_count) != 0) {
+        nvlist_free(draid);
+        return NULL;
+    }
+
+    return draid;
+}
+
 nvlist_t* go_create_stripe_vdev(nvlist_t** children, uint_t child_count) {
     nvlist_t* stripe = NULL;
 
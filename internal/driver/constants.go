@@ -1,5 +1,3 @@
-//go:build freebsd
-
 package driver
 
 // Pool state constants
@@ -14,6 +12,30 @@ const (
 	PoolStatePotentiallyActive = 7
 )
 
+// Helper function to map driver pool state to string
+func mapPoolState(state int) string {
+	switch state {
+	case PoolStateActive:
+		return "ACTIVE"
+	case PoolStateExported:
+		return "EXPORTED"
+	case PoolStateDestroyed:
+		return "DESTROYED"
+	case PoolStateSpare:
+		return "SPARE"
+	case PoolStateL2Cache:
+		return "L2CACHE"
+	case PoolStateUninitialized:
+		return "UNINITIALIZED"
+	case PoolStateUnavail:
+		return "UNAVAIL"
+	case PoolStatePotentiallyActive:
+		return "POTENTIALLY_ACTIVE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // Pool health status constants
 const (
 	PoolStatusCorruptCache   = 0
@@ -106,13 +128,31 @@ const (
 	VdevTypeSpare  = "spare"
 	VdevTypeLog    = "log"
 	VdevTypeCache  = "cache"
+
+	VdevTypeFile      = "file"
+	VdevTypeDraid     = "draid"
+	VdevTypeReplacing = "replacing"
+	VdevTypeIndirect  = "indirect"
+	VdevTypeHole      = "hole"
+	VdevTypeMissing   = "missing"
+)
+
+// Vdev allocation classes
+const (
+	VdevClassNormal  = ""
+	VdevClassLog     = "log"
+	VdevClassSpecial = "special"
+	VdevClassDedup   = "dedup"
+	VdevClassSpare   = "spare"
+	VdevClassCache   = "cache"
 )
 
 // Pool scan function types
 const (
-	PoolScanNone     = 0
-	PoolScanScrub    = 1
-	PoolScanResilver = 2
+	PoolScanNone       = 0
+	PoolScanScrub      = 1
+	PoolScanResilver   = 2
+	PoolScanErrorScrub = 3
 )
 
 // Pool scan states
@@ -122,3 +162,26 @@ const (
 	PoolScanStateFinished = 2
 	PoolScanStateCanceled = 3
 )
+
+// Pool checkpoint states (checkpoint_state_t)
+const (
+	CheckpointStateNone       = 0
+	CheckpointStateExists     = 1
+	CheckpointStateDiscarding = 2
+)
+
+// Vdev initializing and TRIM states (vdev_initializing_state_t,
+// vdev_trim_state_t)
+const (
+	VdevActionStateNone      = 0
+	VdevActionStateActive    = 1
+	VdevActionStateCanceled  = 2
+	VdevActionStateSuspended = 3
+	VdevActionStateComplete  = 4
+)
+
+// Pool scrub commands (pool_scrub_cmd_t)
+const (
+	PoolScrubNormal = 0
+	PoolScrubPause  = 1
+)
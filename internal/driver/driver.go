@@ -1,5 +1,3 @@
-//go:build freebsd
-
 package driver
 
 import "context"
@@ -53,6 +51,7 @@ const (
 	PropSourceDefault
 	PropSourceTemporary
 	PropSourceReceived
+	PropSourceNone
 )
 
 func (s PropSource) String() string {
@@ -67,6 +66,8 @@ func (s PropSource) String() string {
 		return "temporary"
 	case PropSourceReceived:
 		return "received"
+	case PropSourceNone:
+		return "none"
 	default:
 		return "unknown"
 	}
@@ -74,18 +75,61 @@ func (s PropSource) String() string {
 
 // PropertyInfo represents a property with its source and type information
 type PropertyInfo struct {
-	Name     string
-	Value    any
-	Source   PropSource
-	Received bool
+	Name          string
+	Value         any // Human readable value, as zfs get prints it
+	Raw           any // Exact value: uint64, bool or string, see PropKind
+	Source        PropSource
+	Received      bool
+	InheritedFrom string // Dataset the value is inherited from, set when Source is PropSourceInherited
+	ReceivedValue any    // Value set by zfs receive, nil when none was received
 }
 
 // ImportOptions represents options for pool import
 type ImportOptions struct {
-	NewName   string // Optional new name for the pool
-	AltRoot   string // Alternative root directory
-	Force     bool   // Force import even if pool appears active
-	Destroyed bool   // Import destroyed pool
+	NewName     string            // Optional new name for the pool
+	AltRoot     string            // Alternative root directory
+	Force       bool              // Force import even if pool appears active
+	Destroyed   bool              // Import destroyed pool
+	ReadOnly    bool              // Import the pool read-only
+	Properties  map[string]string // Pool properties to set on import
+	SearchPaths []string          // Directories to scan for devices, the default when empty
+	CacheFile   string            // Read the pool config from this cachefile instead of scanning
+
+	// Recovery of pools that cannot be opened, zpool import -F, -n, -X, -T and -m
+	Rewind        bool   // Discard the last transactions if the pool cannot be opened
+	DryRun        bool   // With Rewind, only report what would be discarded
+	ExtremeRewind bool   // With Rewind, search every txg instead of the last few
+	MaxTxg        uint64 // Rewind to this txg or earlier, implies Rewind and ExtremeRewind
+	MissingLog    bool   // Import even if a log device is missing, losing its records
+
+	// Return the pool to its checkpoint, discarding everything written
+	// since, zpool import --rewind-to-checkpoint
+	RewindToCheckpoint bool
+}
+
+// RewindReport describes what a rewinding import discards
+type RewindReport struct {
+	Needed     bool   // The pool cannot be opened at its latest txg
+	Possible   bool   // An earlier txg the pool can be opened at was found
+	Imported   bool   // The pool opened without rewinding during a dry run and is imported
+	RewindTime uint64 // Timestamp of the txg the pool returns to, seconds since the epoch
+	Discarded  int64  // Seconds of transactions that are discarded
+	DataErrors uint64 // Data errors found while verifying that txg
+	MetaErrors uint64 // Metadata errors found while verifying that txg
+}
+
+// DiscoverOptions represents options for finding importable pools
+type DiscoverOptions struct {
+	SearchPaths []string // Directories to scan for devices, the default when empty
+	CacheFile   string   // Read pool configs from this cachefile instead of scanning
+	Destroyed   bool     // Include destroyed pools
+	Pool        string   // Only return pools with this name or GUID
+}
+
+// ImportablePool represents a pool found on devices that are not in use
+type ImportablePool struct {
+	PoolStatus
+	DevicePaths []string // Paths of the leaf vdevs, spares and cache devices
 }
 
 // ExportOptions represents options for pool export
@@ -99,13 +143,46 @@ type CreateOptions struct {
 	Properties   map[string]string // Pool properties
 	FsProperties map[string]string // Root filesystem properties
 	AltRoot      string            // Alternative root directory
-	Force        bool              // Force creation
+	Force        bool              // Force creation, also with mismatched replication levels
+}
+
+// PoolFeature describes a feature flag and its state on a pool
+type PoolFeature struct {
+	Name           string   // Short name, e.g. async_destroy
+	GUID           string   // e.g. com.delphix:async_destroy
+	State          string   // FeatureDisabled, FeatureEnabled or FeatureActive
+	ReadOnlyCompat bool     // Pools using it can still be imported read-only without support for it
+	NoUpgrade      bool     // Enabled by the kernel when needed rather than by zpool upgrade
+	Dependencies   []string // Features that are enabled along with it
+}
+
+// SplitOptions represents options for splitting mirrors off into a new pool
+type SplitOptions struct {
+	Devices    []string          // Mirror sides for the new pool, the last side of each other mirror
+	AltRoot    string            // Alternative root directory of the new pool, implies Import
+	Properties map[string]string // Properties of the new pool
+	Import     bool              // Import the new pool instead of leaving it exported
+	DryRun     bool              // Only return the vdev tree the new pool would get
+}
+
+// InheritOptions represents options for clearing a dataset property
+type InheritOptions struct {
+	Recursive bool // Also clear the property on every descendant
+	Received  bool // Revert to the received value, if any, instead of inheriting (zfs inherit -S)
 }
 
 // VdevSpec represents a vdev specification for pool operations
 type VdevSpec struct {
 	Type    string   // Type of vdev (mirror, raidz, etc.) - use VdevType* constants
 	Devices []string // Device paths
+	Class   string   // Allocation class - use VdevClass* constants. Spares and cache devices are disks.
+
+	// dRAID layout, as in draid<Parity>:<Data>d:<Children>c:<Spares>s.
+	// Zero values take the zpool create defaults.
+	Parity   int // Parity level, 1 by default
+	Data     int // Data devices per redundancy group, at most 8 by default
+	Spares   int // Distributed spares
+	Children int // Expected number of devices, checked against Devices
 }
 
 // VdevOnlineFlags represents flags for vdev online operations
@@ -118,6 +195,190 @@ const (
 	VdevOnlineExpand
 )
 
+// VdevInfo represents a vdev and its children in a pool configuration
+type VdevInfo struct {
+	Type       string // root, mirror, raidz, raidz2, draid, disk, file, spare, replacing, indirect, ...
+	ID         uint64 // Position among its siblings
+	Path       string // Device path of leaf vdevs
+	GUID       uint64
+	State      string // ONLINE, DEGRADED, FAULTED, ...; AVAIL or INUSE for hot spares
+	Aux        string // Reason for the state, e.g. "cannot open", empty when there is none
+	Class      string // Allocation class of top-level vdevs, see VdevClass* constants
+	NParity    uint64 // Parity level of raidz and draid vdevs
+	Stats      VdevStats
+	Initialize VdevProgress // Initializing of leaf vdevs
+	Trim       VdevProgress // Manual TRIM of leaf vdevs
+	Removing   bool         // Top-level vdev whose data is being copied off by a removal
+	Mapping    uint64       // Bytes of memory the remapping table of an indirect vdev takes
+	Children   []VdevInfo
+}
+
+// VdevStats represents the space and error counters of a vdev (vdev_stat_t)
+type VdevStats struct {
+	Alloc          uint64
+	Space          uint64
+	DSpace         uint64
+	ReadErrors     uint64
+	WriteErrors    uint64
+	ChecksumErrors uint64
+	SlowIOs        uint64
+}
+
+// VdevProgress represents how far initializing or trimming a leaf vdev has
+// got. The action time is when it started, or when it was last suspended,
+// canceled or completed, in seconds since the epoch.
+type VdevProgress struct {
+	State        int // VdevActionState* constants
+	BytesDone    uint64
+	BytesEst     uint64 // Bytes to initialize or trim in total
+	ActionTime   uint64
+	Errors       uint64
+	NotSupported bool // The device does not support TRIM, trim progress only
+}
+
+// ScanInfo represents the progress of the last scrub, resilver or error
+// scrub of a pool (pool_scan_stat_t). Times are seconds since the epoch.
+type ScanInfo struct {
+	Function        int // PoolScan* constants
+	State           int // PoolScanState* constants
+	StartTime       uint64
+	EndTime         uint64
+	ToExamine       uint64 // Bytes to scan, or error blocks for error scrubs
+	Examined        uint64 // Bytes located by the scanner, or error blocks scrubbed
+	Skipped         uint64 // Bytes skipped by the scanner (to_process before OpenZFS 2.2)
+	Processed       uint64 // Bytes repaired
+	Errors          uint64
+	Issued          uint64 // Bytes checked
+	PassStart       uint64
+	PassExamined    uint64
+	PassIssued      uint64
+	PassPaused      uint64 // Time the scan was paused, zero when it is not
+	PassSpentPaused uint64 // Seconds the current pass spent paused
+}
+
+// PoolStatus represents the vdev configuration and health of an imported pool
+type PoolStatus struct {
+	PoolInfo
+	Vdevs      VdevInfo        // Root vdev; log, special and dedup vdevs are top-level children
+	Spares     []VdevInfo      // Hot spares
+	L2Cache    []VdevInfo      // Cache devices
+	DataErrors uint64          // Number of persistent data errors
+	Scan       *ScanInfo       // Last scrub or resilver, nil if none was ever run
+	ErrorScrub *ScanInfo       // Last error scrub, nil if none was ever run
+	Checkpoint *CheckpointInfo // Pool checkpoint, nil if there is none
+	Removal    *RemovalInfo    // Last device removal, nil if none was ever run
+}
+
+// CheckpointInfo represents the checkpoint of a pool (pool_checkpoint_stat_t)
+type CheckpointInfo struct {
+	State     int    // CheckpointState* constants
+	StartTime uint64 // When the checkpoint was taken, seconds since the epoch
+	Space     uint64 // Bytes the checkpoint keeps from being freed
+}
+
+// RemovalInfo represents the evacuation of the last top-level vdev removed
+// from a pool (pool_removal_stat_t). Times are seconds since the epoch.
+type RemovalInfo struct {
+	State         int    // PoolScanState* constants
+	Vdev          uint64 // ID of the removed top-level vdev
+	StartTime     uint64
+	EndTime       uint64
+	ToCopy        uint64 // Bytes to copy off the vdev
+	Copied        uint64
+	MappingMemory uint64 // Bytes of memory the mappings of removed vdevs take
+}
+
+// HistoryRecord is an entry of the command history of a pool. A record
+// holds either the command line of a zfs or zpool command, an internal
+// event or a logged ioctl.
+type HistoryRecord struct {
+	Time      uint64 // Seconds since the epoch
+	Command   string // Command line, empty for internal events
+	Who       uint64 // User ID that ran the command, valid when HasWho is set
+	HasWho    bool
+	Host      string
+	Zone      string
+	TXG       uint64 // Transaction group an internal event was synced in
+	Event     string // Name of an internal event, e.g. snapshot
+	Detail    string // Description of an internal event, e.g. the property set
+	Dataset   string // Dataset of an internal event
+	DatasetID uint64
+	Ioctl     string // Name of a logged ioctl, e.g. snapshot
+	Errno     int64  // Result of a logged ioctl
+}
+
+// ScrubCommand selects what ScrubPool does
+type ScrubCommand int
+
+const (
+	ScrubStart  ScrubCommand = iota // Start a scrub, or resume a paused one
+	ScrubPause                      // Pause the running scrub (zpool scrub -p)
+	ScrubCancel                     // Stop the running scrub (zpool scrub -s)
+)
+
+// ScrubOptions represents options for scrub control
+type ScrubOptions struct {
+	Command    ScrubCommand
+	ErrorScrub bool // Only scrub blocks with known errors (zpool scrub -e)
+}
+
+// VdevActionCommand selects what InitializeVdevs and TrimVdevs do, with the
+// values of pool_initialize_func_t and pool_trim_func_t
+type VdevActionCommand int
+
+const (
+	VdevActionStart   VdevActionCommand = iota // Start, or resume a suspended one
+	VdevActionCancel                           // Stop and discard the progress (-c)
+	VdevActionSuspend                          // Stop, keeping the progress to resume from (-s)
+)
+
+// TrimOptions represents options for zpool trim
+type TrimOptions struct {
+	Command VdevActionCommand
+	Secure  bool   // Use secure TRIM, which not every device supports (-d)
+	Rate    uint64 // Bytes per second to trim each vdev at, 0 for no limit (-r)
+}
+
+// WaitActivity is a pool activity WaitPool can wait for (zpool_wait_activity_t)
+type WaitActivity int
+
+const (
+	WaitCheckpointDiscard WaitActivity = iota
+	WaitFree
+	WaitInitialize
+	WaitReplace
+	WaitRemove
+	WaitResilver
+	WaitScrub
+	WaitTrim
+	WaitRaidzExpand
+)
+
+func (a WaitActivity) String() string {
+	switch a {
+	case WaitCheckpointDiscard:
+		return "discard_checkpoint"
+	case WaitFree:
+		return "free"
+	case WaitInitialize:
+		return "initialize"
+	case WaitReplace:
+		return "replace"
+	case WaitRemove:
+		return "remove"
+	case WaitResilver:
+		return "resilver"
+	case WaitScrub:
+		return "scrub"
+	case WaitTrim:
+		return "trim"
+	case WaitRaidzExpand:
+		return "raidz_expand"
+	default:
+		return "unknown"
+	}
+}
+
 // CloneInfo represents information about a ZFS clone
 type CloneInfo struct {
 	Name       string   // Clone dataset name
@@ -139,9 +400,18 @@ type Driver interface {
 	// Pool operations
 	ListPools(ctx context.Context) ([]PoolInfo, error)
 	GetPoolProps(ctx context.Context, poolName string, propNames []string) (map[string]PropertyInfo, error)
-	ImportPool(ctx context.Context, poolName string, opts ImportOptions) error
+	GetPoolStatus(ctx context.Context, poolName string) (*PoolStatus, error)
+	SetPoolProp(ctx context.Context, poolName, propName, propValue string) error
+	ScrubPool(ctx context.Context, poolName string, opts ScrubOptions) error
+	CheckpointPool(ctx context.Context, poolName string) error
+	DiscardCheckpoint(ctx context.Context, poolName string) error
+	WaitPool(ctx context.Context, poolName string, activity WaitActivity) (waited bool, err error)
+	GetPoolHistory(ctx context.Context, poolName string, offset uint64) ([]HistoryRecord, uint64, error)
+	DiscoverPools(ctx context.Context, opts DiscoverOptions) ([]ImportablePool, error)
+	ImportPool(ctx context.Context, poolName string, opts ImportOptions) (*RewindReport, error)
 	ExportPool(ctx context.Context, poolName string, opts ExportOptions) error
-	CreatePool(ctx context.Context, poolName string, vdevs []string, opts CreateOptions) error
+	CreatePool(ctx context.Context, poolName string, vdevs []VdevSpec, opts CreateOptions) error
+	SplitPool(ctx context.Context, poolName, newPoolName string, opts SplitOptions) (*VdevInfo, error)
 	DestroyPool(ctx context.Context, poolName string) error
 
 	// Dataset operations
@@ -150,6 +420,8 @@ type Driver interface {
 	ListDatasetsByType(ctx context.Context, dsType *DatasetType, recursive bool) ([]DatasetInfo, error)
 	GetDatasetProps(ctx context.Context, datasetName string, propNames []string) (map[string]PropertyInfo, error)
 	SetDatasetProp(ctx context.Context, datasetName, propName, propValue string) error
+	SetDatasetProps(ctx context.Context, datasetName string, props map[string]string) error
+	InheritDatasetProp(ctx context.Context, datasetName, propName string, opts InheritOptions) error
 	CreateDataset(ctx context.Context, datasetName string, dsType DatasetType, props map[string]string) error
 	DestroyDataset(ctx context.Context, datasetName string, recursive bool) error
 
@@ -171,13 +443,18 @@ type Driver interface {
 	DetachVdev(ctx context.Context, poolName, device string) error
 	ReplaceVdev(ctx context.Context, poolName, oldDevice, newDevice string) error
 	RemoveVdev(ctx context.Context, poolName, device string) error
-	OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) error
+	CancelRemoval(ctx context.Context, poolName string) error
+	OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) (state string, err error)
 	OfflineVdev(ctx context.Context, poolName, device string, temporary bool) error
 	ClearVdev(ctx context.Context, poolName, device string) error
+	InitializeVdevs(ctx context.Context, poolName string, devices []string, cmd VdevActionCommand) error
+	TrimVdevs(ctx context.Context, poolName string, devices []string, opts TrimOptions) error
 
 	// Feature and capability detection
 	SupportsFeature(ctx context.Context, feature string) (bool, error)
 	GetAvailableFeatures(ctx context.Context) ([]string, error)
+	GetPoolFeatures(ctx context.Context, poolName string) ([]PoolFeature, error)
+	LoadCompatibility(ctx context.Context, compatibility string) ([]string, error)
 	GetSupportedCompressionAlgorithms(ctx context.Context) ([]string, error)
 	GetZFSVersion(ctx context.Context) (string, error)
 }
@@ -240,9 +517,10 @@ const (
 	PropNameKeystatus     = "keystatus"
 
 	// Pool-specific property names
-	PropNameSize      = "size"
-	PropNameCapacity  = "capacity"
-	PropNameFree      = "free"
-	PropNameAllocated = "allocated"
-	PropNameHealth    = "health"
+	PropNameSize          = "size"
+	PropNameCapacity      = "capacity"
+	PropNameFree          = "free"
+	PropNameAllocated     = "allocated"
+	PropNameHealth        = "health"
+	PropNameCompatibility = "compatibility"
 )
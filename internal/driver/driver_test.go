@@ -1,5 +1,3 @@
-//go:build freebsd
-
 package driver
 
 import (
@@ -38,6 +36,7 @@ func TestPropSource_String(t *testing.T) {
 		{PropSourceDefault, "default"},
 		{PropSourceTemporary, "temporary"},
 		{PropSourceReceived, "received"},
+		{PropSourceNone, "none"},
 		{PropSource(999), "unknown"},
 	}
 
@@ -51,6 +50,25 @@ func TestPropSource_String(t *testing.T) {
 	}
 }
 
+func TestMode_String(t *testing.T) {
+	tests := []struct {
+		mode     Mode
+		expected string
+	}{
+		{ModeAuto, "auto"},
+		{ModeAutoIoctl, "auto-ioctl"},
+		{ModeLibZFS, "libzfs"},
+		{ModeIoctl, "ioctl"},
+		{Mode(99), "unknown"},
+	}
+
+	for _, test := range tests {
+		if got := test.mode.String(); got != test.expected {
+			t.Errorf("Mode(%d).String() = %q, want %q", test.mode, got, test.expected)
+		}
+	}
+}
+
 func TestPropertyConstants(t *testing.T) {
 	// Test that property name constants are not empty
 	propertyNames := []string{
@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+// Fixtures shared by the tests decoding kernel nvlists and stats arrays
+
+// propEntry builds the value/source nvlist the kernel uses for a property
+func propEntry(t *testing.T, value any, source any) *nvlist.List {
+	t.Helper()
+	l := nvlist.New()
+	if err := l.Add(zpropValue, value); err != nil {
+		t.Fatal(err)
+	}
+	if source != nil {
+		if err := l.Add(zpropSource, source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+// pack packs an nvlist the way the kernel returns it
+func pack(t *testing.T, l *nvlist.List) []byte {
+	t.Helper()
+	data, err := l.Pack(nvlist.EncodingNative)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	return data
+}
+
+// poolConfig builds the config ZFS_IOC_POOL_CONFIGS reports for a pool
+func poolConfig(t *testing.T, name string, guid, state, vdevState, vdevAux uint64) *nvlist.List {
+	t.Helper()
+	tree := nvlist.New()
+	if err := tree.Add(zpoolConfigVdevStats, vdevStatsArray(vdevState, vdevAux, 0, 0, 0, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	config := nvlist.New()
+	for _, err := range []error{
+		config.Add(zpoolConfigName, name),
+		config.Add(zpoolConfigPoolGUID, guid),
+		config.Add(zpoolConfigPoolState, state),
+		config.Add(zpoolConfigVdevTree, tree),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return config
+}
+
+// vdevStatsArray builds a vdev_stat_t array with the given state and counters
+func vdevStatsArray(state, aux, alloc, space, read, write, cksum, slow uint64) []uint64 {
+	stats := make([]uint64, vdevStatsSlowIOsIndex+1)
+	stats[vdevStatsStateIndex] = state
+	stats[vdevStatsAuxIndex] = aux
+	stats[vdevStatsAllocIndex] = alloc
+	stats[vdevStatsSpaceIndex] = space
+	stats[vdevStatsDSpaceIndex] = space
+	stats[vdevStatsReadErrorsIndex] = read
+	stats[vdevStatsWriteErrorsIndex] = write
+	stats[vdevStatsChecksumErrorsIndex] = cksum
+	stats[vdevStatsSlowIOsIndex] = slow
+	return stats
+}
+
+// healthyStats builds the vdev_stat_t array of a healthy vdev without
+// allocations or errors
+func healthyStats() []uint64 {
+	return vdevStatsArray(vdevStateHealthy, 0, 0, 0, 0, 0, 0, 0)
+}
+
+// leafConfig builds the config of a disk vdev
+func leafConfig(id, guid uint64, path string, stats []uint64) map[string]any {
+	return map[string]any{
+		zpoolConfigType:      VdevTypeDisk,
+		zpoolConfigID:        id,
+		zpoolConfigGUID:      guid,
+		zpoolConfigPath:      path,
+		zpoolConfigVdevStats: stats,
+	}
+}
+
+// importConfig builds the config zpool_search_import reports for a pool
+func importConfig(name string, guid, state uint64, leaves ...map[string]any) map[string]any {
+	healthy := healthyStats()
+	return map[string]any{
+		zpoolConfigName:      name,
+		zpoolConfigPoolGUID:  guid,
+		zpoolConfigPoolState: state,
+		zpoolConfigVdevTree: map[string]any{
+			zpoolConfigType:      VdevTypeRoot,
+			zpoolConfigGUID:      guid + 1,
+			zpoolConfigVdevStats: healthy,
+			zpoolConfigChildren: []map[string]any{{
+				zpoolConfigType:      VdevTypeMirror,
+				zpoolConfigGUID:      guid + 2,
+				zpoolConfigVdevStats: healthy,
+				zpoolConfigChildren:  leaves,
+			}},
+		},
+	}
+}
@@ -5,15 +5,28 @@ package driver
 import (
 	"context"
 	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
 	"golang.org/x/sys/unix"
 )
 
 // ioctlDriver implements the Driver interface using direct /dev/zfs ioctls
 type ioctlDriver struct {
+	mu    sync.Mutex
 	zfsFD int
 	caps  map[string]bool // feature capabilities discovered at init
 }
 
+// ioctlBuilt reports whether the ioctl driver is compiled in
+const ioctlBuilt = true
+
+// Initial size of the nvlist result buffer, grown when the kernel asks for more
+const ioctlDstSize = 256 << 10
+
 // NewIoctl creates a new ioctl-based driver
 func NewIoctl() (Driver, error) {
 	// Open /dev/zfs
@@ -27,7 +40,6 @@ func NewIoctl() (Driver, error) {
 		caps:  make(map[string]bool),
 	}
 
-	// TODO: Probe capabilities/features
 	if err := d.probeCapabilities(); err != nil {
 		unix.Close(fd)
 		return nil, fmt.Errorf("failed to probe capabilities: %w", err)
@@ -37,6 +49,9 @@ func NewIoctl() (Driver, error) {
 }
 
 func (d *ioctlDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if d.zfsFD >= 0 {
 		err := unix.Close(d.zfsFD)
 		d.zfsFD = -1
@@ -46,52 +61,458 @@ func (d *ioctlDriver) Close() error {
 }
 
 func (d *ioctlDriver) probeCapabilities() error {
-	// TODO: Implement capability probing via ioctls
-	// For now, assume basic capabilities
+	// The kernel module must speak the zfs_cmd_t layout in zfs_cmd.go
+	ver, err := unix.SysctlUint32("vfs.zfs.version.ioctl")
+	if err != nil {
+		return fmt.Errorf("failed to read vfs.zfs.version.ioctl: %w", err)
+	}
+	if ver != zfsIoctlVersion {
+		return fmt.Errorf("unsupported ZFS ioctl version %d, want %d", ver, zfsIoctlVersion)
+	}
+
 	d.caps["pools"] = true
 	d.caps["datasets"] = true
+	d.caps["snapshots"] = true
 	return nil
 }
 
+// ioctl issues a ZFS ioctl. When dst is set a result buffer is attached and
+// grown until the packed nvlist fits, the packed nvlist is returned along
+// with the command as updated by the kernel.
+func (d *ioctlDriver) ioctl(nr uint, in zfsCmd, dst bool) (zfsCmd, []byte, error) {
+	var out zfsCmd
+	if d.zfsFD < 0 {
+		return out, nil, fmt.Errorf("driver closed")
+	}
+
+	size := uint64(ioctlDstSize)
+	for {
+		zc := in
+		var buf []byte
+		if dst {
+			buf = make([]byte, size)
+			zc.nvlistDst = uint64(uintptr(unsafe.Pointer(&buf[0])))
+			zc.nvlistDstSize = size
+		}
+
+		cmd := make([]byte, zfsCmdBufferSize)
+		if err := zc.marshal(cmd); err != nil {
+			return out, nil, err
+		}
+
+		// zfs_iocparm_t
+		parm := make([]byte, zfsIocparmSize)
+		zcOrder.PutUint32(parm[0:], zfsIoctlVersion)
+		zcOrder.PutUint64(parm[8:], uint64(uintptr(unsafe.Pointer(&cmd[0]))))
+		zcOrder.PutUint64(parm[16:], zfsCmdSize)
+
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(d.zfsFD), uintptr(zfsIoctlRequest(nr)), uintptr(unsafe.Pointer(&parm[0])))
+		runtime.KeepAlive(buf)
+		runtime.KeepAlive(cmd)
+		runtime.KeepAlive(parm)
+
+		if err := out.unmarshal(cmd); err != nil {
+			return out, nil, err
+		}
+
+		// The kernel reports the size it needs when the buffer is too small
+		if dst && errno == unix.ENOMEM && out.nvlistDstSize > size {
+			size = out.nvlistDstSize
+			continue
+		}
+		if errno != 0 {
+			return out, nil, errno
+		}
+		if dst {
+			return out, buf[:out.nvlistDstSize], nil
+		}
+		return out, nil, nil
+	}
+}
+
+// ioctlError converts an ioctl failure into a ZfsError
+func ioctlError(op, resource string, err error) error {
+	errno, ok := err.(unix.Errno)
+	if !ok {
+		return zfserrors.WrapZfsError(op, resource, err)
+	}
+	return zfserrors.NewZfsError(op, resource, zfserrors.MapErrno(int(errno)), int(errno), errno.Error(), err)
+}
+
 func (d *ioctlDriver) RuntimeInfo(ctx context.Context) (string, string, string, error) {
-	// TODO: Extract version info via ioctls
-	return "ioctl", "OpenZFS 2.x", "FreeBSD", nil
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.zfsFD < 0 {
+		return "", "", "", fmt.Errorf("driver closed")
+	}
+
+	zfsVer, err := unix.Sysctl("vfs.zfs.version.module")
+	if err != nil {
+		zfsVer = "OpenZFS 2.x"
+	}
+	kernel, err := unix.Sysctl("kern.osrelease")
+	if err != nil {
+		kernel = "FreeBSD"
+	}
+	return "ioctl", zfsVer, kernel, nil
 }
 
 func (d *ioctlDriver) ListPools(ctx context.Context) ([]PoolInfo, error) {
-	// TODO: Implement pool listing via ZFS_IOC_POOL_CONFIGS ioctl
-	return nil, fmt.Errorf("ioctl pool listing not implemented yet")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, packed, err := d.ioctl(zfsIocPoolConfigs, zfsCmd{}, true)
+	if err != nil {
+		return nil, ioctlError("list_pools", "", err)
+	}
+
+	pools, err := parsePoolConfigs(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	// The namespace configs may be stale, refresh each pool's health
+	for i := range pools {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, packed, err := d.ioctl(zfsIocPoolStats, zfsCmd{name: pools[i].Name}, true)
+		if err != nil || len(packed) == 0 {
+			continue
+		}
+		config, err := nvlist.Unpack(packed)
+		if err != nil {
+			continue
+		}
+		pools[i] = poolInfoFromConfig(pools[i].Name, config)
+	}
+
+	return pools, nil
 }
 
 func (d *ioctlDriver) GetPoolProps(ctx context.Context, poolName string, propNames []string) (map[string]PropertyInfo, error) {
-	return nil, fmt.Errorf("ioctl pool properties not implemented yet")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, packed, err := d.ioctl(zfsIocPoolGetProps, zfsCmd{name: poolName}, true)
+	if err != nil {
+		return nil, ioctlError("get_pool", poolName, err)
+	}
+
+	// Feature states are only part of the pool stats config
+	var features *nvlist.List
+	wantFeatures := len(propNames) == 0
+	for _, name := range propNames {
+		wantFeatures = wantFeatures || IsPoolFeatureProp(name)
+	}
+	if wantFeatures {
+		if _, stats, err := d.ioctl(zfsIocPoolStats, zfsCmd{name: poolName}, true); err == nil && len(stats) > 0 {
+			if config, err := nvlist.Unpack(stats); err == nil {
+				features, _ = config.LookupList(zpoolConfigFeatureStats)
+			}
+		}
+	}
+	return parsePoolProps(poolName, packed, features, propNames)
+}
+
+func (d *ioctlDriver) GetPoolStatus(ctx context.Context, poolName string) (*PoolStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, packed, err := d.ioctl(zfsIocPoolStats, zfsCmd{name: poolName}, true)
+	if err != nil {
+		return nil, ioctlError("get_pool_status", poolName, err)
+	}
+
+	config, err := nvlist.Unpack(packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pool config: %w", err)
+	}
+	return parsePoolStatus(poolName, config)
+}
+
+func (d *ioctlDriver) SetPoolProp(ctx context.Context, poolName, propName, propValue string) error {
+	return fmt.Errorf("ioctl SetPoolProp not implemented yet")
+}
+
+func (d *ioctlDriver) ScrubPool(ctx context.Context, poolName string, opts ScrubOptions) error {
+	return fmt.Errorf("ioctl ScrubPool not implemented yet")
+}
+
+func (d *ioctlDriver) CheckpointPool(ctx context.Context, poolName string) error {
+	return fmt.Errorf("ioctl CheckpointPool not implemented yet")
+}
+
+func (d *ioctlDriver) DiscardCheckpoint(ctx context.Context, poolName string) error {
+	return fmt.Errorf("ioctl DiscardCheckpoint not implemented yet")
+}
+
+func (d *ioctlDriver) WaitPool(ctx context.Context, poolName string, activity WaitActivity) (bool, error) {
+	return false, fmt.Errorf("ioctl WaitPool not implemented yet")
+}
+
+// GetPoolHistory reads the history records of a pool from offset to the
+// end, like zpool_get_history, and returns the offset after the last one
+func (d *ioctlDriver) GetPoolHistory(ctx context.Context, poolName string, offset uint64) ([]HistoryRecord, uint64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var records []HistoryRecord
+	buf := make([]byte, historyBufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		zc := zfsCmd{
+			name:          poolName,
+			history:       uint64(uintptr(unsafe.Pointer(&buf[0]))),
+			historyLen:    uint64(len(buf)),
+			historyOffset: offset,
+		}
+		out, _, err := d.ioctl(zfsIocPoolGetHistory, zc, false)
+		runtime.KeepAlive(buf)
+		if err != nil {
+			return nil, 0, ioctlError("get_history", poolName, err)
+		}
+		if out.historyLen == 0 {
+			return records, offset, nil
+		}
+
+		read, used, err := unpackHistory(buf[:out.historyLen])
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, read...)
+		offset += uint64(used)
+
+		// A record larger than the buffer needs a bigger one
+		if used == 0 {
+			buf = make([]byte, 2*len(buf))
+		}
+	}
+}
+
+// objsetStats returns the type and packed properties of a dataset
+func (d *ioctlDriver) objsetStats(name string) (zfsCmd, []byte, error) {
+	return d.ioctl(zfsIocObjsetStats, zfsCmd{name: name}, true)
+}
+
+// listChildren returns the datasets below name, descending into every
+// level when recursive is set. Snapshots are included when snapshots is set.
+func (d *ioctlDriver) listChildren(ctx context.Context, name string, recursive, snapshots bool) ([]DatasetInfo, error) {
+	var datasets []DatasetInfo
+
+	// ZFS_IOC_DATASET_LIST_NEXT walks children using zc_cookie, ESRCH ends the walk
+	var children []DatasetInfo
+	zc := zfsCmd{name: name}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out, _, err := d.ioctl(zfsIocDatasetListNext, zc, false)
+		if err == unix.ESRCH {
+			break
+		}
+		if err != nil {
+			return nil, ioctlError("list_datasets", name, err)
+		}
+		children = append(children, DatasetInfo{
+			Name: out.name,
+			Type: out.objsetStats.datasetType(),
+			GUID: out.objsetStats.guid,
+		})
+		zc.cookie = out.cookie
+	}
+
+	if snapshots {
+		zc = zfsCmd{name: name, simple: true}
+		for {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			out, _, err := d.ioctl(zfsIocSnapshotListNext, zc, false)
+			if err == unix.ESRCH {
+				break
+			}
+			if err != nil {
+				return nil, ioctlError("list_datasets", name, err)
+			}
+			datasets = append(datasets, DatasetInfo{
+				Name: out.name,
+				Type: DatasetSnapshot,
+				GUID: out.objsetStats.guid,
+			})
+			zc.cookie = out.cookie
+		}
+	}
+
+	for _, child := range children {
+		datasets = append(datasets, child)
+		if !recursive {
+			continue
+		}
+		descendants, err := d.listChildren(ctx, child.Name, recursive, snapshots)
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, descendants...)
+	}
+
+	return datasets, nil
+}
+
+// listPool returns the root dataset of a pool followed by its descendants
+func (d *ioctlDriver) listPool(ctx context.Context, poolName string, recursive, snapshots bool) ([]DatasetInfo, error) {
+	out, _, err := d.ioctl(zfsIocObjsetStats, zfsCmd{name: poolName}, false)
+	if err != nil {
+		return nil, ioctlError("list_datasets", poolName, err)
+	}
+
+	datasets := []DatasetInfo{{
+		Name: poolName,
+		Type: out.objsetStats.datasetType(),
+		GUID: out.objsetStats.guid,
+	}}
+	if !recursive && !snapshots {
+		return datasets, nil
+	}
+
+	children, err := d.listChildren(ctx, poolName, recursive, snapshots)
+	if err != nil {
+		return nil, err
+	}
+	return append(datasets, children...), nil
+}
+
+// poolNames returns the names of the imported pools
+func (d *ioctlDriver) poolNames() ([]string, error) {
+	_, packed, err := d.ioctl(zfsIocPoolConfigs, zfsCmd{}, true)
+	if err != nil {
+		return nil, ioctlError("list_pools", "", err)
+	}
+	pools, err := parsePoolConfigs(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(pools))
+	for i, p := range pools {
+		names[i] = p.Name
+	}
+	return names, nil
+}
+
+// listAll lists the datasets of every pool
+func (d *ioctlDriver) listAll(ctx context.Context, recursive, snapshots bool) ([]DatasetInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	names, err := d.poolNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var datasets []DatasetInfo
+	for _, name := range names {
+		pool, err := d.listPool(ctx, name, recursive, snapshots)
+		if err != nil {
+			// Pools that cannot be opened have no datasets to list
+			if zfsErr, ok := zfserrors.AsZfsError(err); ok && zfsErr.Resource == name {
+				continue
+			}
+			return nil, err
+		}
+		datasets = append(datasets, pool...)
+	}
+	return datasets, nil
 }
 
 func (d *ioctlDriver) ListDatasets(ctx context.Context, recursive bool) ([]DatasetInfo, error) {
-	// TODO: Implement dataset listing via ZFS_IOC_DATASET_LIST_NEXT ioctl
-	return nil, fmt.Errorf("ioctl dataset listing not implemented yet")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.listAll(ctx, recursive, false)
 }
 
 func (d *ioctlDriver) ListDatasetsInPool(ctx context.Context, poolName string, recursive bool) ([]DatasetInfo, error) {
-	return nil, fmt.Errorf("ioctl pool-specific dataset listing not implemented yet")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.listPool(ctx, poolName, recursive, false)
 }
 
 func (d *ioctlDriver) GetDatasetProps(ctx context.Context, datasetName string, propNames []string) (map[string]PropertyInfo, error) {
-	return nil, fmt.Errorf("ioctl dataset properties not implemented yet")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out, packed, err := d.objsetStats(datasetName)
+	if err != nil {
+		return nil, ioctlError("get_dataset", datasetName, err)
+	}
+	dsType := out.objsetStats.datasetType()
+
+	// version, utf8only, normalization and casesensitivity live in the ZPL
+	// master node and are only reported by ZFS_IOC_OBJSET_ZPLPROPS
+	var zpl []byte
+	if dsType == DatasetFilesystem || dsType == DatasetSnapshot {
+		if _, zplPacked, err := d.ioctl(zfsIocObjsetZplprops, zfsCmd{name: datasetName}, true); err == nil && len(zplPacked) > 0 {
+			zpl = zplPacked
+		}
+	}
+
+	// Received values are kept apart from the effective ones, datasets that
+	// were never received have none
+	var recvd []byte
+	if _, recvdPacked, err := d.ioctl(zfsIocObjsetRecvdProps, zfsCmd{name: datasetName}, true); err == nil && len(recvdPacked) > 0 {
+		recvd = recvdPacked
+	}
+
+	extra := objsetExtraProps(datasetName, out.objsetStats, zpl)
+	return parseDatasetProps(datasetName, dsType, packed, recvd, extra, propNames)
+}
+
+func (d *ioctlDriver) DiscoverPools(ctx context.Context, opts DiscoverOptions) ([]ImportablePool, error) {
+	return nil, fmt.Errorf("ioctl DiscoverPools not implemented yet")
 }
 
-func (d *ioctlDriver) ImportPool(ctx context.Context, poolName string, opts ImportOptions) error {
-	return fmt.Errorf("ioctl ImportPool not implemented yet")
+func (d *ioctlDriver) ImportPool(ctx context.Context, poolName string, opts ImportOptions) (*RewindReport, error) {
+	return nil, fmt.Errorf("ioctl ImportPool not implemented yet")
 }
 
 func (d *ioctlDriver) ExportPool(ctx context.Context, poolName string, opts ExportOptions) error {
 	return fmt.Errorf("ioctl ExportPool not implemented yet")
 }
 
-func (d *ioctlDriver) CreatePool(ctx context.Context, poolName string, vdevs []string, opts CreateOptions) error {
+func (d *ioctlDriver) CreatePool(ctx context.Context, poolName string, vdevs []VdevSpec, opts CreateOptions) error {
 	return fmt.Errorf("ioctl CreatePool not implemented yet")
 }
 
+func (d *ioctlDriver) SplitPool(ctx context.Context, poolName, newPoolName string, opts SplitOptions) (*VdevInfo, error) {
+	return nil, fmt.Errorf("ioctl SplitPool not implemented yet")
+}
+
 func (d *ioctlDriver) DestroyPool(ctx context.Context, poolName string) error {
 	return fmt.Errorf("ioctl DestroyPool not implemented yet")
 }
@@ -104,6 +525,14 @@ func (d *ioctlDriver) SetDatasetProp(ctx context.Context, datasetName, propName,
 	return fmt.Errorf("ioctl SetDatasetProp not implemented yet")
 }
 
+func (d *ioctlDriver) SetDatasetProps(ctx context.Context, datasetName string, props map[string]string) error {
+	return fmt.Errorf("ioctl SetDatasetProps not implemented yet")
+}
+
+func (d *ioctlDriver) InheritDatasetProp(ctx context.Context, datasetName, propName string, opts InheritOptions) error {
+	return fmt.Errorf("ioctl InheritDatasetProp not implemented yet")
+}
+
 func (d *ioctlDriver) DestroyDataset(ctx context.Context, datasetName string, recursive bool) error {
 	return fmt.Errorf("ioctl DestroyDataset not implemented yet")
 }
@@ -127,10 +556,27 @@ func (d *ioctlDriver) SupportsFeature(ctx context.Context, feature string) (bool
 	return false, nil
 }
 
-// ListDatasetsByType - stub implementation for now
+// ListDatasetsByType lists datasets of every pool including snapshots,
+// optionally filtered by type
 func (d *ioctlDriver) ListDatasetsByType(ctx context.Context, dsType *DatasetType, recursive bool) ([]DatasetInfo, error) {
-	// TODO: Implement when ioctl driver is fully developed
-	return nil, fmt.Errorf("ListDatasetsByType not implemented in ioctl driver yet")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	all, err := d.listAll(ctx, recursive, true)
+	if err != nil {
+		return nil, err
+	}
+	if dsType == nil {
+		return all, nil
+	}
+
+	var datasets []DatasetInfo
+	for _, ds := range all {
+		if ds.Type == *dsType {
+			datasets = append(datasets, ds)
+		}
+	}
+	return datasets, nil
 }
 
 // Vdev management operations - stub implementations
@@ -154,8 +600,12 @@ func (d *ioctlDriver) RemoveVdev(ctx context.Context, poolName, device string) e
 	return fmt.Errorf("RemoveVdev not implemented in ioctl driver yet")
 }
 
-func (d *ioctlDriver) OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) error {
-	return fmt.Errorf("OnlineVdev not implemented in ioctl driver yet")
+func (d *ioctlDriver) CancelRemoval(ctx context.Context, poolName string) error {
+	return fmt.Errorf("CancelRemoval not implemented in ioctl driver yet")
+}
+
+func (d *ioctlDriver) OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) (string, error) {
+	return "", fmt.Errorf("OnlineVdev not implemented in ioctl driver yet")
 }
 
 func (d *ioctlDriver) OfflineVdev(ctx context.Context, poolName, device string, temporary bool) error {
@@ -166,17 +616,56 @@ func (d *ioctlDriver) ClearVdev(ctx context.Context, poolName, device string) er
 	return fmt.Errorf("ClearVdev not implemented in ioctl driver yet")
 }
 
+func (d *ioctlDriver) InitializeVdevs(ctx context.Context, poolName string, devices []string, cmd VdevActionCommand) error {
+	return fmt.Errorf("InitializeVdevs not implemented in ioctl driver yet")
+}
+
+func (d *ioctlDriver) TrimVdevs(ctx context.Context, poolName string, devices []string, opts TrimOptions) error {
+	return fmt.Errorf("TrimVdevs not implemented in ioctl driver yet")
+}
+
 // Feature detection - stub implementations
 func (d *ioctlDriver) GetAvailableFeatures(ctx context.Context) ([]string, error) {
 	return nil, fmt.Errorf("GetAvailableFeatures not implemented in ioctl driver yet")
 }
 
+func (d *ioctlDriver) GetPoolFeatures(ctx context.Context, poolName string) ([]PoolFeature, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, packed, err := d.ioctl(zfsIocPoolStats, zfsCmd{name: poolName}, true)
+	if err != nil {
+		return nil, ioctlError("get_pool_features", poolName, err)
+	}
+	config, err := nvlist.Unpack(packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pool config: %w", err)
+	}
+	stats, ok := config.LookupList(zpoolConfigFeatureStats)
+	if !ok {
+		return nil, fmt.Errorf("pool %s config has no feature stats", poolName)
+	}
+	return parsePoolFeatures(stats), nil
+}
+
+func (d *ioctlDriver) LoadCompatibility(ctx context.Context, compatibility string) ([]string, error) {
+	return LoadCompatibility(compatibility, CompatibilityDirs)
+}
+
 func (d *ioctlDriver) GetSupportedCompressionAlgorithms(ctx context.Context) ([]string, error) {
 	return nil, fmt.Errorf("GetSupportedCompressionAlgorithms not implemented in ioctl driver yet")
 }
 
 func (d *ioctlDriver) GetZFSVersion(ctx context.Context) (string, error) {
-	return "", fmt.Errorf("GetZFSVersion not implemented in ioctl driver yet")
+	ver, err := unix.Sysctl("vfs.zfs.version.module")
+	if err != nil {
+		return "", fmt.Errorf("failed to read vfs.zfs.version.module: %w", err)
+	}
+	return ver, nil
 }
 
 // Clone operations - stub implementations
@@ -199,29 +688,3 @@ func (d *ioctlDriver) ListClones(ctx context.Context, snapshotName string) ([]st
 func (d *ioctlDriver) DestroyClone(ctx context.Context, cloneName string, force bool) error {
 	return fmt.Errorf("DestroyClone not implemented in ioctl driver yet")
 }
-
-// TODO: Define ioctl constants and structures
-// These would typically come from sys/fs/zfs.h or similar
-const (
-	// ZFS ioctl command numbers - these are FreeBSD-specific
-	// TODO: Extract these from actual kernel headers
-	ZFS_IOC_POOL_CONFIGS  = 0x5a00 // placeholder
-	ZFS_IOC_DATASET_LIST  = 0x5a01 // placeholder
-	ZFS_IOC_POOL_STATS    = 0x5a02 // placeholder
-	ZFS_IOC_DATASET_PROPS = 0x5a03 // placeholder
-)
-
-// TODO: Define nvlist and ioctl data structures for direct ioctl communication
-type zfsIoctlHeader struct {
-	// Common ioctl header fields
-	// TODO: Define based on actual FreeBSD ZFS ioctl structures
-}
-
-// TODO: Implement nvlist encoder/decoder for pure Go nvlist handling
-type nvlistEncoder struct {
-	// Fields for encoding Go data to nvlist format
-}
-
-type nvlistDecoder struct {
-	// Fields for decoding nvlist format to Go data
-}
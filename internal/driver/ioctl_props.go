@@ -0,0 +1,550 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+// Pool configuration nvlist keys (ZPOOL_CONFIG_* in sys/fs/zfs.h)
+const (
+	zpoolConfigName      = "name"
+	zpoolConfigPoolGUID  = "pool_guid"
+	zpoolConfigPoolState = "state"
+	zpoolConfigVdevTree  = "vdev_tree"
+	zpoolConfigVdevStats = "vdev_stats"
+
+	zpoolConfigFeatureStats = "feature_stats"
+)
+
+// Indexes into the vdev_stat_t array of a vdev config
+const (
+	vdevStatsStateIndex = 1 // vs_state
+	vdevStatsAuxIndex   = 2 // vs_aux
+)
+
+// Property nvlist keys and sources (ZPROP_* in sys/fs/zfs.h)
+const (
+	zpropValue          = "value"
+	zpropSource         = "source"
+	zpropSourceValRecvd = "$recvd"
+
+	zpropSourceNone      = 0x1
+	zpropSourceDefault   = 0x2
+	zpropSourceTemporary = 0x4
+	zpropSourceLocal     = 0x8
+	zpropSourceInherited = 0x10
+	zpropSourceReceived  = 0x20
+)
+
+// zfsCompressLevelShift is SPA_COMPRESSBITS, compression levels are stored above it
+const zfsCompressLevelShift = 7
+
+// Vdev states (vdev_state_t)
+const (
+	vdevStateUnknown  = 0
+	vdevStateClosed   = 1
+	vdevStateOffline  = 2
+	vdevStateRemoved  = 3
+	vdevStateCantOpen = 4
+	vdevStateFaulted  = 5
+	vdevStateDegraded = 6
+	vdevStateHealthy  = 7
+)
+
+// Vdev auxiliary states (vdev_aux_t) that change how CANT_OPEN is reported
+const (
+	vdevAuxCorruptData = 2
+	vdevAuxBadLog      = 13
+	vdevAuxSplitPool   = 15
+)
+
+// vdevStateName returns the health name of a vdev state, matching
+// zpool_state_to_name in libzfs
+func vdevStateName(state, aux uint64) string {
+	switch state {
+	case vdevStateClosed, vdevStateOffline:
+		return "OFFLINE"
+	case vdevStateRemoved:
+		return "REMOVED"
+	case vdevStateCantOpen:
+		switch aux {
+		case vdevAuxCorruptData, vdevAuxBadLog:
+			return "FAULTED"
+		case vdevAuxSplitPool:
+			return "SPLIT"
+		}
+		return "UNAVAIL"
+	case vdevStateFaulted:
+		return "FAULTED"
+	case vdevStateDegraded:
+		return "DEGRADED"
+	case vdevStateHealthy:
+		return "ONLINE"
+	}
+	return "UNKNOWN"
+}
+
+// poolInfoFromConfig builds a PoolInfo from a pool configuration nvlist
+func poolInfoFromConfig(name string, config *nvlist.List) PoolInfo {
+	info := PoolInfo{Name: name, Health: "UNKNOWN", State: "UNKNOWN"}
+	if n, ok := config.LookupString(zpoolConfigName); ok {
+		info.Name = n
+	}
+	if guid, ok := config.LookupUint64(zpoolConfigPoolGUID); ok {
+		info.GUID = guid
+	}
+	if state, ok := config.LookupUint64(zpoolConfigPoolState); ok {
+		info.State = mapPoolState(int(state))
+	}
+	if tree, ok := config.LookupList(zpoolConfigVdevTree); ok {
+		if stats, ok := tree.LookupUint64Array(zpoolConfigVdevStats); ok && len(stats) > vdevStatsAuxIndex {
+			info.Health = vdevStateName(stats[vdevStatsStateIndex], stats[vdevStatsAuxIndex])
+		}
+	}
+	return info
+}
+
+// parsePoolConfigs decodes the result of ZFS_IOC_POOL_CONFIGS, a list of
+// pool name to configuration, sorted by pool name
+func parsePoolConfigs(packed []byte) ([]PoolInfo, error) {
+	configs, err := nvlist.Unpack(packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pool configs: %w", err)
+	}
+
+	pools := make([]PoolInfo, 0, configs.Len())
+	for _, p := range configs.Pairs {
+		config, ok := p.Value.(*nvlist.List)
+		if !ok {
+			return nil, fmt.Errorf("pool %s: config is %v, want nvlist", p.Name, p.Type)
+		}
+		pools = append(pools, poolInfoFromConfig(p.Name, config))
+	}
+
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools, nil
+}
+
+// propFormat describes how a raw property value is rendered
+type propFormat int
+
+const (
+	formatString   propFormat = iota
+	formatNumber              // plain decimal
+	formatBytes               // zfs_nicenum, e.g. 1.50G
+	formatRatio               // value*100, e.g. 1.23x
+	formatPercent             // e.g. 42%, UINT64_MAX is "-"
+	formatQuota               // bytes, zero is "none"
+	formatOptional            // bytes, zero is "-"
+	formatLimit               // count, UINT64_MAX is "none"
+	formatDate                // seconds since the epoch
+	formatIndex               // named value from an index table
+	formatHealth              // vdev state
+)
+
+// propDesc describes a property known to the ioctl driver
+type propDesc struct {
+	format propFormat
+	index  map[uint64]string // names for formatIndex
+	def    any               // value when the kernel omits the property
+}
+
+var compressionIndex = map[uint64]string{
+	0:  "inherit",
+	1:  "on",
+	2:  "off",
+	3:  "lzjb",
+	4:  "empty",
+	5:  "gzip-1",
+	6:  "gzip-2",
+	7:  "gzip-3",
+	8:  "gzip-4",
+	9:  "gzip-5",
+	10: "gzip-6",
+	11: "gzip-7",
+	12: "gzip-8",
+	13: "gzip-9",
+	14: "zle",
+	15: "lz4",
+	16: "zstd",
+}
+
+// Zstd compression levels are stored above SPA_COMPRESSBITS
+const (
+	zioCompressZstd    = 16
+	zstdLevelDefault   = 3
+	zstdLevelFastFirst = 1001
+)
+
+var zstdFastLevels = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 500, 1000}
+
+// compressionName renders a compression value, including the zstd level
+func compressionName(v uint64) string {
+	alg := v & (1<<zfsCompressLevelShift - 1)
+	level := int(v >> zfsCompressLevelShift)
+	if alg != zioCompressZstd || level == 0 || level == zstdLevelDefault {
+		if name, ok := compressionIndex[alg]; ok {
+			return name
+		}
+		return strconv.FormatUint(v, 10)
+	}
+	if level >= zstdLevelFastFirst && level-zstdLevelFastFirst < len(zstdFastLevels) {
+		return fmt.Sprintf("zstd-fast-%d", zstdFastLevels[level-zstdLevelFastFirst])
+	}
+	return fmt.Sprintf("zstd-%d", level)
+}
+
+// formatProp renders a raw property value the way zfs get does
+func formatProp(desc propDesc, name string, raw any) string {
+	var v uint64
+	switch raw := raw.(type) {
+	case uint64:
+		v = raw
+	case *nvlist.List:
+		// clones is reported as a list keyed by dataset name
+		names := make([]string, 0, raw.Len())
+		for _, p := range raw.Pairs {
+			names = append(names, p.Name)
+		}
+		return strings.Join(names, ",")
+	default:
+		return fmt.Sprint(raw)
+	}
+
+	switch desc.format {
+	case formatBytes:
+		return niceNum(v)
+	case formatRatio:
+		return fmt.Sprintf("%d.%02dx", v/100, v%100)
+	case formatPercent:
+		if v == noLimit {
+			return "-"
+		}
+		return fmt.Sprintf("%d%%", v)
+	case formatOptional:
+		if v == 0 {
+			return "-"
+		}
+		return niceNum(v)
+	case formatQuota:
+		if v == 0 {
+			return "none"
+		}
+		return niceNum(v)
+	case formatLimit:
+		if v == noLimit {
+			return "none"
+		}
+	case formatDate:
+		return time.Unix(int64(v), 0).Format("Mon Jan _2 15:04 2006")
+	case formatIndex:
+		if name == PropNameCompression {
+			return compressionName(v)
+		}
+		if s, ok := desc.index[v]; ok {
+			return s
+		}
+	case formatHealth:
+		return vdevStateName(v, 0)
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// rawPropValue converts a raw kernel value to the form reported in
+// PropertyInfo.Raw: numbers stay uint64, index values become their name,
+// or a bool for on/off and yes/no properties
+func rawPropValue(prop datasetProp, name string, raw any) any {
+	switch prop.kind() {
+	case PropKindBool:
+		s := formatProp(prop.desc(), name, raw)
+		return s == "on" || s == "yes"
+	case PropKindIndex, PropKindString:
+		return formatProp(prop.desc(), name, raw)
+	}
+	return raw
+}
+
+// niceNum formats a byte count like zfs_nicenum with 1024 based units
+func niceNum(num uint64) string {
+	const units = " KMGTPE"
+
+	index := 0
+	for n := num; n >= 1024 && index < len(units)-1; n /= 1024 {
+		index++
+	}
+	if index == 0 {
+		return strconv.FormatUint(num, 10)
+	}
+
+	unit := units[index : index+1]
+	shift := uint(10 * index)
+	if num&(1<<shift-1) == 0 {
+		return strconv.FormatUint(num>>shift, 10) + unit
+	}
+
+	val := float64(num) / float64(uint64(1)<<shift)
+	var s string
+	for prec := 2; prec >= 0; prec-- {
+		s = strconv.FormatFloat(val, 'f', prec, 64) + unit
+		if len(s) <= 5 {
+			break
+		}
+	}
+	return s
+}
+
+// parsePoolProps decodes the result of ZFS_IOC_POOL_GET_PROPS. Each entry
+// is an nvlist holding the value and a numeric zprop source. feature@
+// properties are resolved from features, the ZPOOL_CONFIG_FEATURE_STATS
+// list of the pool, and skipped when it is nil. Every native property and
+// known feature is returned when propNames is empty.
+func parsePoolProps(pool string, packed []byte, features *nvlist.List, propNames []string) (map[string]PropertyInfo, error) {
+	props, err := nvlist.Unpack(packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pool properties: %w", err)
+	}
+
+	if len(propNames) == 0 {
+		propNames = PoolPropNames()
+	}
+
+	properties := make(map[string]PropertyInfo)
+	for _, requested := range propNames {
+		if IsPoolFeatureProp(requested) {
+			guid, known := PoolFeatureGUID(requested)
+			if !known {
+				return nil, UnknownPropertyError(pool, requested)
+			}
+			if features == nil {
+				continue
+			}
+			refcount, enabled := features.LookupUint64(guid)
+			state := featureState(refcount, enabled)
+			properties[requested] = PropertyInfo{Name: requested, Value: state, Raw: state, Source: FeatureSource(state)}
+			continue
+		}
+
+		name, known := CanonicalPoolProp(requested)
+		if !known {
+			return nil, UnknownPropertyError(pool, requested)
+		}
+		prop := poolPropTable[name]
+
+		info := PropertyInfo{Name: requested, Source: PropSourceDefault}
+		var raw any
+		if entry, ok := props.LookupList(name); ok {
+			value, _ := entry.Lookup(zpropValue)
+			raw = value.Value
+			if src, ok := entry.LookupUint64(zpropSource); ok {
+				info.Source = mapPropSource(src)
+			}
+		} else if prop.def != nil {
+			raw = prop.def
+		} else {
+			continue
+		}
+
+		info.Value = formatProp(prop.desc(), name, raw)
+		info.Raw = rawPropValue(prop, name, raw)
+		info.Received = info.Source == PropSourceReceived
+		properties[requested] = info
+	}
+	return properties, nil
+}
+
+// mapPropSource maps a zprop_source_t to a PropSource
+func mapPropSource(src uint64) PropSource {
+	switch src {
+	case zpropSourceNone:
+		return PropSourceNone
+	case zpropSourceLocal:
+		return PropSourceLocal
+	case zpropSourceInherited:
+		return PropSourceInherited
+	case zpropSourceTemporary:
+		return PropSourceTemporary
+	case zpropSourceReceived:
+		return PropSourceReceived
+	}
+	return PropSourceDefault
+}
+
+// datasetPropSource maps the setpoint reported by the kernel to a
+// PropSource. Local values name the dataset itself, inherited values name
+// the ancestor they were set on, which is returned as well.
+func datasetPropSource(dataset, setpoint string, present bool) (PropSource, string) {
+	switch {
+	case !present || setpoint == "":
+		return PropSourceDefault, ""
+	case setpoint == zpropSourceValRecvd:
+		return PropSourceReceived, ""
+	case setpoint == dataset:
+		return PropSourceLocal, ""
+	}
+	return PropSourceInherited, setpoint
+}
+
+// parseDatasetProps decodes the property nvlist of ZFS_IOC_OBJSET_STATS for
+// a dataset. recvd is the packed result of ZFS_IOC_OBJSET_RECVD_PROPS, or
+// nil, and extra holds raw values the kernel reports elsewhere, such as the
+// ZPL properties. Requested names are resolved through the native
+// property table and the results are keyed by the name asked for; with no
+// names every property applicable to the dataset type is returned.
+func parseDatasetProps(dataset string, dsType DatasetType, packed, recvd []byte, extra map[string]any, propNames []string) (map[string]PropertyInfo, error) {
+	props, err := nvlist.Unpack(packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dataset properties: %w", err)
+	}
+	received := nvlist.New()
+	if len(recvd) > 0 {
+		if received, err = nvlist.Unpack(recvd); err != nil {
+			return nil, fmt.Errorf("failed to decode received properties: %w", err)
+		}
+	}
+
+	if len(propNames) == 0 {
+		propNames = append(DatasetPropNames(dsType), userPropNames(props)...)
+	}
+
+	properties := make(map[string]PropertyInfo)
+	for _, name := range propNames {
+		if IsUserProp(name) {
+			if info, ok := userPropInfo(dataset, name, props, received); ok {
+				properties[name] = info
+			}
+			continue
+		}
+
+		canonical, known := CanonicalDatasetProp(name)
+		if !known {
+			return nil, UnknownPropertyError(dataset, name)
+		}
+		prop := datasetPropTable[canonical]
+		if prop.types&(1<<dsType) == 0 {
+			continue
+		}
+
+		var raw any
+		var setpoint string
+		entry, found := props.LookupList(canonical)
+		if found {
+			if v, ok := entry.Lookup(zpropValue); ok {
+				raw = v.Value
+			}
+			setpoint, _ = entry.LookupString(zpropSource)
+		} else {
+			raw = extra[canonical]
+		}
+
+		info := PropertyInfo{Name: name}
+		info.Source, info.InheritedFrom = datasetPropSource(dataset, setpoint, found)
+		if prop.readonly || (!found && raw != nil) {
+			// Statistics and values kept outside the property list have no source
+			info.Source = PropSourceNone
+		}
+		info.Received = info.Source == PropSourceReceived
+		if entry, ok := received.LookupList(canonical); ok {
+			if v, ok := entry.Lookup(zpropValue); ok {
+				info.ReceivedValue = formatProp(prop.desc(), canonical, v.Value)
+			}
+		}
+
+		switch {
+		case canonical == PropNameMountpoint:
+			info.Value = mountpointValue(dataset, raw, setpoint, info.Source)
+			info.Raw = info.Value
+		case raw != nil:
+			info.Value = formatProp(prop.desc(), canonical, raw)
+			info.Raw = rawPropValue(prop, canonical, raw)
+		case prop.def != nil:
+			info.Value = formatProp(prop.desc(), canonical, prop.def)
+			info.Raw = rawPropValue(prop, canonical, prop.def)
+		default:
+			continue
+		}
+		properties[name] = info
+	}
+	return properties, nil
+}
+
+// userPropNames returns the names of the user properties in a property
+// list, sorted
+func userPropNames(props *nvlist.List) []string {
+	var names []string
+	for _, p := range props.Pairs {
+		if IsUserProp(p.Name) {
+			names = append(names, p.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// userPropInfo builds the PropertyInfo of a user property from the
+// value/source entries of the effective and received property lists.
+// User properties without a value anywhere in the hierarchy are not set.
+func userPropInfo(dataset, name string, props, received *nvlist.List) (PropertyInfo, bool) {
+	entry, ok := props.LookupList(name)
+	if !ok {
+		return PropertyInfo{}, false
+	}
+	value, _ := entry.LookupString(zpropValue)
+	setpoint, _ := entry.LookupString(zpropSource)
+
+	info := PropertyInfo{Name: name, Value: value, Raw: value}
+	info.Source, info.InheritedFrom = datasetPropSource(dataset, setpoint, true)
+	info.Received = info.Source == PropSourceReceived
+	if entry, ok := received.LookupList(name); ok {
+		if v, ok := entry.LookupString(zpropValue); ok {
+			info.ReceivedValue = v
+		}
+	}
+	return info, true
+}
+
+// objsetExtraProps returns the raw values of properties that are not part
+// of the OBJSET_STATS property list: the name and type, the origin from the
+// objset stats, and the ZPL properties from ZFS_IOC_OBJSET_ZPLPROPS when
+// zpl holds its packed result
+func objsetExtraProps(name string, stats dmuObjsetStats, zpl []byte) map[string]any {
+	extra := map[string]any{
+		"name": name,
+		"type": stats.datasetType().String(),
+	}
+	if stats.origin != "" {
+		extra["origin"] = stats.origin
+	}
+	if zpl == nil {
+		return extra
+	}
+	if props, err := nvlist.Unpack(zpl); err == nil {
+		for _, p := range props.Pairs {
+			extra[p.Name] = p.Value
+		}
+	}
+	return extra
+}
+
+// mountpointValue derives the effective mountpoint. Inherited mountpoints
+// have the dataset's path below the setpoint appended and the default is
+// the dataset name under /.
+func mountpointValue(dataset string, raw any, setpoint string, source PropSource) string {
+	mnt, _ := raw.(string)
+	switch {
+	case source == PropSourceDefault || mnt == "":
+		return "/" + dataset
+	case mnt == "legacy" || mnt == "none" || source != PropSourceInherited:
+		return mnt
+	}
+
+	rel := strings.TrimPrefix(dataset, setpoint)
+	if mnt == "/" {
+		return "/" + strings.TrimPrefix(rel, "/")
+	}
+	return mnt + rel
+}
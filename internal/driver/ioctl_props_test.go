@@ -0,0 +1,472 @@
+package driver
+
+import (
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+func TestParsePoolConfigs(t *testing.T) {
+	configs := nvlist.New()
+	configs.Add("zroot", poolConfig(t, "zroot", 2, PoolStateActive, vdevStateDegraded, 0))
+	configs.Add("tank", poolConfig(t, "tank", 1, PoolStateActive, vdevStateHealthy, 0))
+	configs.Add("broken", poolConfig(t, "broken", 3, PoolStateActive, vdevStateCantOpen, vdevAuxCorruptData))
+
+	pools, err := parsePoolConfigs(pack(t, configs))
+	if err != nil {
+		t.Fatalf("parsePoolConfigs() error = %v", err)
+	}
+
+	want := []PoolInfo{
+		{Name: "broken", GUID: 3, Health: "FAULTED", State: "ACTIVE"},
+		{Name: "tank", GUID: 1, Health: "ONLINE", State: "ACTIVE"},
+		{Name: "zroot", GUID: 2, Health: "DEGRADED", State: "ACTIVE"},
+	}
+	if len(pools) != len(want) {
+		t.Fatalf("parsePoolConfigs() = %+v, want %+v", pools, want)
+	}
+	for i := range want {
+		if pools[i] != want[i] {
+			t.Errorf("pool %d = %+v, want %+v", i, pools[i], want[i])
+		}
+	}
+
+	bad := nvlist.New()
+	bad.Add("tank", "not a config")
+	if _, err := parsePoolConfigs(pack(t, bad)); err == nil {
+		t.Error("parsePoolConfigs() accepted a non-nvlist config")
+	}
+}
+
+func TestVdevStateName(t *testing.T) {
+	tests := []struct {
+		state, aux uint64
+		want       string
+	}{
+		{vdevStateHealthy, 0, "ONLINE"},
+		{vdevStateDegraded, 0, "DEGRADED"},
+		{vdevStateFaulted, 0, "FAULTED"},
+		{vdevStateCantOpen, 0, "UNAVAIL"},
+		{vdevStateCantOpen, vdevAuxBadLog, "FAULTED"},
+		{vdevStateCantOpen, vdevAuxSplitPool, "SPLIT"},
+		{vdevStateRemoved, 0, "REMOVED"},
+		{vdevStateOffline, 0, "OFFLINE"},
+		{vdevStateClosed, 0, "OFFLINE"},
+		{vdevStateUnknown, 0, "UNKNOWN"},
+	}
+
+	for _, test := range tests {
+		if got := vdevStateName(test.state, test.aux); got != test.want {
+			t.Errorf("vdevStateName(%d, %d) = %q, want %q", test.state, test.aux, got, test.want)
+		}
+	}
+}
+
+func TestNiceNum(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0"},
+		{1023, "1023"},
+		{1024, "1K"},
+		{1536, "1.50K"},
+		{128 << 10, "128K"},
+		{100*(1<<20) + 1, "100M"},
+		{10*(1<<30) + 1<<29, "10.5G"},
+		{1 << 60, "1E"},
+	}
+
+	for _, test := range tests {
+		if got := niceNum(test.n); got != test.want {
+			t.Errorf("niceNum(%d) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestCompressionName(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		want string
+	}{
+		{1, "on"},
+		{2, "off"},
+		{15, "lz4"},
+		{13, "gzip-9"},
+		{zioCompressZstd, "zstd"},
+		{3<<zfsCompressLevelShift | zioCompressZstd, "zstd"},
+		{19<<zfsCompressLevelShift | zioCompressZstd, "zstd-19"},
+		{1001<<zfsCompressLevelShift | zioCompressZstd, "zstd-fast-1"},
+		{1021<<zfsCompressLevelShift | zioCompressZstd, "zstd-fast-1000"},
+		{99, "99"},
+	}
+
+	for _, test := range tests {
+		if got := compressionName(test.v); got != test.want {
+			t.Errorf("compressionName(%d) = %q, want %q", test.v, got, test.want)
+		}
+	}
+}
+
+func TestParsePoolProps(t *testing.T) {
+	props := nvlist.New()
+	props.Add(PropNameSize, propEntry(t, uint64(10<<30), uint64(zpropSourceNone)))
+	props.Add(PropNameCapacity, propEntry(t, uint64(42), uint64(zpropSourceNone)))
+	props.Add(PropNameHealth, propEntry(t, uint64(vdevStateHealthy), uint64(zpropSourceNone)))
+	props.Add(PropNameGuid, propEntry(t, uint64(1234), uint64(zpropSourceNone)))
+	props.Add("fragmentation", propEntry(t, uint64(noLimit), uint64(zpropSourceNone)))
+	props.Add("expandsize", propEntry(t, uint64(0), uint64(zpropSourceNone)))
+	props.Add("dedupratio", propEntry(t, uint64(150), uint64(zpropSourceNone)))
+	props.Add("comment", propEntry(t, "hello", uint64(zpropSourceLocal)))
+	props.Add("failmode", propEntry(t, uint64(1), uint64(zpropSourceLocal)))
+	props.Add("autotrim", propEntry(t, uint64(1), uint64(zpropSourceLocal)))
+
+	features := nvlist.New()
+	features.Add("com.delphix:async_destroy", uint64(0))
+	features.Add("org.illumos:lz4_compress", uint64(3))
+
+	got, err := parsePoolProps("tank", pack(t, props), features, nil)
+	if err != nil {
+		t.Fatalf("parsePoolProps() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		raw    any
+		source PropSource
+	}{
+		{PropNameSize, "10G", uint64(10 << 30), PropSourceNone},
+		{"cap", "", nil, 0},
+		{PropNameCapacity, "42%", uint64(42), PropSourceNone},
+		{PropNameHealth, "ONLINE", "ONLINE", PropSourceNone},
+		{PropNameGuid, "1234", uint64(1234), PropSourceNone},
+		{"fragmentation", "-", uint64(noLimit), PropSourceNone},
+		{"expandsize", "-", uint64(0), PropSourceNone},
+		{"dedupratio", "1.50x", uint64(150), PropSourceNone},
+		{"comment", "hello", "hello", PropSourceLocal},
+		{"failmode", "continue", "continue", PropSourceLocal},
+		{"autotrim", "on", true, PropSourceLocal},
+		{"autoexpand", "off", false, PropSourceDefault},
+		{PropNameVersion, "-", "-", PropSourceDefault},
+		{"feature@async_destroy", "enabled", "enabled", PropSourceLocal},
+		{"feature@lz4_compress", "active", "active", PropSourceLocal},
+		{"feature@draid", "disabled", "disabled", PropSourceDefault},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prop, ok := got[test.name]
+			if test.value == "" {
+				if ok {
+					t.Errorf("alias %s reported when listing all properties", test.name)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("property %q missing", test.name)
+			}
+			if prop.Value != test.value || prop.Raw != test.raw || prop.Source != test.source {
+				t.Errorf("%s = %v/%#v (%v), want %v/%#v (%v)",
+					test.name, prop.Value, prop.Raw, prop.Source, test.value, test.raw, test.source)
+			}
+		})
+	}
+
+	got, err = parsePoolProps("tank", pack(t, props), nil, []string{"cap", "feature@lz4_compress"})
+	if err != nil {
+		t.Fatalf("parsePoolProps() error = %v", err)
+	}
+	if len(got) != 1 || got["cap"].Value != "42%" {
+		t.Errorf("parsePoolProps(cap) = %v", got)
+	}
+
+	for _, name := range []string{"bogus", "feature@bogus"} {
+		if _, err := parsePoolProps("tank", pack(t, props), nil, []string{name}); !zfserrors.IsUnknownProperty(err) {
+			t.Errorf("parsePoolProps(%s) error = %v, want unknown property", name, err)
+		}
+	}
+	if _, err := parsePoolProps("tank", []byte{1, 2}, nil, nil); err == nil {
+		t.Error("parsePoolProps() accepted invalid data")
+	}
+}
+
+func TestMapPropSource(t *testing.T) {
+	tests := []struct {
+		src  uint64
+		want PropSource
+	}{
+		{zpropSourceNone, PropSourceNone},
+		{zpropSourceDefault, PropSourceDefault},
+		{zpropSourceLocal, PropSourceLocal},
+		{zpropSourceInherited, PropSourceInherited},
+		{zpropSourceTemporary, PropSourceTemporary},
+		{zpropSourceReceived, PropSourceReceived},
+	}
+
+	for _, test := range tests {
+		if got := mapPropSource(test.src); got != test.want {
+			t.Errorf("mapPropSource(%#x) = %v, want %v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestParseDatasetProps(t *testing.T) {
+	props := nvlist.New()
+	props.Add("used", propEntry(t, uint64(1536), nil))
+	props.Add("available", propEntry(t, uint64(5<<30), nil))
+	props.Add("referenced", propEntry(t, uint64(1<<20), nil))
+	props.Add("compressratio", propEntry(t, uint64(205), nil))
+	props.Add("quota", propEntry(t, uint64(1<<30), "tank/home"))
+	props.Add("compression", propEntry(t, uint64(15), "tank"))
+	props.Add("recordsize", propEntry(t, uint64(1<<20), zpropSourceValRecvd))
+	props.Add("mountpoint", propEntry(t, "/home", "tank/home"))
+	props.Add("atime", propEntry(t, uint64(0), "tank/home/alice"))
+	props.Add("snapshot_limit", propEntry(t, uint64(10), "tank/home/alice"))
+
+	recvd := nvlist.New()
+	recvd.Add("recordsize", propEntry(t, uint64(1<<20), nil))
+	recvd.Add("atime", propEntry(t, uint64(1), nil))
+
+	extra := map[string]any{"type": "filesystem", "casesensitivity": uint64(2)}
+	names := []string{
+		PropNameUsed, PropNameAvail, PropNameRefer, PropNameCompressratio, PropNameQuota,
+		PropNameReservation, PropNameCompression, PropNameRecordsize, PropNameMountpoint,
+		"atime", "checksum", "filesystem_limit", "snapshot_limit", "type", "casesensitivity",
+	}
+	got, err := parseDatasetProps("tank/home/alice", DatasetFilesystem, pack(t, props), pack(t, recvd), extra, names)
+	if err != nil {
+		t.Fatalf("parseDatasetProps() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		value         string
+		source        PropSource
+		inheritedFrom string
+		received      any
+	}{
+		{PropNameUsed, "1.50K", PropSourceNone, "", nil},
+		{PropNameAvail, "5G", PropSourceNone, "", nil},
+		{PropNameRefer, "1M", PropSourceNone, "", nil},
+		{PropNameCompressratio, "2.05x", PropSourceNone, "", nil},
+		{PropNameQuota, "1G", PropSourceInherited, "tank/home", nil},
+		{PropNameReservation, "none", PropSourceDefault, "", nil},
+		{PropNameCompression, "lz4", PropSourceInherited, "tank", nil},
+		{PropNameRecordsize, "1M", PropSourceReceived, "", "1M"},
+		{PropNameMountpoint, "/home/alice", PropSourceInherited, "tank/home", nil},
+		{"atime", "off", PropSourceLocal, "", "on"},
+		{"checksum", "on", PropSourceDefault, "", nil},
+		{"filesystem_limit", "none", PropSourceDefault, "", nil},
+		{"snapshot_limit", "10", PropSourceLocal, "", nil},
+		{"type", "filesystem", PropSourceNone, "", nil},
+		{"casesensitivity", "mixed", PropSourceNone, "", nil},
+	}
+
+	if len(got) != len(tests) {
+		t.Errorf("parseDatasetProps() returned %d properties, want %d", len(got), len(tests))
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, ok := got[test.name]
+			if !ok {
+				t.Fatalf("property %s missing", test.name)
+			}
+			if info.Name != test.name {
+				t.Errorf("Name = %q, want %q", info.Name, test.name)
+			}
+			if info.Value != test.value {
+				t.Errorf("Value = %v, want %q", info.Value, test.value)
+			}
+			if info.Source != test.source {
+				t.Errorf("Source = %v, want %v", info.Source, test.source)
+			}
+			if info.Received != (test.source == PropSourceReceived) {
+				t.Errorf("Received = %v", info.Received)
+			}
+			if info.InheritedFrom != test.inheritedFrom {
+				t.Errorf("InheritedFrom = %q, want %q", info.InheritedFrom, test.inheritedFrom)
+			}
+			if info.ReceivedValue != test.received {
+				t.Errorf("ReceivedValue = %v, want %v", info.ReceivedValue, test.received)
+			}
+		})
+	}
+
+	raw := map[string]any{
+		PropNameUsed:          uint64(1536),
+		PropNameCompressratio: uint64(205),
+		PropNameReservation:   uint64(0),
+		PropNameCompression:   "lz4",
+		PropNameMountpoint:    "/home/alice",
+		"atime":               false,
+		"filesystem_limit":    uint64(noLimit),
+		"casesensitivity":     "mixed",
+	}
+	for name, want := range raw {
+		if got[name].Raw != want {
+			t.Errorf("%s Raw = %#v, want %#v", name, got[name].Raw, want)
+		}
+	}
+
+	vol, err := parseDatasetProps("tank/vol", DatasetVolume, pack(t, props), nil, nil, []string{PropNameMountpoint, PropNameUsed})
+	if err != nil {
+		t.Fatalf("parseDatasetProps() error = %v", err)
+	}
+	if _, ok := vol[PropNameMountpoint]; ok {
+		t.Error("volume reported a mountpoint")
+	}
+	if len(vol) != 1 {
+		t.Errorf("parseDatasetProps(volume) = %v", vol)
+	}
+
+	_, err = parseDatasetProps("tank/home", DatasetFilesystem, pack(t, props), nil, nil, []string{PropNameUsed, "bogus"})
+	if !zfserrors.IsUnknownProperty(err) {
+		t.Errorf("parseDatasetProps(bogus) error = %v, want unknown property", err)
+	}
+}
+
+func TestParseDatasetProps_All(t *testing.T) {
+	props := nvlist.New()
+	props.Add("used", propEntry(t, uint64(1536), nil))
+	props.Add("volsize", propEntry(t, uint64(1<<30), "tank/vol"))
+
+	got, err := parseDatasetProps("tank/vol", DatasetVolume, pack(t, props), nil, map[string]any{"type": "volume"}, nil)
+	if err != nil {
+		t.Fatalf("parseDatasetProps() error = %v", err)
+	}
+
+	want := map[string]string{
+		"used":         "1.50K",
+		"volsize":      "1G",
+		"volblocksize": "16K",
+		"type":         "volume",
+		"volmode":      "default",
+		"snapdev":      "hidden",
+	}
+	for name, value := range want {
+		if got[name].Value != value {
+			t.Errorf("%s = %q, want %q", name, got[name].Value, value)
+		}
+	}
+	for _, name := range []string{PropNameMountpoint, "recordsize", "atime", "available"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("volume reported %s", name)
+		}
+	}
+	for name := range got {
+		if !DatasetPropApplies(name, DatasetVolume) {
+			t.Errorf("property %s does not apply to volumes", name)
+		}
+	}
+}
+
+func TestObjsetExtraProps(t *testing.T) {
+	zpl := nvlist.New()
+	zpl.Add("version", uint64(5))
+	zpl.Add("normalization", uint64(0x50))
+
+	stats := dmuObjsetStats{objsetType: dmuOstZFS, origin: "tank/a@s"}
+	extra := objsetExtraProps("tank/b", stats, pack(t, zpl))
+
+	want := map[string]any{
+		"name":          "tank/b",
+		"type":          "filesystem",
+		"origin":        "tank/a@s",
+		"version":       uint64(5),
+		"normalization": uint64(0x50),
+	}
+	if len(extra) != len(want) {
+		t.Errorf("objsetExtraProps() = %v, want %v", extra, want)
+	}
+	for name, value := range want {
+		if extra[name] != value {
+			t.Errorf("%s = %v, want %v", name, extra[name], value)
+		}
+	}
+
+	snap := objsetExtraProps("tank/b@s", dmuObjsetStats{objsetType: dmuOstZFS, isSnapshot: true}, nil)
+	if len(snap) != 2 || snap["type"] != "snapshot" {
+		t.Errorf("objsetExtraProps(snapshot) = %v", snap)
+	}
+}
+
+func TestMountpointValue(t *testing.T) {
+	tests := []struct {
+		dataset  string
+		raw      any
+		setpoint string
+		source   PropSource
+		want     string
+	}{
+		{"tank/a/b", nil, "", PropSourceDefault, "/tank/a/b"},
+		{"tank/a", "/data", "tank/a", PropSourceLocal, "/data"},
+		{"tank/a/b", "/data", "tank/a", PropSourceInherited, "/data/b"},
+		{"tank/a/b", "/", "tank", PropSourceInherited, "/a/b"},
+		{"tank/a/b", "legacy", "tank", PropSourceInherited, "legacy"},
+		{"tank/a/b", "none", "tank", PropSourceInherited, "none"},
+	}
+
+	for _, test := range tests {
+		if got := mountpointValue(test.dataset, test.raw, test.setpoint, test.source); got != test.want {
+			t.Errorf("mountpointValue(%q, %v, %q) = %q, want %q", test.dataset, test.raw, test.setpoint, got, test.want)
+		}
+	}
+}
+
+func TestParseDatasetProps_UserProps(t *testing.T) {
+	props := nvlist.New()
+	props.Add("used", propEntry(t, uint64(1536), nil))
+	props.Add("com.example:owner", propEntry(t, "ops", "tank"))
+	props.Add("com.example:tier", propEntry(t, "gold", "tank/home"))
+	props.Add("com.example:backup", propEntry(t, "daily", zpropSourceValRecvd))
+
+	recvd := nvlist.New()
+	recvd.Add("com.example:backup", propEntry(t, "daily", nil))
+
+	tests := []struct {
+		name          string
+		value         string
+		source        PropSource
+		inheritedFrom string
+		received      any
+	}{
+		{"com.example:owner", "ops", PropSourceInherited, "tank", nil},
+		{"com.example:tier", "gold", PropSourceLocal, "", nil},
+		{"com.example:backup", "daily", PropSourceReceived, "", "daily"},
+	}
+
+	got, err := parseDatasetProps("tank/home", DatasetFilesystem, pack(t, props), pack(t, recvd), nil,
+		[]string{"com.example:owner", "com.example:tier", "com.example:backup", "com.example:unset"})
+	if err != nil {
+		t.Fatalf("parseDatasetProps() error = %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prop, ok := got[test.name]
+			if !ok {
+				t.Fatalf("property %q missing", test.name)
+			}
+			if prop.Value != test.value || prop.Raw != test.value || prop.Source != test.source {
+				t.Errorf("%s = %v/%v (%v), want %v (%v)", test.name, prop.Value, prop.Raw, prop.Source, test.value, test.source)
+			}
+			if prop.InheritedFrom != test.inheritedFrom || prop.ReceivedValue != test.received {
+				t.Errorf("%s inherited from %q received %v, want %q %v",
+					test.name, prop.InheritedFrom, prop.ReceivedValue, test.inheritedFrom, test.received)
+			}
+		})
+	}
+	if _, ok := got["com.example:unset"]; ok {
+		t.Error("unset user property reported")
+	}
+
+	all, err := parseDatasetProps("tank/home", DatasetFilesystem, pack(t, props), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("parseDatasetProps() error = %v", err)
+	}
+	for _, test := range tests {
+		if _, ok := all[test.name]; !ok {
+			t.Errorf("all properties missing %s", test.name)
+		}
+	}
+}
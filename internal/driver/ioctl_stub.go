@@ -0,0 +1,11 @@
+//go:build !freebsd
+
+package driver
+
+// ioctlBuilt reports whether the ioctl driver is compiled in
+const ioctlBuilt = false
+
+// NewIoctl returns a stub driver, /dev/zfs ioctls are only issued on FreeBSD
+func NewIoctl() (Driver, error) {
+	return &stubDriver{}, nil
+}
@@ -1,4 +1,4 @@
-//go:build freebsd && !no_libzfs
+//go:build freebsd && cgo && !no_libzfs
 
 package driver
 
@@ -50,13 +50,36 @@ extern int go_get_zfs_prop_recordsize();
 extern int go_get_zfs_prop_mountpoint();
 extern int go_get_zfs_prop_compression();
 
+// Property name resolution
+extern int go_zfs_name_to_prop(char* name);
+extern int go_zfs_prop_valid_for_type(int prop, zfs_handle_t* zhp);
+extern int go_zpool_name_to_prop(char* name);
+
 // Property retrieval
 extern int go_get_zpool_property(zpool_handle_t* zhp, int prop, char* buf, size_t len);
 extern int go_get_zfs_property(zfs_handle_t* zhp, int prop, char* buf, size_t len);
+extern int go_zpool_get_prop(zpool_handle_t* zhp, zpool_prop_t prop, char* buf, size_t len,
+                             zprop_source_t* src, boolean_t literal);
+extern int go_zfs_get_prop(zfs_handle_t* zhp, zfs_prop_t prop, char* buf, size_t len,
+                           zprop_source_t* src, char* statbuf, size_t statlen, boolean_t literal);
+extern int go_zpool_get_config_packed(zpool_handle_t* zhp, char** buf, size_t* size);
+extern int go_zpool_get_history_packed(zpool_handle_t* zhp, uint64_t* off, boolean_t* eof, char** buf, size_t* size);
+extern int go_zpool_prop_get_feature(zpool_handle_t* zhp, char* propname, char* buf, size_t len);
+extern int go_zfeature_count(void);
+extern const char* go_zfeature_name(int index, boolean_t* supported);
+extern uint64_t go_zpool_get_prop_int(zpool_handle_t* zhp, int prop);
+extern int go_zpool_set_prop(zpool_handle_t* zhp, char* propname, char* propval);
+extern int go_zfs_prop_get_recvd(zfs_handle_t* zhp, char* name, char* buf, size_t len);
+extern int go_zfs_prop_get_numeric(zfs_handle_t* zhp, int prop, uint64_t* value);
+extern int go_zfs_get_user_props_packed(zfs_handle_t* zhp, char** buf, size_t* size);
+extern int go_zfs_prop_inherit(zfs_handle_t* zhp, char* propname, boolean_t received, boolean_t recursive);
 
 // Pool configuration and status
 extern void* go_zpool_get_config(zpool_handle_t* zhp, void** oldconfig);
 extern int go_zpool_scan(zpool_handle_t* zhp, int func, int cmd);
+extern int go_zpool_wait_status(zpool_handle_t* zhp, int activity, boolean_t* missing, boolean_t* waited);
+extern int go_zpool_checkpoint(zpool_handle_t* zhp);
+extern int go_zpool_discard_checkpoint(zpool_handle_t* zhp);
 
 // Nvlist helpers
 extern int go_nvlist_lookup_nvlist(void* nvl, char* name, void** val);
@@ -64,29 +87,20 @@ extern int go_nvlist_lookup_nvlist_array(void* nvl, char* name, void*** val, uns
 extern int go_nvlist_lookup_string(void* nvl, char* name, char** val);
 extern int go_nvlist_lookup_uint64(void* nvl, char* name, uint64_t* val);
 
-// Scan status structure
-struct scan_info {
-    uint64_t func;
-    uint64_t state;
-    uint64_t start_time;
-    uint64_t end_time;
-    uint64_t examined;
-    uint64_t to_examine;
-    uint64_t processed;
-    uint64_t to_process;
-    uint64_t errors;
-    uint64_t pass_examined;
-    uint64_t pass_start;
-};
-
-extern int go_get_scan_status(void* nvroot, struct scan_info* scan);
-
 // Pool operations
 extern int go_zpool_import(libzfs_handle_t* hdl, void* config, char* newname, char* altroot);
 extern int go_zpool_export(zpool_handle_t* zhp, int force, char* message);
 extern int go_zpool_export_force(zpool_handle_t* zhp);
-extern void* go_zpool_find_import(libzfs_handle_t* hdl, int argc, char** argv, int do_destroyed, char** poolname);
+extern int go_zpool_import_props(libzfs_handle_t* hdl, void* config, char* newname, void* props, int flags);
+extern void* go_zpool_find_import(libzfs_handle_t* hdl, int argc, char** argv, char* cachefile,
+                                  char* poolname, uint64_t guid, void* policy, char* errbuf, size_t errlen);
+extern void* go_zpool_load_policy(uint32_t rewind, uint64_t txg);
+extern int go_zpool_add_load_policy(void* config, void* policy);
+extern int go_zpool_import_dry_run(libzfs_handle_t* hdl, void* config, int flags, char** buf, size_t* size);
+extern void* go_nvlist_nvlist_at(void* nvl, int index);
+extern int go_nvlist_pack(void* nvl, char** buf, size_t* size);
 extern int go_zpool_create(libzfs_handle_t* hdl, char* poolname, void* nvroot, void* props, void* fsprops);
+extern int go_zpool_split(zpool_handle_t* zhp, char* newname, void* newroot, void* props, int dryrun, int import, char** buf, size_t* size);
 extern int go_zpool_destroy(zpool_handle_t* zhp, char* message);
 
 // Dataset operations
@@ -101,6 +115,7 @@ extern int go_get_zfs_type_snapshot();
 
 // Property setting
 extern int go_zfs_prop_set(zfs_handle_t* zhp, char* propname, char* propval);
+extern int go_zfs_prop_set_list(zfs_handle_t* zhp, void* props);
 
 // Snapshot operations
 extern int go_zfs_snapshot(libzfs_handle_t* hdl, char* path, int recursive, void* props);
@@ -135,9 +150,12 @@ extern int go_zpool_attach(zpool_handle_t* zhp, char* old_disk, char* new_disk,
 extern int go_zpool_detach(zpool_handle_t* zhp, char* path);
 extern int go_zpool_replace(zpool_handle_t* zhp, char* old_disk, char* new_disk, void* props);
 extern int go_zpool_remove(zpool_handle_t* zhp, char* path);
+extern int go_zpool_remove_cancel(zpool_handle_t* zhp);
 extern int go_zpool_online(zpool_handle_t* zhp, char* path, int flags, int* newstate);
 extern int go_zpool_offline(zpool_handle_t* zhp, char* path, int istmp);
 extern int go_zpool_clear(zpool_handle_t* zhp, char* path, void* rewind_policy);
+extern int go_zpool_initialize(zpool_handle_t* zhp, int cmd, char** devices, int count);
+extern int go_zpool_trim(zpool_handle_t* zhp, int cmd, char** devices, int count, boolean_t secure, uint64_t rate);
 
 // Pool handle operations
 extern zpool_handle_t* go_zpool_open(libzfs_handle_t* hdl, char* name);
@@ -146,6 +164,8 @@ extern void go_zpool_close(zpool_handle_t* zhp);
 // Vdev creation helpers
 extern void* go_create_mirror_vdev(void** children, unsigned int child_count);
 extern void* go_create_raidz_vdev(void** children, unsigned int child_count, int parity);
+extern void* go_create_draid_vdev(void** children, unsigned int child_count, uint64_t nparity,
+    uint64_t ndata, uint64_t nspares, uint64_t ngroups);
 
 // Vdev state constants
 extern int go_get_vdev_state_offline();
@@ -167,12 +187,14 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"unsafe"
 
 	// Import the cgo package to link its C code
 	_ "github.com/zombocoder/go-freebsd-libzfs/internal/cgo"
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
 )
 
 // libzfsDriver implements the Driver interface using FreeBSD's libzfs
@@ -181,6 +203,9 @@ type libzfsDriver struct {
 	h  *C.libzfs_handle_t
 }
 
+// libzfsBuilt reports whether the libzfs driver is compiled in
+const libzfsBuilt = true
+
 // NewLibZFS creates a new libzfs-backed driver
 func NewLibZFS() (Driver, error) {
 	h := C.go_libzfs_init()
@@ -295,44 +320,60 @@ func (d *libzfsDriver) GetPoolProps(ctx context.Context, poolName string, propNa
 	}
 	defer C.zpool_close(zhp)
 
+	// If no specific properties requested, get every native property and
+	// the state of every known feature
+	if len(propNames) == 0 {
+		propNames = PoolPropNames()
+	}
+
 	properties := make(map[string]PropertyInfo)
+	buf := make([]byte, 1024) // ZFS_MAXPROPLEN
 
-	// Map of property names to their C constants
-	propMap := map[string]func() C.int{
-		PropNameSize:      func() C.int { return C.go_get_zpool_prop_size() },
-		PropNameCapacity:  func() C.int { return C.go_get_zpool_prop_capacity() },
-		PropNameHealth:    func() C.int { return C.go_get_zpool_prop_health() },
-		PropNameGuid:      func() C.int { return C.go_get_zpool_prop_guid() },
-		PropNameVersion:   func() C.int { return C.go_get_zpool_prop_version() },
-		PropNameFree:      func() C.int { return C.go_get_zpool_prop_free() },
-		PropNameAllocated: func() C.int { return C.go_get_zpool_prop_allocated() },
-	}
+	for _, propName := range propNames {
+		cPropName := C.CString(propName)
+		if IsPoolFeatureProp(propName) {
+			if _, known := PoolFeatureGUID(propName); !known {
+				C.free(unsafe.Pointer(cPropName))
+				return nil, UnknownPropertyError(poolName, propName)
+			}
+			// Features this libzfs does not know about are left out
+			ret := C.go_zpool_prop_get_feature(zhp, cPropName, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+			C.free(unsafe.Pointer(cPropName))
+			if ret == 0 {
+				state := C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
+				properties[propName] = PropertyInfo{Name: propName, Value: state, Raw: state, Source: FeatureSource(state)}
+			}
+			continue
+		}
 
-	// If no specific properties requested, get all known properties
-	if len(propNames) == 0 {
-		for propName := range propMap {
-			propNames = append(propNames, propName)
+		prop := C.go_zpool_name_to_prop(cPropName)
+		C.free(unsafe.Pointer(cPropName))
+		if prop < 0 {
+			return nil, UnknownPropertyError(poolName, propName)
 		}
-	}
 
-	// Retrieve each requested property
-	for _, propName := range propNames {
-		if propFunc, exists := propMap[propName]; exists {
-			propValue := propFunc()
-			buf := make([]byte, 1024)
-			ret := C.go_get_zpool_property(zhp, propValue, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+		var src C.zprop_source_t
+		ret := C.go_zpool_get_prop(zhp, C.zpool_prop_t(prop), (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)), &src, C.B_FALSE)
+		if ret != 0 {
+			continue
+		}
 
-			if ret == 0 {
-				// Successfully retrieved property
-				value := C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
-				properties[propName] = PropertyInfo{
-					Name:     propName,
-					Value:    value,
-					Source:   PropSourceLocal, // TODO: Get actual source
-					Received: false,
-				}
+		info := PropertyInfo{
+			Name:   propName,
+			Value:  C.GoString((*C.char)(unsafe.Pointer(&buf[0]))),
+			Source: mapPropSource(uint64(src)),
+		}
+		info.Raw = info.Value
+		if canonical, ok := CanonicalPoolProp(propName); ok {
+			switch poolPropTable[canonical].kind() {
+			case PropKindNumber, PropKindBytes, PropKindRatio:
+				info.Raw = uint64(C.go_zpool_get_prop_int(zhp, prop))
+			case PropKindBool:
+				info.Raw = info.Value == "on"
 			}
 		}
+		info.Received = info.Source == PropSourceReceived
+		properties[propName] = info
 	}
 
 	return properties, nil
@@ -492,61 +533,574 @@ func (d *libzfsDriver) GetDatasetProps(ctx context.Context, datasetName string,
 	}
 	defer C.zfs_close(zhp)
 
-	properties := make(map[string]PropertyInfo)
-
-	// Map of property names to their C constants
-	propMap := map[string]func() C.int{
-		PropNameUsed:          func() C.int { return C.go_get_zfs_prop_used() },
-		PropNameAvail:         func() C.int { return C.go_get_zfs_prop_available() },
-		PropNameRefer:         func() C.int { return C.go_get_zfs_prop_referenced() },
-		PropNameCompressratio: func() C.int { return C.go_get_zfs_prop_compressratio() },
-		PropNameQuota:         func() C.int { return C.go_get_zfs_prop_quota() },
-		PropNameReservation:   func() C.int { return C.go_get_zfs_prop_reservation() },
-		PropNameRecordsize:    func() C.int { return C.go_get_zfs_prop_recordsize() },
-		PropNameMountpoint:    func() C.int { return C.go_get_zfs_prop_mountpoint() },
-		PropNameCompression:   func() C.int { return C.go_get_zfs_prop_compression() },
+	userProps, err := d.userProps(zhp)
+	if err != nil {
+		return nil, err
 	}
 
-	// If no specific properties requested, get all known properties
+	// If no specific properties requested, get every native property of the
+	// dataset type and every user property set on it or its ancestors
 	if len(propNames) == 0 {
-		for propName := range propMap {
-			propNames = append(propNames, propName)
+		propNames = DatasetPropNames(mapDatasetType(int(C.go_zfs_get_type(zhp))))
+		propNames = append(propNames, userPropNames(userProps)...)
+	}
+
+	properties := make(map[string]PropertyInfo)
+	buf := make([]byte, 1024)           // ZFS_MAXPROPLEN
+	statbuf := make([]byte, maxNameLen) // setpoint of inherited values
+
+	receivedValue := func(propName string) (string, bool) {
+		cRecvdName := C.CString(propName)
+		defer C.free(unsafe.Pointer(cRecvdName))
+		if C.go_zfs_prop_get_recvd(zhp, cRecvdName, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) != 0 {
+			return "", false
 		}
+		return C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), true
 	}
 
-	// Retrieve each requested property
 	for _, propName := range propNames {
-		if propFunc, exists := propMap[propName]; exists {
-			propValue := propFunc()
-			buf := make([]byte, 1024)
-			ret := C.go_get_zfs_property(zhp, propValue, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
-
-			if ret == 0 {
-				// Successfully retrieved property
-				value := C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
-				properties[propName] = PropertyInfo{
-					Name:     propName,
-					Value:    value,
-					Source:   PropSourceLocal, // TODO: Get actual source
-					Received: false,
+		if IsUserProp(propName) {
+			if info, ok := userPropInfo(datasetName, propName, userProps, nvlist.New()); ok {
+				if value, ok := receivedValue(propName); ok {
+					info.ReceivedValue = value
 				}
+				properties[propName] = info
+			}
+			continue
+		}
+
+		cPropName := C.CString(propName)
+		prop := C.go_zfs_name_to_prop(cPropName)
+		C.free(unsafe.Pointer(cPropName))
+		if prop < 0 {
+			return nil, UnknownPropertyError(datasetName, propName)
+		}
+
+		// Valid properties that do not apply to this dataset type are left out
+		if C.go_zfs_prop_valid_for_type(prop, zhp) == 0 {
+			continue
+		}
+
+		var src C.zprop_source_t
+		statbuf[0] = 0
+		ret := C.go_zfs_get_prop(zhp, C.zfs_prop_t(prop), (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)),
+			&src, (*C.char)(unsafe.Pointer(&statbuf[0])), C.size_t(len(statbuf)), C.B_FALSE)
+		if ret != 0 {
+			// Not available for this dataset, e.g. origin of a non-clone
+			continue
+		}
+
+		info := PropertyInfo{
+			Name:   propName,
+			Value:  C.GoString((*C.char)(unsafe.Pointer(&buf[0]))),
+			Source: mapPropSource(uint64(src)),
+		}
+		info.Raw = info.Value
+		switch DatasetPropKind(propName) {
+		case PropKindNumber, PropKindBytes, PropKindRatio, PropKindDate:
+			var value C.uint64_t
+			if C.go_zfs_prop_get_numeric(zhp, prop, &value) == 0 {
+				info.Raw = uint64(value)
 			}
+		case PropKindBool:
+			info.Raw = info.Value == "on" || info.Value == "yes"
 		}
+		info.Received = info.Source == PropSourceReceived
+		if info.Source == PropSourceInherited {
+			// statbuf names the dataset the value was inherited from
+			info.InheritedFrom = C.GoString((*C.char)(unsafe.Pointer(&statbuf[0])))
+		}
+
+		if value, ok := receivedValue(propName); ok {
+			info.ReceivedValue = value
+		}
+
+		properties[propName] = info
 	}
 
 	return properties, nil
 }
 
-func (d *libzfsDriver) ImportPool(ctx context.Context, poolName string, opts ImportOptions) error {
+// userProps returns the user properties of a dataset, decoded from the
+// nvlist libzfs keeps for the handle
+func (d *libzfsDriver) userProps(zhp *C.zfs_handle_t) (*nvlist.List, error) {
+	var buf *C.char
+	var size C.size_t
+	if ret := C.go_zfs_get_user_props_packed(zhp, &buf, &size); ret != 0 {
+		return nil, fmt.Errorf("failed to pack user properties (errno %d)", ret)
+	}
+	defer C.free(unsafe.Pointer(buf))
+
+	props, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode user properties: %w", err)
+	}
+	return props, nil
+}
+
+func (d *libzfsDriver) GetPoolStatus(ctx context.Context, poolName string) (*PoolStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil, fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open_canfail(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return nil, fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	var buf *C.char
+	var size C.size_t
+	if ret := C.go_zpool_get_config_packed(zhp, &buf, &size); ret != 0 {
+		return nil, fmt.Errorf("failed to get config of pool %s (errno %d)", poolName, ret)
+	}
+	defer C.free(unsafe.Pointer(buf))
+
+	config, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pool config: %w", err)
+	}
+	return parsePoolStatus(poolName, config)
+}
+
+func (d *libzfsDriver) SetPoolProp(ctx context.Context, poolName, propName, propValue string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	if err := ValidatePoolProp(poolName, propName, propValue); err != nil {
+		return err
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	cPropName := C.CString(propName)
+	defer C.free(unsafe.Pointer(cPropName))
+	cPropValue := C.CString(propValue)
+	defer C.free(unsafe.Pointer(cPropValue))
+
+	if C.go_zpool_set_prop(zhp, cPropName, cPropValue) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to set property %s=%s on pool %s (errno %d): %s", propName, propValue, poolName, errno, desc)
+	}
+
+	return nil
+}
+
+func (d *libzfsDriver) ScrubPool(ctx context.Context, poolName string, opts ScrubOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	// zpool scrub -s stops both kinds of scrub with POOL_SCAN_NONE
+	fn, cmd := PoolScanScrub, PoolScrubNormal
+	if opts.ErrorScrub {
+		fn = PoolScanErrorScrub
+	}
+	switch opts.Command {
+	case ScrubStart:
+	case ScrubPause:
+		cmd = PoolScrubPause
+	case ScrubCancel:
+		fn = PoolScanNone
+	default:
+		return fmt.Errorf("unknown scrub command %d", opts.Command)
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	if C.go_zpool_scan(zhp, C.int(fn), C.int(cmd)) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to scrub pool %s (errno %d): %s", poolName, errno, desc)
+	}
+
+	return nil
+}
+
+func (d *libzfsDriver) CheckpointPool(ctx context.Context, poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	if C.go_zpool_checkpoint(zhp) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to checkpoint pool %s (errno %d): %s", poolName, errno, desc)
+	}
+
+	return nil
+}
+
+// DiscardCheckpoint starts discarding the checkpoint, which the kernel
+// finishes in the background
+func (d *libzfsDriver) DiscardCheckpoint(ctx context.Context, poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	if C.go_zpool_discard_checkpoint(zhp) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to discard checkpoint of pool %s (errno %d): %s", poolName, errno, desc)
+	}
+
+	return nil
+}
+
+// WaitPool blocks in the kernel until the activity is done. When ctx is
+// canceled first it returns right away, and the wait goroutine lingers
+// until the activity ends.
+func (d *libzfsDriver) WaitPool(ctx context.Context, poolName string, activity WaitActivity) (bool, error) {
+	d.mu.Lock()
+	closed := d.h == nil
+	d.mu.Unlock()
+
+	if closed {
+		return false, fmt.Errorf("driver closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	type result struct {
+		waited bool
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		waited, err := waitPoolActivity(poolName, activity)
+		done <- result{waited, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.waited, r.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// GetPoolHistory reads the history records of a pool from offset to the
+// end and returns the offset after the last one
+func (d *libzfsDriver) GetPoolHistory(ctx context.Context, poolName string, offset uint64) ([]HistoryRecord, uint64, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	if d.h == nil {
-		return fmt.Errorf("driver closed")
+	if d.h == nil {
+		return nil, 0, fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open_canfail(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return nil, 0, fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	var records []HistoryRecord
+	off := C.uint64_t(offset)
+	eof := C.boolean_t(C.B_FALSE)
+	for eof == C.B_FALSE {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		var buf *C.char
+		var size C.size_t
+		if ret := C.go_zpool_get_history_packed(zhp, &off, &eof, &buf, &size); ret != 0 {
+			errno, desc := d.getLibzfsError()
+			return nil, 0, fmt.Errorf("failed to get history of pool %s (errno %d): %s", poolName, errno, desc)
+		}
+		nvhis, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+		C.free(unsafe.Pointer(buf))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to decode pool history: %w", err)
+		}
+		records = append(records, parseHistoryRecords(nvhis)...)
+	}
+
+	return records, uint64(off), nil
+}
+
+// waitPoolActivity waits on a libzfs handle of its own, so that a wait
+// abandoned on cancellation neither holds d.mu nor outlives d.h
+func waitPoolActivity(poolName string, activity WaitActivity) (bool, error) {
+	h := C.go_libzfs_init()
+	if h == nil {
+		return false, fmt.Errorf("libzfs_init failed")
+	}
+	defer C.go_libzfs_fini(h)
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(h, poolNameC)
+	if zhp == nil {
+		return false, fmt.Errorf("failed to open pool %s (errno %d): %s", poolName,
+			int(C.go_libzfs_errno(h)), C.GoString(C.go_libzfs_error_description(h)))
+	}
+	defer C.zpool_close(zhp)
+
+	var missing, waited C.boolean_t
+	if C.go_zpool_wait_status(zhp, C.int(activity), &missing, &waited) != 0 {
+		return false, fmt.Errorf("failed to wait for %s on pool %s (errno %d): %s", activity, poolName,
+			int(C.go_libzfs_errno(h)), C.GoString(C.go_libzfs_error_description(h)))
+	}
+	if missing != C.B_FALSE {
+		return waited != C.B_FALSE, fmt.Errorf("pool %s was exported or destroyed while waiting", poolName)
+	}
+
+	return waited != C.B_FALSE, nil
+}
+
+func (d *libzfsDriver) DiscoverPools(ctx context.Context, opts DiscoverOptions) ([]ImportablePool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil, fmt.Errorf("driver closed")
+	}
+
+	found, pools, err := d.findImport(opts.SearchPaths, opts.CacheFile, opts.Pool, nil)
+	if err != nil {
+		return nil, err
+	}
+	C.go_nvlist_free(found)
+
+	return filterImportablePools(pools, opts), nil
+}
+
+func (d *libzfsDriver) ImportPool(ctx context.Context, poolName string, opts ImportOptions) (*RewindReport, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil, fmt.Errorf("driver closed")
+	}
+
+	rewind, txg, err := rewindPolicy(poolName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]string, len(opts.Properties)+3)
+	for name, value := range opts.Properties {
+		props[name] = value
+	}
+	if opts.AltRoot != "" {
+		// Like zpool import -R, keep the pool out of the default cachefile
+		props["altroot"] = opts.AltRoot
+		if _, ok := props["cachefile"]; !ok {
+			props["cachefile"] = "none"
+		}
+	}
+	if opts.ReadOnly {
+		props["readonly"] = "on"
+	}
+	for name, value := range props {
+		if err := ValidatePoolImportProp(poolName, name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Like zpool import, the policy applies to the search and the import
+	policy := C.go_zpool_load_policy(C.uint32_t(rewind), C.uint64_t(txg))
+	if policy == nil {
+		return nil, fmt.Errorf("failed to allocate load policy")
+	}
+	defer C.go_nvlist_free(policy)
+
+	found, pools, err := d.findImport(opts.SearchPaths, opts.CacheFile, poolName, policy)
+	if err != nil {
+		return nil, err
+	}
+	defer C.go_nvlist_free(found)
+
+	index, err := selectImportablePool(pools, poolName, opts.Destroyed)
+	if err != nil {
+		return nil, err
+	}
+	config := C.go_nvlist_nvlist_at(found, C.int(index))
+	if config == nil {
+		return nil, fmt.Errorf("failed to get config of pool %s", poolName)
+	}
+	if ret := C.go_zpool_add_load_policy(config, policy); ret != 0 {
+		return nil, fmt.Errorf("failed to add load policy to pool %s (errno %d)", poolName, ret)
+	}
+
+	flags := C.int(C.ZFS_IMPORT_NORMAL)
+	if opts.Force {
+		flags |= C.ZFS_IMPORT_ANY_HOST
+	}
+	if opts.MissingLog {
+		flags |= C.ZFS_IMPORT_MISSING_LOG
+	}
+	if opts.RewindToCheckpoint {
+		flags |= C.ZFS_IMPORT_CHECKPOINT
+	}
+	if opts.DryRun {
+		return d.rewindDryRun(poolName, &pools[index], config, flags)
+	}
+
+	propsNvlist, err := d.createPropsNvlist(props)
+	if err != nil {
+		return nil, err
+	}
+	defer d.freeNvlist(propsNvlist)
+
+	var newNameC *C.char
+	if opts.NewName != "" {
+		newNameC = C.CString(opts.NewName)
+		defer C.free(unsafe.Pointer(newNameC))
+	}
+
+	if C.go_zpool_import_props(d.h, config, newNameC, propsNvlist, flags) != 0 {
+		errno, desc := d.getLibzfsError()
+		return nil, fmt.Errorf("failed to import pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	return nil, nil
+}
+
+// rewindDryRun reports what rewinding a pool would discard, like zpool
+// import -F -n. The kernel imports a pool that opens at its latest txg even
+// on a dry run, so such pools are left alone.
+func (d *libzfsDriver) rewindDryRun(poolName string, pool *ImportablePool, config unsafe.Pointer, flags C.int) (*RewindReport, error) {
+	if canOpen(pool) {
+		return &RewindReport{}, nil
+	}
+
+	var buf *C.char
+	var size C.size_t
+	ret := C.go_zpool_import_dry_run(d.h, config, flags, &buf, &size)
+	if buf != nil {
+		defer C.free(unsafe.Pointer(buf))
+	}
+	if ret == 0 {
+		return &RewindReport{Imported: true}, nil
+	}
+
+	report := &RewindReport{Needed: true}
+	if size > 0 {
+		out, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode rewind of pool %s: %w", poolName, err)
+		}
+		report = parseRewindReport(out)
+	}
+	if !report.Possible {
+		return nil, fmt.Errorf("no txg to rewind pool %s to was found (errno %d)", poolName, ret)
+	}
+	return report, nil
+}
+
+// findImport scans for importable pools like zpool import does, only for
+// the pool named by nameOrGUID when it is set, loading them with the given
+// load policy. The returned nvlist holds the config of each pool in the same
+// order and must be freed by the caller.
+func (d *libzfsDriver) findImport(searchPaths []string, cacheFile, nameOrGUID string, policy unsafe.Pointer) (unsafe.Pointer, []ImportablePool, error) {
+	var argv **C.char
+	if len(searchPaths) > 0 {
+		paths := make([]*C.char, len(searchPaths))
+		for i, path := range searchPaths {
+			paths[i] = C.CString(path)
+			defer C.free(unsafe.Pointer(paths[i]))
+		}
+		argv = &paths[0]
+	}
+
+	var cacheFileC, poolNameC *C.char
+	if cacheFile != "" {
+		cacheFileC = C.CString(cacheFile)
+		defer C.free(unsafe.Pointer(cacheFileC))
+	}
+	name, guid := importFilter(nameOrGUID)
+	if name != "" {
+		poolNameC = C.CString(name)
+		defer C.free(unsafe.Pointer(poolNameC))
+	}
+
+	var errbuf [1024]C.char
+	found := C.go_zpool_find_import(d.h, C.int(len(searchPaths)), argv, cacheFileC, poolNameC,
+		C.uint64_t(guid), policy, &errbuf[0], C.size_t(len(errbuf)))
+	if found == nil {
+		return nil, nil, fmt.Errorf("failed to search for importable pools: %s", C.GoString(&errbuf[0]))
+	}
+
+	var buf *C.char
+	var size C.size_t
+	if ret := C.go_nvlist_pack(found, &buf, &size); ret != 0 {
+		C.go_nvlist_free(found)
+		return nil, nil, fmt.Errorf("failed to pack importable pool configs (errno %d)", ret)
 	}
+	defer C.free(unsafe.Pointer(buf))
 
-	// TODO: Implement pool import - requires complex nvlist handling
-	return fmt.Errorf("ImportPool not fully implemented yet")
+	list, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+	if err != nil {
+		C.go_nvlist_free(found)
+		return nil, nil, fmt.Errorf("failed to decode importable pool configs: %w", err)
+	}
+	pools, err := parseImportablePools(list)
+	if err != nil {
+		C.go_nvlist_free(found)
+		return nil, nil, err
+	}
+	return found, pools, nil
 }
 
 func (d *libzfsDriver) ExportPool(ctx context.Context, poolName string, opts ExportOptions) error {
@@ -588,7 +1142,7 @@ func (d *libzfsDriver) ExportPool(ctx context.Context, poolName string, opts Exp
 	return nil
 }
 
-func (d *libzfsDriver) CreatePool(ctx context.Context, poolName string, vdevs []string, opts CreateOptions) error {
+func (d *libzfsDriver) CreatePool(ctx context.Context, poolName string, vdevs []VdevSpec, opts CreateOptions) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -599,25 +1153,34 @@ func (d *libzfsDriver) CreatePool(ctx context.Context, poolName string, vdevs []
 	if len(vdevs) == 0 {
 		return fmt.Errorf("at least one vdev is required to create a pool")
 	}
+	if err := ValidateTopology(poolName, vdevs, opts.Force); err != nil {
+		return err
+	}
 
 	// Create pool name C string
 	cPoolName := C.CString(poolName)
 	defer C.free(unsafe.Pointer(cPoolName))
 
 	// Create vdev root with children using helper
-	nvroot, vdevList, err := d.createVdevRoot(vdevs)
+	nvroot, err := d.createVdevRoot(vdevs)
 	if err != nil {
 		return err
 	}
 	defer d.freeNvlist(nvroot)
 
+	// Features outside the compatibility feature-sets stay disabled
+	props := opts.Properties
+	if compatibility, ok := props[PropNameCompatibility]; ok {
+		allowed, err := d.loadCompatibility(compatibility)
+		if err != nil {
+			return err
+		}
+		props = CompatibilityCreateProps(props, allowed)
+	}
+
 	// Create pool properties nvlist
-	poolProps, err := d.createPropsNvlist(opts.Properties)
+	poolProps, err := d.createPropsNvlist(props)
 	if err != nil {
-		// Clean up vdev nvlists
-		for _, vdev := range vdevList {
-			d.freeNvlist(vdev)
-		}
 		return fmt.Errorf("failed to create pool properties: %w", err)
 	}
 	defer d.freeNvlist(poolProps)
@@ -625,22 +1188,12 @@ func (d *libzfsDriver) CreatePool(ctx context.Context, poolName string, vdevs []
 	// Create filesystem properties nvlist
 	fsProps, err := d.createPropsNvlist(opts.FsProperties)
 	if err != nil {
-		// Clean up vdev nvlists
-		for _, vdev := range vdevList {
-			d.freeNvlist(vdev)
-		}
 		return fmt.Errorf("failed to create filesystem properties: %w", err)
 	}
 	defer d.freeNvlist(fsProps)
 
 	// Create the pool
 	createRet := C.go_zpool_create(d.h, cPoolName, nvroot, poolProps, fsProps)
-
-	// Clean up vdev nvlists
-	for _, vdev := range vdevList {
-		d.freeNvlist(vdev)
-	}
-
 	if createRet != 0 {
 		errno := C.go_libzfs_errno(d.h)
 		desc := C.GoString(C.go_libzfs_error_description(d.h))
@@ -650,6 +1203,85 @@ func (d *libzfsDriver) CreatePool(ctx context.Context, poolName string, vdevs []
 	return nil
 }
 
+// SplitPool splits one side of every mirror of a pool off into a new pool,
+// like zpool split. On a dry run nothing changes and the vdev tree the new
+// pool would get is returned.
+func (d *libzfsDriver) SplitPool(ctx context.Context, poolName, newPoolName string, opts SplitOptions) (*VdevInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil, fmt.Errorf("driver closed")
+	}
+
+	props, err := SplitProps(newPoolName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return nil, fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	// Like zpool split, the named sides become single disk vdevs of a root;
+	// go_zpool_split frees it
+	var nvroot unsafe.Pointer
+	if len(opts.Devices) > 0 {
+		specs := make([]VdevSpec, len(opts.Devices))
+		for i, device := range SplitDevices(opts.Devices) {
+			specs[i] = VdevSpec{Devices: []string{device}}
+		}
+		if nvroot, err = d.createVdevRoot(specs); err != nil {
+			return nil, err
+		}
+	}
+
+	propsNvlist, err := d.createPropsNvlist(props)
+	if err != nil {
+		d.freeNvlist(nvroot)
+		return nil, fmt.Errorf("failed to create pool properties: %w", err)
+	}
+	defer d.freeNvlist(propsNvlist)
+
+	newNameC := C.CString(newPoolName)
+	defer C.free(unsafe.Pointer(newNameC))
+
+	var dryRun, doImport C.int
+	if opts.DryRun {
+		dryRun = 1
+	}
+	if opts.Import || opts.AltRoot != "" {
+		doImport = 1
+	}
+
+	var buf *C.char
+	var size C.size_t
+	ret := C.go_zpool_split(zhp, newNameC, nvroot, propsNvlist, dryRun, doImport, &buf, &size)
+	if buf != nil {
+		defer C.free(unsafe.Pointer(buf))
+	}
+	if ret != 0 {
+		errno, desc := d.getLibzfsError()
+		return nil, fmt.Errorf("failed to split pool %s into %s (errno %d): %s", poolName, newPoolName, errno, desc)
+	}
+	if !opts.DryRun {
+		return nil, nil
+	}
+
+	tree, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode vdev tree of pool %s: %w", newPoolName, err)
+	}
+	root := parseVdev(tree, VdevClassNormal)
+	return &root, nil
+}
+
 func (d *libzfsDriver) DestroyPool(ctx context.Context, poolName string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -755,6 +1387,82 @@ func (d *libzfsDriver) SetDatasetProp(ctx context.Context, datasetName, propName
 	return nil
 }
 
+func (d *libzfsDriver) SetDatasetProps(ctx context.Context, datasetName string, props map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver is closed")
+	}
+
+	zhp, err := d.openDatasetHandle(datasetName)
+	if err != nil {
+		return err
+	}
+	defer C.zfs_close(zhp)
+
+	dsType := mapDatasetType(int(C.go_zfs_get_type(zhp)))
+	if err := ValidateDatasetProps(datasetName, dsType, props); err != nil {
+		return err
+	}
+	if len(props) == 0 {
+		return nil
+	}
+
+	propsNvlist := C.go_nvlist_alloc()
+	if propsNvlist == nil {
+		return fmt.Errorf("failed to allocate properties nvlist")
+	}
+	defer C.go_nvlist_free(propsNvlist)
+
+	for key, value := range props {
+		cKey := C.CString(key)
+		cValue := C.CString(value)
+		ret := C.go_nvlist_add_string(propsNvlist, cKey, cValue)
+		C.free(unsafe.Pointer(cKey))
+		C.free(unsafe.Pointer(cValue))
+		if ret != 0 {
+			return fmt.Errorf("failed to add property %s to nvlist", key)
+		}
+	}
+
+	// libzfs reports the kernel's rejected properties through its error
+	// description only, so the batch fails as a whole here
+	ret := C.go_zfs_prop_set_list(zhp, propsNvlist)
+	if ret != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to set properties on dataset %s (errno %d): %s", datasetName, errno, desc)
+	}
+
+	return nil
+}
+
+func (d *libzfsDriver) InheritDatasetProp(ctx context.Context, datasetName, propName string, opts InheritOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	zhp, err := d.openDatasetHandle(datasetName)
+	if err != nil {
+		return err
+	}
+	defer C.zfs_close(zhp)
+
+	cPropName := C.CString(propName)
+	defer C.free(unsafe.Pointer(cPropName))
+
+	ret := C.go_zfs_prop_inherit(zhp, cPropName, C.boolean_t(btoc(opts.Received)), C.boolean_t(btoc(opts.Recursive)))
+	if ret != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to inherit property %s on dataset %s (errno %d): %s", propName, datasetName, errno, desc)
+	}
+
+	return nil
+}
+
 func (d *libzfsDriver) DestroyDataset(ctx context.Context, datasetName string, recursive bool) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -1169,8 +1877,8 @@ func (d *libzfsDriver) AddVdev(ctx context.Context, poolName string, vdevSpec Vd
 	}
 	defer C.go_zpool_close(zhp)
 
-	// Create vdev nvlist based on spec
-	vdevNvlist, err := d.createComplexVdevNvlist(vdevSpec)
+	// zpool_add takes a root vdev, like the one a pool is created from
+	vdevNvlist, err := d.createVdevRoot([]VdevSpec{vdevSpec})
 	if err != nil {
 		return fmt.Errorf("failed to create vdev specification: %w", err)
 	}
@@ -1336,12 +2044,40 @@ func (d *libzfsDriver) RemoveVdev(ctx context.Context, poolName, device string)
 	return nil
 }
 
-func (d *libzfsDriver) OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) error {
+// CancelRemoval stops the removal of a top-level vdev whose data is still
+// being copied off, like zpool remove -s
+func (d *libzfsDriver) CancelRemoval(ctx context.Context, poolName string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	if d.h == nil {
-		return fmt.Errorf("driver is closed")
+		return fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	if C.go_zpool_remove_cancel(zhp) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to cancel removal in pool %s (errno %d): %s", poolName, errno, desc)
+	}
+
+	return nil
+}
+
+func (d *libzfsDriver) OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return "", fmt.Errorf("driver is closed")
 	}
 
 	// Open the pool
@@ -1352,7 +2088,7 @@ func (d *libzfsDriver) OnlineVdev(ctx context.Context, poolName, device string,
 	if zhp == nil {
 		errno := C.go_libzfs_errno(d.h)
 		desc := C.GoString(C.go_libzfs_error_description(d.h))
-		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+		return "", fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
 	}
 	defer C.go_zpool_close(zhp)
 
@@ -1381,10 +2117,10 @@ func (d *libzfsDriver) OnlineVdev(ctx context.Context, poolName, device string,
 	if ret != 0 {
 		errno := C.go_libzfs_errno(d.h)
 		desc := C.GoString(C.go_libzfs_error_description(d.h))
-		return fmt.Errorf("failed to online vdev %s in pool %s (errno %d): %s", device, poolName, errno, desc)
+		return "", fmt.Errorf("failed to online vdev %s in pool %s (errno %d): %s", device, poolName, errno, desc)
 	}
 
-	return nil
+	return vdevStateName(uint64(newState), 0), nil
 }
 
 func (d *libzfsDriver) OfflineVdev(ctx context.Context, poolName, device string, temporary bool) error {
@@ -1462,18 +2198,77 @@ func (d *libzfsDriver) ClearVdev(ctx context.Context, poolName, device string) e
 	return nil
 }
 
+// InitializeVdevs starts, suspends or cancels writing to the unallocated
+// space of the named leaf vdevs, every leaf of the pool when none are named
+func (d *libzfsDriver) InitializeVdevs(ctx context.Context, poolName string, devices []string, cmd VdevActionCommand) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	devicesC, free := cStrings(devices)
+	defer free()
+
+	if C.go_zpool_initialize(zhp, C.int(cmd), devicesC, C.int(len(devices))) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to initialize vdevs of pool %s (errno %d): %s", poolName, errno, desc)
+	}
+
+	return nil
+}
+
+// TrimVdevs starts, suspends or cancels a manual TRIM of the named leaf
+// vdevs, every leaf of the pool that supports TRIM when none are named
+func (d *libzfsDriver) TrimVdevs(ctx context.Context, poolName string, devices []string, opts TrimOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	devicesC, free := cStrings(devices)
+	defer free()
+
+	if C.go_zpool_trim(zhp, C.int(opts.Command), devicesC, C.int(len(devices)),
+		C.boolean_t(btoc(opts.Secure)), C.uint64_t(opts.Rate)) != 0 {
+		errno, desc := d.getLibzfsError()
+		return fmt.Errorf("failed to trim vdevs of pool %s (errno %d): %s", poolName, errno, desc)
+	}
+
+	return nil
+}
+
 // Helper function to create complex vdev nvlist from specification
 func (d *libzfsDriver) createComplexVdevNvlist(spec VdevSpec) (unsafe.Pointer, error) {
-	switch spec.Type {
+	switch SpecType(spec) {
 	case VdevTypeDisk:
 		if len(spec.Devices) != 1 {
 			return nil, fmt.Errorf("disk vdev requires exactly 1 device, got %d", len(spec.Devices))
 		}
-		cPath := C.CString(spec.Devices[0])
-		defer C.free(unsafe.Pointer(cPath))
-		cType := C.CString("disk")
-		defer C.free(unsafe.Pointer(cType))
-		return C.go_create_vdev_nvlist(cType, cPath), nil
+		return d.createVdevNvlist(leafVdevType(spec.Devices[0]), spec.Devices[0])
 
 	case VdevTypeMirror:
 		if len(spec.Devices) < 2 {
@@ -1499,6 +2294,13 @@ func (d *libzfsDriver) createComplexVdevNvlist(spec VdevSpec) (unsafe.Pointer, e
 		}
 		return d.createRaidzVdev(spec.Devices, 3)
 
+	case VdevTypeDraid:
+		config, err := DraidLayout(spec)
+		if err != nil {
+			return nil, err
+		}
+		return d.createDraidVdev(spec.Devices, config)
+
 	default:
 		return nil, fmt.Errorf("unsupported vdev type: %s", spec.Type)
 	}
@@ -1506,62 +2308,62 @@ func (d *libzfsDriver) createComplexVdevNvlist(spec VdevSpec) (unsafe.Pointer, e
 
 func (d *libzfsDriver) createMirrorVdev(devices []string) (unsafe.Pointer, error) {
 	// Create device nvlists
-	deviceNvlists := make([]unsafe.Pointer, len(devices))
-	for i, device := range devices {
-		cDevice := C.CString(device)
-		cDiskType := C.CString("disk")
-		deviceNvlists[i] = C.go_create_vdev_nvlist(cDiskType, cDevice)
-		C.free(unsafe.Pointer(cDevice))
-		C.free(unsafe.Pointer(cDiskType))
-		if deviceNvlists[i] == nil {
-			// Clean up any previously created nvlists
-			for j := 0; j < i; j++ {
-				C.go_nvlist_free(deviceNvlists[j])
-			}
-			return nil, fmt.Errorf("failed to create nvlist for device %s", device)
-		}
+	deviceNvlists, err := d.createLeafNvlists(devices)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create mirror vdev
 	mirror := C.go_create_mirror_vdev((*unsafe.Pointer)(unsafe.Pointer(&deviceNvlists[0])), C.uint(len(devices)))
 
 	// Clean up device nvlists (they're copied into the mirror)
-	for _, nvl := range deviceNvlists {
-		C.go_nvlist_free(nvl)
-	}
+	d.freeNvlists(deviceNvlists)
 
+	if mirror == nil {
+		return nil, fmt.Errorf("failed to create mirror vdev nvlist")
+	}
 	return mirror, nil
 }
 
 func (d *libzfsDriver) createRaidzVdev(devices []string, parity int) (unsafe.Pointer, error) {
 	// Create device nvlists
-	deviceNvlists := make([]unsafe.Pointer, len(devices))
-	for i, device := range devices {
-		cDevice := C.CString(device)
-		cDiskType := C.CString("disk")
-		deviceNvlists[i] = C.go_create_vdev_nvlist(cDiskType, cDevice)
-		C.free(unsafe.Pointer(cDevice))
-		C.free(unsafe.Pointer(cDiskType))
-		if deviceNvlists[i] == nil {
-			// Clean up any previously created nvlists
-			for j := 0; j < i; j++ {
-				C.go_nvlist_free(deviceNvlists[j])
-			}
-			return nil, fmt.Errorf("failed to create nvlist for device %s", device)
-		}
+	deviceNvlists, err := d.createLeafNvlists(devices)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create raidz vdev
 	raidz := C.go_create_raidz_vdev((*unsafe.Pointer)(unsafe.Pointer(&deviceNvlists[0])), C.uint(len(devices)), C.int(parity))
 
 	// Clean up device nvlists (they're copied into the raidz)
-	for _, nvl := range deviceNvlists {
-		C.go_nvlist_free(nvl)
-	}
+	d.freeNvlists(deviceNvlists)
 
+	if raidz == nil {
+		return nil, fmt.Errorf("failed to create raidz%d vdev nvlist", parity)
+	}
 	return raidz, nil
 }
 
+func (d *libzfsDriver) createDraidVdev(devices []string, config DraidConfig) (unsafe.Pointer, error) {
+	// Create device nvlists
+	deviceNvlists, err := d.createLeafNvlists(devices)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create draid vdev; the kernel adds the distributed spares itself
+	draid := C.go_create_draid_vdev((*unsafe.Pointer)(unsafe.Pointer(&deviceNvlists[0])), C.uint(len(devices)),
+		C.uint64_t(config.Parity), C.uint64_t(config.Data), C.uint64_t(config.Spares), C.uint64_t(config.Groups))
+
+	// Clean up device nvlists (they're copied into the draid)
+	d.freeNvlists(deviceNvlists)
+
+	if draid == nil {
+		return nil, fmt.Errorf("failed to create draid%d vdev nvlist", config.Parity)
+	}
+	return draid, nil
+}
+
 func (d *libzfsDriver) SupportsFeature(ctx context.Context, feature string) (bool, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -1570,56 +2372,19 @@ func (d *libzfsDriver) SupportsFeature(ctx context.Context, feature string) (boo
 		return false, fmt.Errorf("driver is closed")
 	}
 
-	// All features are handled by the helper function
-	return d.checkZFSFeature(feature)
-}
-
-// Helper function to check if a specific ZFS feature is supported
-func (d *libzfsDriver) checkZFSFeature(feature string) (bool, error) {
-	// This is a simplified implementation that checks if the feature exists
-	// in the kernel module. A more sophisticated implementation would check
-	// specific pool compatibility and version requirements.
-
-	// For now, we'll assume most modern features are available
-	// In a production environment, this should query the actual ZFS kernel
-	// module capabilities or check against known version matrices
-
-	commonFeatures := map[string]bool{
-		"bookmarks":             true,
-		"encryption":            true,
-		"large_blocks":          true,
-		"spacemap_histogram":    true,
-		"extensible_dataset":    true,
-		"embedded_data":         true,
-		"async_destroy":         true,
-		"empty_bpobj":           true,
-		"lz4_compress":          true,
-		"multi_vdev_crash_dump": true,
-		"spacemap_v2":           true,
-		"enabled_txg":           true,
-		"hole_birth":            true,
-		"device_removal":        true,
-		"obsolete_counts":       true,
-		"zpool_checkpoint":      true,
-		"allocation_classes":    true,
-		"resilver_defer":        true,
-		"bookmark_v2":           true,
-		"redaction_bookmarks":   true,
-		"redacted_datasets":     true,
-		"bookmark_written":      true,
-		"log_spacemap":          true,
-		"livelist":              true,
-		"redaction_list_spill":  true,
-		"zstd_compress":         true,
-		"draid":                 false, // DRAID might not be available on all systems
-	}
-
-	if supported, exists := commonFeatures[feature]; exists {
-		return supported, nil
-	}
-
-	// For unknown features, return false but no error
-	return false, nil
+	return d.kernelFeatures()[feature], nil
+}
+
+// kernelFeatures returns the pool features of spa_feature_table and whether
+// the loaded kernel module supports each of them
+func (d *libzfsDriver) kernelFeatures() map[string]bool {
+	features := make(map[string]bool)
+	for i := 0; i < int(C.go_zfeature_count()); i++ {
+		var supported C.boolean_t
+		name := C.GoString(C.go_zfeature_name(C.int(i), &supported))
+		features[name] = supported == C.B_TRUE
+	}
+	return features
 }
 
 func (d *libzfsDriver) GetAvailableFeatures(ctx context.Context) ([]string, error) {
@@ -1630,42 +2395,82 @@ func (d *libzfsDriver) GetAvailableFeatures(ctx context.Context) ([]string, erro
 		return nil, fmt.Errorf("driver is closed")
 	}
 
-	// Return a list of commonly available ZFS features
-	// In a production environment, this should query the actual kernel module
-	features := []string{
-		"async_destroy",
-		"empty_bpobj",
-		"lz4_compress",
-		"multi_vdev_crash_dump",
-		"spacemap_v2",
-		"enabled_txg",
-		"hole_birth",
-		"extensible_dataset",
-		"embedded_data",
-		"bookmarks",
-		"filesystem_limits",
-		"large_blocks",
-		"large_dnode",
-		"sha512",
-		"skein",
-		"edonr",
-		"device_removal",
-		"obsolete_counts",
-		"zpool_checkpoint",
-		"spacemap_histogram",
-		"allocation_classes",
-		"resilver_defer",
-		"bookmark_v2",
-		"redaction_bookmarks",
-		"redacted_datasets",
-		"bookmark_written",
-		"log_spacemap",
-		"livelist",
-		"redaction_list_spill",
-		"zstd_compress",
-		"encryption",
+	var features []string
+	for name, supported := range d.kernelFeatures() {
+		if supported {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+
+	return features, nil
+}
+
+// GetPoolFeatures describes the features of a pool from the feature stats
+// of its refreshed configuration
+func (d *libzfsDriver) GetPoolFeatures(ctx context.Context, poolName string) ([]PoolFeature, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil, fmt.Errorf("driver closed")
+	}
+
+	poolNameC := C.CString(poolName)
+	defer C.free(unsafe.Pointer(poolNameC))
+
+	zhp := C.zpool_open_canfail(d.h, poolNameC)
+	if zhp == nil {
+		errno, desc := d.getLibzfsError()
+		return nil, fmt.Errorf("failed to open pool %s (errno %d): %s", poolName, errno, desc)
+	}
+	defer C.zpool_close(zhp)
+
+	var buf *C.char
+	var size C.size_t
+	if ret := C.go_zpool_get_config_packed(zhp, &buf, &size); ret != 0 {
+		return nil, fmt.Errorf("failed to get config of pool %s (errno %d)", poolName, ret)
+	}
+	defer C.free(unsafe.Pointer(buf))
+
+	config, err := nvlist.Unpack(C.GoBytes(unsafe.Pointer(buf), C.int(size)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pool config: %w", err)
+	}
+	stats, ok := config.LookupList(zpoolConfigFeatureStats)
+	if !ok {
+		return nil, fmt.Errorf("pool %s config has no feature stats", poolName)
+	}
+	return parsePoolFeatures(stats), nil
+}
+
+// LoadCompatibility returns the features a compatibility property value
+// allows that the kernel module supports, as zpool_load_compat does
+func (d *libzfsDriver) LoadCompatibility(ctx context.Context, compatibility string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil, fmt.Errorf("driver closed")
 	}
 
+	return d.loadCompatibility(compatibility)
+}
+
+// loadCompatibility filters the features of the compatibility feature-sets
+// down to the ones the kernel module supports
+func (d *libzfsDriver) loadCompatibility(compatibility string) ([]string, error) {
+	allowed, err := LoadCompatibility(compatibility, CompatibilityDirs)
+	if err != nil {
+		return nil, err
+	}
+	supported := d.kernelFeatures()
+	features := allowed[:0]
+	for _, name := range allowed {
+		if supported[name] {
+			features = append(features, name)
+		}
+	}
 	return features, nil
 }
 
@@ -1698,7 +2503,7 @@ func (d *libzfsDriver) GetSupportedCompressionAlgorithms(ctx context.Context) ([
 	}
 
 	// Check if ZSTD is supported
-	if supported, _ := d.checkZFSFeature("zstd_compress"); supported {
+	if d.kernelFeatures()["zstd_compress"] {
 		algorithms = append(algorithms, "zstd", "zstd-1", "zstd-2", "zstd-3", "zstd-4", "zstd-5",
 			"zstd-6", "zstd-7", "zstd-8", "zstd-9", "zstd-10", "zstd-11", "zstd-12", "zstd-13",
 			"zstd-14", "zstd-15", "zstd-16", "zstd-17", "zstd-18", "zstd-19", "zstd-fast-1",
@@ -1,4 +1,4 @@
-//go:build freebsd && !no_libzfs
+//go:build freebsd && cgo && !no_libzfs
 
 package driver
 
@@ -22,6 +22,7 @@ extern int go_get_zfs_type_snapshot();
 extern void* go_nvlist_alloc();
 extern void go_nvlist_free(void* nvl);
 extern int go_nvlist_add_string(void* nvl, char* name, char* val);
+extern int go_nvlist_add_uint64(void* nvl, char* name, uint64_t val);
 extern int go_nvlist_add_nvlist(void* nvl, char* name, void* val);
 extern int go_nvlist_add_nvlist_array(void* nvl, char* name, void** val, unsigned int nelem);
 extern void* go_create_vdev_nvlist(char* type, char* path);
@@ -53,6 +54,23 @@ func btoc(b bool) C.int {
 	return 0
 }
 
+// cStrings copies strs to C strings, returning a pointer to the first one,
+// nil when there are none, and a function freeing them
+func cStrings(strs []string) (**C.char, func()) {
+	if len(strs) == 0 {
+		return nil, func() {}
+	}
+	array := make([]*C.char, len(strs))
+	for i, s := range strs {
+		array[i] = C.CString(s)
+	}
+	return &array[0], func() {
+		for _, cs := range array {
+			C.free(unsafe.Pointer(cs))
+		}
+	}
+}
+
 // Helper function to convert Go properties map to nvlist
 func (d *libzfsDriver) createPropsNvlist(props map[string]string) (unsafe.Pointer, error) {
 	if len(props) == 0 {
@@ -104,12 +122,72 @@ func (d *libzfsDriver) createVdevNvlist(vdevType, path string) (unsafe.Pointer,
 	return vdev, nil
 }
 
-// Helper function to create vdev root nvlist with children
-func (d *libzfsDriver) createVdevRoot(vdevs []string) (unsafe.Pointer, []unsafe.Pointer, error) {
+// Helper function to free a slice of nvlists
+func (d *libzfsDriver) freeNvlists(nvls []unsafe.Pointer) {
+	for _, nvl := range nvls {
+		d.freeNvlist(nvl)
+	}
+}
+
+// Helper function to create leaf vdev nvlists, as disks or files
+func (d *libzfsDriver) createLeafNvlists(devices []string) ([]unsafe.Pointer, error) {
+	leaves := make([]unsafe.Pointer, 0, len(devices))
+	for _, device := range devices {
+		leaf, err := d.createVdevNvlist(leafVdevType(device), device)
+		if err != nil {
+			d.freeNvlists(leaves)
+			return nil, err
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+// Helper function to add an array of nvlists, which is copied
+func (d *libzfsDriver) addNvlistArray(nvl unsafe.Pointer, name string, items []unsafe.Pointer) error {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	if C.go_nvlist_add_nvlist_array(nvl, cName, (*unsafe.Pointer)(unsafe.Pointer(&items[0])), C.uint(len(items))) != 0 {
+		return fmt.Errorf("failed to add %s to vdev nvlist", name)
+	}
+	return nil
+}
+
+// Helper function to mark a top-level vdev with its allocation class, the
+// way zpool create does with is_log and alloc_bias
+func (d *libzfsDriver) setVdevClass(vdev unsafe.Pointer, class string) error {
+	var isLog C.uint64_t
+	if class == VdevClassLog {
+		isLog = 1
+	}
+	cIsLog := C.CString(zpoolConfigIsLog)
+	defer C.free(unsafe.Pointer(cIsLog))
+	if C.go_nvlist_add_uint64(vdev, cIsLog, isLog) != 0 {
+		return fmt.Errorf("failed to set %s", zpoolConfigIsLog)
+	}
+
+	if class == VdevClassNormal {
+		return nil
+	}
+	cBias := C.CString(zpoolConfigAllocBias)
+	defer C.free(unsafe.Pointer(cBias))
+	cClass := C.CString(class)
+	defer C.free(unsafe.Pointer(cClass))
+	if C.go_nvlist_add_string(vdev, cBias, cClass) != 0 {
+		return fmt.Errorf("failed to set %s", zpoolConfigAllocBias)
+	}
+	return nil
+}
+
+// Helper function to create the vdev root nvlist of a new pool, or of the
+// vdevs added to one. Hot spares and cache devices go in arrays of their
+// own, every device a vdev.
+func (d *libzfsDriver) createVdevRoot(vdevs []VdevSpec) (unsafe.Pointer, error) {
 	// Create vdev root nvlist
 	nvroot := C.go_nvlist_alloc()
 	if nvroot == nil {
-		return nil, nil, fmt.Errorf("failed to allocate vdev root nvlist")
+		return nil, fmt.Errorf("failed to allocate vdev root nvlist")
 	}
 
 	// Set root vdev type
@@ -120,63 +198,63 @@ func (d *libzfsDriver) createVdevRoot(vdevs []string) (unsafe.Pointer, []unsafe.
 
 	if C.go_nvlist_add_string(nvroot, cType, cRoot) != 0 {
 		d.freeNvlist(nvroot)
-		return nil, nil, fmt.Errorf("failed to set root vdev type")
+		return nil, fmt.Errorf("failed to set root vdev type")
 	}
 
-	// Create child vdevs array
-	vdevList := make([]unsafe.Pointer, len(vdevs))
-	for i, vdev := range vdevs {
-		vdevNvlist, err := d.createVdevNvlist(VdevTypeDisk, vdev)
-		if err != nil {
-			// Clean up previously created vdevs
-			for j := 0; j < i; j++ {
-				d.freeNvlist(vdevList[j])
+	// Build the top-level vdevs; the arrays are copied into the root
+	var children, spares, cache []unsafe.Pointer
+	defer func() {
+		d.freeNvlists(children)
+		d.freeNvlists(spares)
+		d.freeNvlists(cache)
+	}()
+
+	for _, spec := range vdevs {
+		switch spec.Class {
+		case VdevClassSpare, VdevClassCache:
+			leaves, err := d.createLeafNvlists(spec.Devices)
+			if err != nil {
+				d.freeNvlist(nvroot)
+				return nil, err
+			}
+			if spec.Class == VdevClassSpare {
+				spares = append(spares, leaves...)
+			} else {
+				cache = append(cache, leaves...)
 			}
+			continue
+		}
+
+		vdev, err := d.createComplexVdevNvlist(spec)
+		if err != nil {
+			d.freeNvlist(nvroot)
+			return nil, err
+		}
+		children = append(children, vdev)
+		if err := d.setVdevClass(vdev, spec.Class); err != nil {
 			d.freeNvlist(nvroot)
-			return nil, nil, err
+			return nil, err
 		}
-		vdevList[i] = vdevNvlist
 	}
 
-	// Add vdevs to root as children
-	cChildren := C.CString("children")
-	defer C.free(unsafe.Pointer(cChildren))
-
-	ret := C.go_nvlist_add_nvlist_array(nvroot, cChildren, (*unsafe.Pointer)(unsafe.Pointer(&vdevList[0])), C.uint(len(vdevList)))
-	if ret != 0 {
-		// Clean up all nvlists
-		for _, vdev := range vdevList {
-			d.freeNvlist(vdev)
+	for _, array := range []struct {
+		name  string
+		items []unsafe.Pointer
+	}{
+		{zpoolConfigChildren, children},
+		{zpoolConfigSpares, spares},
+		{zpoolConfigL2Cache, cache},
+	} {
+		if len(array.items) == 0 {
+			continue
+		}
+		if err := d.addNvlistArray(nvroot, array.name, array.items); err != nil {
+			d.freeNvlist(nvroot)
+			return nil, err
 		}
-		d.freeNvlist(nvroot)
-		return nil, nil, fmt.Errorf("failed to add children to vdev root")
-	}
-
-	return nvroot, vdevList, nil
-}
-
-// Helper function to map driver pool state to string
-func mapPoolState(state int) string {
-	switch state {
-	case PoolStateActive:
-		return "ACTIVE"
-	case PoolStateExported:
-		return "EXPORTED"
-	case PoolStateDestroyed:
-		return "DESTROYED"
-	case PoolStateSpare:
-		return "SPARE"
-	case PoolStateL2Cache:
-		return "L2CACHE"
-	case PoolStateUninitialized:
-		return "UNINITIALIZED"
-	case PoolStateUnavail:
-		return "UNAVAIL"
-	case PoolStatePotentiallyActive:
-		return "POTENTIALLY_ACTIVE"
-	default:
-		return "UNKNOWN"
 	}
+
+	return nvroot, nil
 }
 
 // Helper function to map driver pool health to string
@@ -0,0 +1,130 @@
+package driver
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Mode selects which driver implementation Open uses
+type Mode int
+
+const (
+	// ModeAuto tries libzfs first and falls back to ioctl
+	ModeAuto Mode = iota
+	// ModeAutoIoctl tries ioctl first and falls back to libzfs
+	ModeAutoIoctl
+	// ModeLibZFS uses libzfs only
+	ModeLibZFS
+	// ModeIoctl uses /dev/zfs ioctls only
+	ModeIoctl
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeAuto:
+		return "auto"
+	case ModeAutoIoctl:
+		return "auto-ioctl"
+	case ModeLibZFS:
+		return "libzfs"
+	case ModeIoctl:
+		return "ioctl"
+	default:
+		return "unknown"
+	}
+}
+
+// Implementation names reported in Selection.Impl
+const (
+	ImplLibZFS = "libzfs"
+	ImplIoctl  = "ioctl"
+	ImplStub   = "stub"
+	ImplCustom = "custom"
+)
+
+// Selection records which driver was chosen and why
+type Selection struct {
+	Impl   string // ImplLibZFS, ImplIoctl, ImplStub or ImplCustom
+	Mode   Mode   // Mode the driver was selected with
+	Reason string // Human readable explanation of the choice
+}
+
+// Injected returns the selection for a driver supplied by the caller
+func Injected() Selection {
+	return Selection{Impl: ImplCustom, Reason: "driver supplied by the caller"}
+}
+
+// backend describes a driver implementation Open can try
+type backend struct {
+	impl  string
+	built bool
+	open  func() (Driver, error)
+}
+
+func (m Mode) backends() []backend {
+	libzfs := backend{impl: ImplLibZFS, built: libzfsBuilt, open: NewLibZFS}
+	ioctl := backend{impl: ImplIoctl, built: ioctlBuilt, open: NewIoctl}
+
+	switch m {
+	case ModeAutoIoctl:
+		return []backend{ioctl, libzfs}
+	case ModeLibZFS:
+		return []backend{libzfs}
+	case ModeIoctl:
+		return []backend{ioctl}
+	default:
+		return []backend{libzfs, ioctl}
+	}
+}
+
+// Open opens a driver according to mode. In the auto modes the second
+// implementation is tried when the first is not built in or fails to
+// open. When no implementation is built in, as on platforms other than
+// FreeBSD, the stub driver is returned so every operation reports
+// errors.ErrNotSupported.
+func Open(mode Mode) (Driver, Selection, error) {
+	sel := Selection{Mode: mode}
+
+	var skipped []string
+	var openErr error
+	for i, b := range mode.backends() {
+		if !b.built {
+			skipped = append(skipped, fmt.Sprintf("%s is not available in this build", b.impl))
+			continue
+		}
+
+		d, err := b.open()
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s failed: %v", b.impl, err))
+			if openErr == nil {
+				openErr = fmt.Errorf("failed to initialize %s driver: %w", b.impl, err)
+			}
+			continue
+		}
+
+		sel.Impl = b.impl
+		switch {
+		case i > 0:
+			sel.Reason = fmt.Sprintf("%s selected as fallback (%s)", b.impl, strings.Join(skipped, "; "))
+		case mode == ModeLibZFS || mode == ModeIoctl:
+			sel.Reason = fmt.Sprintf("%s requested explicitly", b.impl)
+		default:
+			sel.Reason = fmt.Sprintf("%s preferred in %s mode", b.impl, mode)
+		}
+		return d, sel, nil
+	}
+
+	if openErr != nil {
+		return nil, sel, openErr
+	}
+
+	// Nothing is built in, NewLibZFS returns the stub driver on such builds
+	d, err := NewLibZFS()
+	if err != nil {
+		return nil, sel, err
+	}
+	sel.Impl = ImplStub
+	sel.Reason = fmt.Sprintf("no ZFS driver is available on %s/%s (%s)", runtime.GOOS, runtime.GOARCH, strings.Join(skipped, "; "))
+	return d, sel, nil
+}
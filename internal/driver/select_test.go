@@ -0,0 +1,36 @@
+//go:build !freebsd
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+func TestOpen_NoBackend(t *testing.T) {
+	for _, mode := range []Mode{ModeAuto, ModeAutoIoctl, ModeLibZFS, ModeIoctl} {
+		t.Run(mode.String(), func(t *testing.T) {
+			d, sel, err := Open(mode)
+			if err != nil {
+				t.Fatalf("Open(%v) error = %v", mode, err)
+			}
+			defer d.Close()
+
+			if sel.Impl != ImplStub {
+				t.Errorf("Impl = %q, want %q", sel.Impl, ImplStub)
+			}
+			if sel.Mode != mode {
+				t.Errorf("Mode = %v, want %v", sel.Mode, mode)
+			}
+			if !strings.Contains(sel.Reason, "not available in this build") {
+				t.Errorf("Reason = %q, want it to explain the missing drivers", sel.Reason)
+			}
+			if _, err := d.ListPools(context.Background()); !zfserrors.IsNotSupported(err) {
+				t.Errorf("ListPools() error = %v, want ENOTSUP", err)
+			}
+		})
+	}
+}
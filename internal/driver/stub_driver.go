@@ -0,0 +1,247 @@
+//go:build !freebsd || !cgo || no_libzfs
+
+package driver
+
+import (
+	"context"
+	"runtime"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+// stubDriver implements the Driver interface on builds without libzfs.
+// Every operation that needs libzfs fails with an error matching
+// errors.ErrNotSupported so that code importing the public packages still
+// compiles and can detect the missing backend at runtime.
+type stubDriver struct{}
+
+// libzfsBuilt reports whether the libzfs driver is compiled in
+const libzfsBuilt = false
+
+// NewLibZFS returns a stub driver when libzfs support is not compiled in
+func NewLibZFS() (Driver, error) {
+	return &stubDriver{}, nil
+}
+
+// notSupported builds the error returned by every stub driver method
+func notSupported(op, resource string) error {
+	return zfserrors.NewZfsError(op, resource, zfserrors.ErrCodeNotSupported, 0,
+		"libzfs is not available in this build ("+runtime.GOOS+")", zfserrors.ErrNotSupported)
+}
+
+func (d *stubDriver) Close() error {
+	return nil
+}
+
+func (d *stubDriver) RuntimeInfo(ctx context.Context) (string, string, string, error) {
+	return "", "", "", notSupported("runtime_info", "")
+}
+
+// Pool operations
+
+func (d *stubDriver) ListPools(ctx context.Context) ([]PoolInfo, error) {
+	return nil, notSupported("list_pools", "")
+}
+
+func (d *stubDriver) GetPoolProps(ctx context.Context, poolName string, propNames []string) (map[string]PropertyInfo, error) {
+	return nil, notSupported("get_pool_props", poolName)
+}
+
+func (d *stubDriver) GetPoolStatus(ctx context.Context, poolName string) (*PoolStatus, error) {
+	return nil, notSupported("get_pool_status", poolName)
+}
+
+func (d *stubDriver) SetPoolProp(ctx context.Context, poolName, propName, propValue string) error {
+	return notSupported("set_pool_prop", poolName)
+}
+
+func (d *stubDriver) ScrubPool(ctx context.Context, poolName string, opts ScrubOptions) error {
+	return notSupported("scrub_pool", poolName)
+}
+
+func (d *stubDriver) CheckpointPool(ctx context.Context, poolName string) error {
+	return notSupported("checkpoint_pool", poolName)
+}
+
+func (d *stubDriver) DiscardCheckpoint(ctx context.Context, poolName string) error {
+	return notSupported("discard_checkpoint", poolName)
+}
+
+func (d *stubDriver) WaitPool(ctx context.Context, poolName string, activity WaitActivity) (bool, error) {
+	return false, notSupported("wait_pool", poolName)
+}
+
+func (d *stubDriver) GetPoolHistory(ctx context.Context, poolName string, offset uint64) ([]HistoryRecord, uint64, error) {
+	return nil, 0, notSupported("get_history", poolName)
+}
+
+func (d *stubDriver) DiscoverPools(ctx context.Context, opts DiscoverOptions) ([]ImportablePool, error) {
+	return nil, notSupported("discover_pools", opts.Pool)
+}
+
+func (d *stubDriver) ImportPool(ctx context.Context, poolName string, opts ImportOptions) (*RewindReport, error) {
+	return nil, notSupported("import_pool", poolName)
+}
+
+func (d *stubDriver) ExportPool(ctx context.Context, poolName string, opts ExportOptions) error {
+	return notSupported("export_pool", poolName)
+}
+
+func (d *stubDriver) CreatePool(ctx context.Context, poolName string, vdevs []VdevSpec, opts CreateOptions) error {
+	return notSupported("create_pool", poolName)
+}
+
+func (d *stubDriver) SplitPool(ctx context.Context, poolName, newPoolName string, opts SplitOptions) (*VdevInfo, error) {
+	return nil, notSupported("split_pool", poolName)
+}
+
+func (d *stubDriver) DestroyPool(ctx context.Context, poolName string) error {
+	return notSupported("destroy_pool", poolName)
+}
+
+// Dataset operations
+
+func (d *stubDriver) ListDatasets(ctx context.Context, recursive bool) ([]DatasetInfo, error) {
+	return nil, notSupported("list_datasets", "")
+}
+
+func (d *stubDriver) ListDatasetsInPool(ctx context.Context, poolName string, recursive bool) ([]DatasetInfo, error) {
+	return nil, notSupported("list_datasets", poolName)
+}
+
+func (d *stubDriver) ListDatasetsByType(ctx context.Context, dsType *DatasetType, recursive bool) ([]DatasetInfo, error) {
+	return nil, notSupported("list_datasets", "")
+}
+
+func (d *stubDriver) GetDatasetProps(ctx context.Context, datasetName string, propNames []string) (map[string]PropertyInfo, error) {
+	return nil, notSupported("get_dataset_props", datasetName)
+}
+
+func (d *stubDriver) SetDatasetProp(ctx context.Context, datasetName, propName, propValue string) error {
+	return notSupported("set_dataset_prop", datasetName)
+}
+
+func (d *stubDriver) SetDatasetProps(ctx context.Context, datasetName string, props map[string]string) error {
+	return notSupported("set_dataset_props", datasetName)
+}
+
+func (d *stubDriver) InheritDatasetProp(ctx context.Context, datasetName, propName string, opts InheritOptions) error {
+	return notSupported("inherit_dataset_prop", datasetName)
+}
+
+func (d *stubDriver) CreateDataset(ctx context.Context, datasetName string, dsType DatasetType, props map[string]string) error {
+	return notSupported("create_dataset", datasetName)
+}
+
+func (d *stubDriver) DestroyDataset(ctx context.Context, datasetName string, recursive bool) error {
+	return notSupported("destroy_dataset", datasetName)
+}
+
+// Snapshot operations
+
+func (d *stubDriver) CreateSnapshot(ctx context.Context, snapshotName string, recursive bool, props map[string]string) error {
+	return notSupported("create_snapshot", snapshotName)
+}
+
+func (d *stubDriver) DestroySnapshot(ctx context.Context, snapshotName string) error {
+	return notSupported("destroy_snapshot", snapshotName)
+}
+
+func (d *stubDriver) RollbackToSnapshot(ctx context.Context, datasetName, snapshotName string, force bool) error {
+	return notSupported("rollback", datasetName)
+}
+
+// Clone operations
+
+func (d *stubDriver) CreateClone(ctx context.Context, snapshotName, cloneName string, props map[string]string) error {
+	return notSupported("create_clone", cloneName)
+}
+
+func (d *stubDriver) PromoteClone(ctx context.Context, cloneName string) error {
+	return notSupported("promote_clone", cloneName)
+}
+
+func (d *stubDriver) GetCloneInfo(ctx context.Context, datasetName string) (*CloneInfo, error) {
+	return nil, notSupported("get_clone_info", datasetName)
+}
+
+func (d *stubDriver) ListClones(ctx context.Context, snapshotName string) ([]string, error) {
+	return nil, notSupported("list_clones", snapshotName)
+}
+
+func (d *stubDriver) DestroyClone(ctx context.Context, cloneName string, force bool) error {
+	return notSupported("destroy_clone", cloneName)
+}
+
+// Vdev management operations
+
+func (d *stubDriver) AddVdev(ctx context.Context, poolName string, vdevSpec VdevSpec) error {
+	return notSupported("add_vdev", poolName)
+}
+
+func (d *stubDriver) AttachVdev(ctx context.Context, poolName, oldDevice, newDevice string, replacing bool) error {
+	return notSupported("attach_vdev", poolName)
+}
+
+func (d *stubDriver) DetachVdev(ctx context.Context, poolName, device string) error {
+	return notSupported("detach_vdev", poolName)
+}
+
+func (d *stubDriver) ReplaceVdev(ctx context.Context, poolName, oldDevice, newDevice string) error {
+	return notSupported("replace_vdev", poolName)
+}
+
+func (d *stubDriver) RemoveVdev(ctx context.Context, poolName, device string) error {
+	return notSupported("remove_vdev", poolName)
+}
+
+func (d *stubDriver) CancelRemoval(ctx context.Context, poolName string) error {
+	return notSupported("cancel_removal", poolName)
+}
+
+func (d *stubDriver) OnlineVdev(ctx context.Context, poolName, device string, flags VdevOnlineFlags) (string, error) {
+	return "", notSupported("online_vdev", poolName)
+}
+
+func (d *stubDriver) OfflineVdev(ctx context.Context, poolName, device string, temporary bool) error {
+	return notSupported("offline_vdev", poolName)
+}
+
+func (d *stubDriver) ClearVdev(ctx context.Context, poolName, device string) error {
+	return notSupported("clear_vdev", poolName)
+}
+
+func (d *stubDriver) InitializeVdevs(ctx context.Context, poolName string, devices []string, cmd VdevActionCommand) error {
+	return notSupported("initialize_vdevs", poolName)
+}
+
+func (d *stubDriver) TrimVdevs(ctx context.Context, poolName string, devices []string, opts TrimOptions) error {
+	return notSupported("trim_vdevs", poolName)
+}
+
+// Feature and capability detection
+
+func (d *stubDriver) SupportsFeature(ctx context.Context, feature string) (bool, error) {
+	return false, notSupported("supports_feature", feature)
+}
+
+func (d *stubDriver) GetAvailableFeatures(ctx context.Context) ([]string, error) {
+	return nil, notSupported("get_features", "")
+}
+
+func (d *stubDriver) GetPoolFeatures(ctx context.Context, poolName string) ([]PoolFeature, error) {
+	return nil, notSupported("get_pool_features", poolName)
+}
+
+// LoadCompatibility only reads feature-set files, which needs no libzfs
+func (d *stubDriver) LoadCompatibility(ctx context.Context, compatibility string) ([]string, error) {
+	return LoadCompatibility(compatibility, CompatibilityDirs)
+}
+
+func (d *stubDriver) GetSupportedCompressionAlgorithms(ctx context.Context) ([]string, error) {
+	return nil, notSupported("get_compression_algorithms", "")
+}
+
+func (d *stubDriver) GetZFSVersion(ctx context.Context) (string, error) {
+	return "", notSupported("get_version", "")
+}
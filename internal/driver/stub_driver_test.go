@@ -0,0 +1,77 @@
+//go:build !freebsd || !cgo || no_libzfs
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+func TestStubDriver_NotSupported(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewLibZFS()
+	if err != nil {
+		t.Fatalf("NewLibZFS() error = %v", err)
+	}
+	defer d.Close()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"RuntimeInfo", func() error { _, _, _, err := d.RuntimeInfo(ctx); return err }},
+		{"ListPools", func() error { _, err := d.ListPools(ctx); return err }},
+		{"GetPoolProps", func() error { _, err := d.GetPoolProps(ctx, "tank", nil); return err }},
+		{"GetPoolStatus", func() error { _, err := d.GetPoolStatus(ctx, "tank"); return err }},
+		{"SetPoolProp", func() error { return d.SetPoolProp(ctx, "tank", "autotrim", "on") }},
+		{"ScrubPool", func() error { return d.ScrubPool(ctx, "tank", ScrubOptions{}) }},
+		{"CheckpointPool", func() error { return d.CheckpointPool(ctx, "tank") }},
+		{"DiscardCheckpoint", func() error { return d.DiscardCheckpoint(ctx, "tank") }},
+		{"WaitPool", func() error { _, err := d.WaitPool(ctx, "tank", WaitScrub); return err }},
+		{"GetPoolHistory", func() error { _, _, err := d.GetPoolHistory(ctx, "tank", 0); return err }},
+		{"DiscoverPools", func() error { _, err := d.DiscoverPools(ctx, DiscoverOptions{}); return err }},
+		{"CreatePool", func() error { return d.CreatePool(ctx, "tank", nil, CreateOptions{}) }},
+		{"SplitPool", func() error { _, err := d.SplitPool(ctx, "tank", "copy", SplitOptions{}); return err }},
+		{"ListDatasets", func() error { _, err := d.ListDatasets(ctx, true); return err }},
+		{"SetDatasetProp", func() error { return d.SetDatasetProp(ctx, "tank", "atime", "off") }},
+		{"SetDatasetProps", func() error { return d.SetDatasetProps(ctx, "tank", map[string]string{"atime": "off"}) }},
+		{"InheritDatasetProp", func() error { return d.InheritDatasetProp(ctx, "tank", "atime", InheritOptions{}) }},
+		{"CreateSnapshot", func() error { return d.CreateSnapshot(ctx, "tank@snap", false, nil) }},
+		{"GetCloneInfo", func() error { _, err := d.GetCloneInfo(ctx, "tank"); return err }},
+		{"CancelRemoval", func() error { return d.CancelRemoval(ctx, "tank") }},
+		{"OnlineVdev", func() error { _, err := d.OnlineVdev(ctx, "tank", "ada0", 0); return err }},
+		{"InitializeVdevs", func() error { return d.InitializeVdevs(ctx, "tank", nil, VdevActionStart) }},
+		{"TrimVdevs", func() error { return d.TrimVdevs(ctx, "tank", nil, TrimOptions{}) }},
+		{"GetPoolFeatures", func() error { _, err := d.GetPoolFeatures(ctx, "tank"); return err }},
+		{"GetZFSVersion", func() error { _, err := d.GetZFSVersion(ctx); return err }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			if !zfserrors.IsNotSupported(err) {
+				t.Errorf("%s() error = %v, want ENOTSUP", test.name, err)
+			}
+			if !errors.Is(err, zfserrors.ErrNotSupported) {
+				t.Errorf("%s() error does not match errors.ErrNotSupported", test.name)
+			}
+		})
+	}
+}
+
+func TestStubDriver_LoadCompatibility(t *testing.T) {
+	d, err := NewLibZFS()
+	if err != nil {
+		t.Fatalf("NewLibZFS() error = %v", err)
+	}
+	defer d.Close()
+
+	features, err := d.LoadCompatibility(context.Background(), CompatibilityLegacy)
+	if err != nil || len(features) != 0 {
+		t.Errorf("LoadCompatibility(legacy) = %v, %v, want no features", features, err)
+	}
+}
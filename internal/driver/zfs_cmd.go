@@ -0,0 +1,280 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ZFS ioctl numbers (zfs_ioc_t in sys/fs/zfs.h)
+const (
+	zfsIocFirst            = 0x5a00
+	zfsIocPoolCreate       = zfsIocFirst + 0x00
+	zfsIocPoolDestroy      = zfsIocFirst + 0x01
+	zfsIocPoolImport       = zfsIocFirst + 0x02
+	zfsIocPoolExport       = zfsIocFirst + 0x03
+	zfsIocPoolConfigs      = zfsIocFirst + 0x04
+	zfsIocPoolStats        = zfsIocFirst + 0x05
+	zfsIocPoolTryimport    = zfsIocFirst + 0x06
+	zfsIocPoolScan         = zfsIocFirst + 0x07
+	zfsIocPoolGetHistory   = zfsIocFirst + 0x0a
+	zfsIocObjsetStats      = zfsIocFirst + 0x12
+	zfsIocObjsetZplprops   = zfsIocFirst + 0x13
+	zfsIocDatasetListNext  = zfsIocFirst + 0x14
+	zfsIocSnapshotListNext = zfsIocFirst + 0x15
+	zfsIocPoolGetProps     = zfsIocFirst + 0x27
+	zfsIocObjsetRecvdProps = zfsIocFirst + 0x33
+)
+
+// zfsIoctlVersion is ZFS_IOCVER_OZFS, the zfs_cmd_t revision used by
+// OpenZFS on FreeBSD (vfs.zfs.version.ioctl)
+const zfsIoctlVersion = 15
+
+// zfsIocparmSize is sizeof(zfs_iocparm_t): version, pad, command address, command size
+const zfsIocparmSize = 24
+
+// zfsIoctlRequest encodes an ioctl number as _IOWR('Z', nr, zfs_iocparm_t)
+func zfsIoctlRequest(nr uint) uint {
+	const (
+		iocInOut    = 0xc0000000
+		iocParmMask = 0x1fff
+	)
+	return iocInOut | (zfsIocparmSize&iocParmMask)<<16 | 'Z'<<8 | nr&0xff
+}
+
+// Buffer sizes from sys/param.h and sys/fs/zfs.h
+const (
+	maxPathLen         = 1024
+	maxNameLen         = 256
+	zfsMaxDatasetName  = 256
+	zfsCmdSize         = 4528 // sizeof(zfs_cmd_t) on 64-bit platforms
+	zfsCmdBufferSize   = 8192 // allocation for zfs_cmd_t, leaves room for newer layouts
+	dmuObjsetStatsSize = 288
+)
+
+// zfs_cmd_t field offsets (sys/zfs_ioctl.h, OpenZFS 2.x, 64-bit)
+const (
+	zcNameOff            = 0    // char zc_name[MAXPATHLEN]
+	zcNvlistSrcOff       = 1024 // uint64_t zc_nvlist_src
+	zcNvlistSrcSizeOff   = 1032 // uint64_t zc_nvlist_src_size
+	zcNvlistDstOff       = 1040 // uint64_t zc_nvlist_dst
+	zcNvlistDstSizeOff   = 1048 // uint64_t zc_nvlist_dst_size
+	zcNvlistDstFilledOff = 1056 // boolean_t zc_nvlist_dst_filled
+	zcHistoryOff         = 1064 // uint64_t zc_history
+	zcValueOff           = 1072 // char zc_value[MAXPATHLEN * 2]
+	zcStringOff          = 3120 // char zc_string[MAXNAMELEN]
+	zcGUIDOff            = 3376 // uint64_t zc_guid
+	zcNvlistConfOff      = 3384 // uint64_t zc_nvlist_conf
+	zcNvlistConfSizeOff  = 3392 // uint64_t zc_nvlist_conf_size
+	zcCookieOff          = 3400 // uint64_t zc_cookie
+	zcObjsetTypeOff      = 3408 // uint64_t zc_objset_type
+	zcHistoryLenOff      = 3424 // uint64_t zc_history_len
+	zcHistoryOffsetOff   = 3432 // uint64_t zc_history_offset
+	zcObjOff             = 3440 // uint64_t zc_obj
+	zcObjsetStatsOff     = 3488 // dmu_objset_stats_t zc_objset_stats
+	zcDeferDestroyOff    = 4432 // uint32_t zc_defer_destroy
+	zcFlagsOff           = 4436 // uint32_t zc_flags
+	zcCleanupFdOff       = 4448 // int zc_cleanup_fd
+	zcSimpleOff          = 4452 // uint8_t zc_simple
+	zcCreatetxgOff       = 4472 // uint64_t zc_createtxg
+)
+
+// dmu_objset_stats_t field offsets
+const (
+	dsNumClonesOff    = 0
+	dsCreationTxgOff  = 8
+	dsGUIDOff         = 16
+	dsTypeOff         = 24 // dmu_objset_type_t
+	dsIsSnapshotOff   = 28
+	dsInconsistentOff = 29
+	dsRedactedOff     = 30
+	dsOriginOff       = 31 // char dds_origin[ZFS_MAX_DATASET_NAME_LEN]
+)
+
+// Object set types (dmu_objset_type_t)
+const (
+	dmuOstNone = 0
+	dmuOstMeta = 1
+	dmuOstZFS  = 2
+	dmuOstZvol = 3
+)
+
+// dmuObjsetStats mirrors dmu_objset_stats_t
+type dmuObjsetStats struct {
+	numClones    uint64
+	creationTxg  uint64
+	guid         uint64
+	objsetType   uint32
+	isSnapshot   bool
+	inconsistent bool
+	redacted     bool
+	origin       string
+}
+
+// datasetType maps the object set type to a DatasetType
+func (s dmuObjsetStats) datasetType() DatasetType {
+	switch {
+	case s.isSnapshot:
+		return DatasetSnapshot
+	case s.objsetType == dmuOstZvol:
+		return DatasetVolume
+	default:
+		return DatasetFilesystem
+	}
+}
+
+// zfsCmd holds the zfs_cmd_t fields used by the ioctl driver. Buffer
+// fields hold user addresses and are filled in by the caller issuing the
+// ioctl.
+type zfsCmd struct {
+	name            string
+	nvlistSrc       uint64
+	nvlistSrcSize   uint64
+	nvlistDst       uint64
+	nvlistDstSize   uint64
+	nvlistDstFilled bool
+	history         uint64
+	value           string
+	str             string
+	guid            uint64
+	nvlistConf      uint64
+	nvlistConfSize  uint64
+	cookie          uint64
+	objsetType      uint64
+	historyLen      uint64
+	historyOffset   uint64
+	obj             uint64
+	objsetStats     dmuObjsetStats
+	deferDestroy    uint32
+	flags           uint32
+	cleanupFd       int32
+	simple          bool
+	createtxg       uint64
+}
+
+var zcOrder = binary.NativeEndian
+
+// putString stores s as a NUL terminated string in a fixed size field
+func putString(buf []byte, off, size int, field, s string) error {
+	if len(s) >= size {
+		return fmt.Errorf("%s %q exceeds %d bytes", field, s, size-1)
+	}
+	copy(buf[off:off+size], s)
+	buf[off+len(s)] = 0
+	return nil
+}
+
+// getString reads a NUL terminated string from a fixed size field
+func getString(buf []byte, off, size int) string {
+	field := buf[off : off+size]
+	if end := bytes.IndexByte(field, 0); end >= 0 {
+		field = field[:end]
+	}
+	return string(field)
+}
+
+func putBool(buf []byte, off int, b bool) {
+	if b {
+		buf[off] = 1
+	} else {
+		buf[off] = 0
+	}
+}
+
+// marshal encodes the command into buf, which must hold at least zfsCmdSize bytes
+func (zc *zfsCmd) marshal(buf []byte) error {
+	if len(buf) < zfsCmdSize {
+		return fmt.Errorf("zfs_cmd_t buffer too small: %d < %d", len(buf), zfsCmdSize)
+	}
+	clear(buf)
+
+	if err := putString(buf, zcNameOff, maxPathLen, "name", zc.name); err != nil {
+		return err
+	}
+	if err := putString(buf, zcValueOff, maxPathLen*2, "value", zc.value); err != nil {
+		return err
+	}
+	if err := putString(buf, zcStringOff, maxNameLen, "string", zc.str); err != nil {
+		return err
+	}
+
+	zcOrder.PutUint64(buf[zcNvlistSrcOff:], zc.nvlistSrc)
+	zcOrder.PutUint64(buf[zcNvlistSrcSizeOff:], zc.nvlistSrcSize)
+	zcOrder.PutUint64(buf[zcNvlistDstOff:], zc.nvlistDst)
+	zcOrder.PutUint64(buf[zcNvlistDstSizeOff:], zc.nvlistDstSize)
+	if zc.nvlistDstFilled {
+		zcOrder.PutUint32(buf[zcNvlistDstFilledOff:], 1)
+	}
+	zcOrder.PutUint64(buf[zcHistoryOff:], zc.history)
+	zcOrder.PutUint64(buf[zcGUIDOff:], zc.guid)
+	zcOrder.PutUint64(buf[zcNvlistConfOff:], zc.nvlistConf)
+	zcOrder.PutUint64(buf[zcNvlistConfSizeOff:], zc.nvlistConfSize)
+	zcOrder.PutUint64(buf[zcCookieOff:], zc.cookie)
+	zcOrder.PutUint64(buf[zcObjsetTypeOff:], zc.objsetType)
+	zcOrder.PutUint64(buf[zcHistoryLenOff:], zc.historyLen)
+	zcOrder.PutUint64(buf[zcHistoryOffsetOff:], zc.historyOffset)
+	zcOrder.PutUint64(buf[zcObjOff:], zc.obj)
+
+	stats := buf[zcObjsetStatsOff : zcObjsetStatsOff+dmuObjsetStatsSize]
+	zcOrder.PutUint64(stats[dsNumClonesOff:], zc.objsetStats.numClones)
+	zcOrder.PutUint64(stats[dsCreationTxgOff:], zc.objsetStats.creationTxg)
+	zcOrder.PutUint64(stats[dsGUIDOff:], zc.objsetStats.guid)
+	zcOrder.PutUint32(stats[dsTypeOff:], zc.objsetStats.objsetType)
+	putBool(stats, dsIsSnapshotOff, zc.objsetStats.isSnapshot)
+	putBool(stats, dsInconsistentOff, zc.objsetStats.inconsistent)
+	putBool(stats, dsRedactedOff, zc.objsetStats.redacted)
+	if err := putString(stats, dsOriginOff, zfsMaxDatasetName, "origin", zc.objsetStats.origin); err != nil {
+		return err
+	}
+
+	zcOrder.PutUint32(buf[zcDeferDestroyOff:], zc.deferDestroy)
+	zcOrder.PutUint32(buf[zcFlagsOff:], zc.flags)
+	zcOrder.PutUint32(buf[zcCleanupFdOff:], uint32(zc.cleanupFd))
+	putBool(buf, zcSimpleOff, zc.simple)
+	zcOrder.PutUint64(buf[zcCreatetxgOff:], zc.createtxg)
+	return nil
+}
+
+// unmarshal decodes a command returned by the kernel
+func (zc *zfsCmd) unmarshal(buf []byte) error {
+	if len(buf) < zfsCmdSize {
+		return fmt.Errorf("zfs_cmd_t buffer too small: %d < %d", len(buf), zfsCmdSize)
+	}
+
+	zc.name = getString(buf, zcNameOff, maxPathLen)
+	zc.nvlistSrc = zcOrder.Uint64(buf[zcNvlistSrcOff:])
+	zc.nvlistSrcSize = zcOrder.Uint64(buf[zcNvlistSrcSizeOff:])
+	zc.nvlistDst = zcOrder.Uint64(buf[zcNvlistDstOff:])
+	zc.nvlistDstSize = zcOrder.Uint64(buf[zcNvlistDstSizeOff:])
+	zc.nvlistDstFilled = zcOrder.Uint32(buf[zcNvlistDstFilledOff:]) != 0
+	zc.history = zcOrder.Uint64(buf[zcHistoryOff:])
+	zc.value = getString(buf, zcValueOff, maxPathLen*2)
+	zc.str = getString(buf, zcStringOff, maxNameLen)
+	zc.guid = zcOrder.Uint64(buf[zcGUIDOff:])
+	zc.nvlistConf = zcOrder.Uint64(buf[zcNvlistConfOff:])
+	zc.nvlistConfSize = zcOrder.Uint64(buf[zcNvlistConfSizeOff:])
+	zc.cookie = zcOrder.Uint64(buf[zcCookieOff:])
+	zc.objsetType = zcOrder.Uint64(buf[zcObjsetTypeOff:])
+	zc.historyLen = zcOrder.Uint64(buf[zcHistoryLenOff:])
+	zc.historyOffset = zcOrder.Uint64(buf[zcHistoryOffsetOff:])
+	zc.obj = zcOrder.Uint64(buf[zcObjOff:])
+
+	stats := buf[zcObjsetStatsOff : zcObjsetStatsOff+dmuObjsetStatsSize]
+	zc.objsetStats = dmuObjsetStats{
+		numClones:    zcOrder.Uint64(stats[dsNumClonesOff:]),
+		creationTxg:  zcOrder.Uint64(stats[dsCreationTxgOff:]),
+		guid:         zcOrder.Uint64(stats[dsGUIDOff:]),
+		objsetType:   zcOrder.Uint32(stats[dsTypeOff:]),
+		isSnapshot:   stats[dsIsSnapshotOff] != 0,
+		inconsistent: stats[dsInconsistentOff] != 0,
+		redacted:     stats[dsRedactedOff] != 0,
+		origin:       getString(stats, dsOriginOff, zfsMaxDatasetName),
+	}
+
+	zc.deferDestroy = zcOrder.Uint32(buf[zcDeferDestroyOff:])
+	zc.flags = zcOrder.Uint32(buf[zcFlagsOff:])
+	zc.cleanupFd = int32(zcOrder.Uint32(buf[zcCleanupFdOff:]))
+	zc.simple = buf[zcSimpleOff] != 0
+	zc.createtxg = zcOrder.Uint64(buf[zcCreatetxgOff:])
+	return nil
+}
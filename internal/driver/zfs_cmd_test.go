@@ -0,0 +1,220 @@
+package driver
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// recordedListNext is the zfs_cmd_t returned by ZFS_IOC_DATASET_LIST_NEXT
+// for tank/home on amd64, as a sparse list of offset to bytes. Everything
+// else in the 4528 byte structure is zero.
+var recordedListNext = map[int]string{
+	0:    "74616e6b2f686f6d6500",   // zc_name "tank/home"
+	1040: "00104000080000",         // zc_nvlist_dst
+	1048: "0000040000000000",       // zc_nvlist_dst_size 256K
+	3400: "2a00000000000000",       // zc_cookie
+	3488: "0100000000000000",       // dds_num_clones
+	3496: "0500000000000000",       // dds_creation_txg
+	3504: "8877665544332211",       // dds_guid
+	3512: "02000000",               // dds_type DMU_OST_ZFS
+	3519: "74616e6b2f6f6c64407300", // dds_origin "tank/old@s"
+	4448: "ffffffff",               // zc_cleanup_fd
+	4472: "0500000000000000",       // zc_createtxg
+}
+
+func recordedBuffer(t *testing.T, fixture map[int]string) []byte {
+	t.Helper()
+	buf := make([]byte, zfsCmdSize)
+	for off, h := range fixture {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			t.Fatalf("bad fixture at %d: %v", off, err)
+		}
+		copy(buf[off:], b)
+	}
+	return buf
+}
+
+func skipBigEndian(t *testing.T) {
+	t.Helper()
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("recorded buffers are little-endian")
+	}
+}
+
+func TestZfsCmd_Unmarshal(t *testing.T) {
+	skipBigEndian(t)
+
+	var zc zfsCmd
+	if err := zc.unmarshal(recordedBuffer(t, recordedListNext)); err != nil {
+		t.Fatalf("unmarshal() error = %v", err)
+	}
+
+	if zc.name != "tank/home" {
+		t.Errorf("name = %q, want tank/home", zc.name)
+	}
+	if zc.nvlistDst != 0x800401000 {
+		t.Errorf("nvlistDst = %#x, want 0x800401000", zc.nvlistDst)
+	}
+	if zc.nvlistDstSize != 256<<10 {
+		t.Errorf("nvlistDstSize = %d, want %d", zc.nvlistDstSize, 256<<10)
+	}
+	if zc.cookie != 42 {
+		t.Errorf("cookie = %d, want 42", zc.cookie)
+	}
+	if zc.cleanupFd != -1 {
+		t.Errorf("cleanupFd = %d, want -1", zc.cleanupFd)
+	}
+	if zc.createtxg != 5 {
+		t.Errorf("createtxg = %d, want 5", zc.createtxg)
+	}
+
+	want := dmuObjsetStats{
+		numClones:   1,
+		creationTxg: 5,
+		guid:        0x1122334455667788,
+		objsetType:  dmuOstZFS,
+		origin:      "tank/old@s",
+	}
+	if zc.objsetStats != want {
+		t.Errorf("objsetStats = %+v, want %+v", zc.objsetStats, want)
+	}
+	if got := zc.objsetStats.datasetType(); got != DatasetFilesystem {
+		t.Errorf("datasetType() = %v, want filesystem", got)
+	}
+}
+
+func TestZfsCmd_MarshalMatchesRecording(t *testing.T) {
+	skipBigEndian(t)
+
+	zc := zfsCmd{
+		name:          "tank/home",
+		nvlistDst:     0x800401000,
+		nvlistDstSize: 256 << 10,
+		cookie:        42,
+		objsetStats: dmuObjsetStats{
+			numClones:   1,
+			creationTxg: 5,
+			guid:        0x1122334455667788,
+			objsetType:  dmuOstZFS,
+			origin:      "tank/old@s",
+		},
+		cleanupFd: -1,
+		createtxg: 5,
+	}
+
+	buf := make([]byte, zfsCmdBufferSize)
+	for i := range buf {
+		buf[i] = 0xff // marshal must clear stale bytes
+	}
+	if err := zc.marshal(buf); err != nil {
+		t.Fatalf("marshal() error = %v", err)
+	}
+
+	want := recordedBuffer(t, recordedListNext)
+	for i := range want {
+		if buf[i] != want[i] {
+			t.Fatalf("byte %d = %#02x, want %#02x", i, buf[i], want[i])
+		}
+	}
+}
+
+func TestZfsCmd_RoundTrip(t *testing.T) {
+	in := zfsCmd{
+		name:            "tank/vol@snap",
+		nvlistSrc:       1,
+		nvlistSrcSize:   2,
+		nvlistDst:       3,
+		nvlistDstSize:   4,
+		nvlistDstFilled: true,
+		history:         5,
+		value:           "value",
+		str:             "string",
+		guid:            6,
+		nvlistConf:      7,
+		nvlistConfSize:  8,
+		cookie:          9,
+		objsetType:      dmuOstZvol,
+		historyLen:      10,
+		historyOffset:   11,
+		obj:             12,
+		objsetStats: dmuObjsetStats{
+			guid:         13,
+			objsetType:   dmuOstZvol,
+			isSnapshot:   true,
+			inconsistent: true,
+			redacted:     true,
+		},
+		deferDestroy: 1,
+		flags:        14,
+		cleanupFd:    15,
+		simple:       true,
+		createtxg:    16,
+	}
+
+	buf := make([]byte, zfsCmdSize)
+	if err := in.marshal(buf); err != nil {
+		t.Fatalf("marshal() error = %v", err)
+	}
+	var out zfsCmd
+	if err := out.unmarshal(buf); err != nil {
+		t.Fatalf("unmarshal() error = %v", err)
+	}
+	if out != in {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+	if got := out.objsetStats.datasetType(); got != DatasetSnapshot {
+		t.Errorf("datasetType() = %v, want snapshot", got)
+	}
+}
+
+func TestZfsCmd_Errors(t *testing.T) {
+	long := make([]byte, maxPathLen)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	tests := []struct {
+		name string
+		zc   zfsCmd
+		size int
+	}{
+		{"short buffer", zfsCmd{name: "tank"}, zfsCmdSize - 1},
+		{"name too long", zfsCmd{name: string(long)}, zfsCmdSize},
+		{"string too long", zfsCmd{str: string(long[:maxNameLen])}, zfsCmdSize},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.zc.marshal(make([]byte, test.size)); err == nil {
+				t.Error("marshal() succeeded, want error")
+			}
+		})
+	}
+
+	var zc zfsCmd
+	if err := zc.unmarshal(make([]byte, 100)); err == nil {
+		t.Error("unmarshal() of a short buffer succeeded, want error")
+	}
+}
+
+func TestZfsIoctlRequest(t *testing.T) {
+	tests := []struct {
+		nr   uint
+		want uint
+	}{
+		{zfsIocPoolConfigs, 0xc0185a04},
+		{zfsIocPoolStats, 0xc0185a05},
+		{zfsIocObjsetStats, 0xc0185a12},
+		{zfsIocDatasetListNext, 0xc0185a14},
+		{zfsIocSnapshotListNext, 0xc0185a15},
+		{zfsIocPoolGetProps, 0xc0185a27},
+	}
+
+	for _, test := range tests {
+		if got := zfsIoctlRequest(test.nr); got != test.want {
+			t.Errorf("zfsIoctlRequest(%#x) = %#x, want %#x", test.nr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,558 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+// Native dataset property table, following zfs_prop_init in zfs_prop.c.
+// It is shared by every driver: libzfs resolves names itself but uses the
+// table to enumerate all properties, the ioctl driver also uses it to
+// render raw kernel values and fill in defaults.
+
+// dsTypes is a bit mask of the dataset types a property applies to
+type dsTypes uint8
+
+const (
+	forFS   dsTypes = 1 << DatasetFilesystem
+	forVol  dsTypes = 1 << DatasetVolume
+	forSnap dsTypes = 1 << DatasetSnapshot
+	forBmk  dsTypes = 1 << DatasetBookmark
+
+	forDataset = forFS | forVol
+	forAll     = forFS | forVol | forSnap
+)
+
+// datasetProp describes a native dataset property
+type datasetProp struct {
+	format   propFormat
+	index    map[uint64]string // names for formatIndex
+	def      any               // raw value when the kernel omits the property
+	types    dsTypes
+	readonly bool
+	setonce  bool // only settable when the dataset is created
+	inherit  bool
+}
+
+func (p datasetProp) desc() propDesc {
+	return propDesc{format: p.format, index: p.index, def: p.def}
+}
+
+// PropKind describes the raw value of a property
+type PropKind int
+
+const (
+	PropKindString PropKind = iota // string
+	PropKindNumber                 // uint64
+	PropKindBytes                  // uint64 byte count, zero is "none" for quotas
+	PropKindRatio                  // uint64 hundredths, 205 is 2.05x
+	PropKindDate                   // uint64 seconds since the epoch
+	PropKindBool                   // bool, on/off or yes/no
+	PropKindIndex                  // string name from a fixed set of values
+)
+
+func (k PropKind) String() string {
+	switch k {
+	case PropKindString:
+		return "string"
+	case PropKindNumber:
+		return "number"
+	case PropKindBytes:
+		return "bytes"
+	case PropKindRatio:
+		return "ratio"
+	case PropKindDate:
+		return "date"
+	case PropKindBool:
+		return "bool"
+	case PropKindIndex:
+		return "index"
+	default:
+		return "unknown"
+	}
+}
+
+func (p datasetProp) kind() PropKind {
+	switch p.format {
+	case formatNumber, formatLimit, formatPercent:
+		return PropKindNumber
+	case formatBytes, formatQuota, formatOptional:
+		return PropKindBytes
+	case formatRatio:
+		return PropKindRatio
+	case formatDate:
+		return PropKindDate
+	case formatIndex:
+		if len(p.index) == 2 && (p.index[1] == "on" || p.index[1] == "yes") {
+			return PropKindBool
+		}
+		return PropKindIndex
+	}
+	return PropKindString
+}
+
+// Index tables (zprop_index_t) for the index properties
+var (
+	onOffIndex = map[uint64]string{0: "off", 1: "on"}
+	yesNoIndex = map[uint64]string{0: "no", 1: "yes"}
+
+	checksumIndex = map[uint64]string{
+		1: "on", 2: "off", 6: "fletcher2", 7: "fletcher4", 8: "sha256",
+		10: "noparity", 11: "sha512", 12: "skein", 13: "edonr", 14: "blake3",
+	}
+	dedupIndex = map[uint64]string{
+		1: "on", 2: "off", 257: "verify", 8: "sha256", 264: "sha256,verify",
+		11: "sha512", 267: "sha512,verify", 12: "skein", 268: "skein,verify",
+		269: "edonr,verify", 14: "blake3", 270: "blake3,verify",
+	}
+	snapdirIndex    = map[uint64]string{0: "hidden", 1: "visible", 2: "disabled"}
+	snapdevIndex    = map[uint64]string{0: "hidden", 1: "visible"}
+	acltypeIndex    = map[uint64]string{0: "off", 1: "posix", 2: "nfsv4"}
+	aclmodeIndex    = map[uint64]string{0: "discard", 2: "groupmask", 3: "passthrough", 4: "restricted"}
+	aclinheritIndex = map[uint64]string{0: "discard", 1: "noallow", 3: "passthrough", 4: "restricted", 5: "passthrough-x"}
+	canmountIndex   = map[uint64]string{0: "off", 1: "on", 2: "noauto"}
+	cacheIndex      = map[uint64]string{0: "none", 1: "metadata", 2: "all"}
+	logbiasIndex    = map[uint64]string{0: "latency", 1: "throughput"}
+	xattrIndex      = map[uint64]string{0: "off", 1: "on", 2: "sa"}
+	dnodesizeIndex  = map[uint64]string{
+		0: "legacy", 1: "auto", 1 << 10: "1k", 2 << 10: "2k", 4 << 10: "4k", 8 << 10: "8k", 16 << 10: "16k",
+	}
+	redundantIndex = map[uint64]string{0: "all", 1: "most", 2: "some", 3: "none"}
+	syncIndex      = map[uint64]string{0: "standard", 1: "always", 2: "disabled"}
+	volmodeIndex   = map[uint64]string{0: "default", 1: "geom", 2: "dev", 3: "none"}
+	caseIndex      = map[uint64]string{0: "sensitive", 1: "insensitive", 2: "mixed"}
+	normalizeIndex = map[uint64]string{0: "none", 0x50: "formC", 0x10: "formD", 0x60: "formKC", 0x20: "formKD"}
+	encryptIndex   = map[uint64]string{
+		1: "on", 2: "off", 3: "aes-128-ccm", 4: "aes-192-ccm", 5: "aes-256-ccm",
+		6: "aes-128-gcm", 7: "aes-192-gcm", 8: "aes-256-gcm",
+	}
+	keyformatIndex = map[uint64]string{0: "none", 1: "raw", 2: "hex", 3: "passphrase"}
+	keystatusIndex = map[uint64]string{0: "none", 1: "unavailable", 2: "available"}
+)
+
+// Errnos reported for invalid property names and values, and missing pools
+const (
+	errnoNoEnt       = 2  // ENOENT
+	errnoInval       = 22 // EINVAL
+	errnoNameTooLong = 63 // ENAMETOOLONG
+)
+
+// User property limits, ZAP_MAXNAMELEN and ZAP_MAXVALUELEN
+const (
+	maxUserPropNameLen  = 256
+	maxUserPropValueLen = 8192
+)
+
+// noLimit is the value of an unset filesystem_limit or snapshot_limit
+const noLimit = math.MaxUint64
+
+var datasetPropTable = map[string]datasetProp{
+	// Statistics
+	"type":                 {format: formatString, types: forAll | forBmk, readonly: true},
+	"name":                 {format: formatString, types: forAll | forBmk, readonly: true},
+	"creation":             {format: formatDate, types: forAll | forBmk, readonly: true},
+	"createtxg":            {format: formatNumber, types: forAll | forBmk, readonly: true},
+	"guid":                 {format: formatNumber, types: forAll | forBmk, readonly: true},
+	"used":                 {format: formatBytes, types: forAll, readonly: true},
+	"available":            {format: formatBytes, types: forDataset, readonly: true},
+	"referenced":           {format: formatBytes, types: forAll | forBmk, readonly: true},
+	"compressratio":        {format: formatRatio, types: forAll, readonly: true, def: uint64(100)},
+	"refcompressratio":     {format: formatRatio, types: forAll, readonly: true, def: uint64(100)},
+	"usedbysnapshots":      {format: formatBytes, types: forDataset, readonly: true},
+	"usedbydataset":        {format: formatBytes, types: forDataset, readonly: true},
+	"usedbychildren":       {format: formatBytes, types: forDataset, readonly: true},
+	"usedbyrefreservation": {format: formatBytes, types: forDataset, readonly: true},
+	"written":              {format: formatBytes, types: forAll, readonly: true},
+	"logicalused":          {format: formatBytes, types: forAll, readonly: true},
+	"logicalreferenced":    {format: formatBytes, types: forAll, readonly: true},
+	"objsetid":             {format: formatNumber, types: forAll, readonly: true},
+	"userrefs":             {format: formatNumber, types: forSnap, readonly: true},
+	"defer_destroy":        {format: formatIndex, index: onOffIndex, types: forSnap, readonly: true, def: uint64(0)},
+	"clones":               {format: formatString, types: forSnap, readonly: true},
+	"origin":               {format: formatString, types: forDataset, readonly: true},
+	"mounted":              {format: formatIndex, index: yesNoIndex, types: forFS, readonly: true},
+	"filesystem_count":     {format: formatNumber, types: forFS, readonly: true},
+	"snapshot_count":       {format: formatNumber, types: forDataset, readonly: true},
+	"snapshots_changed":    {format: formatDate, types: forDataset, readonly: true},
+	"receive_resume_token": {format: formatString, types: forDataset, readonly: true},
+	"redact_snaps":         {format: formatString, types: forAll | forBmk, readonly: true},
+	"encryptionroot":       {format: formatString, types: forDataset, readonly: true},
+	"keystatus":            {format: formatIndex, index: keystatusIndex, types: forDataset, readonly: true},
+
+	// Space management
+	"quota":                {format: formatQuota, types: forFS, def: uint64(0)},
+	"refquota":             {format: formatQuota, types: forFS, def: uint64(0)},
+	"reservation":          {format: formatQuota, types: forDataset, def: uint64(0)},
+	"refreservation":       {format: formatQuota, types: forDataset, def: uint64(0)},
+	"volsize":              {format: formatBytes, types: forVol},
+	"filesystem_limit":     {format: formatLimit, types: forFS, def: uint64(noLimit)},
+	"snapshot_limit":       {format: formatLimit, types: forDataset, def: uint64(noLimit)},
+	"recordsize":           {format: formatBytes, types: forFS, inherit: true, def: uint64(128 << 10)},
+	"volblocksize":         {format: formatBytes, types: forVol, setonce: true, def: uint64(16 << 10)},
+	"special_small_blocks": {format: formatBytes, types: forFS, inherit: true, def: uint64(0)},
+
+	// Inheritable index properties
+	"checksum":           {format: formatIndex, index: checksumIndex, types: forDataset, inherit: true, def: uint64(1)},
+	"compression":        {format: formatIndex, types: forDataset, inherit: true, def: uint64(1)},
+	"dedup":              {format: formatIndex, index: dedupIndex, types: forDataset, inherit: true, def: uint64(2)},
+	"atime":              {format: formatIndex, index: onOffIndex, types: forFS, inherit: true, def: uint64(1)},
+	"relatime":           {format: formatIndex, index: onOffIndex, types: forFS | forSnap, inherit: true, def: uint64(0)},
+	"devices":            {format: formatIndex, index: onOffIndex, types: forFS | forSnap, inherit: true, def: uint64(1)},
+	"exec":               {format: formatIndex, index: onOffIndex, types: forFS | forSnap, inherit: true, def: uint64(1)},
+	"setuid":             {format: formatIndex, index: onOffIndex, types: forFS | forSnap, inherit: true, def: uint64(1)},
+	"readonly":           {format: formatIndex, index: onOffIndex, types: forDataset, inherit: true, def: uint64(0)},
+	"jailed":             {format: formatIndex, index: onOffIndex, types: forFS, inherit: true, def: uint64(0)},
+	"vscan":              {format: formatIndex, index: onOffIndex, types: forFS, inherit: true, def: uint64(0)},
+	"nbmand":             {format: formatIndex, index: onOffIndex, types: forFS | forSnap, inherit: true, def: uint64(0)},
+	"overlay":            {format: formatIndex, index: onOffIndex, types: forFS, inherit: true, def: uint64(1)},
+	"snapdir":            {format: formatIndex, index: snapdirIndex, types: forFS, inherit: true, def: uint64(0)},
+	"snapdev":            {format: formatIndex, index: snapdevIndex, types: forVol, inherit: true, def: uint64(0)},
+	"acltype":            {format: formatIndex, index: acltypeIndex, types: forFS | forSnap, inherit: true, def: uint64(2)},
+	"aclmode":            {format: formatIndex, index: aclmodeIndex, types: forFS, inherit: true, def: uint64(0)},
+	"aclinherit":         {format: formatIndex, index: aclinheritIndex, types: forFS, inherit: true, def: uint64(4)},
+	"xattr":              {format: formatIndex, index: xattrIndex, types: forFS | forSnap, inherit: true, def: uint64(1)},
+	"copies":             {format: formatNumber, types: forDataset, inherit: true, def: uint64(1)},
+	"primarycache":       {format: formatIndex, index: cacheIndex, types: forAll, inherit: true, def: uint64(2)},
+	"secondarycache":     {format: formatIndex, index: cacheIndex, types: forAll, inherit: true, def: uint64(2)},
+	"logbias":            {format: formatIndex, index: logbiasIndex, types: forDataset, inherit: true, def: uint64(0)},
+	"sync":               {format: formatIndex, index: syncIndex, types: forDataset, inherit: true, def: uint64(0)},
+	"dnodesize":          {format: formatIndex, index: dnodesizeIndex, types: forFS, inherit: true, def: uint64(0)},
+	"redundant_metadata": {format: formatIndex, index: redundantIndex, types: forDataset, inherit: true, def: uint64(0)},
+	"volmode":            {format: formatIndex, index: volmodeIndex, types: forVol, inherit: true, def: uint64(0)},
+	"canmount":           {format: formatIndex, index: canmountIndex, types: forFS, def: uint64(1)},
+
+	// Set at creation time
+	"version":         {format: formatNumber, types: forFS | forSnap, def: uint64(5)},
+	"utf8only":        {format: formatIndex, index: onOffIndex, types: forFS | forSnap, setonce: true, def: uint64(0)},
+	"normalization":   {format: formatIndex, index: normalizeIndex, types: forFS | forSnap, setonce: true, def: uint64(0)},
+	"casesensitivity": {format: formatIndex, index: caseIndex, types: forFS | forSnap, setonce: true, def: uint64(0)},
+	"encryption":      {format: formatIndex, index: encryptIndex, types: forAll, setonce: true, def: uint64(2)},
+	"keyformat":       {format: formatIndex, index: keyformatIndex, types: forDataset, setonce: true, def: uint64(0)},
+	"pbkdf2iters":     {format: formatNumber, types: forDataset, setonce: true, def: uint64(0)},
+
+	// Inheritable string properties
+	"mountpoint":  {format: formatString, types: forFS, inherit: true},
+	"sharenfs":    {format: formatString, types: forFS, inherit: true, def: "off"},
+	"sharesmb":    {format: formatString, types: forFS, inherit: true, def: "off"},
+	"mlslabel":    {format: formatString, types: forAll, inherit: true, def: "none"},
+	"keylocation": {format: formatString, types: forDataset, def: "none"},
+}
+
+// datasetPropAliases maps the short names accepted by zfs(8), and the
+// names used by this package's constants, to the canonical property names
+var datasetPropAliases = map[string]string{
+	"avail":         "available",
+	"refer":         "referenced",
+	"ratio":         "compressratio",
+	"refratio":      "refcompressratio",
+	"compress":      "compression",
+	"recsize":       "recordsize",
+	"reserv":        "reservation",
+	"refreserv":     "refreservation",
+	"volblock":      "volblocksize",
+	"usedsnap":      "usedbysnapshots",
+	"usedds":        "usedbydataset",
+	"usedchild":     "usedbychildren",
+	"usedrefreserv": "usedbyrefreservation",
+	"lused":         "logicalused",
+	"lrefer":        "logicalreferenced",
+	"normalize":     "normalization",
+	"zoned":         "jailed",
+}
+
+// CanonicalDatasetProp resolves a native dataset property name or alias to
+// its canonical name. It reports false for names that are not native
+// properties.
+func CanonicalDatasetProp(name string) (string, bool) {
+	if canonical, ok := datasetPropAliases[name]; ok {
+		name = canonical
+	}
+	_, ok := datasetPropTable[name]
+	return name, ok
+}
+
+// UnknownPropertyError reports a property name that is neither a native
+// property nor an alias of one
+func UnknownPropertyError(resource, name string) error {
+	return zfserrors.NewZfsError("get_property", resource, zfserrors.ErrCodeInval, errnoInval,
+		fmt.Sprintf("unknown property %q", name), nil)
+}
+
+// IsUserProp reports whether name is a user property, which always
+// contains a colon, e.g. com.example:owner
+func IsUserProp(name string) bool {
+	return strings.Contains(name, ":")
+}
+
+// ValidateUserProp applies the libzfs rules for user property names and
+// values: the name contains a colon and only lowercase letters, digits
+// and ":-_.", and both stay below the ZAP limits. An empty value is valid.
+func ValidateUserProp(resource, name, value string) error {
+	invalid := func(detail string) error {
+		return zfserrors.NewZfsError("set_property", resource, zfserrors.ErrCodeInval, errnoInval, detail, nil)
+	}
+
+	if !IsUserProp(name) {
+		return invalid(fmt.Sprintf("user property %q must contain a colon", name))
+	}
+	if len(name) >= maxUserPropNameLen {
+		return zfserrors.NewZfsError("set_property", resource, zfserrors.ErrCodeNameTooLong, errnoNameTooLong,
+			fmt.Sprintf("property name %q is too long", name), nil)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune(":-_.", c)) {
+			return invalid(fmt.Sprintf("invalid character %q in property name %q", c, name))
+		}
+	}
+	if len(value) >= maxUserPropValueLen {
+		return invalid(fmt.Sprintf("value of property %q is too long", name))
+	}
+	return nil
+}
+
+// ValidateDatasetProp applies the libzfs rules for setting a property on
+// an existing dataset of type t. User properties follow ValidateUserProp;
+// native ones must be settable after creation, apply to the type and hold
+// a value of the right kind.
+func ValidateDatasetProp(resource string, t DatasetType, name, value string) error {
+	if IsUserProp(name) {
+		return ValidateUserProp(resource, name, value)
+	}
+	invalid := func(detail string) error {
+		return zfserrors.NewZfsError("set_property", resource, zfserrors.ErrCodeInval, errnoInval, detail, nil)
+	}
+
+	canonical, ok := CanonicalDatasetProp(name)
+	if !ok {
+		return invalid(fmt.Sprintf("invalid property %q", name))
+	}
+	prop := datasetPropTable[canonical]
+	switch {
+	case prop.readonly:
+		return invalid(fmt.Sprintf("property %q is read-only", canonical))
+	case prop.setonce:
+		return invalid(fmt.Sprintf("property %q can only be set at creation time", canonical))
+	case t == DatasetSnapshot:
+		return invalid("this property can not be modified for snapshots")
+	case prop.types&(1<<t) == 0:
+		return invalid(fmt.Sprintf("property %q does not apply to %ss", canonical, t))
+	}
+
+	if !validPropValue(canonical, prop, value) {
+		return invalid(fmt.Sprintf("bad value %q for property %q", value, canonical))
+	}
+	return nil
+}
+
+// ValidateDatasetProps checks a batch of properties with
+// ValidateDatasetProp and also rejects names that set the same property
+// twice, e.g. compress and compression. Every rejected property is
+// reported in a *zfserrors.PropertyErrors.
+func ValidateDatasetProps(resource string, t DatasetType, props map[string]string) error {
+	errs := make(map[string]error)
+	seen := make(map[string][]string)
+	for name, value := range props {
+		if err := ValidateDatasetProp(resource, t, name, value); err != nil {
+			errs[name] = err
+			continue
+		}
+		canonical, _ := CanonicalDatasetProp(name)
+		seen[canonical] = append(seen[canonical], name)
+	}
+	for canonical, names := range seen {
+		if len(names) < 2 {
+			continue
+		}
+		for _, name := range names {
+			errs[name] = zfserrors.NewZfsError("set_property", resource, zfserrors.ErrCodeInval, errnoInval,
+				fmt.Sprintf("property %q is set more than once", canonical), nil)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &zfserrors.PropertyErrors{Op: "set_properties", Resource: resource, Errors: errs}
+}
+
+// validPropValue reports whether value parses as the kind of prop
+func validPropValue(name string, prop datasetProp, value string) bool {
+	switch prop.kind() {
+	case PropKindNumber, PropKindBytes, PropKindBool:
+		_, err := parsePropValue(prop, value)
+		return err == nil
+	case PropKindIndex:
+		if name == "compression" {
+			return validCompression(value)
+		}
+		for _, v := range prop.index {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	if name == "mountpoint" {
+		return value == "none" || value == "legacy" || strings.HasPrefix(value, "/")
+	}
+	return true
+}
+
+// validCompression accepts the compression names, gzip as an alias of
+// gzip-6 and the zstd and zstd-fast levels
+func validCompression(value string) bool {
+	for _, name := range compressionIndex {
+		if name == value && name != "inherit" && name != "empty" {
+			return true
+		}
+	}
+	if value == "gzip" {
+		return true
+	}
+	if level, ok := strings.CutPrefix(value, "zstd-fast-"); ok {
+		n, err := strconv.Atoi(level)
+		return err == nil && slices.Contains(zstdFastLevels, n)
+	}
+	if level, ok := strings.CutPrefix(value, "zstd-"); ok {
+		n, err := strconv.Atoi(level)
+		return err == nil && n >= 1 && n <= 19
+	}
+	return false
+}
+
+// DatasetPropKind returns the kind of a native property's raw value.
+// User properties and unknown names are strings.
+func DatasetPropKind(name string) PropKind {
+	name, ok := CanonicalDatasetProp(name)
+	if !ok {
+		return PropKindString
+	}
+	return datasetPropTable[name].kind()
+}
+
+// DatasetPropApplies reports whether a native property applies to a dataset type
+func DatasetPropApplies(name string, t DatasetType) bool {
+	name, ok := CanonicalDatasetProp(name)
+	return ok && datasetPropTable[name].types&(1<<t) != 0
+}
+
+// IsDatasetPropReadOnly reports whether a native property is read-only
+func IsDatasetPropReadOnly(name string) bool {
+	name, ok := CanonicalDatasetProp(name)
+	return ok && datasetPropTable[name].readonly
+}
+
+// DatasetPropNames returns the canonical names of the native properties
+// that apply to a dataset type, sorted
+func DatasetPropNames(t DatasetType) []string {
+	names := make([]string, 0, len(datasetPropTable))
+	for name, prop := range datasetPropTable {
+		if prop.types&(1<<t) != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseNiceNum parses a number with an optional binary unit suffix, such
+// as 1.5G, 10K, 4KiB or 512B, like zfs_nicestrtonum
+func ParseNiceNum(s string) (uint64, error) {
+	num := strings.TrimRightFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if num == "" {
+		return 0, fmt.Errorf("bad numeric value %q", s)
+	}
+
+	shift := 0
+	if suffix := strings.ToUpper(s[len(num):]); suffix != "" {
+		i := strings.IndexByte("BKMGTPE", suffix[0])
+		rest := suffix[1:]
+		if i < 0 || (i == 0 && rest != "") || (rest != "" && rest != "B" && rest != "IB") {
+			return 0, fmt.Errorf("invalid numeric suffix in %q", s)
+		}
+		shift = 10 * i
+	}
+
+	if !strings.Contains(num, ".") {
+		n, err := strconv.ParseUint(num, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad numeric value %q", s)
+		}
+		if n > math.MaxUint64>>shift {
+			return 0, fmt.Errorf("numeric value %q is too large", s)
+		}
+		return n << shift, nil
+	}
+
+	if shift == 0 {
+		return 0, fmt.Errorf("fractional value %q needs a unit suffix", s)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric value %q", s)
+	}
+	f *= float64(uint64(1) << shift)
+	if f >= math.MaxUint64 {
+		return 0, fmt.Errorf("numeric value %q is too large", s)
+	}
+	return uint64(f), nil
+}
+
+// ParseDatasetPropValue converts a property value in zfs get form, human
+// or parsable, to its raw form as reported in PropertyInfo.Raw
+func ParseDatasetPropValue(name, value string) (any, error) {
+	canonical, ok := CanonicalDatasetProp(name)
+	if !ok {
+		return value, nil
+	}
+	return parsePropValue(datasetPropTable[canonical], value)
+}
+
+// parsePropValue converts a value as zfs get or zpool get prints it to the
+// raw form of prop
+func parsePropValue(prop datasetProp, value string) (any, error) {
+	switch prop.kind() {
+	case PropKindNumber, PropKindBytes:
+		switch {
+		case value == "none" && prop.format == formatLimit:
+			return uint64(noLimit), nil
+		case value == "none" && prop.format == formatQuota:
+			return uint64(0), nil
+		case value == "-" && prop.format == formatPercent:
+			return uint64(noLimit), nil
+		case value == "-" && prop.format == formatOptional:
+			return uint64(0), nil
+		case prop.format == formatPercent:
+			return strconv.ParseUint(strings.TrimSuffix(value, "%"), 10, 64)
+		}
+		return ParseNiceNum(value)
+	case PropKindRatio:
+		whole, frac, _ := strings.Cut(strings.TrimSuffix(value, "x"), ".")
+		w, err := strconv.ParseUint(whole, 10, 64)
+		if err != nil || len(frac) > 2 {
+			return nil, fmt.Errorf("bad ratio %q", value)
+		}
+		f, err := strconv.ParseUint((frac + "00")[:2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad ratio %q", value)
+		}
+		return w*100 + f, nil
+	case PropKindDate:
+		return strconv.ParseUint(value, 10, 64)
+	case PropKindBool:
+		switch value {
+		case "on", "yes":
+			return true, nil
+		case "off", "no":
+			return false, nil
+		}
+		return nil, fmt.Errorf("bad boolean value %q", value)
+	}
+	return value, nil
+}
@@ -0,0 +1,300 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+func TestCanonicalDatasetProp(t *testing.T) {
+	tests := []struct {
+		name      string
+		canonical string
+		known     bool
+	}{
+		{"used", "used", true},
+		{"avail", "available", true},
+		{"refer", "referenced", true},
+		{"compress", "compression", true},
+		{"recsize", "recordsize", true},
+		{"zoned", "jailed", true},
+		{"lrefer", "logicalreferenced", true},
+		{"special_small_blocks", "special_small_blocks", true},
+		{"bogus", "bogus", false},
+		{"com.example:prop", "com.example:prop", false},
+	}
+
+	for _, test := range tests {
+		canonical, known := CanonicalDatasetProp(test.name)
+		if canonical != test.canonical || known != test.known {
+			t.Errorf("CanonicalDatasetProp(%q) = %q, %v, want %q, %v",
+				test.name, canonical, known, test.canonical, test.known)
+		}
+	}
+}
+
+func TestDatasetPropTable(t *testing.T) {
+	for alias, name := range datasetPropAliases {
+		if _, ok := datasetPropTable[name]; !ok {
+			t.Errorf("alias %s refers to unknown property %s", alias, name)
+		}
+	}
+	for name, prop := range datasetPropTable {
+		if prop.types == 0 {
+			t.Errorf("%s applies to no dataset type", name)
+		}
+		if prop.readonly && prop.inherit {
+			t.Errorf("%s is both read-only and inheritable", name)
+		}
+		if v, ok := prop.def.(uint64); ok && prop.index != nil {
+			if _, ok := prop.index[v]; !ok {
+				t.Errorf("%s default %d is not in its index", name, v)
+			}
+		}
+	}
+}
+
+func TestDatasetPropNames(t *testing.T) {
+	tests := []struct {
+		dsType DatasetType
+		has    []string
+		hasNot []string
+	}{
+		{DatasetFilesystem, []string{"mountpoint", "atime", "quota", "used"}, []string{"volsize", "userrefs"}},
+		{DatasetVolume, []string{"volsize", "volblocksize", "used"}, []string{"mountpoint", "recordsize"}},
+		{DatasetSnapshot, []string{"userrefs", "defer_destroy", "used"}, []string{"quota", "available"}},
+		{DatasetBookmark, []string{"guid", "createtxg"}, []string{"used"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dsType.String(), func(t *testing.T) {
+			names := DatasetPropNames(test.dsType)
+			set := make(map[string]bool)
+			for i, name := range names {
+				set[name] = true
+				if i > 0 && names[i-1] >= name {
+					t.Errorf("names not sorted at %s", name)
+				}
+			}
+			for _, name := range test.has {
+				if !set[name] {
+					t.Errorf("missing %s", name)
+				}
+			}
+			for _, name := range test.hasNot {
+				if set[name] {
+					t.Errorf("unexpected %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownPropertyError(t *testing.T) {
+	err := UnknownPropertyError("tank/home", "bogus")
+	if !zfserrors.IsUnknownProperty(err) {
+		t.Errorf("IsUnknownProperty(%v) = false", err)
+	}
+	zfsErr, _ := zfserrors.AsZfsError(err)
+	if zfsErr.Resource != "tank/home" || zfsErr.Errno != errnoInval {
+		t.Errorf("error = %+v", zfsErr)
+	}
+	if IsDatasetPropReadOnly("quota") || !IsDatasetPropReadOnly("avail") {
+		t.Error("IsDatasetPropReadOnly() disagrees with the table")
+	}
+}
+
+func TestDatasetPropKind(t *testing.T) {
+	tests := []struct {
+		name string
+		want PropKind
+	}{
+		{"used", PropKindBytes},
+		{"avail", PropKindBytes},
+		{"quota", PropKindBytes},
+		{"guid", PropKindNumber},
+		{"copies", PropKindNumber},
+		{"snapshot_limit", PropKindNumber},
+		{"compressratio", PropKindRatio},
+		{"creation", PropKindDate},
+		{"atime", PropKindBool},
+		{"mounted", PropKindBool},
+		{"compression", PropKindIndex},
+		{"sync", PropKindIndex},
+		{"mountpoint", PropKindString},
+		{"com.example:prop", PropKindString},
+	}
+
+	for _, test := range tests {
+		if got := DatasetPropKind(test.name); got != test.want {
+			t.Errorf("DatasetPropKind(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseNiceNum(t *testing.T) {
+	tests := []struct {
+		s    string
+		want uint64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"1K", 1 << 10},
+		{"1k", 1 << 10},
+		{"128K", 128 << 10},
+		{"4KiB", 4 << 10},
+		{"10GB", 10 << 30},
+		{"1.5G", 3 << 29},
+		{"1.50K", 1536},
+		{"1E", 1 << 60},
+	}
+
+	for _, test := range tests {
+		got, err := ParseNiceNum(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("ParseNiceNum(%q) = %d, %v, want %d", test.s, got, err, test.want)
+		}
+	}
+
+	for _, bad := range []string{"", "G", "1X", "1.5", "-1", "1BB", "16E", "1KX"} {
+		if _, err := ParseNiceNum(bad); err == nil {
+			t.Errorf("ParseNiceNum(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseDatasetPropValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  any
+	}{
+		{"used", "1.50K", uint64(1536)},
+		{"quota", "none", uint64(0)},
+		{"filesystem_limit", "none", uint64(noLimit)},
+		{"compressratio", "2.05x", uint64(205)},
+		{"refratio", "1.5x", uint64(150)},
+		{"creation", "1700000000", uint64(1700000000)},
+		{"atime", "off", false},
+		{"mounted", "yes", true},
+		{"compression", "zstd-19", "zstd-19"},
+		{"mountpoint", "/data", "/data"},
+		{"com.example:prop", "10G", "10G"},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDatasetPropValue(test.name, test.value)
+		if err != nil || got != test.want {
+			t.Errorf("ParseDatasetPropValue(%q, %q) = %v, %v, want %v", test.name, test.value, got, err, test.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"atime", "maybe"}, {"compressratio", "x"}, {"used", "lots"}} {
+		if _, err := ParseDatasetPropValue(bad[0], bad[1]); err == nil {
+			t.Errorf("ParseDatasetPropValue(%q, %q) succeeded, want error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestValidateUserProp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		code  string
+	}{
+		{"com.example:owner", "ops", ""},
+		{"org.freebsd:swap", "", ""},
+		{"a:b-c_d.e", "x", ""},
+		{"owner", "ops", zfserrors.ErrCodeInval},
+		{"com.Example:owner", "ops", zfserrors.ErrCodeInval},
+		{"com.example:own er", "ops", zfserrors.ErrCodeInval},
+		{"com.example:" + strings.Repeat("x", maxUserPropNameLen), "ops", zfserrors.ErrCodeNameTooLong},
+		{"com.example:owner", strings.Repeat("x", maxUserPropValueLen), zfserrors.ErrCodeInval},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateUserProp("tank/home", test.name, test.value)
+			if test.code == "" {
+				if err != nil {
+					t.Errorf("ValidateUserProp() error = %v", err)
+				}
+				return
+			}
+			zfsErr, ok := zfserrors.AsZfsError(err)
+			if !ok || zfsErr.Code != test.code || zfsErr.Op != "set_property" {
+				t.Errorf("ValidateUserProp() error = %v, want %s", err, test.code)
+			}
+		})
+	}
+}
+
+func TestValidateDatasetProp(t *testing.T) {
+	tests := []struct {
+		typ   DatasetType
+		name  string
+		value string
+		valid bool
+	}{
+		{DatasetFilesystem, "compression", "zstd-19", true},
+		{DatasetFilesystem, "compress", "gzip", true},
+		{DatasetFilesystem, "compression", "zstd-fast-500", true},
+		{DatasetFilesystem, "compression", "zstd-20", false},
+		{DatasetFilesystem, "compression", "inherit", false},
+		{DatasetFilesystem, "quota", "10G", true},
+		{DatasetFilesystem, "quota", "none", true},
+		{DatasetFilesystem, "quota", "lots", false},
+		{DatasetFilesystem, "atime", "off", true},
+		{DatasetFilesystem, "atime", "maybe", false},
+		{DatasetFilesystem, "sync", "always", true},
+		{DatasetFilesystem, "mountpoint", "/data", true},
+		{DatasetFilesystem, "mountpoint", "data", false},
+		{DatasetFilesystem, "com.example:owner", "ops", true},
+		{DatasetFilesystem, "used", "1G", false},
+		{DatasetFilesystem, "casesensitivity", "mixed", false},
+		{DatasetFilesystem, "volsize", "1G", false},
+		{DatasetFilesystem, "bogus", "1", false},
+		{DatasetVolume, "volsize", "2G", true},
+		{DatasetVolume, "volblocksize", "8K", false},
+		{DatasetSnapshot, "atime", "off", false},
+		{DatasetSnapshot, "com.example:owner", "ops", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.typ.String()+"/"+test.name+"="+test.value, func(t *testing.T) {
+			err := ValidateDatasetProp("tank/data", test.typ, test.name, test.value)
+			if (err == nil) != test.valid {
+				t.Errorf("ValidateDatasetProp() error = %v, want valid %v", err, test.valid)
+			}
+			if err != nil && !zfserrors.IsZfsError(err) {
+				t.Errorf("ValidateDatasetProp() error = %T, want *ZfsError", err)
+			}
+		})
+	}
+}
+
+func TestValidateDatasetProps(t *testing.T) {
+	if err := ValidateDatasetProps("tank/data", DatasetFilesystem, map[string]string{
+		"quota": "10G", "reservation": "1G", "compression": "lz4",
+	}); err != nil {
+		t.Errorf("ValidateDatasetProps() error = %v", err)
+	}
+
+	err := ValidateDatasetProps("tank/data", DatasetFilesystem, map[string]string{
+		"quota": "lots", "compress": "lz4", "compression": "zstd", "atime": "off", "used": "1",
+	})
+	propErrs, ok := zfserrors.AsPropertyErrors(err)
+	if !ok {
+		t.Fatalf("ValidateDatasetProps() error = %v, want PropertyErrors", err)
+	}
+	for _, name := range []string{"quota", "compress", "compression", "used"} {
+		if propErrs.Errors[name] == nil {
+			t.Errorf("%s not reported", name)
+		}
+	}
+	if propErrs.Errors["atime"] != nil || propErrs.Resource != "tank/data" {
+		t.Errorf("report = %+v", propErrs)
+	}
+}
@@ -0,0 +1,147 @@
+package driver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+// Special values of the compatibility pool property
+const (
+	CompatibilityOff    = "off"    // Every feature may be enabled
+	CompatibilityLegacy = "legacy" // No feature may be enabled
+)
+
+// CompatibilityDirs are the directories searched for the feature-set files
+// named by the compatibility property, local ones first as in
+// ZPOOL_SYSCONF_COMPAT_D and ZPOOL_DATA_COMPAT_D
+var CompatibilityDirs = []string{"/etc/zfs/compatibility.d", "/usr/share/zfs/compatibility.d"}
+
+// LoadCompatibility returns the sorted pool features a compatibility
+// property value allows, like zpool_load_compat. The value is off, legacy
+// or a comma-separated list of feature-set files from dirs; a feature is
+// allowed when every file lists it. Unknown features are an error in files
+// of the first directory and ignored in the others, which ship with ZFS
+// and may name features of newer releases.
+func LoadCompatibility(compatibility string, dirs []string) ([]string, error) {
+	switch compatibility {
+	case "", CompatibilityOff:
+		return PoolFeatureNames(), nil
+	case CompatibilityLegacy:
+		return []string{}, nil
+	}
+
+	var allowed map[string]bool
+	for _, file := range strings.Split(compatibility, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		if file == "." || file == ".." || strings.Contains(file, "/") {
+			return nil, compatibilityError(compatibility, fmt.Sprintf("invalid feature-set file name %q", file))
+		}
+
+		features, local, err := readFeatureSet(file, dirs)
+		if err != nil {
+			return nil, compatibilityError(compatibility, err.Error())
+		}
+
+		set := make(map[string]bool)
+		for _, name := range features {
+			if _, known := poolFeatures[name]; known {
+				set[name] = true
+			} else if local {
+				return nil, compatibilityError(compatibility, fmt.Sprintf("unknown feature %q in %s", name, file))
+			}
+		}
+		if allowed == nil {
+			allowed = set
+			continue
+		}
+		for name := range allowed {
+			if !set[name] {
+				delete(allowed, name)
+			}
+		}
+	}
+
+	if allowed == nil {
+		return PoolFeatureNames(), nil
+	}
+	names := make([]string, 0, len(allowed))
+	for name := range allowed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readFeatureSet reads a feature-set file from the first of dirs holding it
+// and reports whether that was the first directory
+func readFeatureSet(file string, dirs []string) ([]string, bool, error) {
+	for i, dir := range dirs {
+		f, err := os.Open(filepath.Join(dir, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		features, err := parseFeatureSet(f)
+		f.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %w", f.Name(), err)
+		}
+		return features, i == 0, nil
+	}
+	return nil, false, fmt.Errorf("feature-set file %s not found", file)
+}
+
+// parseFeatureSet parses the feature names of a feature-set file, separated
+// by whitespace or commas, with # starting a comment
+func parseFeatureSet(r io.Reader) ([]string, error) {
+	var features []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		features = append(features, strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t' || c == '\r'
+		})...)
+	}
+	return features, scanner.Err()
+}
+
+// compatibilityError reports an unusable compatibility property value
+func compatibilityError(compatibility, detail string) error {
+	return zfserrors.NewZfsError("load_compatibility", compatibility, zfserrors.ErrCodeInval, errnoInval, detail, nil)
+}
+
+// CompatibilityCreateProps returns the properties to create a pool with so
+// that it only enables the features its compatibility property allows. As
+// zpool create does, each allowed feature is enabled explicitly, which keeps
+// the kernel from enabling every other one. Properties already naming
+// features are left alone.
+func CompatibilityCreateProps(props map[string]string, allowed []string) map[string]string {
+	for name := range props {
+		if IsPoolFeatureProp(name) {
+			return props
+		}
+	}
+
+	merged := make(map[string]string, len(props)+len(allowed))
+	for name, value := range props {
+		merged[name] = value
+	}
+	for _, feature := range allowed {
+		merged[poolFeaturePrefix+feature] = FeatureEnabled
+	}
+	return merged
+}
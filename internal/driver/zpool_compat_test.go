@@ -0,0 +1,88 @@
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFeatureSet(t *testing.T) {
+	input := "# openzfs-2.0\nasync_destroy\nbookmarks, embedded_data\n\tlz4_compress  # comment\n\n"
+	got, err := parseFeatureSet(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseFeatureSet() error = %v", err)
+	}
+	want := []string{"async_destroy", "bookmarks", "embedded_data", "lz4_compress"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFeatureSet() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadCompatibility(t *testing.T) {
+	local, data := t.TempDir(), t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(data, "openzfs-2.1", "async_destroy\nbookmarks\nlz4_compress\nsome_future_feature\n")
+	write(data, "grub2", "async_destroy, lz4_compress\nhole_birth\n")
+	write(local, "site", "lz4_compress\nbogus_feature\n")
+	write(data, "site", "lz4_compress\n")
+	dirs := []string{local, data}
+
+	tests := []struct {
+		compatibility string
+		want          []string
+		wantErr       bool
+	}{
+		{"legacy", []string{}, false},
+		{"openzfs-2.1", []string{"async_destroy", "bookmarks", "lz4_compress"}, false},
+		{"openzfs-2.1,grub2", []string{"async_destroy", "lz4_compress"}, false},
+		{"site", nil, true},
+		{"missing", nil, true},
+		{"../grub2", nil, true},
+		{"grub2, openzfs-2.1,", []string{"async_destroy", "lz4_compress"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.compatibility, func(t *testing.T) {
+			got, err := LoadCompatibility(test.compatibility, dirs)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("LoadCompatibility(%q) error = %v, wantErr %v", test.compatibility, err, test.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("LoadCompatibility(%q) = %v, want %v", test.compatibility, got, test.want)
+			}
+		})
+	}
+
+	all, err := LoadCompatibility("off", dirs)
+	if err != nil || len(all) != len(poolFeatures) {
+		t.Errorf("LoadCompatibility(off) = %d features, %v, want all %d", len(all), err, len(poolFeatures))
+	}
+}
+
+func TestCompatibilityCreateProps(t *testing.T) {
+	props := map[string]string{"compatibility": "grub2"}
+	got := CompatibilityCreateProps(props, []string{"async_destroy", "lz4_compress"})
+	want := map[string]string{
+		"compatibility":         "grub2",
+		"feature@async_destroy": FeatureEnabled,
+		"feature@lz4_compress":  FeatureEnabled,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CompatibilityCreateProps() = %v, want %v", got, want)
+	}
+	if len(props) != 1 {
+		t.Errorf("CompatibilityCreateProps() modified its input: %v", props)
+	}
+
+	explicit := map[string]string{"compatibility": "grub2", "feature@lz4_compress": FeatureEnabled}
+	if got := CompatibilityCreateProps(explicit, []string{"async_destroy"}); !reflect.DeepEqual(got, explicit) {
+		t.Errorf("CompatibilityCreateProps() with explicit features = %v, want %v", got, explicit)
+	}
+}
@@ -0,0 +1,106 @@
+package driver
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+// History record nvlist keys (ZPOOL_HIST_* in sys/fs/zfs.h)
+const (
+	zpoolHistRecord   = "history record"
+	zpoolHistTime     = "history time"
+	zpoolHistCmd      = "history command"
+	zpoolHistWho      = "history who"
+	zpoolHistHost     = "history hostname"
+	zpoolHistZone     = "history zone"
+	zpoolHistTXG      = "history txg"
+	zpoolHistIntEvent = "history internal event"
+	zpoolHistIntStr   = "history internal str"
+	zpoolHistIntName  = "internal_name"
+	zpoolHistIoctl    = "ioctl"
+	zpoolHistDSName   = "dsname"
+	zpoolHistDSID     = "dsid"
+	zpoolHistErrno    = "errno"
+)
+
+// historyBufferSize is the size of the first buffer the history is read
+// into, as in zpool_get_history
+const historyBufferSize = 128 << 10
+
+// legacyHistoryEvents names the internal events pools written by older
+// releases log by number (zfs_history_event_names)
+var legacyHistoryEvents = []string{
+	"invalid event", "pool create", "vdev add", "pool remove",
+	"pool destroy", "pool export", "pool import", "vdev attach",
+	"vdev replace", "vdev detach", "vdev online", "vdev offline",
+	"vdev upgrade", "pool clear", "pool scrub", "pool property set",
+	"create", "clone", "destroy", "destroy_begin_sync",
+	"inherit", "property set", "quota set", "permission update",
+	"permission remove", "permission who remove", "promote", "receive",
+	"rename", "reservation set", "replay_inc_sync", "replay_full_sync",
+	"rollback", "snapshot", "filesystem version upgrade", "refquota set",
+	"refreservation set", "pool scrub done", "user hold", "user release",
+	"pool split",
+}
+
+// parseHistoryRecord converts a history record nvlist
+func parseHistoryRecord(nvl *nvlist.List) HistoryRecord {
+	var record HistoryRecord
+	record.Time, _ = nvl.LookupUint64(zpoolHistTime)
+	record.Command, _ = nvl.LookupString(zpoolHistCmd)
+	record.Who, record.HasWho = nvl.LookupUint64(zpoolHistWho)
+	record.Host, _ = nvl.LookupString(zpoolHistHost)
+	record.Zone, _ = nvl.LookupString(zpoolHistZone)
+	record.TXG, _ = nvl.LookupUint64(zpoolHistTXG)
+	record.Detail, _ = nvl.LookupString(zpoolHistIntStr)
+	record.Dataset, _ = nvl.LookupString(zpoolHistDSName)
+	record.DatasetID, _ = nvl.LookupUint64(zpoolHistDSID)
+	record.Ioctl, _ = nvl.LookupString(zpoolHistIoctl)
+	record.Errno, _ = nvl.LookupInt64(zpoolHistErrno)
+
+	if name, ok := nvl.LookupString(zpoolHistIntName); ok {
+		record.Event = name
+	} else if event, ok := nvl.LookupUint64(zpoolHistIntEvent); ok {
+		if event < uint64(len(legacyHistoryEvents)) {
+			record.Event = legacyHistoryEvents[event]
+		} else {
+			record.Event = fmt.Sprintf("unknown event %d", event)
+		}
+	}
+	return record
+}
+
+// parseHistoryRecords converts the ZPOOL_HIST_RECORD array zpool_get_history
+// returns
+func parseHistoryRecords(nvhis *nvlist.List) []HistoryRecord {
+	lists, _ := nvhis.LookupListArray(zpoolHistRecord)
+	records := make([]HistoryRecord, len(lists))
+	for i, nvl := range lists {
+		records[i] = parseHistoryRecord(nvl)
+	}
+	return records
+}
+
+// unpackHistory unpacks the records ZFS_IOC_POOL_GET_HISTORY read into buf,
+// each a packed nvlist after its little endian uint64 length, like
+// zpool_history_unpack. It returns how many bytes the whole records took; a
+// record cut off at the end of buf is left for the next read.
+func unpackHistory(buf []byte) ([]HistoryRecord, int, error) {
+	var records []HistoryRecord
+	used := 0
+	for len(buf)-used > 8 {
+		length := binary.LittleEndian.Uint64(buf[used:])
+		if length > uint64(len(buf)-used-8) {
+			break
+		}
+		nvl, err := nvlist.Unpack(buf[used+8 : used+8+int(length)])
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to decode history record at %d: %w", used, err)
+		}
+		records = append(records, parseHistoryRecord(nvl))
+		used += 8 + int(length)
+	}
+	return records, used, nil
+}
@@ -0,0 +1,131 @@
+package driver
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+func TestParseHistoryRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record map[string]any
+		want   HistoryRecord
+	}{
+		{
+			name: "command",
+			record: map[string]any{
+				zpoolHistTime: uint64(1700000000),
+				zpoolHistCmd:  "zpool create tank ada0",
+				zpoolHistWho:  uint64(0),
+				zpoolHistHost: "host1",
+				zpoolHistZone: "global",
+			},
+			want: HistoryRecord{Time: 1700000000, Command: "zpool create tank ada0", HasWho: true, Host: "host1", Zone: "global"},
+		},
+		{
+			name: "internal event",
+			record: map[string]any{
+				zpoolHistTime:    uint64(1700000001),
+				zpoolHistTXG:     uint64(42),
+				zpoolHistIntName: "snapshot",
+				zpoolHistIntStr:  "",
+				zpoolHistDSName:  "tank/home@now",
+				zpoolHistDSID:    uint64(77),
+			},
+			want: HistoryRecord{Time: 1700000001, TXG: 42, Event: "snapshot", Dataset: "tank/home@now", DatasetID: 77},
+		},
+		{
+			name: "legacy event",
+			record: map[string]any{
+				zpoolHistTime:     uint64(1300000000),
+				zpoolHistTXG:      uint64(5),
+				zpoolHistIntEvent: uint64(15),
+				zpoolHistIntStr:   "autoexpand=1",
+			},
+			want: HistoryRecord{Time: 1300000000, TXG: 5, Event: "pool property set", Detail: "autoexpand=1"},
+		},
+		{
+			name: "unknown legacy event",
+			record: map[string]any{
+				zpoolHistIntEvent: uint64(99),
+			},
+			want: HistoryRecord{Event: "unknown event 99"},
+		},
+		{
+			name: "ioctl",
+			record: map[string]any{
+				zpoolHistTime:  uint64(1700000002),
+				zpoolHistIoctl: "snapshot",
+				zpoolHistErrno: int64(17),
+				zpoolHistWho:   uint64(1001),
+			},
+			want: HistoryRecord{Time: 1700000002, Ioctl: "snapshot", Errno: 17, Who: 1001, HasWho: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nvl, err := nvlist.Encode(test.record)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if got := parseHistoryRecord(nvl); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseHistoryRecord() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnpackHistory(t *testing.T) {
+	var buf []byte
+	for _, cmd := range []string{"zpool create tank ada0", "zfs create tank/home"} {
+		nvl, err := nvlist.Encode(map[string]any{zpoolHistCmd: cmd})
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		packed := pack(t, nvl)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(packed)))
+		buf = append(buf, packed...)
+	}
+
+	records, used, err := unpackHistory(buf)
+	if err != nil {
+		t.Fatalf("unpackHistory() error = %v", err)
+	}
+	if used != len(buf) || len(records) != 2 || records[1].Command != "zfs create tank/home" {
+		t.Errorf("unpackHistory() = %+v, %d, want both records and %d bytes", records, used, len(buf))
+	}
+
+	// A record cut off by the end of the buffer is left for the next read
+	records, used, err = unpackHistory(buf[:len(buf)-4])
+	if err != nil {
+		t.Fatalf("unpackHistory() of a partial record error = %v", err)
+	}
+	if len(records) != 1 || records[0].Command != "zpool create tank ada0" {
+		t.Errorf("unpackHistory() of a partial record = %+v, want the first record", records)
+	}
+	if used >= len(buf)-4 {
+		t.Errorf("unpackHistory() of a partial record used %d bytes, want the first record only", used)
+	}
+
+	bad := binary.LittleEndian.AppendUint64(nil, 4)
+	if _, _, err := unpackHistory(append(bad, 1, 2, 3, 4)); err == nil {
+		t.Error("unpackHistory() of a corrupt record should fail")
+	}
+
+	nvhis, err := nvlist.Encode(map[string]any{zpoolHistRecord: []map[string]any{
+		{zpoolHistCmd: "zpool scrub tank"},
+		{zpoolHistIntName: "scan setup", zpoolHistTXG: uint64(9)},
+	}})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := parseHistoryRecords(nvhis)
+	want := []HistoryRecord{{Command: "zpool scrub tank"}, {Event: "scan setup", TXG: 9}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHistoryRecords() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+// Rewind policy flags of the import load policy (ZPOOL_*_REWIND)
+const (
+	zpoolNoRewind      = 1 // Import as is, the default
+	zpoolTryRewind     = 4 // Search for a txg to rewind to without committing
+	zpoolDoRewind      = 8 // Rewind to the latest txg the pool can be opened at
+	zpoolExtremeRewind = 16
+)
+
+// Keys of the load info an import returns (ZPOOL_CONFIG_LOAD_INFO)
+const (
+	zpoolConfigLoadInfo       = "load_info"
+	zpoolConfigRewindInfo     = "rewind_info"
+	zpoolConfigLoadTime       = "rewind_txg_ts"
+	zpoolConfigRewindTime     = "seconds_of_rewind"
+	zpoolConfigLoadDataErrors = "verify_data_errors"
+	zpoolConfigLoadMetaErrors = "verify_meta_errors"
+)
+
+// parseImportablePools decodes the result of zpool_search_import, an nvlist
+// of pool configs keyed by pool name, keeping the order libzfs found them in
+func parseImportablePools(pools *nvlist.List) ([]ImportablePool, error) {
+	result := make([]ImportablePool, 0, pools.Len())
+	for _, pair := range pools.Pairs {
+		config, ok := pair.Value.(*nvlist.List)
+		if !ok {
+			return nil, fmt.Errorf("pool %s: config is a %s, not an nvlist", pair.Name, pair.Type)
+		}
+		status, err := parsePoolStatus(pair.Name, config)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := ImportablePool{PoolStatus: *status}
+		pool.DevicePaths = leafPaths(pool.Vdevs, nil)
+		for _, dev := range append(pool.Spares, pool.L2Cache...) {
+			pool.DevicePaths = leafPaths(dev, pool.DevicePaths)
+		}
+		result = append(result, pool)
+	}
+	return result, nil
+}
+
+// leafPaths appends the paths of the leaf vdevs below vdev
+func leafPaths(vdev VdevInfo, paths []string) []string {
+	if len(vdev.Children) == 0 {
+		if vdev.Path != "" {
+			paths = append(paths, vdev.Path)
+		}
+		return paths
+	}
+	for _, child := range vdev.Children {
+		paths = leafPaths(child, paths)
+	}
+	return paths
+}
+
+// importFilter splits the pool argument of zpool import into a pool name
+// and a GUID. Pool names start with a letter, so a number is always a GUID.
+func importFilter(nameOrGUID string) (name string, guid uint64) {
+	if guid, err := strconv.ParseUint(nameOrGUID, 10, 64); err == nil {
+		return "", guid
+	}
+	return nameOrGUID, 0
+}
+
+// wantImportable reports whether a discovered pool matches nameOrGUID, any
+// pool when empty, leaving destroyed pools out unless asked for
+func wantImportable(pool *ImportablePool, nameOrGUID string, destroyed bool) bool {
+	if pool.State == mapPoolState(PoolStateDestroyed) && !destroyed {
+		return false
+	}
+	if nameOrGUID == "" {
+		return true
+	}
+	name, guid := importFilter(nameOrGUID)
+	return pool.Name == name || guid != 0 && pool.GUID == guid
+}
+
+// filterImportablePools keeps the pools a discovery asked for
+func filterImportablePools(pools []ImportablePool, opts DiscoverOptions) []ImportablePool {
+	result := pools[:0]
+	for i := range pools {
+		if wantImportable(&pools[i], opts.Pool, opts.Destroyed) {
+			result = append(result, pools[i])
+		}
+	}
+	return result
+}
+
+// selectImportablePool returns the index of the single pool an import of
+// nameOrGUID refers to. Pools sharing a name have to be imported by GUID.
+func selectImportablePool(pools []ImportablePool, nameOrGUID string, destroyed bool) (int, error) {
+	index := -1
+	for i := range pools {
+		if !wantImportable(&pools[i], nameOrGUID, destroyed) {
+			continue
+		}
+		if index >= 0 {
+			return -1, zfserrors.NewZfsError("import_pool", nameOrGUID, zfserrors.ErrCodeInval, errnoInval,
+				"more than one matching pool, import by GUID instead", nil)
+		}
+		index = i
+	}
+	if index < 0 {
+		return -1, zfserrors.NewZfsError("get_pool", nameOrGUID, zfserrors.ErrCodeNotFound, errnoNoEnt,
+			"no such pool available for import", nil)
+	}
+	return index, nil
+}
+
+// rewindPolicy returns the load-rewind-policy and load-request-txg of the
+// load policy zpool import builds from -F, -n, -X and -T
+func rewindPolicy(poolName string, opts ImportOptions) (policy uint32, txg uint64, err error) {
+	rewind := opts.Rewind || opts.MaxTxg != 0
+	extreme := opts.ExtremeRewind || opts.MaxTxg != 0
+	if opts.RewindToCheckpoint && (rewind || opts.DryRun || extreme) {
+		return 0, 0, zfserrors.NewZfsError("import_pool", poolName, zfserrors.ErrCodeInval, errnoInval,
+			"rewind to checkpoint cannot be combined with a txg rewind", nil)
+	}
+	if !rewind {
+		if opts.DryRun || extreme {
+			return 0, 0, zfserrors.NewZfsError("import_pool", poolName, zfserrors.ErrCodeInval, errnoInval,
+				"dry run and extreme rewind are only meaningful with rewind", nil)
+		}
+		return zpoolNoRewind, math.MaxUint64, nil
+	}
+
+	policy = zpoolDoRewind
+	if opts.DryRun {
+		policy = zpoolTryRewind
+	}
+	if extreme {
+		policy |= zpoolExtremeRewind
+	}
+	txg = math.MaxUint64
+	if opts.MaxTxg != 0 {
+		txg = opts.MaxTxg
+	}
+	return policy, txg, nil
+}
+
+// canOpen reports whether a discovered pool could be opened at its latest
+// txg, so importing it does not need a rewind
+func canOpen(pool *ImportablePool) bool {
+	return pool.Health == "ONLINE" || pool.Health == "DEGRADED"
+}
+
+// parseRewindReport decodes the load info a rewinding import returns. A
+// failed dry run nests the txg it found under rewind_info.
+func parseRewindReport(config *nvlist.List) *RewindReport {
+	report := &RewindReport{Needed: true}
+	info, ok := config.LookupList(zpoolConfigLoadInfo)
+	if !ok {
+		return report
+	}
+	if rewind, ok := info.LookupList(zpoolConfigRewindInfo); ok {
+		info = rewind
+	}
+
+	report.RewindTime, report.Possible = info.LookupUint64(zpoolConfigLoadTime)
+	report.Discarded, _ = info.LookupInt64(zpoolConfigRewindTime)
+	report.DataErrors, _ = info.LookupUint64(zpoolConfigLoadDataErrors)
+	report.MetaErrors, _ = info.LookupUint64(zpoolConfigLoadMetaErrors)
+	return report
+}
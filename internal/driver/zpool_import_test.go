@@ -0,0 +1,162 @@
+package driver
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+func TestParseImportablePools(t *testing.T) {
+	healthy := healthyStats()
+	tank := importConfig("tank", 100, PoolStateExported,
+		leafConfig(0, 111, "/dev/ada0", healthy), leafConfig(1, 112, "/dev/ada1", healthy))
+	tank[zpoolConfigVdevTree].(map[string]any)[zpoolConfigSpares] = []map[string]any{
+		leafConfig(0, 113, "/dev/ada2", healthy),
+	}
+
+	// Pools sharing a name are separate pairs, so build the list by hand
+	found := nvlist.New()
+	found.Flags = 0
+	for _, config := range []map[string]any{
+		tank,
+		importConfig("tank", 200, PoolStateDestroyed, leafConfig(0, 211, "/dev/da0", healthy)),
+		importConfig("backup", 300, PoolStateExported, leafConfig(0, 311, "/dev/da1", healthy)),
+	} {
+		list, err := nvlist.Encode(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := found.Add(config[zpoolConfigName].(string), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pools, err := parseImportablePools(found)
+	if err != nil {
+		t.Fatalf("parseImportablePools() error = %v", err)
+	}
+	if len(pools) != 3 {
+		t.Fatalf("parseImportablePools() = %d pools, want 3", len(pools))
+	}
+	first := pools[0]
+	if first.Name != "tank" || first.GUID != 100 || first.State != "EXPORTED" || first.Health != "ONLINE" {
+		t.Errorf("pools[0] = %+v", first.PoolInfo)
+	}
+	if want := []string{"/dev/ada0", "/dev/ada1", "/dev/ada2"}; !reflect.DeepEqual(first.DevicePaths, want) {
+		t.Errorf("DevicePaths = %v, want %v", first.DevicePaths, want)
+	}
+	if len(first.Vdevs.Children) != 1 || len(first.Vdevs.Children[0].Children) != 2 {
+		t.Errorf("config tree = %+v, want a two-way mirror", first.Vdevs)
+	}
+
+	tests := []struct {
+		name       string
+		nameOrGUID string
+		destroyed  bool
+		want       int
+		wantCode   string
+	}{
+		{"by name", "tank", false, 0, ""},
+		{"by guid", "300", false, 2, ""},
+		{"destroyed by guid", "200", true, 1, ""},
+		{"destroyed left out", "200", false, -1, zfserrors.ErrCodeNotFound},
+		{"ambiguous name", "tank", true, -1, zfserrors.ErrCodeInval},
+		{"unknown", "missing", false, -1, zfserrors.ErrCodeNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index, err := selectImportablePool(pools, test.nameOrGUID, test.destroyed)
+			code := ""
+			if zerr, ok := zfserrors.AsZfsError(err); ok {
+				code = zerr.Code
+			}
+			if index != test.want || code != test.wantCode {
+				t.Errorf("selectImportablePool() = %d, %v, want %d, %q", index, err, test.want, test.wantCode)
+			}
+		})
+	}
+
+	filtered := filterImportablePools(pools, DiscoverOptions{Pool: "tank"})
+	if len(filtered) != 1 || filtered[0].GUID != 100 {
+		t.Errorf("filterImportablePools() = %+v, want the exported tank only", filtered)
+	}
+}
+
+func TestRewindPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       ImportOptions
+		wantPolicy uint32
+		wantTxg    uint64
+		wantErr    bool
+	}{
+		{"no rewind", ImportOptions{}, zpoolNoRewind, math.MaxUint64, false},
+		{"rewind", ImportOptions{Rewind: true}, zpoolDoRewind, math.MaxUint64, false},
+		{"dry run", ImportOptions{Rewind: true, DryRun: true}, zpoolTryRewind, math.MaxUint64, false},
+		{"extreme", ImportOptions{Rewind: true, ExtremeRewind: true}, zpoolDoRewind | zpoolExtremeRewind, math.MaxUint64, false},
+		{"max txg", ImportOptions{MaxTxg: 1234}, zpoolDoRewind | zpoolExtremeRewind, 1234, false},
+		{"max txg dry run", ImportOptions{MaxTxg: 1234, DryRun: true}, zpoolTryRewind | zpoolExtremeRewind, 1234, false},
+		{"dry run without rewind", ImportOptions{DryRun: true}, 0, 0, true},
+		{"extreme without rewind", ImportOptions{ExtremeRewind: true}, 0, 0, true},
+		{"checkpoint", ImportOptions{RewindToCheckpoint: true}, zpoolNoRewind, math.MaxUint64, false},
+		{"checkpoint and rewind", ImportOptions{RewindToCheckpoint: true, Rewind: true}, 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, txg, err := rewindPolicy("tank", test.opts)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("rewindPolicy() error = %v, want error %v", err, test.wantErr)
+			}
+			if policy != test.wantPolicy || txg != test.wantTxg {
+				t.Errorf("rewindPolicy() = %d, %d, want %d, %d", policy, txg, test.wantPolicy, test.wantTxg)
+			}
+		})
+	}
+}
+
+func TestParseRewindReport(t *testing.T) {
+	rewindInfo := map[string]any{
+		zpoolConfigLoadTime:       uint64(1700000000),
+		zpoolConfigRewindTime:     int64(75),
+		zpoolConfigLoadDataErrors: uint64(2),
+	}
+	tests := []struct {
+		name   string
+		config map[string]any
+		want   *RewindReport
+	}{
+		{
+			name: "failed dry run",
+			config: map[string]any{zpoolConfigLoadInfo: map[string]any{
+				zpoolConfigRewindInfo: rewindInfo,
+			}},
+			want: &RewindReport{Needed: true, Possible: true, RewindTime: 1700000000, Discarded: 75, DataErrors: 2},
+		},
+		{
+			name:   "rewound",
+			config: map[string]any{zpoolConfigLoadInfo: rewindInfo},
+			want:   &RewindReport{Needed: true, Possible: true, RewindTime: 1700000000, Discarded: 75, DataErrors: 2},
+		},
+		{
+			name:   "nothing to rewind to",
+			config: map[string]any{zpoolConfigLoadInfo: map[string]any{}},
+			want:   &RewindReport{Needed: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := nvlist.Encode(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parseRewindReport(config); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseRewindReport() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
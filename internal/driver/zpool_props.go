@@ -0,0 +1,337 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+// Native pool property table, following zpool_prop_init in zpool_prop.c.
+// Pool properties share the dataset property description; types and
+// inherit do not apply to them.
+var poolPropTable = map[string]datasetProp{
+	// Read-only statistics
+	"name":          {format: formatString, readonly: true},
+	"size":          {format: formatBytes, readonly: true},
+	"capacity":      {format: formatPercent, readonly: true},
+	"free":          {format: formatBytes, readonly: true},
+	"allocated":     {format: formatBytes, readonly: true},
+	"expandsize":    {format: formatOptional, readonly: true},
+	"freeing":       {format: formatBytes, readonly: true, def: uint64(0)},
+	"leaked":        {format: formatBytes, readonly: true, def: uint64(0)},
+	"fragmentation": {format: formatPercent, readonly: true},
+	"checkpoint":    {format: formatOptional, readonly: true, def: uint64(0)},
+	"guid":          {format: formatNumber, readonly: true},
+	"load_guid":     {format: formatNumber, readonly: true},
+	"health":        {format: formatHealth, readonly: true},
+	"dedupratio":    {format: formatRatio, readonly: true},
+	"bcloneused":    {format: formatBytes, readonly: true},
+	"bclonesaved":   {format: formatBytes, readonly: true},
+	"bcloneratio":   {format: formatRatio, readonly: true},
+
+	// Set at creation or import time
+	"altroot":  {format: formatString, setonce: true, def: "-"},
+	"readonly": {format: formatIndex, index: onOffIndex, setonce: true, def: uint64(0)},
+
+	// Settable
+	"version":       {format: formatNumber, def: "-"},
+	"bootfs":        {format: formatString, def: "-"},
+	"cachefile":     {format: formatString, def: "-"},
+	"comment":       {format: formatString, def: "-"},
+	"compatibility": {format: formatString, def: "off"},
+	"ashift":        {format: formatNumber, def: uint64(0)},
+	"failmode":      {format: formatIndex, index: failmodeIndex, def: uint64(0)},
+	"delegation":    {format: formatIndex, index: onOffIndex, def: uint64(1)},
+	"autoreplace":   {format: formatIndex, index: onOffIndex, def: uint64(0)},
+	"listsnapshots": {format: formatIndex, index: onOffIndex, def: uint64(0)},
+	"autoexpand":    {format: formatIndex, index: onOffIndex, def: uint64(0)},
+	"multihost":     {format: formatIndex, index: onOffIndex, def: uint64(0)},
+	"autotrim":      {format: formatIndex, index: onOffIndex, def: uint64(0)},
+}
+
+var failmodeIndex = map[uint64]string{0: "wait", 1: "continue", 2: "panic"}
+
+// poolPropAliases are the column names zpool_name_to_prop accepts
+var poolPropAliases = map[string]string{
+	"cap":          "capacity",
+	"alloc":        "allocated",
+	"expandsz":     "expandsize",
+	"frag":         "fragmentation",
+	"ckpoint":      "checkpoint",
+	"dedup":        "dedupratio",
+	"replace":      "autoreplace",
+	"listsnaps":    "listsnapshots",
+	"expand":       "autoexpand",
+	"rdonly":       "readonly",
+	"bclone_used":  "bcloneused",
+	"bclone_saved": "bclonesaved",
+	"bclone_ratio": "bcloneratio",
+}
+
+// maxPoolCommentLen is ZPROP_MAX_COMMENT
+const maxPoolCommentLen = 32
+
+// poolFeaturePrefix starts the name of every feature@ pool property
+const poolFeaturePrefix = "feature@"
+
+// Pool feature states, as zpool get feature@name reports them
+const (
+	FeatureDisabled = "disabled"
+	FeatureEnabled  = "enabled"
+	FeatureActive   = "active"
+)
+
+// poolFeature describes a pool feature of spa_feature_table
+type poolFeature struct {
+	guid      string   // Key of the feature in ZPOOL_CONFIG_FEATURE_STATS
+	readonly  bool     // ZFEATURE_FLAG_READONLY_COMPAT
+	noUpgrade bool     // ZFEATURE_FLAG_NO_UPGRADE, left to the kernel to enable
+	deps      []string // Features enabling it enables first
+}
+
+// poolFeatures maps the short name of each pool feature to its GUID, flags
+// and dependencies, following spa_feature_table
+var poolFeatures = map[string]poolFeature{
+	"async_destroy":         {guid: "com.delphix:async_destroy", readonly: true},
+	"empty_bpobj":           {guid: "com.delphix:empty_bpobj", readonly: true},
+	"lz4_compress":          {guid: "org.illumos:lz4_compress"},
+	"multi_vdev_crash_dump": {guid: "com.joyent:multi_vdev_crash_dump"},
+	"spacemap_histogram":    {guid: "com.delphix:spacemap_histogram", readonly: true},
+	"enabled_txg":           {guid: "com.delphix:enabled_txg", readonly: true},
+	"hole_birth":            {guid: "com.delphix:hole_birth", deps: []string{"enabled_txg"}},
+	"extensible_dataset":    {guid: "com.delphix:extensible_dataset"},
+	"embedded_data":         {guid: "com.delphix:embedded_data"},
+	"bookmarks":             {guid: "com.delphix:bookmarks", readonly: true, deps: []string{"extensible_dataset"}},
+	"filesystem_limits":     {guid: "com.joyent:filesystem_limits", readonly: true, deps: []string{"extensible_dataset"}},
+	"large_blocks":          {guid: "org.open-zfs:large_blocks", deps: []string{"extensible_dataset"}},
+	"large_dnode":           {guid: "org.zfsonlinux:large_dnode", deps: []string{"extensible_dataset"}},
+	"sha512":                {guid: "org.illumos:sha512", deps: []string{"extensible_dataset"}},
+	"skein":                 {guid: "org.illumos:skein", deps: []string{"extensible_dataset"}},
+	"edonr":                 {guid: "org.illumos:edonr", deps: []string{"extensible_dataset"}},
+	"userobj_accounting":    {guid: "org.zfsonlinux:userobj_accounting", readonly: true, deps: []string{"extensible_dataset"}},
+	"encryption":            {guid: "com.datto:encryption", deps: []string{"extensible_dataset", "bookmark_v2"}},
+	"project_quota":         {guid: "org.zfsonlinux:project_quota", readonly: true, deps: []string{"extensible_dataset"}},
+	"device_removal":        {guid: "com.delphix:device_removal"},
+	"obsolete_counts":       {guid: "com.delphix:obsolete_counts", readonly: true, deps: []string{"device_removal"}},
+	"zpool_checkpoint":      {guid: "com.delphix:zpool_checkpoint", readonly: true},
+	"spacemap_v2":           {guid: "com.delphix:spacemap_v2", readonly: true},
+	"allocation_classes":    {guid: "org.zfsonlinux:allocation_classes", readonly: true},
+	"resilver_defer":        {guid: "com.datto:resilver_defer", readonly: true},
+	"bookmark_v2":           {guid: "com.datto:bookmark_v2", deps: []string{"bookmarks", "extensible_dataset"}},
+	"redaction_bookmarks":   {guid: "com.delphix:redaction_bookmarks", deps: []string{"bookmarks", "extensible_dataset", "bookmark_v2"}},
+	"redacted_datasets":     {guid: "com.delphix:redacted_datasets", deps: []string{"extensible_dataset"}},
+	"bookmark_written":      {guid: "com.delphix:bookmark_written", deps: []string{"bookmark_v2", "extensible_dataset", "bookmarks"}},
+	"log_spacemap":          {guid: "com.delphix:log_spacemap", readonly: true, deps: []string{"spacemap_v2"}},
+	"livelist":              {guid: "com.delphix:livelist", readonly: true, deps: []string{"extensible_dataset"}},
+	"device_rebuild":        {guid: "org.openzfs:device_rebuild", readonly: true},
+	"zstd_compress":         {guid: "org.freebsd:zstd_compress", deps: []string{"extensible_dataset"}},
+	"draid":                 {guid: "org.openzfs:draid"},
+	"zilsaxattr":            {guid: "org.openzfs:zilsaxattr", readonly: true, deps: []string{"extensible_dataset"}},
+	"head_errlog":           {guid: "com.delphix:head_errlog"},
+	"blake3":                {guid: "org.openzfs:blake3", deps: []string{"extensible_dataset"}},
+	"block_cloning":         {guid: "com.fudosecurity:block_cloning", readonly: true},
+	"vdev_zaps_v2":          {guid: "com.klarasystems:vdev_zaps_v2", noUpgrade: true},
+	"redaction_list_spill":  {guid: "com.delphix:redaction_list_spill", deps: []string{"redaction_bookmarks"}},
+	"raidz_expansion":       {guid: "org.openzfs:raidz_expansion"},
+	"fast_dedup":            {guid: "com.klarasystems:fast_dedup", readonly: true},
+	"longname":              {guid: "org.zfsonlinux:longname", deps: []string{"extensible_dataset"}},
+	"large_microzap":        {guid: "com.klarasystems:large_microzap", readonly: true, deps: []string{"extensible_dataset", "large_blocks"}},
+}
+
+// CanonicalPoolProp resolves a native pool property name or column alias,
+// e.g. cap for capacity. The boolean is false for unknown names, including
+// feature@ properties.
+func CanonicalPoolProp(name string) (string, bool) {
+	if canonical, ok := poolPropAliases[name]; ok {
+		name = canonical
+	}
+	_, ok := poolPropTable[name]
+	return name, ok
+}
+
+// IsPoolFeatureProp reports whether name is a feature@ pool property
+func IsPoolFeatureProp(name string) bool {
+	return strings.HasPrefix(name, poolFeaturePrefix)
+}
+
+// PoolFeatureGUID returns the GUID of a pool feature given its short name
+// or its feature@ property name
+func PoolFeatureGUID(name string) (string, bool) {
+	feature, ok := poolFeatures[strings.TrimPrefix(name, poolFeaturePrefix)]
+	return feature.guid, ok
+}
+
+// DescribePoolFeature returns a known pool feature, given its short name,
+// in the given state
+func DescribePoolFeature(name, state string) (PoolFeature, bool) {
+	feature, ok := poolFeatures[name]
+	if !ok {
+		return PoolFeature{}, false
+	}
+	return PoolFeature{
+		Name:           name,
+		GUID:           feature.guid,
+		State:          state,
+		ReadOnlyCompat: feature.readonly,
+		NoUpgrade:      feature.noUpgrade,
+		Dependencies:   append([]string(nil), feature.deps...),
+	}, true
+}
+
+// PoolFeatureNames returns the short names of every known pool feature,
+// sorted
+func PoolFeatureNames() []string {
+	names := make([]string, 0, len(poolFeatures))
+	for name := range poolFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsPoolPropReadOnly reports whether a native pool property is read-only
+func IsPoolPropReadOnly(name string) bool {
+	name, ok := CanonicalPoolProp(name)
+	return ok && poolPropTable[name].readonly
+}
+
+// PoolPropNames returns the canonical names of the native pool properties
+// followed by the feature@ property of every known feature, both sorted
+func PoolPropNames() []string {
+	names := make([]string, 0, len(poolPropTable))
+	for name := range poolPropTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, PoolFeatureProps()...)
+}
+
+// PoolFeatureProps returns the feature@ property names of every known
+// pool feature, sorted
+func PoolFeatureProps() []string {
+	names := PoolFeatureNames()
+	for i, name := range names {
+		names[i] = poolFeaturePrefix + name
+	}
+	return names
+}
+
+// featureState returns the state of a feature from its reference count in
+// ZPOOL_CONFIG_FEATURE_STATS, which omits features that are not enabled
+func featureState(refcount uint64, enabled bool) string {
+	switch {
+	case !enabled:
+		return FeatureDisabled
+	case refcount > 0:
+		return FeatureActive
+	}
+	return FeatureEnabled
+}
+
+// FeatureSource returns the source of a feature@ property in the given
+// state: features are only local once enabled, disabled ones are defaults
+func FeatureSource(state string) PropSource {
+	if state == FeatureDisabled {
+		return PropSourceDefault
+	}
+	return PropSourceLocal
+}
+
+// parsePoolFeatures describes every known feature of a pool from its
+// ZPOOL_CONFIG_FEATURE_STATS list, sorted by name. Features this library
+// does not know are left out.
+func parsePoolFeatures(stats *nvlist.List) []PoolFeature {
+	features := make([]PoolFeature, 0, len(poolFeatures))
+	for _, name := range PoolFeatureNames() {
+		refcount, enabled := stats.LookupUint64(poolFeatures[name].guid)
+		feature, _ := DescribePoolFeature(name, featureState(refcount, enabled))
+		features = append(features, feature)
+	}
+	return features
+}
+
+// ParsePoolPropValue converts a pool property value as zpool get prints
+// it to its raw form: uint64 for numbers, byte counts, percentages and
+// ratios, bool for on/off properties and string otherwise
+func ParsePoolPropValue(name, value string) (any, error) {
+	canonical, ok := CanonicalPoolProp(name)
+	if !ok || value == "-" && canonical == "version" {
+		return value, nil
+	}
+	return parsePropValue(poolPropTable[canonical], value)
+}
+
+// ValidatePoolProp applies the libzfs rules for setting a pool property
+// on an imported pool. Features can only be set to enabled.
+func ValidatePoolProp(resource, name, value string) error {
+	invalid := func(detail string) error {
+		return zfserrors.NewZfsError("set_property", resource, zfserrors.ErrCodeInval, errnoInval, detail, nil)
+	}
+
+	if IsPoolFeatureProp(name) {
+		if _, ok := PoolFeatureGUID(name); !ok {
+			return invalid(fmt.Sprintf("unsupported feature %q", strings.TrimPrefix(name, poolFeaturePrefix)))
+		}
+		if value != FeatureEnabled {
+			return invalid(fmt.Sprintf("property %q can only be set to %q", name, FeatureEnabled))
+		}
+		return nil
+	}
+
+	canonical, ok := CanonicalPoolProp(name)
+	if !ok {
+		return invalid(fmt.Sprintf("invalid property %q", name))
+	}
+	prop := poolPropTable[canonical]
+	switch {
+	case prop.readonly:
+		return invalid(fmt.Sprintf("property %q is read-only", canonical))
+	case prop.setonce:
+		return invalid(fmt.Sprintf("property %q can only be set at creation or import time", canonical))
+	}
+
+	valid := true
+	switch canonical {
+	case "cachefile":
+		valid = value == "" || value == "none" || strings.HasPrefix(value, "/")
+	case "comment":
+		if len(value) > maxPoolCommentLen {
+			return invalid(fmt.Sprintf("comment must be at most %d characters", maxPoolCommentLen))
+		}
+		for _, c := range value {
+			valid = valid && c >= ' ' && c <= '~'
+		}
+	case "ashift":
+		v, err := ParseNiceNum(value)
+		valid = err == nil && (v == 0 || v >= 9 && v <= 16)
+	case "bootfs", "compatibility":
+	default:
+		valid = validPropValue(canonical, prop, value)
+	}
+	if !valid {
+		return invalid(fmt.Sprintf("bad value %q for property %q", value, canonical))
+	}
+	return nil
+}
+
+// ValidatePoolImportProp applies the rules for a property given when a pool
+// is imported, where the set-once altroot and readonly are accepted too
+func ValidatePoolImportProp(resource, name, value string) error {
+	canonical, ok := CanonicalPoolProp(name)
+	if !ok || !poolPropTable[canonical].setonce {
+		return ValidatePoolProp(resource, name, value)
+	}
+
+	valid := validPropValue(canonical, poolPropTable[canonical], value)
+	if canonical == "altroot" {
+		valid = strings.HasPrefix(value, "/")
+	}
+	if !valid {
+		return zfserrors.NewZfsError("set_property", resource, zfserrors.ErrCodeInval, errnoInval,
+			fmt.Sprintf("bad value %q for property %q", value, canonical), nil)
+	}
+	return nil
+}
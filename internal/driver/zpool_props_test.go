@@ -0,0 +1,212 @@
+package driver
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+func TestCanonicalPoolProp(t *testing.T) {
+	tests := []struct {
+		name      string
+		canonical string
+		known     bool
+	}{
+		{"capacity", "capacity", true},
+		{"cap", "capacity", true},
+		{"frag", "fragmentation", true},
+		{"expandsz", "expandsize", true},
+		{"rdonly", "readonly", true},
+		{"autotrim", "autotrim", true},
+		{"feature@async_destroy", "feature@async_destroy", false},
+		{"bogus", "bogus", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			canonical, known := CanonicalPoolProp(test.name)
+			if canonical != test.canonical || known != test.known {
+				t.Errorf("CanonicalPoolProp(%q) = %q, %v, want %q, %v", test.name, canonical, known, test.canonical, test.known)
+			}
+		})
+	}
+
+	for alias, canonical := range poolPropAliases {
+		if _, ok := poolPropTable[canonical]; !ok {
+			t.Errorf("alias %s points to unknown property %s", alias, canonical)
+		}
+	}
+}
+
+func TestPoolPropNames(t *testing.T) {
+	names := PoolPropNames()
+	if len(names) != len(poolPropTable)+len(poolFeatures) {
+		t.Errorf("PoolPropNames() returned %d names, want %d", len(names), len(poolPropTable)+len(poolFeatures))
+	}
+	native := names[:len(poolPropTable)]
+	if !sort.StringsAreSorted(native) || !sort.StringsAreSorted(names[len(poolPropTable):]) {
+		t.Error("PoolPropNames() is not sorted")
+	}
+	for _, name := range native {
+		if IsPoolFeatureProp(name) {
+			t.Errorf("feature %s listed with the native properties", name)
+		}
+	}
+	if guid, ok := PoolFeatureGUID("feature@zstd_compress"); !ok || guid != "org.freebsd:zstd_compress" {
+		t.Errorf("PoolFeatureGUID(zstd_compress) = %q, %v", guid, ok)
+	}
+	if !IsPoolPropReadOnly("frag") || IsPoolPropReadOnly("autotrim") {
+		t.Error("IsPoolPropReadOnly() disagrees with the table")
+	}
+}
+
+func TestParsePoolPropValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  any
+	}{
+		{"size", "10G", uint64(10 << 30)},
+		{"capacity", "42%", uint64(42)},
+		{"fragmentation", "-", uint64(noLimit)},
+		{"expandsize", "-", uint64(0)},
+		{"dedupratio", "1.50x", uint64(150)},
+		{"autotrim", "on", true},
+		{"failmode", "panic", "panic"},
+		{"version", "-", "-"},
+		{"version", "28", uint64(28)},
+		{"comment", "hello", "hello"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+"="+test.value, func(t *testing.T) {
+			got, err := ParsePoolPropValue(test.name, test.value)
+			if err != nil || got != test.want {
+				t.Errorf("ParsePoolPropValue() = %#v, %v, want %#v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidatePoolProp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"autotrim", "on", true},
+		{"autotrim", "maybe", false},
+		{"failmode", "continue", true},
+		{"failmode", "retry", false},
+		{"comment", "rack 4", true},
+		{"comment", "this comment is far too long to be stored", false},
+		{"cachefile", "none", true},
+		{"cachefile", "zpool.cache", false},
+		{"ashift", "12", true},
+		{"ashift", "20", false},
+		{"bootfs", "tank/ROOT/default", true},
+		{"version", "5000", true},
+		{"feature@async_destroy", "enabled", true},
+		{"feature@async_destroy", "disabled", false},
+		{"feature@bogus", "enabled", false},
+		{"size", "1G", false},
+		{"altroot", "/mnt", false},
+		{"bogus", "1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+"="+test.value, func(t *testing.T) {
+			err := ValidatePoolProp("tank", test.name, test.value)
+			if (err == nil) != test.valid {
+				t.Errorf("ValidatePoolProp() error = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestValidatePoolImportProp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"altroot", "/mnt", true},
+		{"altroot", "mnt", false},
+		{"readonly", "on", true},
+		{"readonly", "maybe", false},
+		{"cachefile", "none", true},
+		{"size", "1G", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+"="+test.value, func(t *testing.T) {
+			err := ValidatePoolImportProp("tank", test.name, test.value)
+			if (err == nil) != test.valid {
+				t.Errorf("ValidatePoolImportProp() error = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestParsePoolFeatures(t *testing.T) {
+	stats := nvlist.New()
+	stats.Add("com.delphix:async_destroy", uint64(0))
+	stats.Add("org.illumos:lz4_compress", uint64(3))
+	stats.Add("com.example:unknown", uint64(1))
+
+	features := parsePoolFeatures(stats)
+	if len(features) != len(poolFeatures) {
+		t.Fatalf("parsePoolFeatures() returned %d features, want %d", len(features), len(poolFeatures))
+	}
+	if !sort.SliceIsSorted(features, func(i, j int) bool { return features[i].Name < features[j].Name }) {
+		t.Error("parsePoolFeatures() result is not sorted")
+	}
+
+	byName := make(map[string]PoolFeature)
+	for _, feature := range features {
+		byName[feature.Name] = feature
+	}
+	tests := []struct {
+		name     string
+		guid     string
+		state    string
+		readonly bool
+	}{
+		{"async_destroy", "com.delphix:async_destroy", FeatureEnabled, true},
+		{"lz4_compress", "org.illumos:lz4_compress", FeatureActive, false},
+		{"draid", "org.openzfs:draid", FeatureDisabled, false},
+	}
+	for _, test := range tests {
+		got := byName[test.name]
+		if got.GUID != test.guid || got.State != test.state || got.ReadOnlyCompat != test.readonly {
+			t.Errorf("feature %s = %+v, want guid %s, state %s, readonly %v", test.name, got, test.guid, test.state, test.readonly)
+		}
+	}
+	if deps := byName["encryption"].Dependencies; len(deps) != 2 || deps[0] != "extensible_dataset" || deps[1] != "bookmark_v2" {
+		t.Errorf("encryption dependencies = %v", deps)
+	}
+	if !byName["vdev_zaps_v2"].NoUpgrade {
+		t.Error("vdev_zaps_v2 should not be enabled by upgrades")
+	}
+
+	for name, feature := range poolFeatures {
+		for _, dep := range feature.deps {
+			if _, ok := poolFeatures[dep]; !ok {
+				t.Errorf("feature %s depends on unknown feature %s", name, dep)
+			}
+		}
+	}
+}
+
+func TestFeatureSource(t *testing.T) {
+	for state, want := range map[string]PropSource{
+		FeatureDisabled: PropSourceDefault,
+		FeatureEnabled:  PropSourceLocal,
+		FeatureActive:   PropSourceLocal,
+	} {
+		if got := FeatureSource(state); got != want {
+			t.Errorf("FeatureSource(%s) = %v, want %v", state, got, want)
+		}
+	}
+}
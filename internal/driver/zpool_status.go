@@ -0,0 +1,403 @@
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+// Vdev configuration nvlist keys (ZPOOL_CONFIG_* in sys/fs/zfs.h)
+const (
+	zpoolConfigType      = "type"
+	zpoolConfigID        = "id"
+	zpoolConfigGUID      = "guid"
+	zpoolConfigPath      = "path"
+	zpoolConfigChildren  = "children"
+	zpoolConfigSpares    = "spares"
+	zpoolConfigL2Cache   = "l2cache"
+	zpoolConfigNParity   = "nparity"
+	zpoolConfigIsLog     = "is_log"
+	zpoolConfigAllocBias = "alloc_bias"
+	zpoolConfigErrCount  = "error_count"
+	zpoolConfigScanStats = "scan_stats"
+	zpoolConfigRemoving  = "removing"
+
+	// Size of the remapping table of an indirect vdev, not stored on disk
+	zpoolConfigIndirectSize = "indirect_size"
+
+	zpoolConfigCheckpointStats = "checkpoint_stats"
+	zpoolConfigRemovalStats    = "removal_stats"
+)
+
+// More indexes into the vdev_stat_t array, older kernels report fewer fields
+const (
+	vdevStatsAllocIndex          = 3  // vs_alloc
+	vdevStatsSpaceIndex          = 4  // vs_space
+	vdevStatsDSpaceIndex         = 5  // vs_dspace
+	vdevStatsReadErrorsIndex     = 20 // vs_read_errors
+	vdevStatsWriteErrorsIndex    = 21 // vs_write_errors
+	vdevStatsChecksumErrorsIndex = 22 // vs_checksum_errors
+	vdevStatsSlowIOsIndex        = 34 // vs_slow_ios
+
+	vdevStatsInitializeErrorsIndex = 23 // vs_initialize_errors
+	vdevStatsInitializeDoneIndex   = 28 // vs_initialize_bytes_done
+	vdevStatsInitializeEstIndex    = 29 // vs_initialize_bytes_est
+	vdevStatsInitializeStateIndex  = 30 // vs_initialize_state
+	vdevStatsInitializeTimeIndex   = 31 // vs_initialize_action_time
+	vdevStatsTrimErrorsIndex       = 35 // vs_trim_errors
+	vdevStatsTrimNotSupIndex       = 36 // vs_trim_notsup
+	vdevStatsTrimDoneIndex         = 37 // vs_trim_bytes_done
+	vdevStatsTrimEstIndex          = 38 // vs_trim_bytes_est
+	vdevStatsTrimStateIndex        = 39 // vs_trim_state
+	vdevStatsTrimTimeIndex         = 40 // vs_trim_action_time
+)
+
+// Indexes into the pool_scan_stat_t array of the root vdev
+const (
+	scanStatsFunc            = 0
+	scanStatsState           = 1
+	scanStatsStartTime       = 2
+	scanStatsEndTime         = 3
+	scanStatsToExamine       = 4
+	scanStatsExamined        = 5
+	scanStatsSkipped         = 6
+	scanStatsProcessed       = 7
+	scanStatsErrors          = 8
+	scanStatsPassExamined    = 9
+	scanStatsPassStart       = 10
+	scanStatsPassPause       = 11
+	scanStatsPassSpentPaused = 12
+	scanStatsPassIssued      = 13
+	scanStatsIssued          = 14
+
+	// Error scrub statistics, OpenZFS 2.2 and later
+	scanStatsErrorScrubFunc      = 15
+	scanStatsErrorScrubState     = 16
+	scanStatsErrorScrubStart     = 17
+	scanStatsErrorScrubEnd       = 18
+	scanStatsErrorScrubExamined  = 19
+	scanStatsErrorScrubToExamine = 20
+
+	// pss_pass_error_scrub_pause is documented in milliseconds, but the
+	// kernel sets it from gethrestime_sec() and zpool status prints it as a
+	// time_t: it is in seconds like pss_pass_scrub_pause
+	scanStatsErrorScrubPause = 21
+)
+
+// Indexes into the pool_checkpoint_stat_t array of the root vdev
+const (
+	checkpointStatsState     = 0
+	checkpointStatsStartTime = 1
+	checkpointStatsSpace     = 2
+)
+
+// Indexes into the pool_removal_stat_t array of the root vdev
+const (
+	removalStatsState         = 0
+	removalStatsVdev          = 1
+	removalStatsStartTime     = 2
+	removalStatsEndTime       = 3
+	removalStatsToCopy        = 4
+	removalStatsCopied        = 5
+	removalStatsMappingMemory = 6
+)
+
+// dssErrorScrubbing is the dsl_scan_state_t of a running error scrub
+const dssErrorScrubbing = 4
+
+// vdevAuxSpared is VDEV_AUX_SPARED, set on hot spares that are in use
+const vdevAuxSpared = 10
+
+// vdevAuxNames describes each vdev_aux_t the way zpool status does
+var vdevAuxNames = map[uint64]string{
+	1:  "cannot open",
+	2:  "corrupted data",
+	3:  "insufficient replicas",
+	4:  "missing device",
+	5:  "device too small",
+	6:  "invalid label",
+	7:  "newer version",
+	8:  "older version",
+	9:  "unsupported feature(s)",
+	10: "currently in use",
+	11: "too many errors",
+	12: "experienced I/O failures",
+	13: "bad intent log",
+	14: "external device fault",
+	15: "split into new pool",
+	16: "bad ashift",
+	17: "external device fault",
+	18: "currently in use",
+	19: "all children offline",
+	20: "unsupported minimum blocksize",
+}
+
+// parsePoolStatus decodes the vdev tree and error counters of a pool
+// configuration as ZFS_IOC_POOL_STATS returns it
+func parsePoolStatus(name string, config *nvlist.List) (*PoolStatus, error) {
+	tree, ok := config.LookupList(zpoolConfigVdevTree)
+	if !ok {
+		return nil, fmt.Errorf("pool %s: config has no vdev tree", name)
+	}
+
+	status := &PoolStatus{
+		PoolInfo: poolInfoFromConfig(name, config),
+		Vdevs:    parseVdev(tree, VdevClassNormal),
+	}
+	status.DataErrors, _ = config.LookupUint64(zpoolConfigErrCount)
+
+	if stats, ok := tree.LookupUint64Array(zpoolConfigScanStats); ok {
+		status.Scan, status.ErrorScrub = parseScanStats(stats)
+	}
+
+	if stats, ok := tree.LookupUint64Array(zpoolConfigCheckpointStats); ok {
+		status.Checkpoint = parseCheckpointStats(stats)
+	}
+
+	if stats, ok := tree.LookupUint64Array(zpoolConfigRemovalStats); ok {
+		status.Removal = parseRemovalStats(stats)
+	}
+
+	if spares, ok := tree.LookupListArray(zpoolConfigSpares); ok {
+		for _, spare := range spares {
+			status.Spares = append(status.Spares, parseVdev(spare, VdevClassSpare))
+		}
+	}
+	if cache, ok := tree.LookupListArray(zpoolConfigL2Cache); ok {
+		for _, dev := range cache {
+			status.L2Cache = append(status.L2Cache, parseVdev(dev, VdevClassCache))
+		}
+	}
+	return status, nil
+}
+
+// parseVdev decodes a vdev config and its children. Top-level vdevs get
+// their allocation class from is_log and alloc_bias, holes are left out.
+// Removed top-level vdevs stay in the tree as indirect vdevs.
+func parseVdev(nv *nvlist.List, class string) VdevInfo {
+	vdev := VdevInfo{Class: class}
+	vdev.Type, _ = nv.LookupString(zpoolConfigType)
+	vdev.ID, _ = nv.LookupUint64(zpoolConfigID)
+	vdev.GUID, _ = nv.LookupUint64(zpoolConfigGUID)
+	vdev.Path, _ = nv.LookupString(zpoolConfigPath)
+	vdev.NParity, _ = nv.LookupUint64(zpoolConfigNParity)
+	vdev.Mapping, _ = nv.LookupUint64(zpoolConfigIndirectSize)
+	if removing, _ := nv.LookupUint64(zpoolConfigRemoving); removing != 0 {
+		vdev.Removing = true
+	}
+
+	// zpool status names single parity raidz "raidz1", VdevSpec calls it raidz
+	if vdev.Type == VdevTypeRaidz && vdev.NParity > 1 {
+		vdev.Type += strconv.FormatUint(vdev.NParity, 10)
+	}
+
+	vdev.State = "UNKNOWN"
+	if stats, ok := nv.LookupUint64Array(zpoolConfigVdevStats); ok {
+		vdev.Stats = vdevStats(stats)
+		vdev.Initialize, vdev.Trim = vdevProgress(stats)
+		if len(stats) > vdevStatsAuxIndex {
+			state, aux := stats[vdevStatsStateIndex], stats[vdevStatsAuxIndex]
+			vdev.State = vdevStateName(state, aux)
+			vdev.Aux = vdevAuxNames[aux]
+			if class == VdevClassSpare {
+				vdev.State = spareStateName(state, aux)
+			}
+		}
+	}
+
+	children, _ := nv.LookupListArray(zpoolConfigChildren)
+	for _, child := range children {
+		childClass := VdevClassNormal
+		if vdev.Type == VdevTypeRoot {
+			childClass = topLevelClass(child)
+		}
+		if t, _ := child.LookupString(zpoolConfigType); t == VdevTypeHole {
+			continue
+		}
+		vdev.Children = append(vdev.Children, parseVdev(child, childClass))
+	}
+	return vdev
+}
+
+// topLevelClass returns the allocation class of a top-level vdev
+func topLevelClass(nv *nvlist.List) string {
+	if bias, ok := nv.LookupString(zpoolConfigAllocBias); ok {
+		return bias
+	}
+	if isLog, _ := nv.LookupUint64(zpoolConfigIsLog); isLog != 0 {
+		return VdevClassLog
+	}
+	return VdevClassNormal
+}
+
+// spareStateName reports hot spares as AVAIL or INUSE like zpool status
+func spareStateName(state, aux uint64) string {
+	switch {
+	case aux == vdevAuxSpared:
+		return "INUSE"
+	case state == vdevStateHealthy:
+		return "AVAIL"
+	}
+	return vdevStateName(state, aux)
+}
+
+// vdevStats picks the counters out of a vdev_stat_t array
+func vdevStats(stats []uint64) VdevStats {
+	at := func(i int) uint64 {
+		if i < len(stats) {
+			return stats[i]
+		}
+		return 0
+	}
+	return VdevStats{
+		Alloc:          at(vdevStatsAllocIndex),
+		Space:          at(vdevStatsSpaceIndex),
+		DSpace:         at(vdevStatsDSpaceIndex),
+		ReadErrors:     at(vdevStatsReadErrorsIndex),
+		WriteErrors:    at(vdevStatsWriteErrorsIndex),
+		ChecksumErrors: at(vdevStatsChecksumErrorsIndex),
+		SlowIOs:        at(vdevStatsSlowIOsIndex),
+	}
+}
+
+// vdevProgress picks the initializing and TRIM progress out of a
+// vdev_stat_t array
+func vdevProgress(stats []uint64) (initialize, trim VdevProgress) {
+	at := func(i int) uint64 {
+		if i < len(stats) {
+			return stats[i]
+		}
+		return 0
+	}
+	initialize = VdevProgress{
+		State:      int(at(vdevStatsInitializeStateIndex)),
+		BytesDone:  at(vdevStatsInitializeDoneIndex),
+		BytesEst:   at(vdevStatsInitializeEstIndex),
+		ActionTime: at(vdevStatsInitializeTimeIndex),
+		Errors:     at(vdevStatsInitializeErrorsIndex),
+	}
+	trim = VdevProgress{
+		State:        int(at(vdevStatsTrimStateIndex)),
+		BytesDone:    at(vdevStatsTrimDoneIndex),
+		BytesEst:     at(vdevStatsTrimEstIndex),
+		ActionTime:   at(vdevStatsTrimTimeIndex),
+		Errors:       at(vdevStatsTrimErrorsIndex),
+		NotSupported: at(vdevStatsTrimNotSupIndex) != 0,
+	}
+	return initialize, trim
+}
+
+// parseCheckpointStats decodes a pool_checkpoint_stat_t array, nil when
+// the pool has no checkpoint
+func parseCheckpointStats(stats []uint64) *CheckpointInfo {
+	if len(stats) <= checkpointStatsSpace || stats[checkpointStatsState] == CheckpointStateNone {
+		return nil
+	}
+	return &CheckpointInfo{
+		State:     int(stats[checkpointStatsState]),
+		StartTime: stats[checkpointStatsStartTime],
+		Space:     stats[checkpointStatsSpace],
+	}
+}
+
+// parseRemovalStats decodes a pool_removal_stat_t array, nil when no
+// device was ever removed from the pool
+func parseRemovalStats(stats []uint64) *RemovalInfo {
+	if len(stats) <= removalStatsMappingMemory || stats[removalStatsState] == PoolScanStateNone {
+		return nil
+	}
+	return &RemovalInfo{
+		State:         int(stats[removalStatsState]),
+		Vdev:          stats[removalStatsVdev],
+		StartTime:     stats[removalStatsStartTime],
+		EndTime:       stats[removalStatsEndTime],
+		ToCopy:        stats[removalStatsToCopy],
+		Copied:        stats[removalStatsCopied],
+		MappingMemory: stats[removalStatsMappingMemory],
+	}
+}
+
+// parseScanStats decodes a pool_scan_stat_t array into the last scrub or
+// resilver and the last error scrub, each nil when none was ever run
+func parseScanStats(stats []uint64) (scan, errorScrub *ScanInfo) {
+	at := func(i int) uint64 {
+		if i < len(stats) {
+			return stats[i]
+		}
+		return 0
+	}
+
+	if fn := at(scanStatsFunc); fn != PoolScanNone {
+		scan = &ScanInfo{
+			Function:        int(fn),
+			State:           int(at(scanStatsState)),
+			StartTime:       at(scanStatsStartTime),
+			EndTime:         at(scanStatsEndTime),
+			ToExamine:       at(scanStatsToExamine),
+			Examined:        at(scanStatsExamined),
+			Skipped:         at(scanStatsSkipped),
+			Processed:       at(scanStatsProcessed),
+			Errors:          at(scanStatsErrors),
+			Issued:          at(scanStatsIssued),
+			PassStart:       at(scanStatsPassStart),
+			PassExamined:    at(scanStatsPassExamined),
+			PassIssued:      at(scanStatsPassIssued),
+			PassPaused:      at(scanStatsPassPause),
+			PassSpentPaused: at(scanStatsPassSpentPaused),
+		}
+	}
+
+	if at(scanStatsErrorScrubFunc) == PoolScanErrorScrub {
+		// A running error scrub is DSS_ERRORSCRUBBING, report it as scanning
+		state := int(at(scanStatsErrorScrubState))
+		if state == dssErrorScrubbing {
+			state = PoolScanStateScanning
+		}
+		errorScrub = &ScanInfo{
+			Function:   PoolScanErrorScrub,
+			State:      state,
+			StartTime:  at(scanStatsErrorScrubStart),
+			EndTime:    at(scanStatsErrorScrubEnd),
+			ToExamine:  at(scanStatsErrorScrubToExamine),
+			Examined:   at(scanStatsErrorScrubExamined),
+			PassStart:  at(scanStatsErrorScrubStart),
+			PassPaused: at(scanStatsErrorScrubPause),
+		}
+	}
+	return scan, errorScrub
+}
+
+// Progress returns the rate at which the current pass checks data, in
+// bytes per second, and the estimated time left, computed like zpool
+// status does. Both are zero unless the scan is running, and the time left
+// is zero when it cannot be estimated yet.
+func (s *ScanInfo) Progress(now time.Time) (rate uint64, left time.Duration) {
+	if s.State != PoolScanStateScanning || s.PassPaused != 0 {
+		return 0, 0
+	}
+
+	elapsed := now.Unix() - int64(s.PassStart) - int64(s.PassSpentPaused)
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	issued := s.PassIssued
+	if s.Function == PoolScanErrorScrub {
+		issued = s.Examined
+	}
+	rate = issued / uint64(elapsed)
+
+	total := s.ToExamine
+	if s.Skipped < total {
+		total -= s.Skipped
+	}
+	done := s.Issued
+	if s.Function == PoolScanErrorScrub {
+		done = s.Examined
+	}
+	if rate == 0 || done >= total {
+		return rate, 0
+	}
+	return rate, time.Duration((total-done)/rate) * time.Second
+}
@@ -0,0 +1,358 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/nvlist"
+)
+
+func TestParsePoolStatus(t *testing.T) {
+	healthy := healthyStats()
+	tree := map[string]any{
+		zpoolConfigType:      VdevTypeRoot,
+		zpoolConfigID:        uint64(0),
+		zpoolConfigGUID:      uint64(100),
+		zpoolConfigVdevStats: vdevStatsArray(vdevStateDegraded, 0, 1024, 4096, 1, 0, 0, 0),
+		zpoolConfigChildren: []map[string]any{
+			{
+				zpoolConfigType:      VdevTypeRaidz,
+				zpoolConfigID:        uint64(0),
+				zpoolConfigGUID:      uint64(10),
+				zpoolConfigNParity:   uint64(2),
+				zpoolConfigVdevStats: vdevStatsArray(vdevStateDegraded, 0, 1024, 3072, 0, 0, 0, 0),
+				zpoolConfigChildren: []map[string]any{
+					leafConfig(0, 11, "/dev/ada0", vdevStatsArray(vdevStateHealthy, 0, 0, 0, 3, 2, 1, 7)),
+					leafConfig(1, 12, "/dev/ada1", vdevStatsArray(vdevStateCantOpen, 1, 0, 0, 0, 0, 0, 0)),
+					leafConfig(2, 13, "/dev/ada2", healthy),
+					leafConfig(3, 14, "/dev/ada3", healthy),
+				},
+			},
+			{zpoolConfigType: VdevTypeHole, zpoolConfigID: uint64(1), zpoolConfigGUID: uint64(0)},
+			func() map[string]any {
+				log := leafConfig(2, 20, "/dev/nvd0", healthy)
+				log[zpoolConfigIsLog] = uint64(1)
+				return log
+			}(),
+			func() map[string]any {
+				special := leafConfig(3, 30, "/dev/nvd1", healthy)
+				special[zpoolConfigAllocBias] = VdevClassSpecial
+				return special
+			}(),
+		},
+		zpoolConfigSpares: []map[string]any{
+			leafConfig(0, 40, "/dev/ada4", healthy),
+			leafConfig(0, 41, "/dev/ada5", vdevStatsArray(vdevStateHealthy, vdevAuxSpared, 0, 0, 0, 0, 0, 0)),
+		},
+		zpoolConfigL2Cache: []map[string]any{
+			leafConfig(0, 50, "/dev/nvd2", healthy),
+		},
+	}
+	config, err := nvlist.Encode(map[string]any{
+		zpoolConfigName:      "tank",
+		zpoolConfigPoolGUID:  uint64(1),
+		zpoolConfigPoolState: uint64(PoolStateActive),
+		zpoolConfigErrCount:  uint64(5),
+		zpoolConfigVdevTree:  tree,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := parsePoolStatus("tank", config)
+	if err != nil {
+		t.Fatalf("parsePoolStatus() error = %v", err)
+	}
+
+	leaf := func(id, guid uint64, path, state, aux, class string) VdevInfo {
+		return VdevInfo{Type: VdevTypeDisk, ID: id, Path: path, GUID: guid, State: state, Aux: aux, Class: class}
+	}
+	raidz := VdevInfo{
+		Type: VdevTypeRaidz2, GUID: 10, State: "DEGRADED", NParity: 2,
+		Stats: VdevStats{Alloc: 1024, Space: 3072, DSpace: 3072},
+		Children: []VdevInfo{
+			leaf(0, 11, "/dev/ada0", "ONLINE", "", ""),
+			leaf(1, 12, "/dev/ada1", "UNAVAIL", "cannot open", ""),
+			leaf(2, 13, "/dev/ada2", "ONLINE", "", ""),
+			leaf(3, 14, "/dev/ada3", "ONLINE", "", ""),
+		},
+	}
+	raidz.Children[0].Stats = VdevStats{ReadErrors: 3, WriteErrors: 2, ChecksumErrors: 1, SlowIOs: 7}
+	want := &PoolStatus{
+		PoolInfo: PoolInfo{Name: "tank", GUID: 1, Health: "DEGRADED", State: "ACTIVE"},
+		Vdevs: VdevInfo{
+			Type: VdevTypeRoot, GUID: 100, State: "DEGRADED",
+			Stats: VdevStats{Alloc: 1024, Space: 4096, DSpace: 4096, ReadErrors: 1},
+			Children: []VdevInfo{
+				raidz,
+				leaf(2, 20, "/dev/nvd0", "ONLINE", "", VdevClassLog),
+				leaf(3, 30, "/dev/nvd1", "ONLINE", "", VdevClassSpecial),
+			},
+		},
+		Spares: []VdevInfo{
+			leaf(0, 40, "/dev/ada4", "AVAIL", "", VdevClassSpare),
+			leaf(0, 41, "/dev/ada5", "INUSE", "currently in use", VdevClassSpare),
+		},
+		L2Cache:    []VdevInfo{leaf(0, 50, "/dev/nvd2", "ONLINE", "", VdevClassCache)},
+		DataErrors: 5,
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("parsePoolStatus() =\n%+v\nwant\n%+v", status, want)
+	}
+
+	if _, err := parsePoolStatus("tank", nvlist.New()); err == nil {
+		t.Error("parsePoolStatus() accepted a config without a vdev tree")
+	}
+}
+
+func TestParseVdev_Removal(t *testing.T) {
+	healthy := healthyStats()
+	root, err := nvlist.Encode(map[string]any{
+		zpoolConfigType:      VdevTypeRoot,
+		zpoolConfigVdevStats: healthy,
+		zpoolConfigChildren: []map[string]any{
+			leafConfig(0, 10, "/dev/ada0", healthy),
+			{
+				zpoolConfigType:         VdevTypeIndirect,
+				zpoolConfigID:           uint64(1),
+				zpoolConfigGUID:         uint64(20),
+				zpoolConfigIndirectSize: uint64(4096),
+				zpoolConfigVdevStats:    healthy,
+			},
+			func() map[string]any {
+				removing := leafConfig(2, 30, "/dev/ada1", healthy)
+				removing[zpoolConfigRemoving] = uint64(1)
+				return removing
+			}(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vdev := parseVdev(root, VdevClassNormal)
+	if len(vdev.Children) != 3 {
+		t.Fatalf("parseVdev() has %d children, want 3", len(vdev.Children))
+	}
+	indirect := vdev.Children[1]
+	if indirect.Type != VdevTypeIndirect || indirect.ID != 1 || indirect.Mapping != 4096 || indirect.Removing {
+		t.Errorf("indirect vdev = %+v", indirect)
+	}
+	if removing := vdev.Children[2]; !removing.Removing || removing.Mapping != 0 {
+		t.Errorf("removing vdev = %+v", removing)
+	}
+	if vdev.Children[0].Removing {
+		t.Error("vdev without removing flag reported as removing")
+	}
+}
+
+func TestVdevStats_ShortArray(t *testing.T) {
+	// Kernels before slow I/O accounting report a shorter vdev_stat_t
+	stats := vdevStatsArray(vdevStateHealthy, 0, 1, 2, 3, 4, 5, 6)[:vdevStatsSlowIOsIndex]
+	got := vdevStats(stats)
+	want := VdevStats{Alloc: 1, Space: 2, DSpace: 2, ReadErrors: 3, WriteErrors: 4, ChecksumErrors: 5}
+	if got != want {
+		t.Errorf("vdevStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestVdevProgress(t *testing.T) {
+	stats := make([]uint64, vdevStatsTrimTimeIndex+1)
+	stats[vdevStatsInitializeStateIndex] = VdevActionStateSuspended
+	stats[vdevStatsInitializeDoneIndex] = 1 << 20
+	stats[vdevStatsInitializeEstIndex] = 1 << 30
+	stats[vdevStatsInitializeTimeIndex] = 1700000000
+	stats[vdevStatsInitializeErrorsIndex] = 2
+	stats[vdevStatsTrimStateIndex] = VdevActionStateActive
+	stats[vdevStatsTrimDoneIndex] = 4096
+	stats[vdevStatsTrimEstIndex] = 8192
+	stats[vdevStatsTrimTimeIndex] = 1700000100
+
+	notSup := make([]uint64, len(stats))
+	notSup[vdevStatsTrimNotSupIndex] = 1
+
+	tests := []struct {
+		name           string
+		stats          []uint64
+		wantInitialize VdevProgress
+		wantTrim       VdevProgress
+	}{
+		{
+			name:           "both",
+			stats:          stats,
+			wantInitialize: VdevProgress{State: VdevActionStateSuspended, BytesDone: 1 << 20, BytesEst: 1 << 30, ActionTime: 1700000000, Errors: 2},
+			wantTrim:       VdevProgress{State: VdevActionStateActive, BytesDone: 4096, BytesEst: 8192, ActionTime: 1700000100},
+		},
+		{
+			// Kernels before TRIM support stop after vs_slow_ios
+			name:           "no trim",
+			stats:          stats[:vdevStatsSlowIOsIndex+1],
+			wantInitialize: VdevProgress{State: VdevActionStateSuspended, BytesDone: 1 << 20, BytesEst: 1 << 30, ActionTime: 1700000000, Errors: 2},
+		},
+		{
+			name:     "trim not supported",
+			stats:    notSup,
+			wantTrim: VdevProgress{NotSupported: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initialize, trim := vdevProgress(test.stats)
+			if initialize != test.wantInitialize || trim != test.wantTrim {
+				t.Errorf("vdevProgress() = %+v, %+v, want %+v, %+v", initialize, trim, test.wantInitialize, test.wantTrim)
+			}
+		})
+	}
+}
+
+func TestParseCheckpointStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats []uint64
+		want  *CheckpointInfo
+	}{
+		{"exists", []uint64{CheckpointStateExists, 1700000000, 4096}, &CheckpointInfo{State: CheckpointStateExists, StartTime: 1700000000, Space: 4096}},
+		{"discarding", []uint64{CheckpointStateDiscarding, 1700000000, 1024}, &CheckpointInfo{State: CheckpointStateDiscarding, StartTime: 1700000000, Space: 1024}},
+		{"none", []uint64{CheckpointStateNone, 0, 0}, nil},
+		{"short", []uint64{CheckpointStateExists}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseCheckpointStats(test.stats); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseCheckpointStats() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseRemovalStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats []uint64
+		want  *RemovalInfo
+	}{
+		{"copying", []uint64{PoolScanStateScanning, 1, 1700000000, 0, 8192, 4096, 512},
+			&RemovalInfo{State: PoolScanStateScanning, Vdev: 1, StartTime: 1700000000, ToCopy: 8192, Copied: 4096, MappingMemory: 512}},
+		{"finished", []uint64{PoolScanStateFinished, 2, 1700000000, 1700000300, 8192, 8192, 1024},
+			&RemovalInfo{State: PoolScanStateFinished, Vdev: 2, StartTime: 1700000000, EndTime: 1700000300, ToCopy: 8192, Copied: 8192, MappingMemory: 1024}},
+		{"never", []uint64{PoolScanStateNone, 0, 0, 0, 0, 0, 0}, nil},
+		{"short", []uint64{PoolScanStateScanning, 1, 1700000000}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseRemovalStats(test.stats); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseRemovalStats() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseScanStats(t *testing.T) {
+	stats := make([]uint64, scanStatsErrorScrubPause+1)
+	stats[scanStatsFunc] = PoolScanScrub
+	stats[scanStatsState] = PoolScanStateScanning
+	stats[scanStatsStartTime] = 1000
+	stats[scanStatsToExamine] = 8 << 30
+	stats[scanStatsExamined] = 6 << 30
+	stats[scanStatsIssued] = 2 << 30
+	stats[scanStatsPassStart] = 1000
+	stats[scanStatsPassIssued] = 2 << 30
+	stats[scanStatsErrorScrubFunc] = PoolScanErrorScrub
+	stats[scanStatsErrorScrubState] = dssErrorScrubbing
+	stats[scanStatsErrorScrubStart] = 1500
+	stats[scanStatsErrorScrubToExamine] = 10
+	stats[scanStatsErrorScrubExamined] = 4
+
+	scan, errorScrub := parseScanStats(stats)
+	want := &ScanInfo{
+		Function: PoolScanScrub, State: PoolScanStateScanning, StartTime: 1000,
+		ToExamine: 8 << 30, Examined: 6 << 30, Issued: 2 << 30, PassStart: 1000, PassIssued: 2 << 30,
+	}
+	if !reflect.DeepEqual(scan, want) {
+		t.Errorf("scan = %+v, want %+v", scan, want)
+	}
+	wantErrorScrub := &ScanInfo{
+		Function: PoolScanErrorScrub, State: PoolScanStateScanning, StartTime: 1500,
+		ToExamine: 10, Examined: 4, PassStart: 1500,
+	}
+	if !reflect.DeepEqual(errorScrub, wantErrorScrub) {
+		t.Errorf("error scrub = %+v, want %+v", errorScrub, wantErrorScrub)
+	}
+
+	// A paused error scrub keeps its pause time in seconds
+	stats[scanStatsErrorScrubPause] = 1600
+	if _, errorScrub := parseScanStats(stats); errorScrub == nil || errorScrub.PassPaused != 1600 {
+		t.Errorf("paused error scrub = %+v, want PassPaused 1600", errorScrub)
+	}
+
+	// Pools that never ran a scan, on kernels without error scrub
+	if scan, errorScrub := parseScanStats(make([]uint64, scanStatsIssued+1)); scan != nil || errorScrub != nil {
+		t.Errorf("parseScanStats() of an idle pool = %+v, %+v, want nil", scan, errorScrub)
+	}
+}
+
+func TestScanInfo_Progress(t *testing.T) {
+	now := time.Unix(2000, 0)
+	tests := []struct {
+		name     string
+		scan     ScanInfo
+		wantRate uint64
+		wantLeft time.Duration
+	}{
+		{
+			name: "running",
+			scan: ScanInfo{
+				Function: PoolScanScrub, State: PoolScanStateScanning, ToExamine: 3000,
+				Issued: 1000, PassIssued: 1000, PassStart: 1900,
+			},
+			wantRate: 10,
+			wantLeft: 200 * time.Second,
+		},
+		{
+			name: "time spent paused does not count",
+			scan: ScanInfo{
+				Function: PoolScanScrub, State: PoolScanStateScanning, ToExamine: 3000,
+				Issued: 1000, PassIssued: 1000, PassStart: 1800, PassSpentPaused: 100,
+			},
+			wantRate: 10,
+			wantLeft: 200 * time.Second,
+		},
+		{
+			name: "skipped bytes are not issued",
+			scan: ScanInfo{
+				Function: PoolScanResilver, State: PoolScanStateScanning, ToExamine: 3000, Skipped: 1000,
+				Issued: 1000, PassIssued: 1000, PassStart: 1900,
+			},
+			wantRate: 10,
+			wantLeft: 100 * time.Second,
+		},
+		{
+			name: "just started",
+			scan: ScanInfo{Function: PoolScanScrub, State: PoolScanStateScanning, ToExamine: 3000, PassStart: 2000},
+		},
+		{
+			name: "paused",
+			scan: ScanInfo{
+				Function: PoolScanScrub, State: PoolScanStateScanning, ToExamine: 3000,
+				Issued: 1000, PassIssued: 1000, PassStart: 1900, PassPaused: 1950,
+			},
+		},
+		{
+			name: "finished",
+			scan: ScanInfo{Function: PoolScanScrub, State: PoolScanStateFinished, ToExamine: 3000, Issued: 3000},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rate, left := test.scan.Progress(now)
+			if rate != test.wantRate || left != test.wantLeft {
+				t.Errorf("Progress() = %d, %v, want %d, %v", rate, left, test.wantRate, test.wantLeft)
+			}
+		})
+	}
+}
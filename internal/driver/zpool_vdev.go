@@ -0,0 +1,261 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+// dRAID limits, following vdev_draid.h
+const (
+	draidMaxParity   = 3   // VDEV_DRAID_MAXPARITY
+	draidMaxChildren = 255 // VDEV_DRAID_MAX_CHILDREN
+	draidMaxSpares   = 100 // VDEV_DRAID_MAX_SPARES
+	draidDefaultData = 8   // Data devices per group zpool create picks
+)
+
+// vdevMinDevices is the number of devices each vdev type needs
+var vdevMinDevices = map[string]int{
+	VdevTypeDisk:   1,
+	VdevTypeMirror: 2,
+	VdevTypeRaidz:  3,
+	VdevTypeRaidz2: 4,
+	VdevTypeRaidz3: 5,
+	VdevTypeDraid:  2,
+}
+
+// DraidConfig is the layout of a dRAID vdev, with the defaults of zpool
+// create filled in
+type DraidConfig struct {
+	Parity int
+	Data   int // Data devices per redundancy group
+	Spares int // Distributed spares
+	Groups int // Redundancy groups, so that groups fill whole rows
+}
+
+// replication is the redundancy of a top-level vdev as zpool create
+// compares it, with raidz levels folded into one type
+type replication struct {
+	typ    string
+	parity int
+	width  int
+}
+
+// leafVdevType returns the type of the leaf vdev for a device path. Like
+// zpool create on FreeBSD, paths outside /dev are taken to be files.
+func leafVdevType(path string) string {
+	if strings.HasPrefix(path, "/dev/") {
+		return VdevTypeDisk
+	}
+	return VdevTypeFile
+}
+
+// SpecType returns the vdev type of a spec, disk when none is given
+func SpecType(spec VdevSpec) string {
+	if spec.Type == "" {
+		return VdevTypeDisk
+	}
+	return spec.Type
+}
+
+// RaidzParity returns the parity level of a raidz vdev type
+func RaidzParity(typ string) int {
+	switch typ {
+	case VdevTypeRaidz:
+		return 1
+	case VdevTypeRaidz2:
+		return 2
+	case VdevTypeRaidz3:
+		return 3
+	}
+	return 0
+}
+
+// DraidLayout works out the layout of a draid spec the way zpool create
+// does for draid<parity>:<data>d:<children>c:<spares>s
+func DraidLayout(spec VdevSpec) (DraidConfig, error) {
+	children := len(spec.Devices)
+	config := DraidConfig{Parity: spec.Parity, Data: spec.Data, Spares: spec.Spares}
+	if config.Parity == 0 {
+		config.Parity = 1
+	}
+
+	switch {
+	case config.Parity < 1 || config.Parity > draidMaxParity:
+		return config, fmt.Errorf("invalid dRAID parity level %d, must be between 1 and %d", config.Parity, draidMaxParity)
+	case spec.Children != 0 && spec.Children != children:
+		return config, fmt.Errorf("requested number of dRAID children %d and actual %d do not match", spec.Children, children)
+	case children > draidMaxChildren:
+		return config, fmt.Errorf("%d dRAID children given, at most %d are supported", children, draidMaxChildren)
+	case config.Spares < 0 || config.Spares > draidMaxSpares:
+		return config, fmt.Errorf("invalid number of dRAID spares %d, must be between 0 and %d", config.Spares, draidMaxSpares)
+	}
+
+	available := children - config.Spares - config.Parity
+	if available < 1 {
+		return config, fmt.Errorf("%d dRAID children cannot hold %d parity and %d spare devices and any data",
+			children, config.Parity, config.Spares)
+	}
+	if config.Data == 0 {
+		config.Data = min(available, draidDefaultData)
+	}
+	if config.Data < 1 || config.Data > available {
+		return config, fmt.Errorf("requested number of dRAID data disks per group %d is too high, at most %d disks are available for data",
+			config.Data, available)
+	}
+
+	config.Groups = 1
+	for config.Groups*(config.Data+config.Parity)%(children-config.Spares) != 0 {
+		config.Groups++
+	}
+	return config, nil
+}
+
+// ValidateTopology checks the vdev groups of a new pool the way zpool
+// create does. Mismatched replication levels across the normal, special
+// and dedup vdevs are refused unless force is set.
+func ValidateTopology(poolName string, vdevs []VdevSpec, force bool) error {
+	invalid := func(detail string) error {
+		return zfserrors.NewZfsError("create_pool", poolName, zfserrors.ErrCodeInval, errnoInval, detail, nil)
+	}
+
+	seen := make(map[string]bool)
+	normal := false
+	var reps []replication
+	for _, spec := range vdevs {
+		typ := SpecType(spec)
+		for _, device := range spec.Devices {
+			if device == "" {
+				return invalid("device paths must not be empty")
+			}
+			if seen[device] {
+				return invalid(fmt.Sprintf("%s is specified more than once", device))
+			}
+			seen[device] = true
+		}
+
+		switch spec.Class {
+		case VdevClassSpare, VdevClassCache:
+			if typ != VdevTypeDisk {
+				return invalid(fmt.Sprintf("unsupported '%s' device: %s", spec.Class, typ))
+			}
+			if len(spec.Devices) == 0 {
+				return invalid(fmt.Sprintf("'%s' requires at least one device", spec.Class))
+			}
+			continue
+		case VdevClassNormal, VdevClassLog, VdevClassSpecial, VdevClassDedup:
+		default:
+			return invalid(fmt.Sprintf("unknown allocation class %q", spec.Class))
+		}
+
+		minDevices, ok := vdevMinDevices[typ]
+		if !ok {
+			return invalid(fmt.Sprintf("unsupported vdev type: %s", typ))
+		}
+		if len(spec.Devices) < minDevices || typ == VdevTypeDisk && len(spec.Devices) != 1 {
+			return invalid(fmt.Sprintf("%s vdev requires at least %d devices, got %d", typ, minDevices, len(spec.Devices)))
+		}
+		if spec.Class == VdevClassLog && typ != VdevTypeDisk && typ != VdevTypeMirror {
+			return invalid(fmt.Sprintf("unsupported 'log' device: %s", typ))
+		}
+
+		rep := replication{typ: typ, width: len(spec.Devices)}
+		switch typ {
+		case VdevTypeDisk:
+			rep.typ = leafVdevType(spec.Devices[0])
+		case VdevTypeMirror:
+			rep.parity = len(spec.Devices) - 1
+		case VdevTypeRaidz, VdevTypeRaidz2, VdevTypeRaidz3:
+			rep.typ = VdevTypeRaidz
+			rep.parity = RaidzParity(typ)
+		case VdevTypeDraid:
+			config, err := DraidLayout(spec)
+			if err != nil {
+				return invalid(err.Error())
+			}
+			rep.parity = config.Parity
+		}
+		if typ != VdevTypeDisk && !force {
+			if err := checkLeafTypes(typ, spec.Devices); err != nil {
+				return invalid(err.Error())
+			}
+		}
+
+		normal = normal || spec.Class == VdevClassNormal
+		if spec.Class != VdevClassLog {
+			reps = append(reps, rep)
+		}
+	}
+
+	if !normal {
+		return invalid("at least one toplevel vdev must be specified")
+	}
+	if force {
+		return nil
+	}
+	for _, rep := range reps[1:] {
+		if err := reps[0].mismatch(rep); err != nil {
+			return invalid(err.Error())
+		}
+	}
+	return nil
+}
+
+// checkLeafTypes refuses vdevs mixing files and devices
+func checkLeafTypes(typ string, devices []string) error {
+	for _, device := range devices[1:] {
+		if leafVdevType(device) != leafVdevType(devices[0]) {
+			return fmt.Errorf("mismatched replication level: %s contains both files and devices", typ)
+		}
+	}
+	return nil
+}
+
+// mismatch reports how other differs from the replication level r, in the
+// words of zpool create
+func (r replication) mismatch(other replication) error {
+	switch {
+	case r.typ != other.typ:
+		return fmt.Errorf("mismatched replication level: both %s and %s vdevs are present", r.typ, other.typ)
+	case r.typ != VdevTypeMirror && r.parity != other.parity:
+		return fmt.Errorf("mismatched replication level: both %d and %d device parity %s vdevs are present",
+			r.parity, other.parity, r.typ)
+	case r.width != other.width:
+		return fmt.Errorf("mismatched replication level: both %d-way and %d-way %s vdevs are present",
+			r.width, other.width, r.typ)
+	}
+	return nil
+}
+
+// SplitDevices returns the paths of the mirror sides named for a split,
+// where zpool split takes disks relative to /dev
+func SplitDevices(devices []string) []string {
+	paths := make([]string, len(devices))
+	for i, device := range devices {
+		paths[i] = device
+		if !strings.HasPrefix(device, "/") {
+			paths[i] = "/dev/" + device
+		}
+	}
+	return paths
+}
+
+// SplitProps returns the properties of the pool a split creates, adding
+// altroot the way zpool split -R does. They are checked like those given
+// to an import.
+func SplitProps(newPoolName string, opts SplitOptions) (map[string]string, error) {
+	props := make(map[string]string, len(opts.Properties)+1)
+	for name, value := range opts.Properties {
+		props[name] = value
+	}
+	if opts.AltRoot != "" {
+		props["altroot"] = opts.AltRoot
+	}
+	for name, value := range props {
+		if err := ValidatePoolImportProp(newPoolName, name, value); err != nil {
+			return nil, err
+		}
+	}
+	return props, nil
+}
@@ -0,0 +1,140 @@
+package driver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDraidLayout(t *testing.T) {
+	devices := func(n int) []string {
+		paths := make([]string, n)
+		for i := range paths {
+			paths[i] = "/dev/da" + string(rune('a'+i))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		spec    VdevSpec
+		want    DraidConfig
+		wantErr bool
+	}{
+		{"defaults", VdevSpec{Devices: devices(11)}, DraidConfig{Parity: 1, Data: 8, Groups: 11}, false},
+		{"narrow", VdevSpec{Devices: devices(4)}, DraidConfig{Parity: 1, Data: 3, Groups: 1}, false},
+		{"draid2:4d:1s", VdevSpec{Devices: devices(11), Parity: 2, Data: 4, Spares: 1}, DraidConfig{Parity: 2, Data: 4, Spares: 1, Groups: 5}, false},
+		{"children match", VdevSpec{Devices: devices(5), Children: 5}, DraidConfig{Parity: 1, Data: 4, Groups: 1}, false},
+		{"children mismatch", VdevSpec{Devices: devices(5), Children: 6}, DraidConfig{}, true},
+		{"parity too high", VdevSpec{Devices: devices(8), Parity: 4}, DraidConfig{}, true},
+		{"data too high", VdevSpec{Devices: devices(6), Data: 6}, DraidConfig{}, true},
+		{"no room for data", VdevSpec{Devices: devices(3), Parity: 2, Spares: 1}, DraidConfig{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DraidLayout(test.spec)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DraidLayout() error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && got != test.want {
+				t.Errorf("DraidLayout() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateTopology(t *testing.T) {
+	disk := func(class, path string) VdevSpec {
+		return VdevSpec{Type: VdevTypeDisk, Devices: []string{path}, Class: class}
+	}
+	mirror := func(class string, paths ...string) VdevSpec {
+		return VdevSpec{Type: VdevTypeMirror, Devices: paths, Class: class}
+	}
+	raidz := func(typ string, paths ...string) VdevSpec {
+		return VdevSpec{Type: typ, Devices: paths}
+	}
+
+	tests := []struct {
+		name    string
+		vdevs   []VdevSpec
+		force   bool
+		wantErr string
+	}{
+		{"stripe", []VdevSpec{disk("", "/dev/ada0"), {Devices: []string{"/dev/ada1"}}}, false, ""},
+		{"mirrors with classes", []VdevSpec{
+			mirror("", "/dev/ada0", "/dev/ada1"),
+			mirror(VdevClassSpecial, "/dev/nvd0", "/dev/nvd1"),
+			disk(VdevClassLog, "/dev/nvd2"),
+			{Devices: []string{"/dev/ada2", "/dev/ada3"}, Class: VdevClassSpare},
+			{Devices: []string{"/dev/nvd3"}, Class: VdevClassCache},
+		}, false, ""},
+		{"mirror and disk", []VdevSpec{mirror("", "/dev/ada0", "/dev/ada1"), disk("", "/dev/ada2")}, false,
+			"both mirror and disk vdevs are present"},
+		{"mirror and disk forced", []VdevSpec{mirror("", "/dev/ada0", "/dev/ada1"), disk("", "/dev/ada2")}, true, ""},
+		{"single special on mirror", []VdevSpec{mirror("", "/dev/ada0", "/dev/ada1"), disk(VdevClassSpecial, "/dev/nvd0")}, false,
+			"both mirror and disk vdevs are present"},
+		{"mirror widths", []VdevSpec{mirror("", "/dev/ada0", "/dev/ada1"), mirror("", "/dev/ada2", "/dev/ada3", "/dev/ada4")}, false,
+			"both 2-way and 3-way mirror vdevs are present"},
+		{"raidz parity", []VdevSpec{
+			raidz(VdevTypeRaidz, "/dev/ada0", "/dev/ada1", "/dev/ada2", "/dev/ada3"),
+			raidz(VdevTypeRaidz2, "/dev/ada4", "/dev/ada5", "/dev/ada6", "/dev/ada7"),
+		}, false, "both 1 and 2 device parity raidz vdevs are present"},
+		{"files and devices", []VdevSpec{mirror("", "/dev/ada0", "/tmp/file0")}, false, "mirror contains both files and devices"},
+		{"log is not compared", []VdevSpec{raidz(VdevTypeRaidz, "/dev/ada0", "/dev/ada1", "/dev/ada2"), disk(VdevClassLog, "/dev/nvd0")}, false, ""},
+		{"raidz log", []VdevSpec{disk("", "/dev/ada0"), {Type: VdevTypeRaidz, Devices: []string{"/dev/nvd0", "/dev/nvd1", "/dev/nvd2"}, Class: VdevClassLog}}, true,
+			"unsupported 'log' device: raidz"},
+		{"mirrored spare", []VdevSpec{disk("", "/dev/ada0"), mirror(VdevClassSpare, "/dev/ada1", "/dev/ada2")}, true,
+			"unsupported 'spare' device: mirror"},
+		{"only a log", []VdevSpec{disk(VdevClassLog, "/dev/nvd0")}, true, "at least one toplevel vdev"},
+		{"device twice", []VdevSpec{disk("", "/dev/ada0"), disk(VdevClassCache, "/dev/ada0")}, true, "specified more than once"},
+		{"short mirror", []VdevSpec{mirror("", "/dev/ada0")}, true, "requires at least 2 devices"},
+		{"unknown class", []VdevSpec{disk("metadata", "/dev/ada0")}, true, "unknown allocation class"},
+		{"bad draid", []VdevSpec{{Type: VdevTypeDraid, Devices: []string{"/dev/ada0", "/dev/ada1"}, Parity: 2}}, true, "dRAID"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateTopology("tank", test.vdevs, test.force)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("ValidateTopology() error = %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("ValidateTopology() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitProps(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SplitOptions
+		want    map[string]string
+		wantErr bool
+	}{
+		{"none", SplitOptions{}, map[string]string{}, false},
+		{"altroot", SplitOptions{AltRoot: "/mnt", Properties: map[string]string{"comment": "copy"}},
+			map[string]string{"altroot": "/mnt", "comment": "copy"}, false},
+		{"readonly", SplitOptions{Properties: map[string]string{"readonly": "on"}}, map[string]string{"readonly": "on"}, false},
+		{"relative altroot", SplitOptions{AltRoot: "mnt"}, nil, true},
+		{"unknown", SplitOptions{Properties: map[string]string{"bogus": "1"}}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := SplitProps("copy", test.opts)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("SplitProps() error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("SplitProps() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	got := SplitDevices([]string{"ada1", "/dev/ada3", "/tmp/file1"})
+	if want := []string{"/dev/ada1", "/dev/ada3", "/tmp/file1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitDevices() = %v, want %v", got, want)
+	}
+}
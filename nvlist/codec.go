@@ -0,0 +1,151 @@
+package nvlist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned when packed data ends before the list does
+var ErrTruncated = errors.New("truncated nvlist")
+
+// Packed stream header (nvs_header_t): encoding, endianness, two reserved bytes
+const headerSize = 4
+
+// Values of nvh_endian
+const (
+	bigEndian    = 0
+	littleEndian = 1
+)
+
+// Sizes of the native in-memory structures, see sys/nvpair.h
+const (
+	nvpairHeaderSize = 16 // nvp_size, nvp_name_sz, nvp_reserve, nvp_value_elem, nvp_type
+	nvlistSize       = 24 // nvl_version, nvl_nvflag, nvl_priv, nvl_flag, nvl_pad
+	pointerSize      = 8  // embedded pointers are always stored as uint64
+)
+
+// hostOrder and hostEndian describe the byte order used for native packing
+var (
+	hostOrder  binary.AppendByteOrder = binary.NativeEndian
+	hostEndian byte                   = func() byte {
+		if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 {
+			return littleEndian
+		}
+		return bigEndian
+	}()
+)
+
+// align4 rounds n up to a multiple of four (NV_ALIGN4)
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// align8 rounds n up to a multiple of eight (NV_ALIGN)
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+// valueSize returns the size of the value area of an in-memory nvpair
+// (i_get_value_size), including the bytes of any strings
+func valueSize(p Pair) int {
+	n := nelem(p)
+	switch p.Type {
+	case TypeBoolean:
+		return 0
+	case TypeBooleanValue, TypeInt32, TypeUint32:
+		return 4
+	case TypeByte, TypeInt8, TypeUint8:
+		return 1
+	case TypeInt16, TypeUint16:
+		return 2
+	case TypeInt64, TypeUint64, TypeHrtime, TypeDouble:
+		return 8
+	case TypeString:
+		return len(p.Value.(string)) + 1
+	case TypeByteArray, TypeInt8Array, TypeUint8Array:
+		return n
+	case TypeInt16Array, TypeUint16Array:
+		return 2 * n
+	case TypeBooleanArray, TypeInt32Array, TypeUint32Array:
+		return 4 * n
+	case TypeInt64Array, TypeUint64Array:
+		return 8 * n
+	case TypeStringArray:
+		size := pointerSize * n
+		for _, s := range p.Value.([]string) {
+			size += len(s) + 1
+		}
+		return size
+	case TypeNvlist:
+		return nvlistSize
+	case TypeNvlistArray:
+		return (pointerSize + nvlistSize) * n
+	}
+	return 0
+}
+
+// nativePairSize returns nvp_size, the size of the in-memory nvpair
+// (NVP_SIZE_CALC). Embedded lists are not included.
+func nativePairSize(p Pair) int {
+	return align8(nvpairHeaderSize+len(p.Name)+1) + align8(valueSize(p))
+}
+
+// reader is a bounds-checked cursor over packed data
+type reader struct {
+	data  []byte
+	off   int
+	order binary.ByteOrder
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.off
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > r.remaining() {
+		return nil, fmt.Errorf("%w at offset %d", ErrTruncated, r.off)
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b, nil
+}
+
+func (r *reader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+func (r *reader) int32() (int32, error) {
+	v, err := r.uint32()
+	return int32(v), err
+}
+
+func (r *reader) uint64() (uint64, error) {
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint64(b), nil
+}
+
+// checkNelem validates the element count of a decoded pair (i_validate_type_nelem)
+func checkNelem(typ DataType, n int32) error {
+	switch {
+	case n < 0:
+		return fmt.Errorf("negative element count %d", n)
+	case typ == TypeBoolean:
+		if n != 0 {
+			return fmt.Errorf("boolean flag with %d elements", n)
+		}
+	case typ.IsArray():
+	default:
+		if n != 1 {
+			return fmt.Errorf("%v value with %d elements", typ, n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,559 @@
+package nvlist
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Marshal packs a map[string]any, a tagged struct or a *List.
+//
+// Struct fields are named by their `nvlist` tag, or by the field name when
+// the tag is absent. A tag of "-" skips the field. The "omitempty" option
+// skips zero values, and the "flag" option encodes a bool field as a
+// TypeBoolean pair that is present only when the field is true. Nested
+// structs and maps become nested lists, and slices of them become list
+// arrays. Signed and unsigned integers keep their width; int and uint are
+// encoded as 64-bit values.
+func Marshal(v any, enc Encoding) ([]byte, error) {
+	l, err := Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return l.Pack(enc)
+}
+
+// Unmarshal unpacks data into a *map[string]any, a pointer to a tagged
+// struct or a *List. Pairs without a matching struct field are ignored.
+// Integer pairs can be stored in any integer field that holds their value.
+func Unmarshal(data []byte, v any) error {
+	l, err := Unpack(data)
+	if err != nil {
+		return err
+	}
+	return Decode(l, v)
+}
+
+// Encode converts a map[string]any or a tagged struct into a List
+func Encode(v any) (*List, error) {
+	if l, ok := v.(*List); ok {
+		if l == nil {
+			return nil, fmt.Errorf("nvlist: cannot encode nil list")
+		}
+		return l, nil
+	}
+
+	l, lists, err := listsFromValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("nvlist: %w", err)
+	}
+	if lists != nil {
+		return nil, fmt.Errorf("nvlist: cannot encode %T as a single list", v)
+	}
+	return l, nil
+}
+
+// Decode stores the pairs of a list into a *map[string]any, a pointer to a
+// tagged struct or a *List
+func Decode(l *List, v any) error {
+	switch out := v.(type) {
+	case *List:
+		*out = *l
+		return nil
+	case *map[string]any:
+		*out = l.Map()
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("nvlist: cannot decode into %T", v)
+	}
+	if err := decodeStruct(l, rv.Elem()); err != nil {
+		return fmt.Errorf("nvlist: %w", err)
+	}
+	return nil
+}
+
+// Map returns the list as a map. Nested lists become map[string]any and
+// list arrays become []map[string]any; all other values keep the Go type
+// documented on Pair. When names repeat, the last pair wins.
+func (l *List) Map() map[string]any {
+	m := make(map[string]any, len(l.Pairs))
+	for _, p := range l.Pairs {
+		switch v := p.Value.(type) {
+		case *List:
+			m[p.Name] = v.Map()
+		case []*List:
+			children := make([]map[string]any, len(v))
+			for i, child := range v {
+				children[i] = child.Map()
+			}
+			m[p.Name] = children
+		default:
+			m[p.Name] = v
+		}
+	}
+	return m
+}
+
+// listsFromValue converts a map or struct into a list, or a slice of them
+// into a list array
+func listsFromValue(v any) (*List, []*List, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, nil, fmt.Errorf("cannot encode nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Struct:
+		l, err := listFromValue(rv, 0)
+		return l, nil, err
+	case reflect.Slice, reflect.Array:
+		lists := make([]*List, rv.Len())
+		for i := range lists {
+			elem := rv.Index(i)
+			for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Interface {
+				if elem.IsNil() {
+					return nil, nil, fmt.Errorf("nil element %d in %s", i, rv.Type())
+				}
+				elem = elem.Elem()
+			}
+			l, err := listFromValue(elem, 1)
+			if err != nil {
+				return nil, nil, err
+			}
+			lists[i] = l
+		}
+		return nil, lists, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported type %s", rv.Type())
+}
+
+func listFromValue(rv reflect.Value, depth int) (*List, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxDepth)
+	}
+	if l, ok := rv.Interface().(List); ok {
+		return &l, nil
+	}
+
+	l := New()
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+			if err := addValue(l, key, value, depth); err != nil {
+				return nil, err
+			}
+		}
+	case reflect.Struct:
+		for _, field := range structFields(rv.Type()) {
+			value := rv.FieldByIndex(field.index)
+			if field.omitEmpty && value.IsZero() {
+				continue
+			}
+			if field.flag {
+				if value.Kind() != reflect.Bool {
+					return nil, fmt.Errorf("field %s: flag option requires a bool", field.goName)
+				}
+				if value.Bool() {
+					l.add(Pair{Name: field.name, Type: TypeBoolean, Value: true})
+				}
+				continue
+			}
+			if err := addValue(l, field.name, value, depth); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", rv.Type())
+	}
+	return l, nil
+}
+
+// addValue converts a Go value to its canonical nvpair representation
+func addValue(l *List, name string, rv reflect.Value, depth int) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		if _, ok := rv.Interface().(*List); ok {
+			break
+		}
+		rv = rv.Elem()
+	}
+
+	switch value := rv.Interface().(type) {
+	case *List, []*List, Pair:
+		return l.Add(name, value)
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return l.Add(name, rv.Bool())
+	case reflect.Int8:
+		return l.Add(name, int8(rv.Int()))
+	case reflect.Int16:
+		return l.Add(name, int16(rv.Int()))
+	case reflect.Int32:
+		return l.Add(name, int32(rv.Int()))
+	case reflect.Int, reflect.Int64:
+		return l.Add(name, rv.Int())
+	case reflect.Uint8:
+		return l.Add(name, uint8(rv.Uint()))
+	case reflect.Uint16:
+		return l.Add(name, uint16(rv.Uint()))
+	case reflect.Uint32:
+		return l.Add(name, uint32(rv.Uint()))
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return l.Add(name, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return l.Add(name, rv.Float())
+	case reflect.String:
+		return l.Add(name, rv.String())
+	case reflect.Map, reflect.Struct:
+		child, err := listFromValue(rv, depth+1)
+		if err != nil {
+			return fmt.Errorf("pair %q: %w", name, err)
+		}
+		return l.Add(name, child)
+	case reflect.Slice, reflect.Array:
+		value, err := sliceValue(rv, depth)
+		if err != nil {
+			return fmt.Errorf("pair %q: %w", name, err)
+		}
+		return l.Add(name, value)
+	}
+	return fmt.Errorf("nvlist: pair %q: unsupported type %s", name, rv.Type())
+}
+
+// sliceValue converts a slice to the canonical array type of its elements
+func sliceValue(rv reflect.Value, depth int) (any, error) {
+	elemType := rv.Type().Elem()
+	kind := elemType.Kind()
+	if kind == reflect.Pointer {
+		kind = elemType.Elem().Kind()
+	}
+
+	var canonical reflect.Type
+	switch kind {
+	case reflect.Bool:
+		canonical = reflect.TypeOf([]bool(nil))
+	case reflect.Int8:
+		canonical = reflect.TypeOf([]int8(nil))
+	case reflect.Int16:
+		canonical = reflect.TypeOf([]int16(nil))
+	case reflect.Int32:
+		canonical = reflect.TypeOf([]int32(nil))
+	case reflect.Int, reflect.Int64:
+		canonical = reflect.TypeOf([]int64(nil))
+	case reflect.Uint8:
+		canonical = reflect.TypeOf([]uint8(nil))
+	case reflect.Uint16:
+		canonical = reflect.TypeOf([]uint16(nil))
+	case reflect.Uint32:
+		canonical = reflect.TypeOf([]uint32(nil))
+	case reflect.Uint, reflect.Uint64:
+		canonical = reflect.TypeOf([]uint64(nil))
+	case reflect.String:
+		canonical = reflect.TypeOf([]string(nil))
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		lists := make([]*List, rv.Len())
+		for i := range lists {
+			elem := rv.Index(i)
+			if l, ok := elem.Interface().(*List); ok && l != nil {
+				lists[i] = l
+				continue
+			}
+			for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Interface {
+				if elem.IsNil() {
+					return nil, fmt.Errorf("nil element %d", i)
+				}
+				elem = elem.Elem()
+			}
+			l, err := listFromValue(elem, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			lists[i] = l
+		}
+		return lists, nil
+	default:
+		return nil, fmt.Errorf("unsupported element type %s", elemType)
+	}
+
+	out := reflect.MakeSlice(canonical, rv.Len(), rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i)
+		if elem.Kind() == reflect.Pointer {
+			if elem.IsNil() {
+				return nil, fmt.Errorf("nil element %d", i)
+			}
+			elem = elem.Elem()
+		}
+		out.Index(i).Set(elem.Convert(canonical.Elem()))
+	}
+	return out.Interface(), nil
+}
+
+// fieldInfo describes how a struct field maps to a pair
+type fieldInfo struct {
+	name      string
+	goName    string
+	index     []int
+	omitEmpty bool
+	flag      bool
+}
+
+// structFields lists the exported fields of a struct type
+func structFields(t reflect.Type) []fieldInfo {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag := sf.Tag.Get("nvlist")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+
+		field := fieldInfo{name: name, goName: sf.Name, index: sf.Index}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "omitempty":
+				field.omitEmpty = true
+			case "flag":
+				field.flag = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func decodeStruct(l *List, rv reflect.Value) error {
+	for _, field := range structFields(rv.Type()) {
+		p, ok := l.Lookup(field.name)
+		if !ok {
+			continue
+		}
+		if err := setField(rv.FieldByIndex(field.index), p); err != nil {
+			return fmt.Errorf("field %s: %w", field.goName, err)
+		}
+	}
+	return nil
+}
+
+// setField stores a pair value in a struct field or slice element
+func setField(fv reflect.Value, p Pair) error {
+	switch fv.Interface().(type) {
+	case *List, []*List:
+		value := reflect.ValueOf(p.Value)
+		if !value.Type().AssignableTo(fv.Type()) {
+			return mismatch(p, fv.Type())
+		}
+		fv.Set(value)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), p); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	case reflect.Interface:
+		value := reflect.ValueOf(mapValue(p))
+		if !value.Type().AssignableTo(fv.Type()) {
+			return mismatch(p, fv.Type())
+		}
+		fv.Set(value)
+		return nil
+	case reflect.Bool:
+		b, ok := p.Value.(bool)
+		if !ok || p.Type == TypeBooleanArray {
+			return mismatch(p, fv.Type())
+		}
+		fv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := signedValue(p)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(i) {
+			return fmt.Errorf("value %d of pair %q overflows %s", i, p.Name, fv.Type())
+		}
+		fv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := unsignedValue(p)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(u) {
+			return fmt.Errorf("value %d of pair %q overflows %s", u, p.Name, fv.Type())
+		}
+		fv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := p.Value.(float64)
+		if !ok {
+			return mismatch(p, fv.Type())
+		}
+		fv.SetFloat(f)
+		return nil
+	case reflect.String:
+		s, ok := p.Value.(string)
+		if !ok {
+			return mismatch(p, fv.Type())
+		}
+		fv.SetString(s)
+		return nil
+	case reflect.Struct:
+		child, ok := p.Value.(*List)
+		if !ok {
+			return mismatch(p, fv.Type())
+		}
+		return decodeStruct(child, fv)
+	case reflect.Map:
+		child, ok := p.Value.(*List)
+		if !ok || fv.Type() != reflect.TypeOf(map[string]any(nil)) {
+			return mismatch(p, fv.Type())
+		}
+		fv.Set(reflect.ValueOf(child.Map()))
+		return nil
+	case reflect.Slice:
+		return setSlice(fv, p)
+	}
+	return mismatch(p, fv.Type())
+}
+
+// setSlice stores an array pair element by element
+func setSlice(fv reflect.Value, p Pair) error {
+	if !p.Type.IsArray() {
+		return mismatch(p, fv.Type())
+	}
+
+	src := reflect.ValueOf(p.Value)
+	out := reflect.MakeSlice(fv.Type(), src.Len(), src.Len())
+	for i := 0; i < src.Len(); i++ {
+		elem := Pair{Name: p.Name, Type: elementType(p.Type), Value: src.Index(i).Interface()}
+		if err := setField(out.Index(i), elem); err != nil {
+			return err
+		}
+	}
+	fv.Set(out)
+	return nil
+}
+
+// elementType returns the scalar type of the elements of an array type
+func elementType(t DataType) DataType {
+	switch t {
+	case TypeByteArray:
+		return TypeByte
+	case TypeInt16Array:
+		return TypeInt16
+	case TypeUint16Array:
+		return TypeUint16
+	case TypeInt32Array:
+		return TypeInt32
+	case TypeUint32Array:
+		return TypeUint32
+	case TypeInt64Array:
+		return TypeInt64
+	case TypeUint64Array:
+		return TypeUint64
+	case TypeStringArray:
+		return TypeString
+	case TypeNvlistArray:
+		return TypeNvlist
+	case TypeBooleanArray:
+		return TypeBooleanValue
+	case TypeInt8Array:
+		return TypeInt8
+	case TypeUint8Array:
+		return TypeUint8
+	}
+	return t
+}
+
+// mapValue returns the value stored for a pair by Map
+func mapValue(p Pair) any {
+	switch v := p.Value.(type) {
+	case *List:
+		return v.Map()
+	case []*List:
+		children := make([]map[string]any, len(v))
+		for i, child := range v {
+			children[i] = child.Map()
+		}
+		return children
+	}
+	return p.Value
+}
+
+func signedValue(p Pair) (int64, error) {
+	switch v := p.Value.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint8, uint16, uint32, uint64:
+		u, _ := unsignedValue(p)
+		if u > 1<<63-1 {
+			return 0, fmt.Errorf("value %d of pair %q overflows int64", u, p.Name)
+		}
+		return int64(u), nil
+	}
+	return 0, mismatch(p, reflect.TypeOf(int64(0)))
+}
+
+func unsignedValue(p Pair) (uint64, error) {
+	switch v := p.Value.(type) {
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case int8, int16, int32, int64:
+		i, _ := signedValue(p)
+		if i < 0 {
+			return 0, fmt.Errorf("negative value %d of pair %q", i, p.Name)
+		}
+		return uint64(i), nil
+	}
+	return 0, mismatch(p, reflect.TypeOf(uint64(0)))
+}
+
+func mismatch(p Pair, t reflect.Type) error {
+	return fmt.Errorf("cannot store %v pair %q in %s", p.Type, p.Name, t)
+}
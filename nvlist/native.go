@@ -0,0 +1,399 @@
+package nvlist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Native encoding (nvs_native_*). Each pair is a copy of the in-memory
+// nvpair_t with its name and value, padded to eight bytes, and pointers
+// zeroed. A list is encoded as its version and flags, followed by each pair
+// and a four byte zero terminator. Embedded lists are encoded in full right
+// after the pair that holds them.
+
+// nativeEncoder appends native items to a buffer
+type nativeEncoder struct {
+	buf   []byte
+	order binary.AppendByteOrder
+}
+
+func packNative(l *List, order binary.AppendByteOrder, endian byte) []byte {
+	e := &nativeEncoder{order: order, buf: make([]byte, 0, headerSize+nativeListSize(l))}
+	e.buf = append(e.buf, byte(EncodingNative), endian, 0, 0)
+	e.list(l)
+	return e.buf
+}
+
+// nativeListSize returns the packed size of a list (nvs_native_nvlist)
+func nativeListSize(l *List) int {
+	size := 4 + 4 + 4
+	for _, p := range l.Pairs {
+		size += nativePairSize(p)
+		switch v := p.Value.(type) {
+		case *List:
+			size += nativeListSize(v)
+		case []*List:
+			for _, child := range v {
+				size += nativeListSize(child)
+			}
+		}
+	}
+	return size
+}
+
+func (e *nativeEncoder) uint16(v uint16) {
+	e.buf = e.order.AppendUint16(e.buf, v)
+}
+
+func (e *nativeEncoder) uint32(v uint32) {
+	e.buf = e.order.AppendUint32(e.buf, v)
+}
+
+func (e *nativeEncoder) uint64(v uint64) {
+	e.buf = e.order.AppendUint64(e.buf, v)
+}
+
+func (e *nativeEncoder) pad(to int) {
+	for len(e.buf) < to {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// header appends an embedded nvlist_t with its pointers cleared
+func (e *nativeEncoder) header(l *List) {
+	e.uint32(uint32(l.Version))
+	e.uint32(l.Flags)
+	e.uint64(0) // nvl_priv
+	e.uint32(0) // nvl_flag
+	e.uint32(0) // nvl_pad
+}
+
+func (e *nativeEncoder) list(l *List) {
+	e.uint32(uint32(l.Version))
+	e.uint32(l.Flags)
+	for _, p := range l.Pairs {
+		e.pair(p)
+	}
+	e.uint32(0)
+}
+
+func (e *nativeEncoder) pair(p Pair) {
+	start := len(e.buf)
+	size := nativePairSize(p)
+
+	e.uint32(uint32(size))
+	e.uint16(uint16(len(p.Name) + 1))
+	e.uint16(0)
+	e.uint32(uint32(nelem(p)))
+	e.uint32(uint32(p.Type))
+	e.buf = append(e.buf, p.Name...)
+	e.buf = append(e.buf, 0)
+	e.pad(start + align8(nvpairHeaderSize+len(p.Name)+1))
+
+	switch v := p.Value.(type) {
+	case bool:
+		if p.Type == TypeBooleanValue {
+			e.uint32(boolWord(v))
+		}
+	case uint8:
+		e.buf = append(e.buf, v)
+	case int8:
+		e.buf = append(e.buf, byte(v))
+	case int16:
+		e.uint16(uint16(v))
+	case uint16:
+		e.uint16(v)
+	case int32:
+		e.uint32(uint32(v))
+	case uint32:
+		e.uint32(v)
+	case int64:
+		e.uint64(uint64(v))
+	case uint64:
+		e.uint64(v)
+	case float64:
+		e.uint64(math.Float64bits(v))
+	case string:
+		e.buf = append(e.buf, v...)
+		e.buf = append(e.buf, 0)
+	case []uint8:
+		e.buf = append(e.buf, v...)
+	case []int8:
+		for _, x := range v {
+			e.buf = append(e.buf, byte(x))
+		}
+	case []int16:
+		for _, x := range v {
+			e.uint16(uint16(x))
+		}
+	case []uint16:
+		for _, x := range v {
+			e.uint16(x)
+		}
+	case []bool:
+		for _, x := range v {
+			e.uint32(boolWord(x))
+		}
+	case []int32:
+		for _, x := range v {
+			e.uint32(uint32(x))
+		}
+	case []uint32:
+		for _, x := range v {
+			e.uint32(x)
+		}
+	case []int64:
+		for _, x := range v {
+			e.uint64(uint64(x))
+		}
+	case []uint64:
+		for _, x := range v {
+			e.uint64(x)
+		}
+	case []string:
+		e.pad(len(e.buf) + pointerSize*len(v))
+		for _, s := range v {
+			e.buf = append(e.buf, s...)
+			e.buf = append(e.buf, 0)
+		}
+	case *List:
+		e.header(v)
+	case []*List:
+		e.pad(len(e.buf) + pointerSize*len(v))
+		for _, child := range v {
+			e.header(child)
+		}
+	}
+	e.pad(start + size)
+
+	switch v := p.Value.(type) {
+	case *List:
+		e.list(v)
+	case []*List:
+		for _, child := range v {
+			e.list(child)
+		}
+	}
+}
+
+// nativeDecoder reads native pairs from packed data
+type nativeDecoder struct {
+	reader
+}
+
+func unpackNative(data []byte) (*List, error) {
+	d := &nativeDecoder{reader{data: data, off: headerSize}}
+	switch data[1] {
+	case littleEndian:
+		d.order = binary.LittleEndian
+	case bigEndian:
+		d.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("nvlist: native: invalid endianness %d", data[1])
+	}
+
+	l, err := d.list(0)
+	if err != nil {
+		return nil, fmt.Errorf("nvlist: native: %w", err)
+	}
+	return l, nil
+}
+
+func (d *nativeDecoder) list(depth int) (*List, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxDepth)
+	}
+
+	version, err := d.int32()
+	if err != nil {
+		return nil, err
+	}
+	flags, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	l := &List{Version: version, Flags: flags}
+
+	for {
+		size, err := d.int32()
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return l, nil
+		}
+		if size < nvpairHeaderSize || int(size)-4 > d.remaining() {
+			return nil, fmt.Errorf("invalid pair size %d at offset %d", size, d.off-4)
+		}
+
+		// Rewind so the pair buffer starts at nvp_size
+		d.off -= 4
+		buf, _ := d.bytes(int(size))
+
+		p, err := d.pair(buf, depth)
+		if err != nil {
+			return nil, err
+		}
+		l.Pairs = append(l.Pairs, p)
+	}
+}
+
+func (d *nativeDecoder) pair(buf []byte, depth int) (Pair, error) {
+	var p Pair
+
+	nameSize := int(d.order.Uint16(buf[4:]))
+	count := int32(d.order.Uint32(buf[8:]))
+	p.Type = DataType(d.order.Uint32(buf[12:]))
+
+	valueOffset := align8(nvpairHeaderSize + nameSize)
+	if nameSize < 1 || valueOffset > len(buf) || buf[nvpairHeaderSize+nameSize-1] != 0 {
+		return p, fmt.Errorf("invalid pair name at offset %d", d.off-len(buf))
+	}
+	p.Name = string(buf[nvpairHeaderSize : nvpairHeaderSize+nameSize-1])
+
+	if err := checkNelem(p.Type, count); err != nil {
+		return p, fmt.Errorf("pair %q: %w", p.Name, err)
+	}
+	n := int(count)
+
+	value := buf[valueOffset:]
+	fixed := valueSize(Pair{Type: p.Type, Value: placeholder(p.Type, n)})
+	if fixed > len(value) {
+		return p, fmt.Errorf("pair %q: %w: value needs %d bytes, have %d", p.Name, ErrTruncated, fixed, len(value))
+	}
+
+	var err error
+	p.Value, err = d.value(p.Type, n, value, depth)
+	if err != nil {
+		return p, fmt.Errorf("pair %q: %w", p.Name, err)
+	}
+	return p, nil
+}
+
+// placeholder returns a zero value with n elements so valueSize can compute
+// the fixed part of a value before it is decoded. Strings count as empty.
+func placeholder(typ DataType, n int) any {
+	switch typ {
+	case TypeString:
+		return ""
+	case TypeStringArray:
+		return make([]string, n)
+	case TypeNvlistArray:
+		return make([]*List, n)
+	case TypeByteArray, TypeUint8Array, TypeInt8Array:
+		return make([]uint8, n)
+	case TypeInt16Array, TypeUint16Array:
+		return make([]uint16, n)
+	case TypeBooleanArray, TypeInt32Array, TypeUint32Array:
+		return make([]uint32, n)
+	case TypeInt64Array, TypeUint64Array:
+		return make([]uint64, n)
+	}
+	return nil
+}
+
+// cstring reads a NUL terminated string from the start of b
+func cstring(b []byte) (string, int, error) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return "", 0, fmt.Errorf("unterminated string")
+	}
+	return string(b[:end]), end + 1, nil
+}
+
+func (d *nativeDecoder) value(typ DataType, n int, b []byte, depth int) (any, error) {
+	order := d.order
+
+	switch typ {
+	case TypeBoolean:
+		return true, nil
+	case TypeBooleanValue:
+		return order.Uint32(b) != 0, nil
+	case TypeByte, TypeUint8:
+		return b[0], nil
+	case TypeInt8:
+		return int8(b[0]), nil
+	case TypeInt16:
+		return int16(order.Uint16(b)), nil
+	case TypeUint16:
+		return order.Uint16(b), nil
+	case TypeInt32:
+		return int32(order.Uint32(b)), nil
+	case TypeUint32:
+		return order.Uint32(b), nil
+	case TypeInt64, TypeHrtime:
+		return int64(order.Uint64(b)), nil
+	case TypeUint64:
+		return order.Uint64(b), nil
+	case TypeDouble:
+		return math.Float64frombits(order.Uint64(b)), nil
+	case TypeString:
+		s, _, err := cstring(b)
+		return s, err
+	case TypeByteArray, TypeUint8Array:
+		return append([]uint8{}, b[:n]...), nil
+	case TypeInt8Array:
+		v := make([]int8, n)
+		for i := range v {
+			v[i] = int8(b[i])
+		}
+		return v, nil
+	case TypeInt16Array:
+		v := make([]int16, n)
+		for i := range v {
+			v[i] = int16(order.Uint16(b[2*i:]))
+		}
+		return v, nil
+	case TypeUint16Array:
+		v := make([]uint16, n)
+		for i := range v {
+			v[i] = order.Uint16(b[2*i:])
+		}
+		return v, nil
+	case TypeBooleanArray, TypeInt32Array, TypeUint32Array:
+		words := make([]uint32, n)
+		for i := range words {
+			words[i] = order.Uint32(b[4*i:])
+		}
+		return convertWords(typ, words), nil
+	case TypeInt64Array:
+		v := make([]int64, n)
+		for i := range v {
+			v[i] = int64(order.Uint64(b[8*i:]))
+		}
+		return v, nil
+	case TypeUint64Array:
+		v := make([]uint64, n)
+		for i := range v {
+			v[i] = order.Uint64(b[8*i:])
+		}
+		return v, nil
+	case TypeStringArray:
+		v := make([]string, n)
+		rest := b[pointerSize*n:]
+		for i := range v {
+			s, used, err := cstring(rest)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = s
+			rest = rest[used:]
+		}
+		return v, nil
+	case TypeNvlist:
+		return d.list(depth + 1)
+	case TypeNvlistArray:
+		v := make([]*List, n)
+		for i := range v {
+			child, err := d.list(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = child
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported data type %v", typ)
+}
@@ -0,0 +1,571 @@
+// Package nvlist encodes and decodes packed name-value pair lists, the
+// serialization format libnvpair uses for pool configurations, property
+// sets, vdev labels and ioctl arguments.
+//
+// Both packed encodings produced by nvlist_pack(3) are supported: the
+// native encoding, which mirrors the in-memory nvpair layout of the host
+// that produced it, and the portable XDR encoding used for on-disk labels.
+// Lists can be built and inspected directly through List and Pair, or
+// converted to and from Go maps and tagged structs with Marshal and
+// Unmarshal.
+package nvlist
+
+import (
+	"fmt"
+)
+
+// DataType identifies the type of an nvpair value (data_type_t)
+type DataType int32
+
+// nvpair data types, numbered as in sys/nvpair.h
+const (
+	TypeUnknown      DataType = 0
+	TypeBoolean      DataType = 1
+	TypeByte         DataType = 2
+	TypeInt16        DataType = 3
+	TypeUint16       DataType = 4
+	TypeInt32        DataType = 5
+	TypeUint32       DataType = 6
+	TypeInt64        DataType = 7
+	TypeUint64       DataType = 8
+	TypeString       DataType = 9
+	TypeByteArray    DataType = 10
+	TypeInt16Array   DataType = 11
+	TypeUint16Array  DataType = 12
+	TypeInt32Array   DataType = 13
+	TypeUint32Array  DataType = 14
+	TypeInt64Array   DataType = 15
+	TypeUint64Array  DataType = 16
+	TypeStringArray  DataType = 17
+	TypeHrtime       DataType = 18
+	TypeNvlist       DataType = 19
+	TypeNvlistArray  DataType = 20
+	TypeBooleanValue DataType = 21
+	TypeInt8         DataType = 22
+	TypeUint8        DataType = 23
+	TypeBooleanArray DataType = 24
+	TypeInt8Array    DataType = 25
+	TypeUint8Array   DataType = 26
+	TypeDouble       DataType = 27
+)
+
+var typeNames = map[DataType]string{
+	TypeUnknown:      "unknown",
+	TypeBoolean:      "boolean",
+	TypeByte:         "byte",
+	TypeInt16:        "int16",
+	TypeUint16:       "uint16",
+	TypeInt32:        "int32",
+	TypeUint32:       "uint32",
+	TypeInt64:        "int64",
+	TypeUint64:       "uint64",
+	TypeString:       "string",
+	TypeByteArray:    "byte_array",
+	TypeInt16Array:   "int16_array",
+	TypeUint16Array:  "uint16_array",
+	TypeInt32Array:   "int32_array",
+	TypeUint32Array:  "uint32_array",
+	TypeInt64Array:   "int64_array",
+	TypeUint64Array:  "uint64_array",
+	TypeStringArray:  "string_array",
+	TypeHrtime:       "hrtime",
+	TypeNvlist:       "nvlist",
+	TypeNvlistArray:  "nvlist_array",
+	TypeBooleanValue: "boolean_value",
+	TypeInt8:         "int8",
+	TypeUint8:        "uint8",
+	TypeBooleanArray: "boolean_array",
+	TypeInt8Array:    "int8_array",
+	TypeUint8Array:   "uint8_array",
+	TypeDouble:       "double",
+}
+
+// LookupString returns the name of the data type
+func (t DataType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("DataType(%d)", int32(t))
+}
+
+// IsArray reports whether values of this type hold multiple elements
+func (t DataType) IsArray() bool {
+	switch t {
+	case TypeByteArray, TypeInt16Array, TypeUint16Array, TypeInt32Array, TypeUint32Array,
+		TypeInt64Array, TypeUint64Array, TypeStringArray, TypeNvlistArray,
+		TypeBooleanArray, TypeInt8Array, TypeUint8Array:
+		return true
+	}
+	return false
+}
+
+// Encoding selects the packed representation of a list
+type Encoding uint8
+
+const (
+	EncodingNative Encoding = 0 // host layout, as used by ioctl arguments
+	EncodingXDR    Encoding = 1 // portable big-endian layout, as used by labels
+)
+
+// LookupString returns the name of the encoding
+func (e Encoding) String() string {
+	switch e {
+	case EncodingNative:
+		return "native"
+	case EncodingXDR:
+		return "xdr"
+	default:
+		return fmt.Sprintf("Encoding(%d)", uint8(e))
+	}
+}
+
+// List flags and version (nvl_nvflag, nvl_version)
+const (
+	Version        int32  = 0
+	UniqueName     uint32 = 0x1 // pair names are unique
+	UniqueNameType uint32 = 0x2 // pair name and type combinations are unique
+)
+
+// maxDepth mirrors nvpair_max_recursion in libnvpair
+const maxDepth = 20
+
+// Pair is a single named value. Value holds the Go representation of Type:
+//
+//	TypeBoolean                       bool (always true, the pair is a flag)
+//	TypeBooleanValue                  bool
+//	TypeByte, TypeUint8               uint8
+//	TypeInt8                          int8
+//	TypeInt16, TypeUint16             int16, uint16
+//	TypeInt32, TypeUint32             int32, uint32
+//	TypeInt64, TypeHrtime             int64
+//	TypeUint64                        uint64
+//	TypeDouble                        float64
+//	TypeString                        string
+//	TypeByteArray, TypeUint8Array     []uint8
+//	TypeInt8Array                     []int8
+//	TypeInt16Array, TypeUint16Array   []int16, []uint16
+//	TypeInt32Array, TypeUint32Array   []int32, []uint32
+//	TypeInt64Array, TypeUint64Array   []int64, []uint64
+//	TypeBooleanArray                  []bool
+//	TypeStringArray                   []string
+//	TypeNvlist                        *List
+//	TypeNvlistArray                   []*List
+type Pair struct {
+	Name  string
+	Type  DataType
+	Value any
+}
+
+// List is an ordered name-value pair list (nvlist_t)
+type List struct {
+	Version int32
+	Flags   uint32
+	Pairs   []Pair
+}
+
+// New returns an empty list with unique names, like nvlist_alloc(NV_UNIQUE_NAME)
+func New() *List {
+	return &List{Version: Version, Flags: UniqueName}
+}
+
+// Len returns the number of pairs in the list
+func (l *List) Len() int {
+	return len(l.Pairs)
+}
+
+// Lookup returns the first pair with the given name
+func (l *List) Lookup(name string) (Pair, bool) {
+	for _, p := range l.Pairs {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Pair{}, false
+}
+
+// Add appends a value, inferring its data type from the Go type. See Pair
+// for the accepted types; int and uint map to TypeInt64 and TypeUint64,
+// map[string]any and tagged structs are converted to nested lists.
+func (l *List) Add(name string, value any) error {
+	p, err := inferPair(name, value)
+	if err != nil {
+		return err
+	}
+	l.add(p)
+	return nil
+}
+
+// AddTyped appends a value with an explicit data type
+func (l *List) AddTyped(name string, typ DataType, value any) error {
+	if err := checkValue(typ, value); err != nil {
+		return fmt.Errorf("nvlist: pair %q: %w", name, err)
+	}
+	l.add(Pair{Name: name, Type: typ, Value: value})
+	return nil
+}
+
+// add appends a pair, replacing existing ones as required by the list flags
+func (l *List) add(p Pair) {
+	if l.Flags&(UniqueName|UniqueNameType) != 0 {
+		for i, existing := range l.Pairs {
+			if existing.Name != p.Name {
+				continue
+			}
+			if l.Flags&UniqueName != 0 || existing.Type == p.Type {
+				l.Pairs = append(l.Pairs[:i], l.Pairs[i+1:]...)
+				break
+			}
+		}
+	}
+	l.Pairs = append(l.Pairs, p)
+}
+
+// Remove deletes all pairs with the given name and reports whether any existed
+func (l *List) Remove(name string) bool {
+	kept := l.Pairs[:0]
+	for _, p := range l.Pairs {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	removed := len(kept) != len(l.Pairs)
+	l.Pairs = kept
+	return removed
+}
+
+// Exists reports whether a pair with the given name is present
+func (l *List) Exists(name string) bool {
+	_, ok := l.Lookup(name)
+	return ok
+}
+
+// LookupString returns the value of a string pair
+func (l *List) LookupString(name string) (string, bool) {
+	p, ok := l.Lookup(name)
+	if !ok || p.Type != TypeString {
+		return "", false
+	}
+	return p.Value.(string), true
+}
+
+// LookupUint64 returns the value of an unsigned integer pair of any width
+func (l *List) LookupUint64(name string) (uint64, bool) {
+	p, ok := l.Lookup(name)
+	if !ok {
+		return 0, false
+	}
+	switch v := p.Value.(type) {
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	}
+	return 0, false
+}
+
+// LookupInt64 returns the value of a signed integer pair of any width
+func (l *List) LookupInt64(name string) (int64, bool) {
+	p, ok := l.Lookup(name)
+	if !ok {
+		return 0, false
+	}
+	switch v := p.Value.(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// LookupBool returns the value of a boolean_value pair, or true for a boolean flag
+func (l *List) LookupBool(name string) (bool, bool) {
+	p, ok := l.Lookup(name)
+	if !ok || (p.Type != TypeBoolean && p.Type != TypeBooleanValue) {
+		return false, false
+	}
+	return p.Value.(bool), true
+}
+
+// LookupUint64Array returns the value of a uint64 array pair
+func (l *List) LookupUint64Array(name string) ([]uint64, bool) {
+	p, ok := l.Lookup(name)
+	if !ok || p.Type != TypeUint64Array {
+		return nil, false
+	}
+	return p.Value.([]uint64), true
+}
+
+// LookupStringArray returns the value of a string array pair
+func (l *List) LookupStringArray(name string) ([]string, bool) {
+	p, ok := l.Lookup(name)
+	if !ok || p.Type != TypeStringArray {
+		return nil, false
+	}
+	return p.Value.([]string), true
+}
+
+// LookupList returns a nested list
+func (l *List) LookupList(name string) (*List, bool) {
+	p, ok := l.Lookup(name)
+	if !ok || p.Type != TypeNvlist {
+		return nil, false
+	}
+	return p.Value.(*List), true
+}
+
+// LookupListArray returns a nested list array
+func (l *List) LookupListArray(name string) ([]*List, bool) {
+	p, ok := l.Lookup(name)
+	if !ok || p.Type != TypeNvlistArray {
+		return nil, false
+	}
+	return p.Value.([]*List), true
+}
+
+// Pack encodes the list with the given encoding, like nvlist_pack(3).
+// Native output uses the byte order of the running host.
+func (l *List) Pack(enc Encoding) ([]byte, error) {
+	if err := l.validate(0); err != nil {
+		return nil, err
+	}
+
+	switch enc {
+	case EncodingNative:
+		return packNative(l, hostOrder, hostEndian), nil
+	case EncodingXDR:
+		return packXDR(l), nil
+	default:
+		return nil, fmt.Errorf("nvlist: unsupported encoding %v", enc)
+	}
+}
+
+// Unpack decodes a packed list in either encoding, like nvlist_unpack(3)
+func Unpack(data []byte) (*List, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("nvlist: %w: missing header", ErrTruncated)
+	}
+
+	switch Encoding(data[0]) {
+	case EncodingNative:
+		return unpackNative(data)
+	case EncodingXDR:
+		return unpackXDR(data)
+	default:
+		return nil, fmt.Errorf("nvlist: unsupported encoding %d", data[0])
+	}
+}
+
+// validate checks that every pair holds a value matching its type
+func (l *List) validate(depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("nvlist: nesting exceeds %d levels", maxDepth)
+	}
+	for _, p := range l.Pairs {
+		if err := checkValue(p.Type, p.Value); err != nil {
+			return fmt.Errorf("nvlist: pair %q: %w", p.Name, err)
+		}
+		switch v := p.Value.(type) {
+		case *List:
+			if err := v.validate(depth + 1); err != nil {
+				return err
+			}
+		case []*List:
+			for _, child := range v {
+				if err := child.validate(depth + 1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkValue verifies that the Go type of value is the one used for typ
+func checkValue(typ DataType, value any) error {
+	ok := false
+	switch typ {
+	case TypeBoolean:
+		v, isBool := value.(bool)
+		ok = isBool && v
+	case TypeBooleanValue:
+		_, ok = value.(bool)
+	case TypeByte, TypeUint8:
+		_, ok = value.(uint8)
+	case TypeInt8:
+		_, ok = value.(int8)
+	case TypeInt16:
+		_, ok = value.(int16)
+	case TypeUint16:
+		_, ok = value.(uint16)
+	case TypeInt32:
+		_, ok = value.(int32)
+	case TypeUint32:
+		_, ok = value.(uint32)
+	case TypeInt64, TypeHrtime:
+		_, ok = value.(int64)
+	case TypeUint64:
+		_, ok = value.(uint64)
+	case TypeDouble:
+		_, ok = value.(float64)
+	case TypeString:
+		_, ok = value.(string)
+	case TypeByteArray, TypeUint8Array:
+		_, ok = value.([]uint8)
+	case TypeInt8Array:
+		_, ok = value.([]int8)
+	case TypeInt16Array:
+		_, ok = value.([]int16)
+	case TypeUint16Array:
+		_, ok = value.([]uint16)
+	case TypeInt32Array:
+		_, ok = value.([]int32)
+	case TypeUint32Array:
+		_, ok = value.([]uint32)
+	case TypeInt64Array:
+		_, ok = value.([]int64)
+	case TypeUint64Array:
+		_, ok = value.([]uint64)
+	case TypeBooleanArray:
+		_, ok = value.([]bool)
+	case TypeStringArray:
+		_, ok = value.([]string)
+	case TypeNvlist:
+		v, isList := value.(*List)
+		ok = isList && v != nil
+	case TypeNvlistArray:
+		v, isArray := value.([]*List)
+		ok = isArray
+		for _, child := range v {
+			ok = ok && child != nil
+		}
+	default:
+		return fmt.Errorf("unsupported data type %v", typ)
+	}
+
+	if !ok {
+		return fmt.Errorf("value %T does not match data type %v", value, typ)
+	}
+	return nil
+}
+
+// nelem returns the element count stored in the nvpair header
+func nelem(p Pair) int {
+	switch v := p.Value.(type) {
+	case []uint8:
+		return len(v)
+	case []int8:
+		return len(v)
+	case []int16:
+		return len(v)
+	case []uint16:
+		return len(v)
+	case []int32:
+		return len(v)
+	case []uint32:
+		return len(v)
+	case []int64:
+		return len(v)
+	case []uint64:
+		return len(v)
+	case []bool:
+		return len(v)
+	case []string:
+		return len(v)
+	case []*List:
+		return len(v)
+	}
+	if p.Type == TypeBoolean {
+		return 0
+	}
+	return 1
+}
+
+// inferPair picks the data type used for a Go value
+func inferPair(name string, value any) (Pair, error) {
+	p := Pair{Name: name, Value: value}
+
+	switch v := value.(type) {
+	case bool:
+		p.Type = TypeBooleanValue
+	case uint8:
+		p.Type = TypeUint8
+	case int8:
+		p.Type = TypeInt8
+	case int16:
+		p.Type = TypeInt16
+	case uint16:
+		p.Type = TypeUint16
+	case int32:
+		p.Type = TypeInt32
+	case uint32:
+		p.Type = TypeUint32
+	case int64:
+		p.Type = TypeInt64
+	case uint64:
+		p.Type = TypeUint64
+	case int:
+		p.Type, p.Value = TypeInt64, int64(v)
+	case uint:
+		p.Type, p.Value = TypeUint64, uint64(v)
+	case float32:
+		p.Type, p.Value = TypeDouble, float64(v)
+	case float64:
+		p.Type = TypeDouble
+	case string:
+		p.Type = TypeString
+	case []uint8:
+		p.Type = TypeUint8Array
+	case []int8:
+		p.Type = TypeInt8Array
+	case []int16:
+		p.Type = TypeInt16Array
+	case []uint16:
+		p.Type = TypeUint16Array
+	case []int32:
+		p.Type = TypeInt32Array
+	case []uint32:
+		p.Type = TypeUint32Array
+	case []int64:
+		p.Type = TypeInt64Array
+	case []uint64:
+		p.Type = TypeUint64Array
+	case []bool:
+		p.Type = TypeBooleanArray
+	case []string:
+		p.Type = TypeStringArray
+	case *List:
+		if v == nil {
+			return p, fmt.Errorf("nvlist: pair %q: nil list", name)
+		}
+		p.Type = TypeNvlist
+	case []*List:
+		p.Type = TypeNvlistArray
+	case Pair:
+		v.Name = name
+		return v, checkValue(v.Type, v.Value)
+	default:
+		child, children, err := listsFromValue(value)
+		if err != nil {
+			return p, fmt.Errorf("nvlist: pair %q: %w", name, err)
+		}
+		if children != nil {
+			p.Type, p.Value = TypeNvlistArray, children
+		} else {
+			p.Type, p.Value = TypeNvlist, child
+		}
+	}
+
+	if err := checkValue(p.Type, p.Value); err != nil {
+		return p, fmt.Errorf("nvlist: pair %q: %w", name, err)
+	}
+	return p, nil
+}
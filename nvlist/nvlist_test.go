@@ -0,0 +1,543 @@
+package nvlist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixture decodes a hex dump, ignoring whitespace and // comments
+func fixture(t *testing.T, dump string) []byte {
+	t.Helper()
+
+	var clean strings.Builder
+	for _, line := range strings.Split(dump, "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		clean.WriteString(strings.Join(strings.Fields(line), ""))
+	}
+	b, err := hex.DecodeString(clean.String())
+	if err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+	return b
+}
+
+// fixtureList is the list encoded by xdrFixture and nativeFixture:
+//
+//	name = "tank"
+//	guid = 0x1122334455667788
+//	vdev = { type = "disk" }
+func fixtureList() *List {
+	vdev := New()
+	vdev.Pairs = []Pair{{Name: "type", Type: TypeString, Value: "disk"}}
+
+	l := New()
+	l.Pairs = []Pair{
+		{Name: "name", Type: TypeString, Value: "tank"},
+		{Name: "guid", Type: TypeUint64, Value: uint64(0x1122334455667788)},
+		{Name: "vdev", Type: TypeNvlist, Value: vdev},
+	}
+	return l
+}
+
+const xdrFixture = `
+01 01 00 00                                  // xdr, little endian host
+00000000 00000001                            // version, NV_UNIQUE_NAME
+00000020 00000020 00000004 6e616d65          // "name": sizes, name
+00000009 00000001 00000004 74616e6b          // string, 1 elem, "tank"
+00000020 00000020 00000004 67756964          // "guid"
+00000008 00000001 11223344 55667788          // uint64
+00000048 00000030 00000004 76646576          // "vdev"
+00000013 00000001                            // nvlist, 1 elem
+00000000 00000001                            //   version, flags
+00000020 00000020 00000004 74797065          //   "type"
+00000009 00000001 00000004 6469736b          //   string "disk"
+00000000 00000000                            //   end of vdev
+00000000 00000000                            // end of list
+`
+
+const nativeFixture = `
+00 01 00 00                                  // native, little endian
+00000000 01000000                            // version, NV_UNIQUE_NAME
+20000000 0500 0000 01000000 09000000         // nvp_size 32, name_sz 5, 1 elem, string
+6e616d65 00000000 74616e6b 00000000          // "name", "tank"
+20000000 0500 0000 01000000 08000000         // uint64
+67756964 00000000 88776655 44332211          // "guid"
+30000000 0500 0000 01000000 13000000         // nvlist
+76646576 00000000                            // "vdev"
+00000000 01000000 00000000 00000000          // embedded nvlist_t, priv cleared
+00000000 00000000
+00000000 01000000                            //   version, flags
+20000000 0500 0000 01000000 09000000         //   string
+74797065 00000000 6469736b 00000000          //   "type", "disk"
+00000000                                     //   end of vdev
+00000000                                     // end of list
+`
+
+// arrayFixtureList is the list encoded by xdrArrayFixture and
+// nativeArrayFixture, one pair of each array type and an nvlist array
+func arrayFixtureList() *List {
+	child := New()
+	child.Pairs = []Pair{{Name: "n", Type: TypeUint64, Value: uint64(1)}}
+
+	l := New()
+	l.Pairs = []Pair{
+		{Name: "b", Type: TypeByteArray, Value: []uint8{0x01, 0x02, 0xff}},
+		{Name: "i8", Type: TypeInt8Array, Value: []int8{-1, 2}},
+		{Name: "u8", Type: TypeUint8Array, Value: []uint8{1, 0x7f}},
+		{Name: "i16", Type: TypeInt16Array, Value: []int16{-2, 3}},
+		{Name: "u16", Type: TypeUint16Array, Value: []uint16{0xffff}},
+		{Name: "i32", Type: TypeInt32Array, Value: []int32{-3}},
+		{Name: "u32", Type: TypeUint32Array, Value: []uint32{0xdeadbeef}},
+		{Name: "i64", Type: TypeInt64Array, Value: []int64{-4}},
+		{Name: "u64", Type: TypeUint64Array, Value: []uint64{0x0102030405060708, 9}},
+		{Name: "bools", Type: TypeBooleanArray, Value: []bool{true, false}},
+		{Name: "strs", Type: TypeStringArray, Value: []string{"a", "", "bcd"}},
+		{Name: "kids", Type: TypeNvlistArray, Value: []*List{child, New()}},
+	}
+	return l
+}
+
+// The array fixtures are assembled by hand from the nvpair.c rules rather
+// than from this package. In XDR, byte arrays are xdr_opaque with no count,
+// every other numeric array is xdr_array with one word or hyper per element,
+// and string arrays are a run of xdr_strings. Values above 0x7f are kept out
+// of the uint8 array, xdr_char sign extends them where char is signed.
+const xdrArrayFixture = `
+01 01 00 00                                  // xdr, little endian host
+00000000 00000001                            // version, NV_UNIQUE_NAME
+0000001c 00000020 00000001 62000000          // "b"
+0000000a 00000003 0102ff00                   // byte array, opaque
+00000024 00000020 00000002 69380000          // "i8"
+00000019 00000002 00000002 ffffffff 00000002 // int8 array, count, chars
+00000024 00000020 00000002 75380000          // "u8"
+0000001a 00000002 00000002 00000001 0000007f // uint8 array
+00000024 00000020 00000003 69313600          // "i16"
+0000000b 00000002 00000002 fffffffe 00000003 // int16 array
+00000020 00000020 00000003 75313600          // "u16"
+0000000c 00000001 00000001 0000ffff          // uint16 array
+00000020 00000020 00000003 69333200          // "i32"
+0000000d 00000001 00000001 fffffffd          // int32 array
+00000020 00000020 00000003 75333200          // "u32"
+0000000e 00000001 00000001 deadbeef          // uint32 array
+00000024 00000020 00000003 69363400          // "i64"
+0000000f 00000001 00000001 ffffffff fffffffc // int64 array
+0000002c 00000028 00000003 75363400          // "u64"
+00000010 00000002 00000002                   // uint64 array
+01020304 05060708 00000000 00000009
+00000028 00000020 00000005 626f6f6c 73000000 // "bools"
+00000018 00000002 00000002 00000001 00000000 // boolean array
+0000002c 00000038 00000004 73747273          // "strs"
+00000011 00000003                            // string array, 3 elem
+00000001 61000000 00000000 00000003 62636400 // "a", "", "bcd"
+00000058 00000058 00000004 6b696473          // "kids"
+00000014 00000002                            // nvlist array, 2 elem
+00000000 00000001                            //   version, flags
+00000020 00000020 00000001 6e000000          //   "n"
+00000008 00000001 00000000 00000001          //   uint64
+00000000 00000000                            //   end of kids[0]
+00000000 00000001                            //   version, flags
+00000000 00000000                            //   end of kids[1]
+00000000 00000000                            // end of list
+`
+
+// In native encoding each array is copied as the in-memory nvpair_t holds
+// it. String and nvlist arrays start with one cleared pointer per element.
+const nativeArrayFixture = `
+00 01 00 00                                  // native, little endian
+00000000 01000000                            // version, NV_UNIQUE_NAME
+20000000 0200 0000 03000000 0a000000         // byte array, 3 elem
+62000000 00000000 0102ff00 00000000          // "b"
+20000000 0300 0000 02000000 19000000         // int8 array
+69380000 00000000 ff020000 00000000          // "i8"
+20000000 0300 0000 02000000 1a000000         // uint8 array
+75380000 00000000 017f0000 00000000          // "u8"
+20000000 0400 0000 02000000 0b000000         // int16 array
+69313600 00000000 feff0300 00000000          // "i16"
+20000000 0400 0000 01000000 0c000000         // uint16 array
+75313600 00000000 ffff0000 00000000          // "u16"
+20000000 0400 0000 01000000 0d000000         // int32 array
+69333200 00000000 fdffffff 00000000          // "i32"
+20000000 0400 0000 01000000 0e000000         // uint32 array
+75333200 00000000 efbeadde 00000000          // "u32"
+20000000 0400 0000 01000000 0f000000         // int64 array
+69363400 00000000 fcffffff ffffffff          // "i64"
+28000000 0400 0000 02000000 10000000         // uint64 array
+75363400 00000000 08070605 04030201          // "u64"
+09000000 00000000
+20000000 0600 0000 02000000 18000000         // boolean array
+626f6f6c 73000000 01000000 00000000          // "bools"
+38000000 0500 0000 03000000 11000000         // string array
+73747273 00000000                            // "strs"
+00000000 00000000 00000000 00000000          // cleared pointers
+00000000 00000000
+61000062 63640000                            // "a", "", "bcd"
+58000000 0500 0000 02000000 14000000         // nvlist array
+6b696473 00000000                            // "kids"
+00000000 00000000 00000000 00000000          // cleared pointers
+00000000 01000000 00000000 00000000          // nvlist_t of kids[0]
+00000000 00000000
+00000000 01000000 00000000 00000000          // nvlist_t of kids[1]
+00000000 00000000
+00000000 01000000                            //   version, flags
+20000000 0200 0000 01000000 08000000         //   uint64
+6e000000 00000000 01000000 00000000          //   "n"
+00000000                                     //   end of kids[0]
+00000000 01000000                            //   version, flags
+00000000                                     //   end of kids[1]
+00000000                                     // end of list
+`
+
+// allTypes returns a list holding every supported data type
+func allTypes() *List {
+	child := New()
+	child.Pairs = []Pair{{Name: "leaf", Type: TypeUint64, Value: uint64(7)}}
+	empty := New()
+
+	l := New()
+	l.Pairs = []Pair{
+		{Name: "boolean", Type: TypeBoolean, Value: true},
+		{Name: "boolean_value", Type: TypeBooleanValue, Value: true},
+		{Name: "byte", Type: TypeByte, Value: uint8(0xab)},
+		{Name: "int8", Type: TypeInt8, Value: int8(-8)},
+		{Name: "uint8", Type: TypeUint8, Value: uint8(8)},
+		{Name: "int16", Type: TypeInt16, Value: int16(-16)},
+		{Name: "uint16", Type: TypeUint16, Value: uint16(16)},
+		{Name: "int32", Type: TypeInt32, Value: int32(-32)},
+		{Name: "uint32", Type: TypeUint32, Value: uint32(32)},
+		{Name: "int64", Type: TypeInt64, Value: int64(-64)},
+		{Name: "uint64", Type: TypeUint64, Value: uint64(1 << 63)},
+		{Name: "hrtime", Type: TypeHrtime, Value: int64(123456789)},
+		{Name: "double", Type: TypeDouble, Value: 1.5},
+		{Name: "string", Type: TypeString, Value: "a longer string value"},
+		{Name: "empty_string", Type: TypeString, Value: ""},
+		{Name: "byte_array", Type: TypeByteArray, Value: []uint8{1, 2, 3}},
+		{Name: "int8_array", Type: TypeInt8Array, Value: []int8{-1, 0, 1, 2, 3}},
+		{Name: "uint8_array", Type: TypeUint8Array, Value: []uint8{}},
+		{Name: "int16_array", Type: TypeInt16Array, Value: []int16{-1, 1}},
+		{Name: "uint16_array", Type: TypeUint16Array, Value: []uint16{65535}},
+		{Name: "int32_array", Type: TypeInt32Array, Value: []int32{-1, 1, 3}},
+		{Name: "uint32_array", Type: TypeUint32Array, Value: []uint32{1, 2}},
+		{Name: "int64_array", Type: TypeInt64Array, Value: []int64{-1}},
+		{Name: "uint64_array", Type: TypeUint64Array, Value: []uint64{1, 2, 3}},
+		{Name: "boolean_array", Type: TypeBooleanArray, Value: []bool{true, false, true}},
+		{Name: "string_array", Type: TypeStringArray, Value: []string{"a", "", "abcdefgh"}},
+		{Name: "nvlist", Type: TypeNvlist, Value: child},
+		{Name: "nvlist_array", Type: TypeNvlistArray, Value: []*List{child, empty, child}},
+	}
+	return l
+}
+
+func TestUnpack_Fixtures(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		enc  Encoding
+		list func() *List
+	}{
+		{"xdr", xdrFixture, EncodingXDR, fixtureList},
+		{"native", nativeFixture, EncodingNative, fixtureList},
+		{"xdr arrays", xdrArrayFixture, EncodingXDR, arrayFixtureList},
+		{"native arrays", nativeArrayFixture, EncodingNative, arrayFixtureList},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := fixture(t, test.dump)
+
+			got, err := Unpack(data)
+			if err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if want := test.list(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Unpack() = %+v, want %+v", got, want)
+			}
+
+			packed, err := got.Pack(test.enc)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			// The header records the host byte order, compare the rest
+			if test.enc == EncodingXDR {
+				packed[1], data[1] = 0, 0
+			}
+			if test.enc == EncodingNative && hostEndian != littleEndian {
+				t.Skip("native fixture is little endian")
+			}
+			if !bytes.Equal(packed, data) {
+				t.Errorf("Pack() =\n%x\nwant\n%x", packed, data)
+			}
+		})
+	}
+}
+
+func TestPack_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		pack func(l *List) ([]byte, error)
+	}{
+		{"xdr", func(l *List) ([]byte, error) { return l.Pack(EncodingXDR) }},
+		{"native", func(l *List) ([]byte, error) { return l.Pack(EncodingNative) }},
+		{"native little endian", func(l *List) ([]byte, error) {
+			return packNative(l, binary.LittleEndian, littleEndian), nil
+		}},
+		{"native big endian", func(l *List) ([]byte, error) {
+			return packNative(l, binary.BigEndian, bigEndian), nil
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := allTypes()
+
+			data, err := test.pack(want)
+			if err != nil {
+				t.Fatalf("pack error = %v", err)
+			}
+
+			got, err := Unpack(data)
+			if err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				for i := range want.Pairs {
+					if i < len(got.Pairs) && !reflect.DeepEqual(got.Pairs[i], want.Pairs[i]) {
+						t.Errorf("pair %d = %#v, want %#v", i, got.Pairs[i], want.Pairs[i])
+					}
+				}
+				t.Fatalf("Unpack() returned %d pairs, want %d", len(got.Pairs), len(want.Pairs))
+			}
+		})
+	}
+}
+
+func TestPack_Sizes(t *testing.T) {
+	l := allTypes()
+
+	xdr, err := l.Pack(EncodingXDR)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if want := headerSize + xdrListSize(l); len(xdr) != want {
+		t.Errorf("xdr length = %d, want %d", len(xdr), want)
+	}
+
+	native, err := l.Pack(EncodingNative)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if want := headerSize + nativeListSize(l); len(native) != want {
+		t.Errorf("native length = %d, want %d", len(native), want)
+	}
+}
+
+func TestUnpack_Truncated(t *testing.T) {
+	for _, enc := range []Encoding{EncodingXDR, EncodingNative} {
+		t.Run(enc.String(), func(t *testing.T) {
+			data, err := allTypes().Pack(enc)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := Unpack(data[:n]); err == nil {
+					t.Fatalf("Unpack() of %d/%d bytes succeeded", n, len(data))
+				}
+			}
+		})
+	}
+}
+
+func TestUnpack_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unknown encoding", []byte{7, 1, 0, 0, 0, 0, 0, 0}},
+		{"bad endianness", []byte{0, 9, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}},
+		// uint64 pair claiming 3 elements
+		{"bad nelem", fixture(t, `
+			01 01 00 00 00000000 00000001
+			00000020 00000020 00000004 67756964 00000008 00000003 00000000 00000001
+			00000000 00000000`)},
+		// string of 0x7fffffff bytes
+		{"oversized string", fixture(t, `
+			01 01 00 00 00000000 00000001
+			00000020 00000020 00000004 6e616d65 00000009 00000001 7fffffff 74616e6b
+			00000000 00000000`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Unpack(test.data); err == nil {
+				t.Error("Unpack() should fail")
+			}
+		})
+	}
+
+	_, err := Unpack([]byte{1})
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("Unpack() of short header error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestPack_InvalidValue(t *testing.T) {
+	l := New()
+	l.Pairs = []Pair{{Name: "guid", Type: TypeUint64, Value: "not a number"}}
+
+	if _, err := l.Pack(EncodingXDR); err == nil {
+		t.Error("Pack() with mismatched value should fail")
+	}
+	if err := l.AddTyped("flag", TypeBoolean, false); err == nil {
+		t.Error("AddTyped() of false boolean flag should fail")
+	}
+}
+
+func TestList_AddAndLookup(t *testing.T) {
+	l := New()
+	for _, add := range []struct {
+		name  string
+		value any
+	}{
+		{"guid", uint64(42)},
+		{"ashift", 12},
+		{"path", "/dev/ada0"},
+		{"children", []map[string]any{{"id": uint64(0)}, {"id": uint64(1)}}},
+		{"path", "/dev/ada1"},
+	} {
+		if err := l.Add(add.name, add.value); err != nil {
+			t.Fatalf("Add(%q) error = %v", add.name, err)
+		}
+	}
+
+	if l.Len() != 4 {
+		t.Errorf("Len() = %d, want 4 with unique names", l.Len())
+	}
+	if guid, ok := l.LookupUint64("guid"); !ok || guid != 42 {
+		t.Errorf("LookupUint64(guid) = %d, %v", guid, ok)
+	}
+	if ashift, ok := l.LookupInt64("ashift"); !ok || ashift != 12 {
+		t.Errorf("LookupInt64(ashift) = %d, %v", ashift, ok)
+	}
+	if path, ok := l.LookupString("path"); !ok || path != "/dev/ada1" {
+		t.Errorf("LookupString(path) = %q, %v", path, ok)
+	}
+	children, ok := l.LookupListArray("children")
+	if !ok || len(children) != 2 {
+		t.Fatalf("LookupListArray(children) = %v, %v", children, ok)
+	}
+	if id, _ := children[1].LookupUint64("id"); id != 1 {
+		t.Errorf("children[1].id = %d, want 1", id)
+	}
+	if !l.Remove("ashift") || l.Exists("ashift") {
+		t.Error("Remove(ashift) did not remove the pair")
+	}
+}
+
+type testVdev struct {
+	Type     string     `nvlist:"type"`
+	ID       uint64     `nvlist:"id"`
+	GUID     uint64     `nvlist:"guid"`
+	Path     string     `nvlist:"path,omitempty"`
+	Ashift   int        `nvlist:"ashift,omitempty"`
+	IsLog    bool       `nvlist:"is_log"`
+	Spare    bool       `nvlist:"is_spare,flag"`
+	Stats    []uint64   `nvlist:"vdev_stats,omitempty"`
+	Children []testVdev `nvlist:"children,omitempty"`
+	Ignored  string     `nvlist:"-"`
+}
+
+type testConfig struct {
+	Name     string   `nvlist:"name"`
+	State    uint64   `nvlist:"state"`
+	Version  uint64   `nvlist:"version"`
+	Features []string `nvlist:"features,omitempty"`
+	VdevTree testVdev `nvlist:"vdev_tree"`
+	Extra    map[string]any
+}
+
+func TestMarshal_Struct(t *testing.T) {
+	want := testConfig{
+		Name:    "tank",
+		State:   0,
+		Version: 5000,
+		VdevTree: testVdev{
+			Type: "root",
+			GUID: 1,
+			Children: []testVdev{
+				{Type: "mirror", ID: 0, GUID: 2, Ashift: 12, Children: []testVdev{
+					{Type: "disk", GUID: 3, Path: "/dev/ada0", Stats: []uint64{1, 2, 3}},
+					{Type: "disk", ID: 1, GUID: 4, Path: "/dev/ada1", Spare: true},
+				}},
+				{Type: "disk", ID: 1, GUID: 5, Path: "/dev/ada2", IsLog: true},
+			},
+		},
+		Extra: map[string]any{"comment": "test pool"},
+	}
+
+	for _, enc := range []Encoding{EncodingXDR, EncodingNative} {
+		t.Run(enc.String(), func(t *testing.T) {
+			data, err := Marshal(want, enc)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			var got testConfig
+			if err := Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+			}
+
+			var m map[string]any
+			if err := Unmarshal(data, &m); err != nil {
+				t.Fatalf("Unmarshal() into map error = %v", err)
+			}
+			tree := m["vdev_tree"].(map[string]any)
+			children := tree["children"].([]map[string]any)
+			leaf := children[0]["children"].([]map[string]any)[1]
+			if leaf["is_spare"] != true || leaf["path"] != "/dev/ada1" {
+				t.Errorf("map leaf = %v, want spare /dev/ada1", leaf)
+			}
+			if _, ok := children[1]["is_spare"]; ok {
+				t.Error("flag field set to false should be omitted")
+			}
+		})
+	}
+}
+
+func TestDecode_IntegerConversion(t *testing.T) {
+	l := New()
+	_ = l.Add("small", uint64(200))
+	_ = l.Add("negative", int32(-1))
+
+	var ok struct {
+		Small uint8 `nvlist:"small"`
+	}
+	if err := Decode(l, &ok); err != nil || ok.Small != 200 {
+		t.Errorf("Decode() = %d, %v, want 200", ok.Small, err)
+	}
+
+	var overflow struct {
+		Small int8 `nvlist:"small"`
+	}
+	if err := Decode(l, &overflow); err == nil {
+		t.Error("Decode() of 200 into int8 should fail")
+	}
+
+	var negative struct {
+		Negative uint64 `nvlist:"negative"`
+	}
+	if err := Decode(l, &negative); err == nil {
+		t.Error("Decode() of -1 into uint64 should fail")
+	}
+
+	if err := Decode(l, ok); err == nil {
+		t.Error("Decode() into non-pointer should fail")
+	}
+}
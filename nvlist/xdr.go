@@ -0,0 +1,454 @@
+package nvlist
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// XDR encoding (nvs_xdr_*). Every item is a big-endian quantity padded to
+// four bytes. A list is encoded as its version and flags, followed by each
+// pair and a terminator of two zero words. Each pair starts with its own
+// encoded size and the size of the equivalent in-memory nvpair.
+
+// xdrEncoder appends XDR items to a buffer
+type xdrEncoder struct {
+	buf []byte
+}
+
+func packXDR(l *List) []byte {
+	e := &xdrEncoder{buf: make([]byte, 0, headerSize+xdrListSize(l))}
+	e.buf = append(e.buf, byte(EncodingXDR), hostEndian, 0, 0)
+	e.list(l)
+	return e.buf
+}
+
+func (e *xdrEncoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *xdrEncoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+// opaque appends variable-length data (xdr_string)
+func (e *xdrEncoder) opaque(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+	e.pad4()
+}
+
+func (e *xdrEncoder) pad4() {
+	for len(e.buf)%4 != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *xdrEncoder) list(l *List) {
+	e.uint32(uint32(l.Version))
+	e.uint32(l.Flags)
+	for _, p := range l.Pairs {
+		e.pair(p)
+	}
+	e.uint32(0)
+	e.uint32(0)
+}
+
+func (e *xdrEncoder) pair(p Pair) {
+	e.uint32(uint32(xdrPairSize(p)))
+	e.uint32(uint32(nativePairSize(p)))
+	e.opaque([]byte(p.Name))
+	e.uint32(uint32(p.Type))
+	e.uint32(uint32(nelem(p)))
+
+	switch v := p.Value.(type) {
+	case bool:
+		if p.Type == TypeBooleanValue {
+			e.uint32(boolWord(v))
+		}
+	case uint8:
+		e.uint32(uint32(v))
+	case int8:
+		e.uint32(uint32(int32(v)))
+	case int16:
+		e.uint32(uint32(int32(v)))
+	case uint16:
+		e.uint32(uint32(v))
+	case int32:
+		e.uint32(uint32(v))
+	case uint32:
+		e.uint32(v)
+	case int64:
+		e.uint64(uint64(v))
+	case uint64:
+		e.uint64(v)
+	case float64:
+		e.uint64(math.Float64bits(v))
+	case string:
+		e.opaque([]byte(v))
+	case []uint8:
+		if p.Type == TypeByteArray {
+			// xdr_opaque, nelem gives the length
+			e.buf = append(e.buf, v...)
+			e.pad4()
+			break
+		}
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(uint32(x))
+		}
+	case []int8:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(uint32(int32(x)))
+		}
+	case []int16:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(uint32(int32(x)))
+		}
+	case []uint16:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(uint32(x))
+		}
+	case []bool:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(boolWord(x))
+		}
+	case []int32:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(uint32(x))
+		}
+	case []uint32:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint32(x)
+		}
+	case []int64:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint64(uint64(x))
+		}
+	case []uint64:
+		e.uint32(uint32(len(v)))
+		for _, x := range v {
+			e.uint64(x)
+		}
+	case []string:
+		// String arrays carry no count of their own, nelem is authoritative
+		for _, s := range v {
+			e.opaque([]byte(s))
+		}
+	case *List:
+		e.list(v)
+	case []*List:
+		for _, child := range v {
+			e.list(child)
+		}
+	}
+}
+
+func boolWord(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// xdrListSize returns the encoded size of a list: version, flags and terminator
+func xdrListSize(l *List) int {
+	size := 4 + 4 + 8
+	for _, p := range l.Pairs {
+		size += xdrPairSize(p)
+	}
+	return size
+}
+
+// xdrPairSize returns the encoded size of a pair (nvs_xdr_nvp_size)
+func xdrPairSize(p Pair) int {
+	size := 4 + 4 + 4 + align4(len(p.Name)) + 4 + 4
+	n := nelem(p)
+
+	switch p.Type {
+	case TypeBoolean:
+	case TypeBooleanValue, TypeByte, TypeInt8, TypeUint8,
+		TypeInt16, TypeUint16, TypeInt32, TypeUint32:
+		size += 4
+	case TypeInt64, TypeUint64, TypeHrtime, TypeDouble:
+		size += 8
+	case TypeString:
+		size += 4 + align4(len(p.Value.(string)))
+	case TypeByteArray:
+		size += align4(n)
+	case TypeInt8Array, TypeUint8Array, TypeInt16Array, TypeUint16Array, TypeBooleanArray, TypeInt32Array, TypeUint32Array:
+		size += 4 + 4*n
+	case TypeInt64Array, TypeUint64Array:
+		size += 4 + 8*n
+	case TypeStringArray:
+		for _, s := range p.Value.([]string) {
+			size += 4 + align4(len(s))
+		}
+	case TypeNvlist:
+		size += xdrListSize(p.Value.(*List))
+	case TypeNvlistArray:
+		for _, child := range p.Value.([]*List) {
+			size += xdrListSize(child)
+		}
+	}
+	return size
+}
+
+// xdrDecoder reads XDR items from packed data
+type xdrDecoder struct {
+	reader
+}
+
+func unpackXDR(data []byte) (*List, error) {
+	d := &xdrDecoder{reader{data: data, off: headerSize, order: binary.BigEndian}}
+	l, err := d.list(0)
+	if err != nil {
+		return nil, fmt.Errorf("nvlist: xdr: %w", err)
+	}
+	return l, nil
+}
+
+// opaque reads variable-length data, limited to the bytes left in the stream
+func (d *xdrDecoder) opaque() ([]byte, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(d.remaining()) {
+		return nil, fmt.Errorf("%w: %d byte item at offset %d", ErrTruncated, n, d.off)
+	}
+	b, err := d.bytes(align4(int(n)))
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// count reads the element count of an xdr_array and checks it against nelem
+func (d *xdrDecoder) count(n int, elemSize int) error {
+	c, err := d.uint32()
+	if err != nil {
+		return err
+	}
+	if int64(c) != int64(n) {
+		return fmt.Errorf("array count %d does not match nelem %d", c, n)
+	}
+	if n*elemSize > d.remaining() {
+		return fmt.Errorf("%w: %d element array at offset %d", ErrTruncated, n, d.off)
+	}
+	return nil
+}
+
+func (d *xdrDecoder) list(depth int) (*List, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxDepth)
+	}
+
+	version, err := d.int32()
+	if err != nil {
+		return nil, err
+	}
+	flags, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	l := &List{Version: version, Flags: flags}
+
+	for {
+		if _, err := d.uint32(); err != nil { // encoded size
+			return nil, err
+		}
+		decodeSize, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		if decodeSize == 0 {
+			return l, nil
+		}
+
+		p, err := d.pair(depth)
+		if err != nil {
+			return nil, err
+		}
+		l.Pairs = append(l.Pairs, p)
+	}
+}
+
+func (d *xdrDecoder) pair(depth int) (Pair, error) {
+	var p Pair
+
+	name, err := d.opaque()
+	if err != nil {
+		return p, err
+	}
+	p.Name = string(name)
+
+	typ, err := d.int32()
+	if err != nil {
+		return p, err
+	}
+	p.Type = DataType(typ)
+
+	count, err := d.int32()
+	if err != nil {
+		return p, err
+	}
+	if err := checkNelem(p.Type, count); err != nil {
+		return p, fmt.Errorf("pair %q: %w", p.Name, err)
+	}
+	n := int(count)
+
+	p.Value, err = d.value(p.Type, n, depth)
+	if err != nil {
+		return p, fmt.Errorf("pair %q: %w", p.Name, err)
+	}
+	return p, nil
+}
+
+func (d *xdrDecoder) value(typ DataType, n int, depth int) (any, error) {
+	switch typ {
+	case TypeBoolean:
+		return true, nil
+	case TypeBooleanValue:
+		v, err := d.uint32()
+		return v != 0, err
+	case TypeByte, TypeUint8:
+		v, err := d.uint32()
+		return uint8(v), err
+	case TypeInt8:
+		v, err := d.uint32()
+		return int8(v), err
+	case TypeInt16:
+		v, err := d.uint32()
+		return int16(v), err
+	case TypeUint16:
+		v, err := d.uint32()
+		return uint16(v), err
+	case TypeInt32:
+		return d.int32()
+	case TypeUint32:
+		return d.uint32()
+	case TypeInt64, TypeHrtime:
+		v, err := d.uint64()
+		return int64(v), err
+	case TypeUint64:
+		return d.uint64()
+	case TypeDouble:
+		v, err := d.uint64()
+		return math.Float64frombits(v), err
+	case TypeString:
+		b, err := d.opaque()
+		return string(b), err
+	case TypeByteArray:
+		b, err := d.bytes(align4(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]uint8{}, b[:n]...), nil
+	case TypeInt8Array, TypeUint8Array, TypeInt16Array, TypeUint16Array, TypeBooleanArray, TypeInt32Array, TypeUint32Array:
+		if err := d.count(n, 4); err != nil {
+			return nil, err
+		}
+		words := make([]uint32, n)
+		for i := range words {
+			words[i], _ = d.uint32()
+		}
+		return convertWords(typ, words), nil
+	case TypeInt64Array, TypeUint64Array:
+		if err := d.count(n, 8); err != nil {
+			return nil, err
+		}
+		v := make([]uint64, n)
+		for i := range v {
+			v[i], _ = d.uint64()
+		}
+		if typ == TypeUint64Array {
+			return v, nil
+		}
+		signed := make([]int64, n)
+		for i, x := range v {
+			signed[i] = int64(x)
+		}
+		return signed, nil
+	case TypeStringArray:
+		if n*4 > d.remaining() {
+			return nil, fmt.Errorf("%w: %d element array at offset %d", ErrTruncated, n, d.off)
+		}
+		v := make([]string, n)
+		for i := range v {
+			b, err := d.opaque()
+			if err != nil {
+				return nil, err
+			}
+			v[i] = string(b)
+		}
+		return v, nil
+	case TypeNvlist:
+		return d.list(depth + 1)
+	case TypeNvlistArray:
+		if n*16 > d.remaining() {
+			return nil, fmt.Errorf("%w: %d element array at offset %d", ErrTruncated, n, d.off)
+		}
+		v := make([]*List, n)
+		for i := range v {
+			child, err := d.list(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = child
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported data type %v", typ)
+}
+
+// convertWords narrows decoded 32-bit array elements to the Go type of typ
+func convertWords(typ DataType, words []uint32) any {
+	switch typ {
+	case TypeInt8Array:
+		v := make([]int8, len(words))
+		for i, w := range words {
+			v[i] = int8(w)
+		}
+		return v
+	case TypeUint8Array:
+		v := make([]uint8, len(words))
+		for i, w := range words {
+			v[i] = uint8(w)
+		}
+		return v
+	case TypeInt16Array:
+		v := make([]int16, len(words))
+		for i, w := range words {
+			v[i] = int16(w)
+		}
+		return v
+	case TypeUint16Array:
+		v := make([]uint16, len(words))
+		for i, w := range words {
+			v[i] = uint16(w)
+		}
+		return v
+	case TypeBooleanArray:
+		v := make([]bool, len(words))
+		for i, w := range words {
+			v[i] = w != 0
+		}
+		return v
+	case TypeInt32Array:
+		v := make([]int32, len(words))
+		for i, w := range words {
+			v[i] = int32(w)
+		}
+		return v
+	default:
+		return words
+	}
+}
@@ -1,5 +1,3 @@
-//go:build freebsd
-
 package version
 
 import (
@@ -14,6 +12,7 @@ import (
 // Info contains version and runtime information
 type Info struct {
 	Impl    string    // "libzfs" or "ioctl"
+	Reason  string    // Why the driver was selected
 	ZFS     string    // ZFS version
 	Kernel  string    // Kernel version
 	Go      string    // Go version
@@ -30,16 +29,20 @@ func (i *Info) String() string {
 
 // Config controls driver selection and behavior
 type Config struct {
-	UseLibZFS bool // prefer libzfs over ioctl (default: true)
+	UseLibZFS bool          // prefer libzfs over ioctl (default: true)
+	Fallback  bool          // try the other driver if the preferred one is unavailable (default: false)
+	Driver    driver.Driver // use this driver instead of opening one, it is not closed
 }
 
 // Option configures the version detection
 type Option func(*Config)
 
-// WithLibZFS forces the use of libzfs driver
+// WithLibZFS selects the libzfs driver, or the ioctl driver when use is
+// false, without falling back to the other
 func WithLibZFS(use bool) Option {
 	return func(c *Config) {
 		c.UseLibZFS = use
+		c.Fallback = false
 	}
 }
 
@@ -47,25 +50,70 @@ func WithLibZFS(use bool) Option {
 func WithIoctlOnly() Option {
 	return func(c *Config) {
 		c.UseLibZFS = false
+		c.Fallback = false
 	}
 }
 
-// Detect probes the system and returns version information
-func Detect(ctx context.Context, opts ...Option) (*Info, error) {
-	cfg := Config{UseLibZFS: true}
+// WithAutoDriver tries libzfs first and falls back to the ioctl driver.
+// With preferIoctl set the order is reversed.
+func WithAutoDriver(preferIoctl bool) Option {
+	return func(c *Config) {
+		c.UseLibZFS = !preferIoctl
+		c.Fallback = true
+	}
+}
+
+// WithDriver uses the given driver instead of opening one
+func WithDriver(d driver.Driver) Option {
+	return func(c *Config) {
+		c.Driver = d
+	}
+}
+
+// defaultConfig selects the libzfs driver without fallback
+func defaultConfig() Config {
+	return Config{UseLibZFS: true}
+}
+
+// mode returns the driver selection mode for the configuration
+func (c Config) mode() driver.Mode {
+	switch {
+	case c.UseLibZFS && c.Fallback:
+		return driver.ModeAuto
+	case c.Fallback:
+		return driver.ModeAutoIoctl
+	case c.UseLibZFS:
+		return driver.ModeLibZFS
+	default:
+		return driver.ModeIoctl
+	}
+}
+
+// openDriver returns the configured driver and a function releasing it
+func openDriver(opts []Option) (driver.Driver, driver.Selection, func(), error) {
+	cfg := defaultConfig()
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
-	var d driver.Driver
-	var err error
+	if cfg.Driver != nil {
+		return cfg.Driver, driver.Injected(), func() {}, nil
+	}
+
+	d, sel, err := driver.Open(cfg.mode())
+	if err != nil {
+		return nil, sel, nil, err
+	}
+	return d, sel, func() { d.Close() }, nil
+}
 
-	// Create libzfs driver
-	d, err = driver.NewLibZFS()
+// Detect probes the system and returns version information
+func Detect(ctx context.Context, opts ...Option) (*Info, error) {
+	d, sel, release, err := openDriver(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize libzfs driver: %w", err)
+		return nil, err
 	}
-	defer d.Close()
+	defer release()
 
 	// Get runtime information from the driver
 	impl, zfsVer, kernel, err := d.RuntimeInfo(ctx)
@@ -75,6 +123,7 @@ func Detect(ctx context.Context, opts ...Option) (*Info, error) {
 
 	return &Info{
 		Impl:    impl,
+		Reason:  sel.Reason,
 		ZFS:     zfsVer,
 		Kernel:  kernel,
 		Go:      runtime.Version(),
@@ -122,19 +171,11 @@ type CapabilitySet struct {
 
 // ProbeCapabilities detects what features are available on this system
 func ProbeCapabilities(ctx context.Context, opts ...Option) (*CapabilitySet, error) {
-	cfg := Config{UseLibZFS: true}
-	for _, opt := range opts {
-		opt(&cfg)
-	}
-
-	var d driver.Driver
-	var err error
-
-	d, err = driver.NewLibZFS()
+	d, _, release, err := openDriver(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize libzfs driver: %w", err)
+		return nil, err
 	}
-	defer d.Close()
+	defer release()
 
 	caps := &CapabilitySet{}
 
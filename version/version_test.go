@@ -1,11 +1,12 @@
-//go:build freebsd
-
 package version
 
 import (
 	"context"
 	"testing"
 	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+	"github.com/zombocoder/go-freebsd-libzfs/zfstest"
 )
 
 func TestCapabilitySet_IsFeatureSupported(t *testing.T) {
@@ -110,3 +111,50 @@ func TestProbeCapabilities_WithTimeout(t *testing.T) {
 		t.Log("ProbeCapabilities succeeded - ZFS is available")
 	}
 }
+
+func TestConfig_Mode(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want driver.Mode
+	}{
+		{"default", nil, driver.ModeLibZFS},
+		{"libzfs", []Option{WithLibZFS(true)}, driver.ModeLibZFS},
+		{"ioctl", []Option{WithIoctlOnly()}, driver.ModeIoctl},
+		{"auto", []Option{WithIoctlOnly(), WithAutoDriver(false)}, driver.ModeAuto},
+		{"auto prefer ioctl", []Option{WithAutoDriver(true)}, driver.ModeAutoIoctl},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			for _, opt := range test.opts {
+				opt(&cfg)
+			}
+			if got := cfg.mode(); got != test.want {
+				t.Errorf("mode() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDetect_WithDriver(t *testing.T) {
+	ctx := context.Background()
+	d := zfstest.NewFakeDriver()
+
+	info, err := Detect(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if info.Impl != "fake" {
+		t.Errorf("Impl = %q, want fake", info.Impl)
+	}
+	if info.Reason == "" {
+		t.Error("Reason is empty")
+	}
+
+	// The injected driver belongs to the caller and stays open
+	if _, err := d.ListPools(ctx); err != nil {
+		t.Errorf("driver closed by Detect: %v", err)
+	}
+}
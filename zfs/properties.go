@@ -0,0 +1,438 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// Ratio is a compression ratio in hundredths, 205 is 2.05x
+type Ratio uint64
+
+func (r Ratio) String() string {
+	return fmt.Sprintf("%d.%02dx", r/100, r%100)
+}
+
+// Float64 returns the ratio as a float, 2.05 for 2.05x
+func (r Ratio) Float64() float64 {
+	return float64(r) / 100
+}
+
+// Compression is the value of the compression property. Levels are part
+// of the value, e.g. gzip-9, zstd-19 or zstd-fast-10.
+type Compression string
+
+const (
+	CompressionOn       Compression = "on"
+	CompressionOff      Compression = "off"
+	CompressionLZJB     Compression = "lzjb"
+	CompressionGzip     Compression = "gzip"
+	CompressionZLE      Compression = "zle"
+	CompressionLZ4      Compression = "lz4"
+	CompressionZstd     Compression = "zstd"
+	CompressionZstdFast Compression = "zstd-fast"
+)
+
+// Checksum is the value of the checksum property
+type Checksum string
+
+const (
+	ChecksumOn        Checksum = "on"
+	ChecksumOff       Checksum = "off"
+	ChecksumFletcher2 Checksum = "fletcher2"
+	ChecksumFletcher4 Checksum = "fletcher4"
+	ChecksumSHA256    Checksum = "sha256"
+	ChecksumNoParity  Checksum = "noparity"
+	ChecksumSHA512    Checksum = "sha512"
+	ChecksumSkein     Checksum = "skein"
+	ChecksumEdonR     Checksum = "edonr"
+	ChecksumBlake3    Checksum = "blake3"
+)
+
+// Dedup is the value of the dedup property. Algorithms may carry a
+// ,verify suffix, e.g. sha256,verify.
+type Dedup string
+
+const (
+	DedupOn     Dedup = "on"
+	DedupOff    Dedup = "off"
+	DedupVerify Dedup = "verify"
+)
+
+// CanMount is the value of the canmount property
+type CanMount string
+
+const (
+	CanMountOn     CanMount = "on"
+	CanMountOff    CanMount = "off"
+	CanMountNoAuto CanMount = "noauto"
+)
+
+// SnapDir is the value of the snapdir and snapdev properties
+type SnapDir string
+
+const (
+	SnapDirHidden   SnapDir = "hidden"
+	SnapDirVisible  SnapDir = "visible"
+	SnapDirDisabled SnapDir = "disabled"
+)
+
+// SyncMode is the value of the sync property
+type SyncMode string
+
+const (
+	SyncStandard SyncMode = "standard"
+	SyncAlways   SyncMode = "always"
+	SyncDisabled SyncMode = "disabled"
+)
+
+// CacheMode is the value of the primarycache and secondarycache properties
+type CacheMode string
+
+const (
+	CacheAll      CacheMode = "all"
+	CacheNone     CacheMode = "none"
+	CacheMetadata CacheMode = "metadata"
+)
+
+// LogBias is the value of the logbias property
+type LogBias string
+
+const (
+	LogBiasLatency    LogBias = "latency"
+	LogBiasThroughput LogBias = "throughput"
+)
+
+// XattrMode is the value of the xattr property
+type XattrMode string
+
+const (
+	XattrOff XattrMode = "off"
+	XattrOn  XattrMode = "on"
+	XattrSA  XattrMode = "sa"
+)
+
+// ACLType is the value of the acltype property
+type ACLType string
+
+const (
+	ACLTypeOff   ACLType = "off"
+	ACLTypePOSIX ACLType = "posix"
+	ACLTypeNFSv4 ACLType = "nfsv4"
+)
+
+// ACLMode is the value of the aclmode property
+type ACLMode string
+
+const (
+	ACLModeDiscard     ACLMode = "discard"
+	ACLModeGroupmask   ACLMode = "groupmask"
+	ACLModePassthrough ACLMode = "passthrough"
+	ACLModeRestricted  ACLMode = "restricted"
+)
+
+// ACLInherit is the value of the aclinherit property
+type ACLInherit string
+
+const (
+	ACLInheritDiscard      ACLInherit = "discard"
+	ACLInheritNoAllow      ACLInherit = "noallow"
+	ACLInheritRestricted   ACLInherit = "restricted"
+	ACLInheritPassthrough  ACLInherit = "passthrough"
+	ACLInheritPassthroughX ACLInherit = "passthrough-x"
+)
+
+// DnodeSize is the value of the dnodesize property
+type DnodeSize string
+
+const (
+	DnodeSizeLegacy DnodeSize = "legacy"
+	DnodeSizeAuto   DnodeSize = "auto"
+	DnodeSize1K     DnodeSize = "1k"
+	DnodeSize2K     DnodeSize = "2k"
+	DnodeSize4K     DnodeSize = "4k"
+	DnodeSize8K     DnodeSize = "8k"
+	DnodeSize16K    DnodeSize = "16k"
+)
+
+// RedundantMetadata is the value of the redundant_metadata property
+type RedundantMetadata string
+
+const (
+	RedundantMetadataAll  RedundantMetadata = "all"
+	RedundantMetadataMost RedundantMetadata = "most"
+	RedundantMetadataSome RedundantMetadata = "some"
+	RedundantMetadataNone RedundantMetadata = "none"
+)
+
+// VolMode is the value of the volmode property
+type VolMode string
+
+const (
+	VolModeDefault VolMode = "default"
+	VolModeGeom    VolMode = "geom"
+	VolModeDev     VolMode = "dev"
+	VolModeNone    VolMode = "none"
+)
+
+// CaseSensitivity is the value of the casesensitivity property
+type CaseSensitivity string
+
+const (
+	CaseSensitive   CaseSensitivity = "sensitive"
+	CaseInsensitive CaseSensitivity = "insensitive"
+	CaseMixed       CaseSensitivity = "mixed"
+)
+
+// Normalization is the value of the normalization property
+type Normalization string
+
+const (
+	NormalizationNone   Normalization = "none"
+	NormalizationFormC  Normalization = "formC"
+	NormalizationFormD  Normalization = "formD"
+	NormalizationFormKC Normalization = "formKC"
+	NormalizationFormKD Normalization = "formKD"
+)
+
+// Encryption is the value of the encryption property
+type Encryption string
+
+const (
+	EncryptionOn        Encryption = "on"
+	EncryptionOff       Encryption = "off"
+	EncryptionAES128CCM Encryption = "aes-128-ccm"
+	EncryptionAES192CCM Encryption = "aes-192-ccm"
+	EncryptionAES256CCM Encryption = "aes-256-ccm"
+	EncryptionAES128GCM Encryption = "aes-128-gcm"
+	EncryptionAES192GCM Encryption = "aes-192-gcm"
+	EncryptionAES256GCM Encryption = "aes-256-gcm"
+)
+
+// KeyFormat is the value of the keyformat property
+type KeyFormat string
+
+const (
+	KeyFormatNone       KeyFormat = "none"
+	KeyFormatRaw        KeyFormat = "raw"
+	KeyFormatHex        KeyFormat = "hex"
+	KeyFormatPassphrase KeyFormat = "passphrase"
+)
+
+// KeyStatus is the value of the keystatus property
+type KeyStatus string
+
+const (
+	KeyStatusNone        KeyStatus = "none"
+	KeyStatusUnavailable KeyStatus = "unavailable"
+	KeyStatusAvailable   KeyStatus = "available"
+)
+
+// enumProps converts the value of each index property to its Go type
+var enumProps = map[string]func(string) any{
+	"compression":        func(s string) any { return Compression(s) },
+	"checksum":           func(s string) any { return Checksum(s) },
+	"dedup":              func(s string) any { return Dedup(s) },
+	"canmount":           func(s string) any { return CanMount(s) },
+	"snapdir":            func(s string) any { return SnapDir(s) },
+	"snapdev":            func(s string) any { return SnapDir(s) },
+	"sync":               func(s string) any { return SyncMode(s) },
+	"primarycache":       func(s string) any { return CacheMode(s) },
+	"secondarycache":     func(s string) any { return CacheMode(s) },
+	"logbias":            func(s string) any { return LogBias(s) },
+	"xattr":              func(s string) any { return XattrMode(s) },
+	"acltype":            func(s string) any { return ACLType(s) },
+	"aclmode":            func(s string) any { return ACLMode(s) },
+	"aclinherit":         func(s string) any { return ACLInherit(s) },
+	"dnodesize":          func(s string) any { return DnodeSize(s) },
+	"redundant_metadata": func(s string) any { return RedundantMetadata(s) },
+	"volmode":            func(s string) any { return VolMode(s) },
+	"casesensitivity":    func(s string) any { return CaseSensitivity(s) },
+	"normalization":      func(s string) any { return Normalization(s) },
+	"encryption":         func(s string) any { return Encryption(s) },
+	"keyformat":          func(s string) any { return KeyFormat(s) },
+	"keystatus":          func(s string) any { return KeyStatus(s) },
+	"type":               func(s string) any { return DatasetType(s) },
+}
+
+// typedValue converts a raw driver value to the Go type of the property:
+// uint64 for numbers and byte counts, Ratio, time.Time, bool, the enum
+// types of this package for index properties and string otherwise
+func typedValue(name string, raw any) any {
+	canonical, _ := driver.CanonicalDatasetProp(name)
+	switch v := raw.(type) {
+	case uint64:
+		switch driver.DatasetPropKind(canonical) {
+		case driver.PropKindRatio:
+			return Ratio(v)
+		case driver.PropKindDate:
+			return time.Unix(int64(v), 0)
+		}
+		return v
+	case string:
+		if enum, ok := enumProps[canonical]; ok {
+			return enum(v)
+		}
+		return v
+	}
+	return raw
+}
+
+// GetTypedProperties retrieves properties like GetProperties, with Value
+// holding the exact typed value and Display the human readable form:
+//
+//   - uint64 for numbers and byte counts, e.g. used, quota or recordsize
+//     (a quota or reservation of 0 is none)
+//   - Ratio for compressratio and refcompressratio
+//   - time.Time for creation and snapshots_changed
+//   - bool for on/off and yes/no properties, e.g. atime or mounted
+//   - the enum types of this package, e.g. Compression or SyncMode
+//   - string for everything else, including user properties
+func (c *Client) GetTypedProperties(ctx context.Context, datasetName string, propNames ...string) (map[string]Property[any], error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	propInfos, err := c.d.GetDatasetProps(ctx, datasetName, propNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset properties: %w", err)
+	}
+
+	properties := make(map[string]Property[any])
+	for name, info := range propInfos {
+		prop := Property[any]{
+			Name:          info.Name,
+			Value:         typedValue(name, info.Raw),
+			Display:       fmt.Sprint(info.Value),
+			Source:        PropertySource(info.Source.String()),
+			Received:      info.Received,
+			InheritedFrom: info.InheritedFrom,
+		}
+		if received, ok := info.ReceivedValue.(string); ok {
+			if raw, err := driver.ParseDatasetPropValue(name, received); err == nil {
+				prop.ReceivedValue = typedValue(name, raw)
+				prop.HasReceivedValue = true
+			}
+		}
+		properties[name] = prop
+	}
+
+	return properties, nil
+}
+
+// GetProperty retrieves a single property with its value as T, which must
+// match the type GetTypedProperties reports for the property:
+//
+//	used, err := zfs.GetProperty[uint64](ctx, client, "tank/data", zfs.PropertyNameUsed)
+//	comp, err := zfs.GetProperty[zfs.Compression](ctx, client, "tank/data", zfs.PropertyNameCompression)
+func GetProperty[T any](ctx context.Context, c *Client, datasetName, propName string) (Property[T], error) {
+	props, err := c.GetTypedProperties(ctx, datasetName, propName)
+	if err != nil {
+		return Property[T]{}, err
+	}
+
+	prop, exists := props[propName]
+	if !exists {
+		return Property[T]{}, fmt.Errorf("property %q not found", propName)
+	}
+
+	value, ok := prop.Value.(T)
+	if !ok {
+		return Property[T]{}, fmt.Errorf("property %q is a %T, not a %T", propName, prop.Value, value)
+	}
+
+	typed := Property[T]{
+		Name:          prop.Name,
+		Value:         value,
+		Display:       prop.Display,
+		Source:        prop.Source,
+		Received:      prop.Received,
+		InheritedFrom: prop.InheritedFrom,
+	}
+	if received, ok := prop.ReceivedValue.(T); ok && prop.HasReceivedValue {
+		typed.ReceivedValue = received
+		typed.HasReceivedValue = true
+	}
+	return typed, nil
+}
+
+// ListUserProperties retrieves the user properties set on a dataset or
+// inherited from its ancestors, keyed by name, e.g. com.example:owner
+func (c *Client) ListUserProperties(ctx context.Context, datasetName string) (map[string]Property[string], error) {
+	props, err := c.GetProperties(ctx, datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	userProps := make(map[string]Property[string])
+	for name, prop := range props {
+		if driver.IsUserProp(name) {
+			userProps[name] = userProperty(prop)
+		}
+	}
+	return userProps, nil
+}
+
+// GetUserProperty retrieves a single user property. A property that is
+// not set anywhere is reported with an empty value and PropertySourceNone.
+func (c *Client) GetUserProperty(ctx context.Context, datasetName, propName string) (Property[string], error) {
+	if !driver.IsUserProp(propName) {
+		return Property[string]{}, fmt.Errorf("%q is not a user property", propName)
+	}
+
+	props, err := c.GetProperties(ctx, datasetName, propName)
+	if err != nil {
+		return Property[string]{}, err
+	}
+
+	prop, exists := props[propName]
+	if !exists {
+		return Property[string]{Name: propName, Source: PropertySourceNone}, nil
+	}
+	return userProperty(prop), nil
+}
+
+// SetUserProperty sets a user property on a dataset. The name must
+// contain a colon and only lowercase letters, digits and ":-_.", and is
+// checked before the driver is called.
+func (c *Client) SetUserProperty(ctx context.Context, datasetName, propName, propValue string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := driver.ValidateUserProp(datasetName, propName, propValue); err != nil {
+		return err
+	}
+	return c.d.SetDatasetProp(ctx, datasetName, propName, propValue)
+}
+
+// InheritUserProperty removes a user property from a dataset so that it
+// inherits the value of its parent, like zfs inherit. With recursive the
+// property is also removed from every descendant, like zfs inherit -r.
+func (c *Client) InheritUserProperty(ctx context.Context, datasetName, propName string, recursive bool) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := driver.ValidateUserProp(datasetName, propName, ""); err != nil {
+		return err
+	}
+	return c.InheritProperty(ctx, datasetName, propName, InheritOptions{Recursive: recursive})
+}
+
+func userProperty(prop Property[any]) Property[string] {
+	value, _ := prop.Value.(string)
+	received, _ := prop.ReceivedValue.(string)
+	return Property[string]{
+		Name:             prop.Name,
+		Value:            value,
+		Display:          prop.Display,
+		Source:           prop.Source,
+		Received:         prop.Received,
+		InheritedFrom:    prop.InheritedFrom,
+		ReceivedValue:    received,
+		HasReceivedValue: prop.HasReceivedValue,
+	}
+}
@@ -0,0 +1,119 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  any
+		want any
+	}{
+		{name: "used", raw: uint64(4096), want: uint64(4096)},
+		{name: "compressratio", raw: uint64(205), want: Ratio(205)},
+		{name: "creation", raw: uint64(1700000000), want: time.Unix(1700000000, 0)},
+		{name: "atime", raw: true, want: true},
+		{name: "compression", raw: "zstd-19", want: Compression("zstd-19")},
+		{name: "compress", raw: "lz4", want: CompressionLZ4},
+		{name: "sync", raw: "always", want: SyncAlways},
+		{name: "mountpoint", raw: "/tank", want: "/tank"},
+		{name: "com.example:owner", raw: "alice", want: "alice"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := typedValue(test.name, test.raw)
+			if want, ok := test.want.(time.Time); ok {
+				if tm, ok := got.(time.Time); !ok || !tm.Equal(want) {
+					t.Errorf("typedValue() = %#v, want %v", got, want)
+				}
+				return
+			}
+			if got != test.want {
+				t.Errorf("typedValue() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetProperty(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+
+	if err := c.SetProperty(ctx, "tank", PropertyNameCompression, "lz4"); err != nil {
+		t.Fatalf("SetProperty() error = %v", err)
+	}
+
+	comp, err := GetProperty[Compression](ctx, c, "tank", PropertyNameCompression)
+	if err != nil {
+		t.Fatalf("GetProperty[Compression]() error = %v", err)
+	}
+	if comp.Value != CompressionLZ4 || comp.Display != "lz4" || comp.Source != PropertySourceLocal {
+		t.Errorf("GetProperty[Compression]() = %+v, want lz4 set locally", comp)
+	}
+
+	if _, err := GetProperty[uint64](ctx, c, "tank", PropertyNameUsed); err != nil {
+		t.Errorf("GetProperty[uint64](used) error = %v", err)
+	}
+	if atime, err := GetProperty[bool](ctx, c, "tank", PropertyNameAtime); err != nil || !atime.Value {
+		t.Errorf("GetProperty[bool](atime) = %+v, %v, want true", atime, err)
+	}
+
+	if _, err := GetProperty[string](ctx, c, "tank", PropertyNameCompression); err == nil {
+		t.Error("GetProperty[string](compression) should fail, the value is a Compression")
+	}
+	if _, err := GetProperty[string](ctx, c, "tank", "nosuchprop"); err == nil {
+		t.Error("GetProperty() of an unknown property should fail")
+	}
+}
+
+func TestUserProperties(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+
+	if err := c.CreateFilesystem(ctx, "tank/home", nil); err != nil {
+		t.Fatalf("CreateFilesystem() error = %v", err)
+	}
+	if err := c.SetUserProperty(ctx, "tank", "owner", "alice"); err == nil {
+		t.Error("SetUserProperty() without a colon should fail")
+	}
+	if err := c.SetUserProperty(ctx, "tank", "com.example:owner", "alice"); err != nil {
+		t.Fatalf("SetUserProperty() error = %v", err)
+	}
+
+	prop, err := c.GetUserProperty(ctx, "tank/home", "com.example:owner")
+	if err != nil {
+		t.Fatalf("GetUserProperty() error = %v", err)
+	}
+	if prop.Value != "alice" || prop.Source != PropertySourceInherited || prop.InheritedFrom != "tank" {
+		t.Errorf("GetUserProperty() = %+v, want alice inherited from tank", prop)
+	}
+
+	props, err := c.ListUserProperties(ctx, "tank/home")
+	if err != nil {
+		t.Fatalf("ListUserProperties() error = %v", err)
+	}
+	if len(props) != 1 || props["com.example:owner"].Value != "alice" {
+		t.Errorf("ListUserProperties() = %+v, want only com.example:owner", props)
+	}
+
+	if prop, err := c.GetUserProperty(ctx, "tank", "com.example:unset"); err != nil || prop.Value != "" || prop.Source != PropertySourceNone {
+		t.Errorf("GetUserProperty() of an unset property = %+v, %v, want an empty value with no source", prop, err)
+	}
+	if _, err := c.GetUserProperty(ctx, "tank", PropertyNameCompression); err == nil {
+		t.Error("GetUserProperty() of a native property should fail")
+	}
+
+	if err := c.InheritUserProperty(ctx, "tank", "com.example:owner", false); err != nil {
+		t.Fatalf("InheritUserProperty() error = %v", err)
+	}
+	if prop, err := c.GetUserProperty(ctx, "tank/home", "com.example:owner"); err != nil || prop.Source != PropertySourceNone {
+		t.Errorf("GetUserProperty() after InheritUserProperty() = %+v, %v, want it unset", prop, err)
+	}
+	if err := c.InheritUserProperty(ctx, "tank", PropertyNameCompression, false); err == nil {
+		t.Error("InheritUserProperty() of a native property should fail")
+	}
+}
@@ -1,5 +1,3 @@
-//go:build freebsd
-
 package zfs
 
 import (
@@ -12,54 +10,86 @@ import (
 
 // Client provides access to ZFS dataset operations
 type Client struct {
-	d driver.Driver
+	d        driver.Driver
+	sel      driver.Selection
+	injected bool // The driver came from WithDriver and belongs to the caller
 }
 
 // Option configures Client creation
 type Option func(*config)
 
 type config struct {
-	useLibzfs bool
+	mode   driver.Mode
+	driver driver.Driver
 }
 
-// WithLibZFS forces the use of libzfs driver (default)
+// WithLibZFS forces the use of libzfs driver without falling back to ioctl
+// (default)
 func WithLibZFS() Option {
 	return func(c *config) {
-		c.useLibzfs = true
+		c.mode = driver.ModeLibZFS
 	}
 }
 
-// WithIoctlOnly forces the use of ioctl-only driver
+// WithIoctlOnly forces the use of ioctl-only driver without falling back to libzfs
 func WithIoctlOnly() Option {
 	return func(c *config) {
-		c.useLibzfs = false
+		c.mode = driver.ModeIoctl
+	}
+}
+
+// WithAutoDriver tries libzfs first and falls back to the ioctl driver
+// when libzfs is not built in or cannot be initialized. With preferIoctl
+// set the order is reversed.
+func WithAutoDriver(preferIoctl bool) Option {
+	return func(c *config) {
+		if preferIoctl {
+			c.mode = driver.ModeAutoIoctl
+		} else {
+			c.mode = driver.ModeAuto
+		}
+	}
+}
+
+// WithDriver injects a driver implementation, such as the in-memory
+// driver from the zfstest package. The driver stays owned by the caller:
+// Client.Close does not close it, so it can be shared between clients.
+func WithDriver(d driver.Driver) Option {
+	return func(c *config) {
+		c.driver = d
 	}
 }
 
 // New creates a new ZFS dataset client
 func New(ctx context.Context, opts ...Option) (*Client, error) {
-	cfg := config{useLibzfs: true}
+	cfg := config{mode: driver.ModeLibZFS}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
-	var d driver.Driver
-	var err error
+	if cfg.driver != nil {
+		return &Client{d: cfg.driver, sel: driver.Injected(), injected: true}, nil
+	}
 
-	d, err = driver.NewLibZFS()
+	d, sel, err := driver.Open(cfg.mode)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize libzfs driver: %w", err)
+		return nil, err
 	}
 
-	return &Client{d: d}, nil
+	return &Client{d: d, sel: sel}, nil
 }
 
-// Close releases resources held by the client
+// Close releases resources held by the client. A driver injected with
+// WithDriver is left open, only the client stops using it.
 func (c *Client) Close() error {
-	if c.d != nil {
-		return c.d.Close()
+	if c.d == nil {
+		return nil
 	}
-	return nil
+	if c.injected {
+		c.d = nil
+		return nil
+	}
+	return c.d.Close()
 }
 
 // Dataset represents a ZFS dataset (filesystem, volume, snapshot, or bookmark)
@@ -172,10 +202,14 @@ func (c *Client) Get(ctx context.Context, name string) (*Dataset, error) {
 
 // Property represents a dataset property with its value and metadata
 type Property[T any] struct {
-	Name     string
-	Value    T
-	Source   PropertySource
-	Received bool
+	Name             string
+	Value            T
+	Display          string // Human readable value, as zfs get prints it
+	Source           PropertySource
+	Received         bool   // Value is the received value
+	InheritedFrom    string // Dataset the value is inherited from, when Source is PropertySourceInherited
+	ReceivedValue    T      // Value set by zfs receive, even when overridden locally
+	HasReceivedValue bool   // A received value exists
 }
 
 // PropertySource indicates where a property value originates
@@ -187,6 +221,7 @@ const (
 	PropertySourceDefault   PropertySource = "default"
 	PropertySourceTemporary PropertySource = "temporary"
 	PropertySourceReceived  PropertySource = "received"
+	PropertySourceNone      PropertySource = "none" // Read-only statistics
 )
 
 // Common dataset property names
@@ -247,7 +282,13 @@ const (
 	PropertyNameKeystatus     = "keystatus"
 )
 
-// GetProperties retrieves multiple properties for a dataset
+// GetProperties retrieves multiple properties for a dataset. Names may be
+// any native property or its short alias and results are keyed by the name
+// requested. Properties that do not apply to the dataset type are left out,
+// names that are not properties at all fail with errors.ErrUnknownProperty.
+// With no names every native property of the dataset is returned. Values
+// are the human readable strings zfs get prints, use GetTypedProperties or
+// GetProperty for exact values.
 func (c *Client) GetProperties(ctx context.Context, datasetName string, propNames ...string) (map[string]Property[any], error) {
 	if c.d == nil {
 		return nil, fmt.Errorf("client is closed")
@@ -261,10 +302,14 @@ func (c *Client) GetProperties(ctx context.Context, datasetName string, propName
 	properties := make(map[string]Property[any])
 	for name, info := range propInfos {
 		prop := Property[any]{
-			Name:     info.Name,
-			Value:    info.Value,
-			Source:   PropertySource(info.Source.String()),
-			Received: info.Received,
+			Name:             info.Name,
+			Value:            info.Value,
+			Display:          fmt.Sprint(info.Value),
+			Source:           PropertySource(info.Source.String()),
+			Received:         info.Received,
+			InheritedFrom:    info.InheritedFrom,
+			ReceivedValue:    info.ReceivedValue,
+			HasReceivedValue: info.ReceivedValue != nil,
 		}
 		properties[name] = prop
 	}
@@ -272,6 +317,12 @@ func (c *Client) GetProperties(ctx context.Context, datasetName string, propName
 	return properties, nil
 }
 
+// GetAllProperties retrieves every native property that applies to a
+// dataset and every user property set on or inherited by it, like zfs get all
+func (c *Client) GetAllProperties(ctx context.Context, datasetName string) (map[string]Property[any], error) {
+	return c.GetProperties(ctx, datasetName)
+}
+
 // GetStringProperty retrieves a string property value
 func (c *Client) GetStringProperty(ctx context.Context, datasetName, propName string) (string, error) {
 	props, err := c.GetProperties(ctx, datasetName, propName)
@@ -291,9 +342,10 @@ func (c *Client) GetStringProperty(ctx context.Context, datasetName, propName st
 	return fmt.Sprintf("%v", prop.Value), nil
 }
 
-// GetUint64Property retrieves a uint64 property value
+// GetUint64Property retrieves the exact value of a numeric property, such
+// as a byte count
 func (c *Client) GetUint64Property(ctx context.Context, datasetName, propName string) (uint64, error) {
-	props, err := c.GetProperties(ctx, datasetName, propName)
+	props, err := c.GetTypedProperties(ctx, datasetName, propName)
 	if err != nil {
 		return 0, err
 	}
@@ -336,6 +388,18 @@ func (c *Client) SetProperty(ctx context.Context, datasetName, propName, propVal
 	return c.d.SetDatasetProp(ctx, datasetName, propName, propValue)
 }
 
+// SetProperties sets several properties in a single update, like zfs set
+// with several name=value pairs. Every property is validated first; when
+// any is rejected nothing is applied and the error is an
+// *errors.PropertyErrors listing each rejected property.
+func (c *Client) SetProperties(ctx context.Context, datasetName string, props map[string]string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	return c.d.SetDatasetProps(ctx, datasetName, props)
+}
+
 // SetStringProperty sets a string property on a dataset
 func (c *Client) SetStringProperty(ctx context.Context, datasetName, propName, propValue string) error {
 	return c.SetProperty(ctx, datasetName, propName, propValue)
@@ -350,6 +414,31 @@ func (c *Client) SetBoolProperty(ctx context.Context, datasetName, propName stri
 	return c.SetProperty(ctx, datasetName, propName, value)
 }
 
+// InheritOptions represents options for clearing a property
+type InheritOptions struct {
+	Recursive bool // Also clear the property on every descendant (zfs inherit -r)
+	Received  bool // Revert to the received value, if any, instead of inheriting (zfs inherit -S)
+}
+
+// InheritProperty clears the local value of a property so that it is
+// inherited from the parent dataset, or the default when no ancestor sets
+// it, like zfs inherit. With Received the property reverts to the value
+// set by zfs receive when there is one.
+func (c *Client) InheritProperty(ctx context.Context, datasetName, propName string, opts InheritOptions) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	err := c.d.InheritDatasetProp(ctx, datasetName, propName, driver.InheritOptions{
+		Recursive: opts.Recursive,
+		Received:  opts.Received,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inherit property: %w", err)
+	}
+	return nil
+}
+
 // Snapshot represents a ZFS snapshot
 type Snapshot struct {
 	Dataset
@@ -487,6 +576,13 @@ func (c *Client) RuntimeInfo(ctx context.Context) (impl, zfsVersion, kernelVersi
 	return c.d.RuntimeInfo(ctx)
 }
 
+// Backend reports which driver implementation the client uses ("libzfs",
+// "ioctl", "stub", or "custom" for a driver passed to WithDriver) and why
+// it was selected
+func (c *Client) Backend() (impl, reason string) {
+	return c.sel.Impl, c.sel.Reason
+}
+
 // Clone represents a ZFS clone with its relationship information
 type Clone struct {
 	Dataset
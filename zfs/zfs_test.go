@@ -0,0 +1,46 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+	"github.com/zombocoder/go-freebsd-libzfs/zfstest"
+)
+
+// newTestClient returns a client on a fake driver with a pool named tank
+func newTestClient(t *testing.T) (*Client, *zfstest.FakeDriver) {
+	t.Helper()
+
+	ctx := context.Background()
+	d := zfstest.NewFakeDriver()
+	if err := d.CreatePool(ctx, "tank", []driver.VdevSpec{{Devices: []string{"/dev/ada0"}}}, driver.CreateOptions{}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	c, err := New(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, d
+}
+
+func TestClose_InjectedDriver(t *testing.T) {
+	ctx := context.Background()
+	c, d := newTestClient(t)
+	other, err := New(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := c.List(ctx, true); err == nil {
+		t.Error("List() on a closed client should fail")
+	}
+	// The shared driver stays usable by other clients
+	if _, err := other.List(ctx, true); err != nil {
+		t.Errorf("List() on another client after Close() error = %v", err)
+	}
+}
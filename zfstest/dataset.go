@@ -0,0 +1,679 @@
+package zfstest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+func (d *FakeDriver) ListDatasets(ctx context.Context, recursive bool) ([]driver.DatasetInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var datasets []driver.DatasetInfo
+	for _, ds := range d.allDatasets() {
+		if ds.typ == driver.DatasetSnapshot {
+			continue
+		}
+		if !recursive && strings.Contains(ds.name, "/") {
+			continue
+		}
+		datasets = append(datasets, ds.info())
+	}
+	return datasets, nil
+}
+
+func (d *FakeDriver) ListDatasetsInPool(ctx context.Context, poolName string, recursive bool) ([]driver.DatasetInfo, error) {
+	datasets, err := d.ListDatasets(ctx, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var poolDatasets []driver.DatasetInfo
+	for _, ds := range datasets {
+		if ds.Name == poolName || strings.HasPrefix(ds.Name, poolName+"/") {
+			poolDatasets = append(poolDatasets, ds)
+		}
+	}
+	return poolDatasets, nil
+}
+
+func (d *FakeDriver) ListDatasetsByType(ctx context.Context, dsType *driver.DatasetType, recursive bool) ([]driver.DatasetInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var datasets []driver.DatasetInfo
+	for _, ds := range d.allDatasets() {
+		if dsType != nil && ds.typ != *dsType {
+			continue
+		}
+		datasets = append(datasets, ds.info())
+	}
+	return datasets, nil
+}
+
+func (d *FakeDriver) GetDatasetProps(ctx context.Context, datasetName string, propNames []string) (map[string]driver.PropertyInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(propNames) == 0 {
+		propNames = pool.propNames(ds)
+	}
+
+	properties := make(map[string]driver.PropertyInfo)
+	for _, name := range propNames {
+		if !isUserProp(name) {
+			if _, known := driver.CanonicalDatasetProp(name); !known {
+				return nil, driver.UnknownPropertyError(datasetName, name)
+			}
+			if !driver.DatasetPropApplies(name, ds.typ) {
+				continue
+			}
+		}
+		if info, ok := pool.resolveProp(ds, name); ok {
+			info.Raw = info.Value
+			if raw, err := driver.ParseDatasetPropValue(name, info.Value.(string)); err == nil {
+				info.Raw = raw
+			}
+			properties[name] = info
+		}
+	}
+	return properties, nil
+}
+
+func (d *FakeDriver) SetDatasetProp(ctx context.Context, datasetName, propName, propValue string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	_, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return err
+	}
+	if err := driver.ValidateDatasetProp(ds.name, ds.typ, propName, propValue); err != nil {
+		return err
+	}
+
+	ds.props[canonicalProp(propName)] = propValue
+	return nil
+}
+
+func (d *FakeDriver) SetDatasetProps(ctx context.Context, datasetName string, props map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	_, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return err
+	}
+	if err := driver.ValidateDatasetProps(ds.name, ds.typ, props); err != nil {
+		return err
+	}
+
+	for name, value := range props {
+		ds.props[canonicalProp(name)] = value
+	}
+	return nil
+}
+
+// InheritDatasetProp clears a property. The fake never receives streams,
+// so reverting to the received value clears it like a plain inherit.
+func (d *FakeDriver) InheritDatasetProp(ctx context.Context, datasetName, propName string, opts driver.InheritOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return err
+	}
+	if err := validateInheritProp(ds, propName, opts.Received); err != nil {
+		return err
+	}
+
+	name := canonicalProp(propName)
+	delete(ds.props, name)
+	if opts.Recursive {
+		for childName, child := range pool.datasets {
+			if strings.HasPrefix(childName, datasetName+"/") || strings.HasPrefix(childName, datasetName+"@") {
+				delete(child.props, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *FakeDriver) CreateDataset(ctx context.Context, datasetName string, dsType driver.DatasetType, props map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	if dsType != driver.DatasetFilesystem && dsType != driver.DatasetVolume {
+		return invalid("create_dataset", datasetName, fmt.Sprintf("unsupported dataset type: %v", dsType))
+	}
+	if dsType == driver.DatasetVolume && props["volsize"] == "" {
+		return invalid("create_dataset", datasetName, "volume size must be specified")
+	}
+
+	pool, err := d.prepareNewDataset("create_dataset", datasetName)
+	if err != nil {
+		return err
+	}
+
+	ds := &fakeDataset{name: datasetName, typ: dsType}
+	if ds.props, err = datasetProps(ds, props); err != nil {
+		return err
+	}
+
+	d.txg++
+	ds.guid = d.newGUID()
+	ds.txg = d.txg
+	pool.datasets[datasetName] = ds
+	pool.logEvent(d.txg, "create", datasetName, "")
+	return nil
+}
+
+func (d *FakeDriver) DestroyDataset(ctx context.Context, datasetName string, recursive bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return err
+	}
+	if ds.typ == driver.DatasetSnapshot {
+		return pool.destroySnapshot(ds)
+	}
+	if ds.name == pool.name {
+		return invalid("destroy_dataset", datasetName, "operation does not apply to pools")
+	}
+
+	return pool.destroyTree(ds, recursive)
+}
+
+// Snapshot operations
+
+func (d *FakeDriver) CreateSnapshot(ctx context.Context, snapshotName string, recursive bool, props map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	if err := validateDatasetName(snapshotName, true); err != nil {
+		return err
+	}
+	parent, snap, ok := strings.Cut(snapshotName, "@")
+	if !ok {
+		return invalid("create_snapshot", snapshotName, "snapshot name must contain '@'")
+	}
+
+	pool, parentDS, err := d.dataset(parent)
+	if err != nil {
+		return err
+	}
+
+	targets := []*fakeDataset{parentDS}
+	if recursive {
+		targets = pool.descendants(parentDS)
+	}
+	for _, target := range targets {
+		if _, exists := pool.datasets[target.name+"@"+snap]; exists {
+			return zfserrors.NewZfsError("create_snapshot", target.name+"@"+snap, zfserrors.ErrCodeExists,
+				errnoExist, "snapshot already exists", nil)
+		}
+	}
+	snapProps, err := datasetProps(&fakeDataset{name: snapshotName, typ: driver.DatasetSnapshot}, props)
+	if err != nil {
+		return err
+	}
+
+	// All snapshots in a recursive request share a single txg
+	d.txg++
+	for _, target := range targets {
+		name := target.name + "@" + snap
+		pool.datasets[name] = &fakeDataset{
+			name:  name,
+			typ:   driver.DatasetSnapshot,
+			guid:  d.newGUID(),
+			txg:   d.txg,
+			props: copyProps(snapProps),
+		}
+		pool.logEvent(d.txg, "snapshot", name, "")
+	}
+	return nil
+}
+
+func (d *FakeDriver) DestroySnapshot(ctx context.Context, snapshotName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, ds, err := d.dataset(snapshotName)
+	if err != nil {
+		return err
+	}
+	if ds.typ != driver.DatasetSnapshot {
+		return invalid("destroy_snapshot", snapshotName, "not a snapshot")
+	}
+
+	return pool.destroySnapshot(ds)
+}
+
+func (d *FakeDriver) RollbackToSnapshot(ctx context.Context, datasetName, snapshotName string, force bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return err
+	}
+	_, snap, err := d.dataset(snapshotName)
+	if err != nil {
+		return err
+	}
+	if ds.typ == driver.DatasetSnapshot || snap.typ != driver.DatasetSnapshot || snapParent(snap.name) != ds.name {
+		return invalid("rollback", snapshotName, fmt.Sprintf("snapshot does not belong to %s", datasetName))
+	}
+
+	var newer []*fakeDataset
+	for _, other := range pool.snapshotsOf(ds) {
+		if other.txg > snap.txg {
+			newer = append(newer, other)
+		}
+	}
+
+	if len(newer) > 0 {
+		if !force {
+			return zfserrors.NewZfsError("rollback", datasetName, zfserrors.ErrCodeExists, errnoExist,
+				fmt.Sprintf("more recent snapshots than %s exist", snapshotName), nil)
+		}
+		for _, other := range newer {
+			if clones := pool.clonesOf(other.name); len(clones) > 0 {
+				return busy("rollback", other.name, "snapshot has dependent clones")
+			}
+		}
+		for _, other := range newer {
+			delete(pool.datasets, other.name)
+		}
+	}
+	return nil
+}
+
+// Clone operations
+
+func (d *FakeDriver) CreateClone(ctx context.Context, snapshotName, cloneName string, props map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	snapPool, snap, err := d.dataset(snapshotName)
+	if err != nil {
+		return err
+	}
+	if snap.typ != driver.DatasetSnapshot {
+		return invalid("create_clone", snapshotName, "origin is not a snapshot")
+	}
+
+	pool, err := d.prepareNewDataset("create_clone", cloneName)
+	if err != nil {
+		return err
+	}
+	if pool != snapPool {
+		return zfserrors.NewZfsError("create_clone", cloneName, zfserrors.ErrCodeCrossDevice, 18,
+			"clone must be in the same pool as its origin", nil)
+	}
+
+	clone := &fakeDataset{
+		name:   cloneName,
+		typ:    pool.datasets[snapParent(snapshotName)].typ,
+		origin: snapshotName,
+	}
+	if clone.props, err = datasetProps(clone, props); err != nil {
+		return err
+	}
+
+	d.txg++
+	clone.guid = d.newGUID()
+	clone.txg = d.txg
+	pool.datasets[cloneName] = clone
+	return nil
+}
+
+func (d *FakeDriver) PromoteClone(ctx context.Context, cloneName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, clone, err := d.dataset(cloneName)
+	if err != nil {
+		return err
+	}
+	if clone.origin == "" {
+		return invalid("promote_clone", cloneName, "not a cloned filesystem")
+	}
+
+	origin := pool.datasets[clone.origin]
+	originFS := pool.datasets[snapParent(clone.origin)]
+
+	// Snapshots up to and including the origin move to the promoted clone
+	var moving []*fakeDataset
+	for _, snap := range pool.snapshotsOf(originFS) {
+		if snap.txg <= origin.txg {
+			moving = append(moving, snap)
+		}
+	}
+	for _, snap := range moving {
+		target := clone.name + "@" + snapName(snap.name)
+		if _, exists := pool.datasets[target]; exists {
+			return zfserrors.NewZfsError("promote_clone", cloneName, zfserrors.ErrCodeExists, errnoExist,
+				fmt.Sprintf("snapshot name collision: %s", target), nil)
+		}
+	}
+
+	renamed := make(map[string]string, len(moving))
+	for _, snap := range moving {
+		oldName := snap.name
+		delete(pool.datasets, oldName)
+		snap.name = clone.name + "@" + snapName(oldName)
+		pool.datasets[snap.name] = snap
+		renamed[oldName] = snap.name
+	}
+
+	newOrigin := renamed[clone.origin]
+	clone.origin = originFS.origin
+	originFS.origin = newOrigin
+	for _, ds := range pool.datasets {
+		if to, ok := renamed[ds.origin]; ok && ds != originFS {
+			ds.origin = to
+		}
+	}
+	return nil
+}
+
+func (d *FakeDriver) GetCloneInfo(ctx context.Context, datasetName string) (*driver.CloneInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, ds, err := d.dataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &driver.CloneInfo{
+		Name:    datasetName,
+		Origin:  ds.origin,
+		IsClone: ds.origin != "",
+	}
+	if ds.typ == driver.DatasetSnapshot {
+		info.Dependents = pool.clonesOf(ds.name)
+		info.CloneCount = len(info.Dependents)
+	}
+	return info, nil
+}
+
+func (d *FakeDriver) ListClones(ctx context.Context, snapshotName string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, ds, err := d.dataset(snapshotName)
+	if err != nil {
+		return nil, err
+	}
+	if ds.typ != driver.DatasetSnapshot {
+		return nil, invalid("list_clones", snapshotName, "not a snapshot")
+	}
+	return pool.clonesOf(ds.name), nil
+}
+
+func (d *FakeDriver) DestroyClone(ctx context.Context, cloneName string, force bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, ds, err := d.dataset(cloneName)
+	if err != nil {
+		return err
+	}
+	if !force && ds.origin == "" {
+		return invalid("destroy_clone", cloneName, fmt.Sprintf("dataset %s is not a clone", cloneName))
+	}
+
+	return pool.destroyTree(ds, false)
+}
+
+// Dataset helpers
+
+func (d *FakeDriver) dataset(name string) (*fakePool, *fakeDataset, error) {
+	pool, ok := d.pools[poolOf(name)]
+	if !ok {
+		return nil, nil, datasetNotFound(name)
+	}
+	ds, ok := pool.datasets[name]
+	if !ok {
+		return nil, nil, datasetNotFound(name)
+	}
+	return pool, ds, nil
+}
+
+// Helper function to validate a new filesystem, volume or clone name
+func (d *FakeDriver) prepareNewDataset(op, name string) (*fakePool, error) {
+	if err := validateDatasetName(name, false); err != nil {
+		return nil, err
+	}
+
+	parentName, _, ok := cutLast(name, "/")
+	if !ok {
+		return nil, invalid(op, name, "missing dataset name; use zpool create for pools")
+	}
+
+	pool, parent, err := d.dataset(parentName)
+	if err != nil {
+		return nil, zfserrors.NewZfsError("get_dataset", name, zfserrors.ErrCodeNotFound, errnoNoEnt,
+			fmt.Sprintf("parent %s does not exist", parentName), err)
+	}
+	if parent.typ != driver.DatasetFilesystem {
+		return nil, invalid(op, name, fmt.Sprintf("parent %s is not a filesystem", parentName))
+	}
+	if _, exists := pool.datasets[name]; exists {
+		return nil, zfserrors.NewZfsError(op, name, zfserrors.ErrCodeExists, errnoExist,
+			"dataset already exists", nil)
+	}
+	return pool, nil
+}
+
+func (d *FakeDriver) allDatasets() []*fakeDataset {
+	var datasets []*fakeDataset
+	for _, pool := range d.pools {
+		for _, ds := range pool.datasets {
+			datasets = append(datasets, ds)
+		}
+	}
+	sort.Slice(datasets, func(i, j int) bool { return datasets[i].name < datasets[j].name })
+	return datasets
+}
+
+// Helper function to return a dataset and every dataset below it, excluding snapshots
+func (p *fakePool) descendants(ds *fakeDataset) []*fakeDataset {
+	var result []*fakeDataset
+	for _, other := range p.datasets {
+		if other.typ == driver.DatasetSnapshot {
+			continue
+		}
+		if other == ds || strings.HasPrefix(other.name, ds.name+"/") {
+			result = append(result, other)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+func (p *fakePool) snapshotsOf(ds *fakeDataset) []*fakeDataset {
+	var snapshots []*fakeDataset
+	for _, other := range p.datasets {
+		if other.typ == driver.DatasetSnapshot && snapParent(other.name) == ds.name {
+			snapshots = append(snapshots, other)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].txg < snapshots[j].txg })
+	return snapshots
+}
+
+func (p *fakePool) clonesOf(snapshotName string) []string {
+	var clones []string
+	for _, ds := range p.datasets {
+		if ds.origin == snapshotName {
+			clones = append(clones, ds.name)
+		}
+	}
+	sort.Strings(clones)
+	return clones
+}
+
+func (p *fakePool) destroySnapshot(snap *fakeDataset) error {
+	if clones := p.clonesOf(snap.name); len(clones) > 0 {
+		return busy("destroy_snapshot", snap.name,
+			fmt.Sprintf("snapshot has dependent clones: %s", strings.Join(clones, ", ")))
+	}
+	delete(p.datasets, snap.name)
+	return nil
+}
+
+// Helper function to destroy a filesystem or volume, optionally with its descendants
+func (p *fakePool) destroyTree(ds *fakeDataset, recursive bool) error {
+	doomed := make(map[string]*fakeDataset)
+	for _, other := range p.datasets {
+		if other == ds || strings.HasPrefix(other.name, ds.name+"/") || strings.HasPrefix(other.name, ds.name+"@") {
+			doomed[other.name] = other
+		}
+	}
+
+	if !recursive && len(doomed) > 1 {
+		return busy("destroy_dataset", ds.name, "filesystem has children; use recursive destroy")
+	}
+
+	for _, other := range doomed {
+		if other.typ != driver.DatasetSnapshot {
+			continue
+		}
+		for _, clone := range p.clonesOf(other.name) {
+			if _, ok := doomed[clone]; !ok {
+				return busy("destroy_dataset", ds.name,
+					fmt.Sprintf("snapshot %s has dependent clone %s", other.name, clone))
+			}
+		}
+	}
+
+	for name := range doomed {
+		delete(p.datasets, name)
+	}
+	return nil
+}
+
+func (ds *fakeDataset) info() driver.DatasetInfo {
+	return driver.DatasetInfo{Name: ds.name, Type: ds.typ, GUID: ds.guid}
+}
+
+func poolOf(name string) string {
+	end := strings.IndexAny(name, "/@#")
+	if end < 0 {
+		return name
+	}
+	return name[:end]
+}
+
+func snapParent(name string) string {
+	parent, _, _ := strings.Cut(name, "@")
+	return parent
+}
+
+func snapName(name string) string {
+	_, snap, _ := strings.Cut(name, "@")
+	return snap
+}
+
+// Helper function to validate creation-time properties and canonicalize their names
+func datasetProps(ds *fakeDataset, props map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(props))
+	for name, value := range props {
+		if err := validateSetProp(ds, name, value); err != nil {
+			return nil, err
+		}
+		result[canonicalProp(name)] = value
+	}
+	return result, nil
+}
+
+// copyDatasets returns a deep copy of the datasets of a pool
+func copyDatasets(datasets map[string]*fakeDataset) map[string]*fakeDataset {
+	result := make(map[string]*fakeDataset, len(datasets))
+	for name, ds := range datasets {
+		copied := *ds
+		copied.props = copyProps(ds.props)
+		result[name] = &copied
+	}
+	return result
+}
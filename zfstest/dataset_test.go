@@ -0,0 +1,272 @@
+package zfstest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+func TestFakeDriver_CreateDatasetRequiresParent(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	err := d.CreateDataset(ctx, "tank/a/b", driver.DatasetFilesystem, nil)
+	if !zfserrors.IsDatasetNotFound(err) {
+		t.Errorf("CreateDataset() without parent error = %v, want dataset not found", err)
+	}
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a/b", driver.DatasetFilesystem, nil))
+
+	if err := d.CreateDataset(ctx, "tank/a", driver.DatasetFilesystem, nil); !zfserrors.IsExists(err) {
+		t.Errorf("duplicate CreateDataset() error = %v, want EEXIST", err)
+	}
+	if err := d.CreateDataset(ctx, "tank/vol", driver.DatasetVolume, nil); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("CreateDataset() volume without volsize error = %v, want EINVAL", err)
+	}
+}
+
+func TestFakeDriver_CloneBlocksSnapshotDestroy(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/src", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank/src@base", false, nil))
+	mustNoErr(t, d.CreateClone(ctx, "tank/src@base", "tank/clone", nil))
+
+	if err := d.DestroySnapshot(ctx, "tank/src@base"); !zfserrors.IsBusy(err) {
+		t.Errorf("DestroySnapshot() with clone error = %v, want EBUSY", err)
+	}
+	if err := d.DestroyDataset(ctx, "tank/src", true); !zfserrors.IsBusy(err) {
+		t.Errorf("recursive DestroyDataset() with external clone error = %v, want EBUSY", err)
+	}
+
+	clones, err := d.ListClones(ctx, "tank/src@base")
+	mustNoErr(t, err)
+	if len(clones) != 1 || clones[0] != "tank/clone" {
+		t.Errorf("ListClones() = %v, want [tank/clone]", clones)
+	}
+
+	mustNoErr(t, d.DestroyClone(ctx, "tank/clone", false))
+	mustNoErr(t, d.DestroySnapshot(ctx, "tank/src@base"))
+}
+
+func TestFakeDriver_Rollback(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank@one", false, nil))
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank@two", false, nil))
+
+	if err := d.RollbackToSnapshot(ctx, "tank", "tank@one", false); !zfserrors.IsExists(err) {
+		t.Errorf("RollbackToSnapshot() to older snapshot error = %v, want EEXIST", err)
+	}
+	mustNoErr(t, d.RollbackToSnapshot(ctx, "tank", "tank@two", false))
+
+	mustNoErr(t, d.CreateClone(ctx, "tank@two", "tank/clone", nil))
+	if err := d.RollbackToSnapshot(ctx, "tank", "tank@one", true); !zfserrors.IsBusy(err) {
+		t.Errorf("forced RollbackToSnapshot() past cloned snapshot error = %v, want EBUSY", err)
+	}
+
+	mustNoErr(t, d.DestroyClone(ctx, "tank/clone", false))
+	mustNoErr(t, d.RollbackToSnapshot(ctx, "tank", "tank@one", true))
+
+	if _, _, err := d.dataset("tank@two"); err == nil {
+		t.Error("forced rollback should destroy newer snapshots")
+	}
+}
+
+func TestFakeDriver_PromoteClone(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/src", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank/src@a", false, nil))
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank/src@b", false, nil))
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank/src@c", false, nil))
+	mustNoErr(t, d.CreateClone(ctx, "tank/src@b", "tank/clone", nil))
+	mustNoErr(t, d.PromoteClone(ctx, "tank/clone"))
+
+	cloneInfo, err := d.GetCloneInfo(ctx, "tank/clone")
+	mustNoErr(t, err)
+	if cloneInfo.IsClone {
+		t.Errorf("promoted clone still has origin %q", cloneInfo.Origin)
+	}
+
+	srcInfo, err := d.GetCloneInfo(ctx, "tank/src")
+	mustNoErr(t, err)
+	if srcInfo.Origin != "tank/clone@b" {
+		t.Errorf("former origin Origin = %q, want tank/clone@b", srcInfo.Origin)
+	}
+
+	for _, name := range []string{"tank/clone@a", "tank/clone@b", "tank/src@c"} {
+		if _, _, err := d.dataset(name); err != nil {
+			t.Errorf("snapshot %s missing after promote: %v", name, err)
+		}
+	}
+}
+
+func TestFakeDriver_PropertyInheritance(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a", driver.DatasetFilesystem, map[string]string{"compression": "zstd"}))
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a/b", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank/a", "com.example:owner", "ops"))
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank/a", "quota", "10G"))
+
+	props, err := d.GetDatasetProps(ctx, "tank/a/b", []string{"compression", "com.example:owner", "quota", "mountpoint", "atime", "used"})
+	mustNoErr(t, err)
+
+	tests := []struct {
+		name          string
+		value         string
+		source        driver.PropSource
+		inheritedFrom string
+	}{
+		{"compression", "zstd", driver.PropSourceInherited, "tank/a"},
+		{"com.example:owner", "ops", driver.PropSourceInherited, "tank/a"},
+		{"quota", "none", driver.PropSourceDefault, ""},
+		{"mountpoint", "/tank/a/b", driver.PropSourceDefault, ""},
+		{"atime", "on", driver.PropSourceDefault, ""},
+		{"used", "0", driver.PropSourceNone, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prop, ok := props[test.name]
+			if !ok {
+				t.Fatalf("property %q missing", test.name)
+			}
+			if prop.Value != test.value || prop.Source != test.source {
+				t.Errorf("%s = %v (%v), want %v (%v)", test.name, prop.Value, prop.Source, test.value, test.source)
+			}
+			if prop.InheritedFrom != test.inheritedFrom {
+				t.Errorf("%s InheritedFrom = %q, want %q", test.name, prop.InheritedFrom, test.inheritedFrom)
+			}
+		})
+	}
+
+	if err := d.SetDatasetProp(ctx, "tank/a", "used", "1"); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("SetDatasetProp() on read-only property error = %v, want EINVAL", err)
+	}
+	if err := d.SetDatasetProp(ctx, "tank/a", "bogus", "1"); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("SetDatasetProp() on unknown property error = %v, want EINVAL", err)
+	}
+}
+
+func TestFakeDriver_InheritDatasetProp(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a/b", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank", "com.example:owner", "root"))
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank/a", "com.example:owner", "ops"))
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank/a/b", "com.example:owner", "dev"))
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank/a/b", "compress", "zstd"))
+
+	mustNoErr(t, d.InheritDatasetProp(ctx, "tank/a/b", "compress", driver.InheritOptions{}))
+	mustNoErr(t, d.InheritDatasetProp(ctx, "tank/a", "com.example:owner", driver.InheritOptions{Recursive: true}))
+
+	props, err := d.GetDatasetProps(ctx, "tank/a/b", []string{"compression", "com.example:owner"})
+	mustNoErr(t, err)
+	if prop := props["compression"]; prop.Value != "on" || prop.Source != driver.PropSourceDefault {
+		t.Errorf("compression = %v (%v), want on (default)", prop.Value, prop.Source)
+	}
+	if prop := props["com.example:owner"]; prop.Value != "root" || prop.InheritedFrom != "tank" {
+		t.Errorf("com.example:owner = %v from %q, want root from tank", prop.Value, prop.InheritedFrom)
+	}
+
+	for _, name := range []string{"used", "quota", "bogus", "com.Example:owner"} {
+		if err := d.InheritDatasetProp(ctx, "tank/a", name, driver.InheritOptions{}); errCode(err) != zfserrors.ErrCodeInval {
+			t.Errorf("InheritDatasetProp(%s) error = %v, want EINVAL", name, err)
+		}
+	}
+
+	// Reverting to the received value also works for non-inheritable properties
+	mustNoErr(t, d.SetDatasetProp(ctx, "tank/a", "quota", "1G"))
+	mustNoErr(t, d.InheritDatasetProp(ctx, "tank/a", "quota", driver.InheritOptions{Received: true}))
+	props, err = d.GetDatasetProps(ctx, "tank/a", []string{"quota"})
+	mustNoErr(t, err)
+	if prop := props["quota"]; prop.Value != "none" || prop.Source != driver.PropSourceDefault {
+		t.Errorf("quota = %v (%v), want none (default)", prop.Value, prop.Source)
+	}
+
+	if err := d.SetDatasetProp(ctx, "tank/a", "com.example:"+strings.Repeat("x", 300), "x"); errCode(err) != zfserrors.ErrCodeNameTooLong {
+		t.Errorf("SetDatasetProp() with long name error = %v, want ENAMETOOLONG", err)
+	}
+}
+
+func TestFakeDriver_SetDatasetProps(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/a", driver.DatasetFilesystem, nil))
+
+	err := d.SetDatasetProps(ctx, "tank/a", map[string]string{"quota": "10G", "compression": "bogus", "used": "1"})
+	propErrs, ok := zfserrors.AsPropertyErrors(err)
+	if !ok || len(propErrs.Errors) != 2 {
+		t.Fatalf("SetDatasetProps() error = %v, want compression and used rejected", err)
+	}
+	props, err := d.GetDatasetProps(ctx, "tank/a", []string{"quota"})
+	mustNoErr(t, err)
+	if props["quota"].Source != driver.PropSourceDefault {
+		t.Errorf("quota applied from a rejected batch: %v", props["quota"].Value)
+	}
+
+	mustNoErr(t, d.SetDatasetProps(ctx, "tank/a", map[string]string{"quota": "10G", "compress": "zstd", "com.example:owner": "ops"}))
+	props, err = d.GetDatasetProps(ctx, "tank/a", []string{"quota", "compression", "com.example:owner"})
+	mustNoErr(t, err)
+	for name, want := range map[string]string{"quota": "10G", "compression": "zstd", "com.example:owner": "ops"} {
+		if props[name].Value != want || props[name].Source != driver.PropSourceLocal {
+			t.Errorf("%s = %v (%v), want %s (local)", name, props[name].Value, props[name].Source, want)
+		}
+	}
+}
+
+func TestFakeDriver_GetDatasetPropsNames(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/vol", driver.DatasetVolume, map[string]string{"volsize": "1G"}))
+
+	if _, err := d.GetDatasetProps(ctx, "tank/vol", []string{"used", "bogus"}); !zfserrors.IsUnknownProperty(err) {
+		t.Errorf("GetDatasetProps() with unknown name error = %v, want unknown property", err)
+	}
+
+	props, err := d.GetDatasetProps(ctx, "tank/vol", []string{"avail", "mountpoint", "atime", "volmode"})
+	mustNoErr(t, err)
+	if _, ok := props["avail"]; !ok {
+		t.Error("alias avail missing")
+	}
+	for _, name := range []string{"mountpoint", "atime"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("volume reported filesystem property %s", name)
+		}
+	}
+
+	raw, err := d.GetDatasetProps(ctx, "tank/vol", []string{"volsize", "compressratio", "readonly", "compression"})
+	mustNoErr(t, err)
+	for name, want := range map[string]any{
+		"volsize":       uint64(1 << 30),
+		"compressratio": uint64(100),
+		"readonly":      false,
+		"compression":   "on",
+	} {
+		if raw[name].Raw != want {
+			t.Errorf("%s Raw = %#v, want %#v", name, raw[name].Raw, want)
+		}
+	}
+
+	all, err := d.GetDatasetProps(ctx, "tank", nil)
+	mustNoErr(t, err)
+	for name := range all {
+		if !driver.DatasetPropApplies(name, driver.DatasetFilesystem) {
+			t.Errorf("filesystem reported %s", name)
+		}
+	}
+}
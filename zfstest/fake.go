@@ -0,0 +1,326 @@
+// Package zfstest provides an in-memory ZFS driver for testing code built on
+// the zfs and zpool clients without a real ZFS installation.
+//
+// The fake driver models pools, datasets, snapshots, clones, properties and
+// vdev state, and enforces the naming and dependency rules libzfs applies:
+//
+//	d := zfstest.NewFakeDriver()
+//	pools, _ := zpool.New(ctx, zpool.WithDriver(d))
+//	datasets, _ := zfs.New(ctx, zfs.WithDriver(d))
+//
+// A single FakeDriver may be shared between several clients. It belongs to
+// the caller: closing a client leaves it open, FakeDriver.Close closes it.
+package zfstest
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// Errno values used by the fake driver, matching errors.MapErrno
+const (
+	errnoNoEnt    = 2
+	errnoIO       = 5
+	errnoBusy     = 16
+	errnoExist    = 17
+	errnoInval    = 22
+	errnoNotSup   = 45
+	errnoNameLong = 63
+)
+
+// maxNameLen mirrors ZFS_MAX_DATASET_NAME_LEN
+const maxNameLen = 256
+
+// fakeDiskSize is the nominal size of every fake leaf device
+const fakeDiskSize = 1 << 30
+
+// Vdev states reported by the fake driver
+const (
+	VdevStateOnline   = "ONLINE"
+	VdevStateOffline  = "OFFLINE"
+	VdevStateDegraded = "DEGRADED"
+	VdevStateFaulted  = "FAULTED"
+	VdevStateRemoved  = "REMOVED"
+	VdevStateUnavail  = "UNAVAIL"
+	VdevStateAvail    = "AVAIL" // Hot spare ready for use
+)
+
+// Pool states reported by the fake driver
+const (
+	poolStateActive    = "ACTIVE"
+	poolStateExported  = "EXPORTED"
+	poolStateDestroyed = "DESTROYED"
+)
+
+// FakeDriver is an in-memory implementation of the driver interface
+type FakeDriver struct {
+	mu       sync.Mutex
+	closed   bool
+	pools    map[string]*fakePool
+	detached []*fakePool // exported and destroyed pools available for import
+	features map[string]bool
+	compat   []string // Directories holding compatibility feature-set files
+	nextGUID uint64
+	txg      uint64
+}
+
+type fakePool struct {
+	name     string
+	guid     uint64
+	state    string
+	props    map[string]string
+	root     *fakeVdev
+	spares   []*fakeVdev
+	l2cache  []*fakeVdev
+	datasets map[string]*fakeDataset
+
+	scan       *driver.ScanInfo // Last scrub
+	errorScrub *driver.ScanInfo // Last error scrub
+
+	lost time.Duration // Transactions an import has to discard, set by DamagePool
+
+	checkpoint *fakeCheckpoint
+	removal    *driver.RemovalInfo // Last top-level vdev removal
+
+	history []driver.HistoryRecord // Offsets into the history are indexes
+}
+
+// fakeCheckpoint is the state of a pool when it was checkpointed
+type fakeCheckpoint struct {
+	created  time.Time
+	props    map[string]string
+	datasets map[string]*fakeDataset
+}
+
+type fakeVdev struct {
+	typ      string
+	class    string // Allocation class of top-level vdevs
+	draid    driver.DraidConfig
+	path     string
+	guid     uint64
+	state    string
+	errors   [3]uint64 // read, write and checksum errors
+	removing bool      // Top-level vdev whose data is being copied off
+	children []*fakeVdev
+
+	initialize driver.VdevProgress
+	trim       driver.VdevProgress
+}
+
+type fakeDataset struct {
+	name   string
+	typ    driver.DatasetType
+	guid   uint64
+	txg    uint64
+	origin string
+	props  map[string]string
+}
+
+// Ensure FakeDriver satisfies the driver interface
+var _ driver.Driver = (*FakeDriver)(nil)
+
+// NewFakeDriver creates an empty in-memory driver
+func NewFakeDriver() *FakeDriver {
+	features := make(map[string]bool, len(defaultFeatures))
+	for _, feature := range defaultFeatures {
+		features[feature] = true
+	}
+
+	return &FakeDriver{
+		pools:    make(map[string]*fakePool),
+		features: features,
+		compat:   driver.CompatibilityDirs,
+		nextGUID: 0x1000,
+	}
+}
+
+// SetFeature marks a feature as supported or unsupported
+func (d *FakeDriver) SetFeature(feature string, supported bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.features[feature] = supported
+}
+
+// SetCompatibilityDirs sets the directories the compatibility pool property
+// loads feature-set files from, instead of the system ones
+func (d *FakeDriver) SetCompatibilityDirs(dirs ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.compat = dirs
+}
+
+func (d *FakeDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	return nil
+}
+
+// Helper function to check the driver and context before an operation
+func (d *FakeDriver) check(ctx context.Context) error {
+	if d.closed {
+		return fmt.Errorf("driver is closed")
+	}
+	return ctx.Err()
+}
+
+func (d *FakeDriver) newGUID() uint64 {
+	d.nextGUID++
+	return d.nextGUID
+}
+
+func (d *FakeDriver) RuntimeInfo(ctx context.Context) (string, string, string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return "", "", "", err
+	}
+	return "fake", "OpenZFS 2.2 (fake)", runtime.GOOS, nil
+}
+
+// Feature and capability detection
+
+// defaultFeatures lists the features a fresh FakeDriver reports as supported
+var defaultFeatures = []string{
+	"pools", "datasets", "snapshots", "clones",
+	"async_destroy", "empty_bpobj", "lz4_compress", "spacemap_histogram",
+	"enabled_txg", "hole_birth", "extensible_dataset", "embedded_data",
+	"bookmarks", "filesystem_limits", "large_blocks", "large_dnode",
+	"sha512", "skein", "device_removal", "obsolete_counts",
+	"zpool_checkpoint", "spacemap_v2", "allocation_classes", "resilver_defer",
+	"bookmark_v2", "redaction_bookmarks", "redacted_datasets", "bookmark_written",
+	"log_spacemap", "livelist", "zstd_compress", "encryption",
+}
+
+func (d *FakeDriver) SupportsFeature(ctx context.Context, feature string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return false, err
+	}
+	return d.features[feature], nil
+}
+
+func (d *FakeDriver) GetAvailableFeatures(ctx context.Context) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var features []string
+	for _, feature := range sortedKeys(d.features) {
+		if d.features[feature] {
+			features = append(features, feature)
+		}
+	}
+	return features, nil
+}
+
+func (d *FakeDriver) GetSupportedCompressionAlgorithms(ctx context.Context) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	algorithms := []string{"off", "on", "lzjb", "gzip", "zle", "lz4"}
+	if d.features["zstd_compress"] {
+		algorithms = append(algorithms, "zstd")
+	}
+	return algorithms, nil
+}
+
+func (d *FakeDriver) GetZFSVersion(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return "", err
+	}
+	return "OpenZFS 2.2 (fake)", nil
+}
+
+// Lookup helpers
+
+func (d *FakeDriver) pool(poolName string) (*fakePool, error) {
+	pool, ok := d.pools[poolName]
+	if !ok {
+		return nil, poolNotFound(poolName)
+	}
+	return pool, nil
+}
+
+// Generic helpers
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func copyProps(props map[string]string) map[string]string {
+	result := make(map[string]string, len(props))
+	for key, value := range props {
+		result[key] = value
+	}
+	return result
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Error helpers
+
+func poolNotFound(poolName string) error {
+	return zfserrors.NewZfsError("get_pool", poolName, zfserrors.ErrCodeNotFound, errnoNoEnt,
+		"pool not found", nil)
+}
+
+func datasetNotFound(name string) error {
+	return zfserrors.NewZfsError("get_dataset", name, zfserrors.ErrCodeNotFound, errnoNoEnt,
+		"dataset does not exist", nil)
+}
+
+func vdevNotFound(op, poolName, device string) error {
+	return zfserrors.NewZfsError(op, poolName, zfserrors.ErrCodeNotFound, errnoNoEnt,
+		fmt.Sprintf("no such device in pool: %s", device), nil)
+}
+
+func noEntry(op, resource, detail string) error {
+	return zfserrors.NewZfsError(op, resource, zfserrors.ErrCodeNotFound, errnoNoEnt, detail, nil)
+}
+
+func invalid(op, resource, detail string) error {
+	return zfserrors.NewZfsError(op, resource, zfserrors.ErrCodeInval, errnoInval, detail, nil)
+}
+
+func busy(op, resource, detail string) error {
+	return zfserrors.NewZfsError(op, resource, zfserrors.ErrCodeBusy, errnoBusy, detail, nil)
+}
+
+func unsupported(op, resource, detail string) error {
+	return zfserrors.NewZfsError(op, resource, zfserrors.ErrCodeNotSupported, errnoNotSup, detail, nil)
+}
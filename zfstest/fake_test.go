@@ -0,0 +1,66 @@
+package zfstest
+
+import (
+	"context"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// newTestPool returns a fake driver with a single-disk pool named tank
+func newTestPool(t *testing.T) *FakeDriver {
+	t.Helper()
+
+	d := NewFakeDriver()
+	if err := d.CreatePool(context.Background(), "tank", disks("/dev/ada0"), driver.CreateOptions{}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	return d
+}
+
+func mustNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// disks returns a single-disk vdev spec for each path
+func disks(paths ...string) []driver.VdevSpec {
+	var specs []driver.VdevSpec
+	for _, path := range paths {
+		specs = append(specs, driver.VdevSpec{Type: driver.VdevTypeDisk, Devices: []string{path}})
+	}
+	return specs
+}
+
+// mirror returns a mirror vdev spec of paths
+func mirror(paths ...string) driver.VdevSpec {
+	return driver.VdevSpec{Type: driver.VdevTypeMirror, Devices: paths}
+}
+
+func errCode(err error) string {
+	if zfsErr, ok := zfserrors.AsZfsError(err); ok {
+		return zfsErr.Code
+	}
+	return ""
+}
+
+func TestFakeDriver_Closed(t *testing.T) {
+	d := NewFakeDriver()
+	mustNoErr(t, d.Close())
+
+	if _, err := d.ListPools(context.Background()); err == nil {
+		t.Error("ListPools() on closed driver should fail")
+	}
+}
+
+func TestFakeDriver_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewFakeDriver().ListPools(ctx); err != context.Canceled {
+		t.Errorf("ListPools() with canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,63 @@
+package zfstest
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// LogCommand records a command line in the history of a pool, as the zfs
+// and zpool commands do once they succeed
+func (d *FakeDriver) LogCommand(poolName, command string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	pool.history = append(pool.history, driver.HistoryRecord{
+		Time:    uint64(time.Now().Unix()),
+		Command: command,
+		Who:     uint64(os.Getuid()),
+		HasWho:  true,
+		Host:    host,
+	})
+	return nil
+}
+
+// GetPoolHistory returns the history records of a pool from offset on.
+// Pool creation, dataset and snapshot creation and pool property changes
+// are logged as internal events, commands by LogCommand.
+func (d *FakeDriver) GetPoolHistory(ctx context.Context, poolName string, offset uint64) ([]driver.HistoryRecord, uint64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset >= uint64(len(pool.history)) {
+		return nil, offset, nil
+	}
+	records := append([]driver.HistoryRecord(nil), pool.history[offset:]...)
+	return records, uint64(len(pool.history)), nil
+}
+
+// logEvent records an internal event in the history of the pool
+func (p *fakePool) logEvent(txg uint64, event, dataset, detail string) {
+	p.history = append(p.history, driver.HistoryRecord{
+		Time:    uint64(time.Now().Unix()),
+		TXG:     txg,
+		Event:   event,
+		Dataset: dataset,
+		Detail:  detail,
+	})
+}
@@ -0,0 +1,47 @@
+package zfstest
+
+import (
+	"context"
+	"testing"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+)
+
+func TestFakeDriver_PoolHistory(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+	mustNoErr(t, d.LogCommand("tank", "zpool create tank ada0"))
+
+	records, offset, err := d.GetPoolHistory(ctx, "tank", 0)
+	mustNoErr(t, err)
+	if len(records) != 2 || records[0].Event != "create" || records[1].Command != "zpool create tank ada0" {
+		t.Fatalf("GetPoolHistory() = %+v, want the create event and command", records)
+	}
+	if !records[1].HasWho || records[0].HasWho {
+		t.Errorf("GetPoolHistory() who = %v, %v, want it on commands only", records[0].HasWho, records[1].HasWho)
+	}
+
+	// Polling from the returned offset only returns newer records
+	records, next, err := d.GetPoolHistory(ctx, "tank", offset)
+	mustNoErr(t, err)
+	if len(records) != 0 || next != offset {
+		t.Errorf("GetPoolHistory(%d) = %+v, %d, want nothing new", offset, records, next)
+	}
+	mustNoErr(t, d.CreateSnapshot(ctx, "tank@now", false, nil))
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "autotrim", "on"))
+	records, next, err = d.GetPoolHistory(ctx, "tank", offset)
+	mustNoErr(t, err)
+	if len(records) != 2 || next <= offset {
+		t.Fatalf("GetPoolHistory(%d) = %+v, %d, want two new records", offset, records, next)
+	}
+	if records[0].Event != "snapshot" || records[0].Dataset != "tank@now" || records[0].TXG == 0 {
+		t.Errorf("snapshot record = %+v", records[0])
+	}
+	if records[1].Event != "set" || records[1].Detail != "autotrim=on" {
+		t.Errorf("set record = %+v", records[1])
+	}
+
+	if _, _, err := d.GetPoolHistory(ctx, "missing", 0); !zfserrors.IsPoolNotFound(err) {
+		t.Errorf("GetPoolHistory(missing) error = %v, want pool not found", err)
+	}
+}
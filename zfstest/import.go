@@ -0,0 +1,234 @@
+package zfstest
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// DamagePool makes an exported pool fail to import until a rewind discards
+// its last lost worth of transactions
+func (d *FakeDriver) DamagePool(poolName string, lost time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, pool := range d.detached {
+		if pool.name == poolName && pool.state == poolStateExported {
+			pool.lost = lost
+			return nil
+		}
+	}
+	return poolNotFound(poolName)
+}
+
+// DiscoverPools returns the exported and destroyed pools. The fake has no
+// cachefiles, so CacheFile is ignored.
+func (d *FakeDriver) DiscoverPools(ctx context.Context, opts driver.DiscoverOptions) ([]driver.ImportablePool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var pools []driver.ImportablePool
+	for _, pool := range d.detached {
+		if !pool.importable(opts.Pool, opts.Destroyed, opts.SearchPaths) {
+			continue
+		}
+		importable := driver.ImportablePool{
+			PoolStatus: driver.PoolStatus{
+				PoolInfo: driver.PoolInfo{
+					Name:   pool.name,
+					GUID:   pool.guid,
+					Health: pool.root.state,
+					State:  pool.state,
+				},
+				Vdevs:   pool.root.info(0),
+				Spares:  auxInfo(pool.spares),
+				L2Cache: auxInfo(pool.l2cache),
+			},
+		}
+		if pool.lost != 0 {
+			importable.Health = VdevStateFaulted
+		}
+		pool.walkDevices(func(leaf *fakeVdev) {
+			importable.DevicePaths = append(importable.DevicePaths, leaf.path)
+		})
+		pools = append(pools, importable)
+	}
+	return pools, nil
+}
+
+// ImportPool imports an exported or destroyed pool. A pool damaged with
+// DamagePool needs a rewind, which a dry run reports without importing.
+func (d *FakeDriver) ImportPool(ctx context.Context, poolName string, opts driver.ImportOptions) (*driver.RewindReport, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	rewind := opts.Rewind || opts.MaxTxg != 0
+	if opts.RewindToCheckpoint && (rewind || opts.DryRun || opts.ExtremeRewind) {
+		return nil, invalid("import_pool", poolName, "rewind to checkpoint cannot be combined with a txg rewind")
+	}
+	if !rewind && (opts.DryRun || opts.ExtremeRewind) {
+		return nil, invalid("import_pool", poolName, "dry run and extreme rewind are only meaningful with rewind")
+	}
+	for name, value := range opts.Properties {
+		if err := driver.ValidatePoolImportProp(poolName, name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	index := -1
+	for i, pool := range d.detached {
+		if !pool.importable(poolName, opts.Destroyed, opts.SearchPaths) {
+			continue
+		}
+		if index >= 0 {
+			return nil, invalid("import_pool", poolName, "more than one matching pool, import by GUID instead")
+		}
+		index = i
+	}
+	if index < 0 {
+		return nil, poolNotFound(poolName)
+	}
+
+	pool := d.detached[index]
+	switch {
+	case pool.lost != 0 && !rewind:
+		return nil, zfserrors.NewZfsError("import_pool", poolName, zfserrors.ErrCodeIO, errnoIO,
+			"the pool metadata is corrupted, rewinding can recover it", nil)
+	case pool.lost != 0 && opts.DryRun:
+		return &driver.RewindReport{
+			Needed:     true,
+			Possible:   true,
+			RewindTime: uint64(time.Now().Add(-pool.lost).Unix()),
+			Discarded:  int64(pool.lost / time.Second),
+		}, nil
+	case opts.DryRun:
+		return &driver.RewindReport{}, nil
+	case opts.RewindToCheckpoint && pool.checkpoint == nil:
+		return nil, noEntry("import_pool", poolName, "checkpoint does not exist")
+	}
+
+	newName := pool.name
+	if opts.NewName != "" {
+		if err := validatePoolName(opts.NewName); err != nil {
+			return nil, err
+		}
+		newName = opts.NewName
+	}
+	if _, exists := d.pools[newName]; exists {
+		return nil, zfserrors.NewZfsError("import_pool", newName, zfserrors.ErrCodeExists, errnoExist,
+			"a pool with that name already exists", nil)
+	}
+
+	if opts.RewindToCheckpoint {
+		// Import-time properties come from this import, not the checkpoint
+		pool.props = pool.checkpoint.props
+		delete(pool.props, "altroot")
+		delete(pool.props, "readonly")
+		pool.datasets = pool.checkpoint.datasets
+		pool.checkpoint = nil
+	}
+	pool.rename(newName)
+	pool.state = poolStateActive
+	for name, value := range opts.Properties {
+		// Enabling a feature is a no-op, as in SetPoolProp
+		if canonical, ok := driver.CanonicalPoolProp(name); ok {
+			pool.props[canonical] = value
+		}
+	}
+	if opts.AltRoot != "" {
+		pool.props["altroot"] = opts.AltRoot
+	}
+	if opts.ReadOnly {
+		pool.props["readonly"] = "on"
+	}
+	pool.lost = 0
+	d.detached = append(d.detached[:index], d.detached[index+1:]...)
+	d.pools[newName] = pool
+	return nil, nil
+}
+
+func (d *FakeDriver) ExportPool(ctx context.Context, poolName string, opts driver.ExportOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	delete(d.pools, poolName)
+	pool.state = poolStateExported
+	delete(pool.props, "altroot")
+	delete(pool.props, "readonly")
+	d.detached = append(d.detached, pool)
+	return nil
+}
+
+// importable reports whether an exported or destroyed pool matches the pool
+// argument of zpool import, any pool when empty, and has a device in one of
+// the search paths
+func (p *fakePool) importable(nameOrGUID string, destroyed bool, searchPaths []string) bool {
+	if p.state == poolStateDestroyed && !destroyed {
+		return false
+	}
+	if nameOrGUID != "" && p.name != nameOrGUID && strconv.FormatUint(p.guid, 10) != nameOrGUID {
+		return false
+	}
+	if len(searchPaths) == 0 {
+		return true
+	}
+
+	found := false
+	p.walkDevices(func(leaf *fakeVdev) {
+		for _, dir := range searchPaths {
+			found = found || leaf.path == dir || filepath.Dir(leaf.path) == filepath.Clean(dir)
+		}
+	})
+	return found
+}
+
+func (p *fakePool) rename(newName string) {
+	if newName == p.name {
+		return
+	}
+
+	rename := func(name string) string {
+		if name == "" || poolOf(name) != p.name {
+			return name
+		}
+		return newName + name[len(p.name):]
+	}
+
+	renameAll := func(datasets map[string]*fakeDataset) map[string]*fakeDataset {
+		renamed := make(map[string]*fakeDataset, len(datasets))
+		for _, ds := range datasets {
+			ds.name = rename(ds.name)
+			ds.origin = rename(ds.origin)
+			renamed[ds.name] = ds
+		}
+		return renamed
+	}
+
+	p.datasets = renameAll(p.datasets)
+	if p.checkpoint != nil {
+		p.checkpoint.datasets = renameAll(p.checkpoint.datasets)
+	}
+	p.root.path = newName
+	p.name = newName
+}
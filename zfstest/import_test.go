@@ -0,0 +1,142 @@
+package zfstest
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+func TestFakeDriver_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreateDataset(ctx, "tank/data", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.ExportPool(ctx, "tank", driver.ExportOptions{}))
+
+	if _, err := d.GetDatasetProps(ctx, "tank/data", nil); !zfserrors.IsDatasetNotFound(err) {
+		t.Errorf("GetDatasetProps() on exported pool error = %v, want dataset not found", err)
+	}
+
+	_, err := d.ImportPool(ctx, "tank", driver.ImportOptions{NewName: "backup"})
+	mustNoErr(t, err)
+	if _, err := d.GetDatasetProps(ctx, "backup/data", []string{"type"}); err != nil {
+		t.Errorf("GetDatasetProps() after renaming import error = %v", err)
+	}
+
+	mustNoErr(t, d.DestroyPool(ctx, "backup"))
+	if _, err := d.ImportPool(ctx, "backup", driver.ImportOptions{}); !zfserrors.IsPoolNotFound(err) {
+		t.Errorf("ImportPool() of destroyed pool error = %v, want pool not found", err)
+	}
+	_, err = d.ImportPool(ctx, "backup", driver.ImportOptions{Destroyed: true})
+	mustNoErr(t, err)
+}
+
+func TestFakeDriver_DiscoverPools(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.CreatePool(ctx, "backup", disks("/tmp/disk0", "/tmp/disk1"), driver.CreateOptions{}))
+	mustNoErr(t, d.ExportPool(ctx, "tank", driver.ExportOptions{}))
+	mustNoErr(t, d.ExportPool(ctx, "backup", driver.ExportOptions{}))
+
+	names := func(pools []driver.ImportablePool) []string {
+		var names []string
+		for _, pool := range pools {
+			names = append(names, pool.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	pools, err := d.DiscoverPools(ctx, driver.DiscoverOptions{})
+	mustNoErr(t, err)
+	if got := names(pools); !reflect.DeepEqual(got, []string{"backup", "tank"}) {
+		t.Errorf("DiscoverPools() = %v, want [backup tank]", got)
+	}
+
+	pools, err = d.DiscoverPools(ctx, driver.DiscoverOptions{SearchPaths: []string{"/tmp/"}})
+	mustNoErr(t, err)
+	if len(pools) != 1 || pools[0].Name != "backup" || pools[0].State != "EXPORTED" {
+		t.Fatalf("DiscoverPools() in /tmp = %+v, want the exported backup pool", pools)
+	}
+	if want := []string{"/tmp/disk0", "/tmp/disk1"}; !reflect.DeepEqual(pools[0].DevicePaths, want) {
+		t.Errorf("DevicePaths = %v, want %v", pools[0].DevicePaths, want)
+	}
+	backupGUID := strconv.FormatUint(pools[0].GUID, 10)
+
+	// A second pool named tank, the first one can only be imported by GUID
+	mustNoErr(t, d.CreatePool(ctx, "tank", disks("/dev/ada1"), driver.CreateOptions{}))
+	mustNoErr(t, d.ExportPool(ctx, "tank", driver.ExportOptions{}))
+	pools, err = d.DiscoverPools(ctx, driver.DiscoverOptions{Pool: "tank"})
+	mustNoErr(t, err)
+	if len(pools) != 2 {
+		t.Fatalf("DiscoverPools() of tank = %d pools, want 2", len(pools))
+	}
+	if _, err := d.ImportPool(ctx, "tank", driver.ImportOptions{}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("ImportPool() of an ambiguous name error = %v, want EINVAL", err)
+	}
+	_, err = d.ImportPool(ctx, strconv.FormatUint(pools[1].GUID, 10), driver.ImportOptions{NewName: "tank2"})
+	mustNoErr(t, err)
+
+	opts := driver.ImportOptions{Properties: map[string]string{"altroot": "mnt"}}
+	if _, err := d.ImportPool(ctx, backupGUID, opts); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("ImportPool() with a relative altroot error = %v, want EINVAL", err)
+	}
+	opts = driver.ImportOptions{ReadOnly: true, Properties: map[string]string{"comment": "offsite"}}
+	_, err = d.ImportPool(ctx, backupGUID, opts)
+	mustNoErr(t, err)
+	props, err := d.GetPoolProps(ctx, "backup", []string{"readonly", "comment"})
+	mustNoErr(t, err)
+	if props["readonly"].Value != "on" || props["comment"].Value != "offsite" {
+		t.Errorf("properties after import = %+v", props)
+	}
+
+	if _, err := d.ImportPool(ctx, "tank", driver.ImportOptions{SearchPaths: []string{"/tmp"}}); !zfserrors.IsPoolNotFound(err) {
+		t.Errorf("ImportPool() outside the search paths error = %v, want pool not found", err)
+	}
+}
+
+func TestFakeDriver_ImportRewind(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.ExportPool(ctx, "tank", driver.ExportOptions{}))
+	mustNoErr(t, d.DamagePool("tank", 90*time.Second))
+
+	pools, err := d.DiscoverPools(ctx, driver.DiscoverOptions{})
+	mustNoErr(t, err)
+	if len(pools) != 1 || pools[0].Health != VdevStateFaulted {
+		t.Errorf("DiscoverPools() of a damaged pool = %+v, want it faulted", pools)
+	}
+
+	if _, err := d.ImportPool(ctx, "tank", driver.ImportOptions{}); errCode(err) != zfserrors.ErrCodeIO {
+		t.Errorf("ImportPool() of a damaged pool error = %v, want EIO", err)
+	}
+	if _, err := d.ImportPool(ctx, "tank", driver.ImportOptions{DryRun: true}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("ImportPool() of a dry run without rewind error = %v, want EINVAL", err)
+	}
+
+	report, err := d.ImportPool(ctx, "tank", driver.ImportOptions{Rewind: true, DryRun: true})
+	mustNoErr(t, err)
+	if report == nil || !report.Needed || !report.Possible || report.Discarded != 90 {
+		t.Fatalf("ImportPool() dry run report = %+v, want 90 seconds discarded", report)
+	}
+	if _, err := d.GetPoolStatus(ctx, "tank"); !zfserrors.IsPoolNotFound(err) {
+		t.Errorf("GetPoolStatus() after a dry run error = %v, want pool not found", err)
+	}
+
+	_, err = d.ImportPool(ctx, "tank", driver.ImportOptions{MaxTxg: 100})
+	mustNoErr(t, err)
+	mustNoErr(t, d.ExportPool(ctx, "tank", driver.ExportOptions{}))
+	report, err = d.ImportPool(ctx, "tank", driver.ImportOptions{Rewind: true, DryRun: true})
+	mustNoErr(t, err)
+	if report == nil || report.Needed {
+		t.Errorf("ImportPool() dry run of a rewound pool = %+v, want no rewind needed", report)
+	}
+}
@@ -0,0 +1,583 @@
+package zfstest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// fakeWaitInterval is how often WaitPool checks whether an activity is done
+const fakeWaitInterval = 10 * time.Millisecond
+
+// ActivateFeature marks an enabled feature of a pool active, as if data
+// relying on it had been written
+func (d *FakeDriver) ActivateFeature(poolName, feature string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+	prop := "feature@" + feature
+	if state := pool.props[prop]; state != driver.FeatureEnabled && state != driver.FeatureActive {
+		return invalid("activate_feature", poolName, fmt.Sprintf("feature %q is not enabled", feature))
+	}
+	pool.props[prop] = driver.FeatureActive
+	return nil
+}
+
+// CompleteScan finishes the running scrub and error scrub of a pool. Fake
+// scans make no progress on their own.
+func (d *FakeDriver) CompleteScan(poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	for _, scan := range []*driver.ScanInfo{pool.scan, pool.errorScrub} {
+		if scan != nil && scan.State == driver.PoolScanStateScanning {
+			scan.State = driver.PoolScanStateFinished
+			scan.EndTime = uint64(time.Now().Unix())
+			scan.PassPaused = 0
+			scan.Examined = scan.ToExamine
+			scan.Issued = scan.ToExamine
+			scan.PassExamined = scan.ToExamine
+			scan.PassIssued = scan.ToExamine
+		}
+	}
+	return nil
+}
+
+func (d *FakeDriver) ListPools(ctx context.Context) ([]driver.PoolInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pools := make([]driver.PoolInfo, 0, len(d.pools))
+	for _, name := range sortedKeys(d.pools) {
+		pool := d.pools[name]
+		pools = append(pools, driver.PoolInfo{
+			Name:   pool.name,
+			GUID:   pool.guid,
+			Health: pool.root.state,
+			State:  pool.state,
+		})
+	}
+	return pools, nil
+}
+
+func (d *FakeDriver) GetPoolStatus(ctx context.Context, poolName string) (*driver.PoolStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &driver.PoolStatus{
+		PoolInfo: driver.PoolInfo{
+			Name:   pool.name,
+			GUID:   pool.guid,
+			Health: pool.root.state,
+			State:  pool.state,
+		},
+		Vdevs:      pool.root.info(0),
+		Spares:     auxInfo(pool.spares),
+		L2Cache:    auxInfo(pool.l2cache),
+		Scan:       copyScan(pool.scan),
+		ErrorScrub: copyScan(pool.errorScrub),
+		Checkpoint: pool.checkpointInfo(),
+		Removal:    copyRemoval(pool.removal),
+	}, nil
+}
+
+func (d *FakeDriver) GetPoolProps(ctx context.Context, poolName string, propNames []string) (map[string]driver.PropertyInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(propNames) == 0 {
+		propNames = driver.PoolPropNames()
+	}
+
+	values := pool.computedProps()
+	properties := make(map[string]driver.PropertyInfo)
+	for _, name := range propNames {
+		if driver.IsPoolFeatureProp(name) {
+			if _, known := driver.PoolFeatureGUID(name); !known {
+				return nil, driver.UnknownPropertyError(poolName, name)
+			}
+			if state, ok := pool.props[name]; ok {
+				properties[name] = driver.PropertyInfo{Name: name, Value: state, Raw: state, Source: driver.FeatureSource(state)}
+			}
+			continue
+		}
+
+		canonical, known := driver.CanonicalPoolProp(name)
+		if !known {
+			return nil, driver.UnknownPropertyError(poolName, name)
+		}
+
+		info := driver.PropertyInfo{Name: name}
+		if value, ok := pool.props[canonical]; ok {
+			info.Value, info.Source = value, driver.PropSourceLocal
+		} else if value, ok := values[canonical]; ok {
+			// Statistics have no source
+			info.Value, info.Source = value, driver.PropSourceNone
+		} else if value, ok := poolDefaults[canonical]; ok {
+			info.Value, info.Source = value, driver.PropSourceDefault
+		} else {
+			continue
+		}
+		info.Raw = info.Value
+		if raw, err := driver.ParsePoolPropValue(canonical, info.Value.(string)); err == nil {
+			info.Raw = raw
+		}
+		properties[name] = info
+	}
+	return properties, nil
+}
+
+func (d *FakeDriver) SetPoolProp(ctx context.Context, poolName, propName, propValue string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+	if err := driver.ValidatePoolProp(poolName, propName, propValue); err != nil {
+		return err
+	}
+
+	if driver.IsPoolFeatureProp(propName) {
+		if err := pool.enableFeature(poolName, strings.TrimPrefix(propName, "feature@")); err != nil {
+			return err
+		}
+		pool.logEvent(d.txg, "set", poolName, propName+"=enabled")
+		return nil
+	}
+
+	name, _ := driver.CanonicalPoolProp(propName)
+	if name == driver.PropNameCompatibility {
+		if _, err := d.loadCompatibility(propValue); err != nil {
+			return err
+		}
+	}
+	if name == "bootfs" && propValue != "" {
+		if _, exists := pool.datasets[propValue]; !exists {
+			return invalid("set_property", poolName, fmt.Sprintf("bootfs %q is not a dataset in the pool", propValue))
+		}
+	}
+	pool.props[name] = propValue
+	pool.logEvent(d.txg, "set", poolName, name+"="+propValue)
+	return nil
+}
+
+func (d *FakeDriver) ScrubPool(ctx context.Context, poolName string, opts driver.ScrubOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	scan, fn := &pool.scan, driver.PoolScanScrub
+	if opts.ErrorScrub {
+		if state := pool.props["feature@head_errlog"]; state != driver.FeatureEnabled && state != driver.FeatureActive {
+			return unsupported("scrub_pool", poolName, "error scrub requires the head_errlog feature")
+		}
+		scan, fn = &pool.errorScrub, driver.PoolScanErrorScrub
+	}
+	running := *scan != nil && (*scan).State == driver.PoolScanStateScanning
+	now := uint64(time.Now().Unix())
+
+	switch opts.Command {
+	case driver.ScrubStart:
+		switch {
+		case running && (*scan).PassPaused != 0:
+			(*scan).PassSpentPaused += now - (*scan).PassPaused
+			(*scan).PassPaused = 0
+		case running:
+			return busy("scrub_pool", poolName, "currently scrubbing")
+		default:
+			// Fake pools hold no data, there is nothing to examine
+			*scan = &driver.ScanInfo{
+				Function:  fn,
+				State:     driver.PoolScanStateScanning,
+				StartTime: now,
+				PassStart: now,
+			}
+		}
+	case driver.ScrubPause:
+		if !running {
+			return noEntry("scrub_pool", poolName, "there is no active scrub")
+		}
+		if (*scan).PassPaused == 0 {
+			(*scan).PassPaused = now
+		}
+	case driver.ScrubCancel:
+		if !running {
+			return noEntry("scrub_pool", poolName, "there is no active scrub")
+		}
+		(*scan).State = driver.PoolScanStateCanceled
+		(*scan).EndTime = now
+		(*scan).PassPaused = 0
+	default:
+		return invalid("scrub_pool", poolName, fmt.Sprintf("unknown scrub command %d", opts.Command))
+	}
+	return nil
+}
+
+// CheckpointPool saves the properties and datasets of a pool, which an
+// import with RewindToCheckpoint restores
+func (d *FakeDriver) CheckpointPool(ctx context.Context, poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+	if pool.checkpoint != nil {
+		return zfserrors.NewZfsError("checkpoint_pool", poolName, zfserrors.ErrCodeExists, errnoExist,
+			"checkpoint exists", nil)
+	}
+
+	pool.checkpoint = &fakeCheckpoint{
+		created:  time.Now(),
+		props:    copyProps(pool.props),
+		datasets: copyDatasets(pool.datasets),
+	}
+	return nil
+}
+
+// DiscardCheckpoint drops the checkpoint right away, so there is never a
+// discard to wait for
+func (d *FakeDriver) DiscardCheckpoint(ctx context.Context, poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+	if pool.checkpoint == nil {
+		return noEntry("discard_checkpoint", poolName, "checkpoint does not exist")
+	}
+
+	pool.checkpoint = nil
+	return nil
+}
+
+func (d *FakeDriver) WaitPool(ctx context.Context, poolName string, activity driver.WaitActivity) (bool, error) {
+	if activity < driver.WaitCheckpointDiscard || activity > driver.WaitRaidzExpand {
+		return false, invalid("wait_pool", poolName, fmt.Sprintf("unknown activity %d", activity))
+	}
+
+	waited := false
+	for {
+		d.mu.Lock()
+		if err := d.check(ctx); err != nil {
+			d.mu.Unlock()
+			return waited, err
+		}
+		pool, err := d.pool(poolName)
+		if err != nil {
+			d.mu.Unlock()
+			return waited, err
+		}
+		running := pool.inProgress(activity)
+		d.mu.Unlock()
+
+		if !running {
+			return waited, nil
+		}
+		waited = true
+
+		select {
+		case <-ctx.Done():
+			return waited, ctx.Err()
+		case <-time.After(fakeWaitInterval):
+		}
+	}
+}
+
+func (d *FakeDriver) CreatePool(ctx context.Context, poolName string, vdevs []driver.VdevSpec, opts driver.CreateOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	if err := validatePoolName(poolName); err != nil {
+		return err
+	}
+	if len(vdevs) == 0 {
+		return invalid("create_pool", poolName, "at least one vdev is required to create a pool")
+	}
+	if _, exists := d.pools[poolName]; exists {
+		return zfserrors.NewZfsError("create_pool", poolName, zfserrors.ErrCodeExists, errnoExist,
+			"pool already exists", nil)
+	}
+	if err := driver.ValidateTopology(poolName, vdevs, opts.Force); err != nil {
+		return err
+	}
+	var devices []string
+	for _, spec := range vdevs {
+		devices = append(devices, spec.Devices...)
+	}
+	if err := d.checkDevicesFree("create_pool", poolName, devices); err != nil {
+		return err
+	}
+
+	root := &fakeVdev{typ: driver.VdevTypeRoot, path: poolName, guid: d.newGUID(), state: VdevStateOnline}
+	pool := &fakePool{
+		name:     poolName,
+		guid:     root.guid,
+		state:    poolStateActive,
+		props:    copyProps(opts.Properties),
+		root:     root,
+		datasets: make(map[string]*fakeDataset),
+	}
+	for _, spec := range vdevs {
+		switch spec.Class {
+		case driver.VdevClassSpare, driver.VdevClassCache:
+			pool.addAux(d, spec)
+		default:
+			root.children = append(root.children, d.newVdev(spec))
+		}
+	}
+	if opts.AltRoot != "" {
+		pool.props["altroot"] = opts.AltRoot
+	}
+	// Like zpool create, every supported feature the compatibility property
+	// allows starts out enabled and the others disabled
+	allowed, err := d.loadCompatibility(opts.Properties[driver.PropNameCompatibility])
+	if err != nil {
+		return err
+	}
+	for _, feature := range allowed {
+		pool.props["feature@"+feature] = driver.FeatureEnabled
+	}
+	for feature, supported := range d.features {
+		if _, known := driver.PoolFeatureGUID(feature); known && supported && pool.props["feature@"+feature] == "" {
+			pool.props["feature@"+feature] = driver.FeatureDisabled
+		}
+	}
+
+	rootDS := &fakeDataset{name: poolName, typ: driver.DatasetFilesystem}
+	if rootDS.props, err = datasetProps(rootDS, opts.FsProperties); err != nil {
+		return err
+	}
+
+	d.txg++
+	rootDS.guid = d.newGUID()
+	rootDS.txg = d.txg
+	pool.datasets[poolName] = rootDS
+	pool.logEvent(d.txg, "create", poolName, "pool version 5000")
+	d.pools[poolName] = pool
+	return nil
+}
+
+func (d *FakeDriver) DestroyPool(ctx context.Context, poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	delete(d.pools, poolName)
+	pool.state = poolStateDestroyed
+	d.detached = append(d.detached, pool)
+	return nil
+}
+
+// GetPoolFeatures reports every known feature, the ones the driver does not
+// support as disabled
+func (d *FakeDriver) GetPoolFeatures(ctx context.Context, poolName string) ([]driver.PoolFeature, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	var features []driver.PoolFeature
+	for _, name := range driver.PoolFeatureNames() {
+		state := pool.props["feature@"+name]
+		if state == "" {
+			state = driver.FeatureDisabled
+		}
+		feature, _ := driver.DescribePoolFeature(name, state)
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+func (d *FakeDriver) LoadCompatibility(ctx context.Context, compatibility string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+	return d.loadCompatibility(compatibility)
+}
+
+// loadCompatibility returns the supported features a compatibility property
+// value allows
+func (d *FakeDriver) loadCompatibility(compatibility string) ([]string, error) {
+	allowed, err := driver.LoadCompatibility(compatibility, d.compat)
+	if err != nil {
+		return nil, err
+	}
+	features := allowed[:0]
+	for _, name := range allowed {
+		if d.features[name] {
+			features = append(features, name)
+		}
+	}
+	return features, nil
+}
+
+// Pool helpers
+
+func (p *fakePool) computedProps() map[string]string {
+	size := p.root.capacity()
+	return map[string]string{
+		"name":                   p.name,
+		driver.PropNameSize:      strconv.FormatUint(size, 10),
+		driver.PropNameAllocated: "0",
+		driver.PropNameFree:      strconv.FormatUint(size, 10),
+		driver.PropNameCapacity:  "0%",
+		driver.PropNameHealth:    p.root.state,
+		driver.PropNameGuid:      strconv.FormatUint(p.guid, 10),
+		"load_guid":              strconv.FormatUint(p.guid, 10),
+		"expandsize":             "-",
+		"freeing":                "0",
+		"leaked":                 "0",
+		"fragmentation":          "0%",
+		"checkpoint":             "-",
+		"dedupratio":             "1.00x",
+		"bcloneused":             "0",
+		"bclonesaved":            "0",
+		"bcloneratio":            "1.00x",
+	}
+}
+
+// inProgress reports whether WaitPool would block on an activity. Paused
+// scrubs do not count, like in the kernel.
+func (p *fakePool) inProgress(activity driver.WaitActivity) bool {
+	active := false
+	switch activity {
+	case driver.WaitScrub:
+		for _, scan := range []*driver.ScanInfo{p.scan, p.errorScrub} {
+			if scan != nil && scan.State == driver.PoolScanStateScanning && scan.PassPaused == 0 {
+				active = true
+			}
+		}
+	case driver.WaitInitialize, driver.WaitTrim:
+		p.root.walkLeaves(func(leaf *fakeVdev) {
+			progress := leaf.initialize
+			if activity == driver.WaitTrim {
+				progress = leaf.trim
+			}
+			active = active || progress.State == driver.VdevActionStateActive
+		})
+	case driver.WaitRemove:
+		active = p.removal != nil && p.removal.State == driver.PoolScanStateScanning
+	}
+	return active
+}
+
+// enableFeature enables a feature of the pool along with the features it
+// depends on, like feature_enable_sync. Enabled or active ones stay as is.
+func (p *fakePool) enableFeature(poolName, feature string) error {
+	if _, supported := p.props["feature@"+feature]; !supported {
+		return unsupported("set_property", poolName, fmt.Sprintf("feature %q is not supported", "feature@"+feature))
+	}
+	described, _ := driver.DescribePoolFeature(feature, "")
+	for _, dep := range described.Dependencies {
+		if err := p.enableFeature(poolName, dep); err != nil {
+			return err
+		}
+	}
+	if p.props["feature@"+feature] == driver.FeatureDisabled {
+		p.props["feature@"+feature] = driver.FeatureEnabled
+	}
+	return nil
+}
+
+// checkpointInfo describes the checkpoint of the pool, nil if there is none
+func (p *fakePool) checkpointInfo() *driver.CheckpointInfo {
+	if p.checkpoint == nil {
+		return nil
+	}
+	return &driver.CheckpointInfo{
+		State:     driver.CheckpointStateExists,
+		StartTime: uint64(p.checkpoint.created.Unix()),
+	}
+}
+
+func copyScan(scan *driver.ScanInfo) *driver.ScanInfo {
+	if scan == nil {
+		return nil
+	}
+	c := *scan
+	return &c
+}
@@ -0,0 +1,389 @@
+package zfstest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+func TestFakeDriver_CreatePool(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	if err := d.CreatePool(ctx, "tank", disks("/dev/ada1"), driver.CreateOptions{}); !zfserrors.IsExists(err) {
+		t.Errorf("duplicate CreatePool() error = %v, want EEXIST", err)
+	}
+	if err := d.CreatePool(ctx, "other", disks("/dev/ada0"), driver.CreateOptions{}); !zfserrors.IsBusy(err) {
+		t.Errorf("CreatePool() with used device error = %v, want EBUSY", err)
+	}
+
+	pools, err := d.ListPools(ctx)
+	mustNoErr(t, err)
+	if len(pools) != 1 || pools[0].Name != "tank" || pools[0].Health != "ONLINE" {
+		t.Errorf("ListPools() = %+v, want one ONLINE pool named tank", pools)
+	}
+
+	datasets, err := d.ListDatasets(ctx, false)
+	mustNoErr(t, err)
+	if len(datasets) != 1 || datasets[0].Name != "tank" {
+		t.Errorf("ListDatasets() = %+v, want root dataset tank", datasets)
+	}
+}
+
+func TestFakeDriver_CreatePoolTopology(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeDriver()
+
+	special := mirror("/dev/nvd0", "/dev/nvd1")
+	special.Class = driver.VdevClassSpecial
+	topology := []driver.VdevSpec{
+		mirror("/dev/ada0", "/dev/ada1"),
+		mirror("/dev/ada2", "/dev/ada3"),
+		special,
+		{Type: driver.VdevTypeDisk, Devices: []string{"/dev/nvd2"}, Class: driver.VdevClassLog},
+		{Devices: []string{"/dev/ada4", "/dev/ada5"}, Class: driver.VdevClassSpare},
+		{Devices: []string{"/dev/nvd3"}, Class: driver.VdevClassCache},
+	}
+	mustNoErr(t, d.CreatePool(ctx, "tank", topology, driver.CreateOptions{}))
+
+	status, err := d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	var classes []string
+	for _, top := range status.Vdevs.Children {
+		classes = append(classes, top.Type+"/"+top.Class)
+	}
+	if want := []string{"mirror/", "mirror/", "mirror/special", "disk/log"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("top-level vdevs = %v, want %v", classes, want)
+	}
+	if len(status.Spares) != 2 || status.Spares[0].State != VdevStateAvail || len(status.L2Cache) != 1 {
+		t.Errorf("Spares = %+v, L2Cache = %+v, want two available spares and one cache device", status.Spares, status.L2Cache)
+	}
+	if err := d.CreatePool(ctx, "other", disks("/dev/ada5"), driver.CreateOptions{}); !zfserrors.IsBusy(err) {
+		t.Errorf("CreatePool() with a spare of tank error = %v, want EBUSY", err)
+	}
+
+	// A raidz next to a mirror needs force, as with zpool create -f
+	mixed := []driver.VdevSpec{
+		mirror("/dev/da0", "/dev/da1"),
+		{Type: driver.VdevTypeRaidz, Devices: []string{"/dev/da2", "/dev/da3", "/dev/da4"}},
+	}
+	if err := d.CreatePool(ctx, "mixed", mixed, driver.CreateOptions{}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("CreatePool() with mismatched replication error = %v, want EINVAL", err)
+	}
+	mustNoErr(t, d.CreatePool(ctx, "mixed", mixed, driver.CreateOptions{Force: true}))
+
+	draid := []driver.VdevSpec{{
+		Type:    driver.VdevTypeDraid,
+		Devices: []string{"/dev/da5", "/dev/da6", "/dev/da7", "/dev/da8", "/dev/da9", "/dev/da10"},
+		Parity:  2,
+		Spares:  1,
+	}}
+	mustNoErr(t, d.CreatePool(ctx, "wide", draid, driver.CreateOptions{}))
+	status, err = d.GetPoolStatus(ctx, "wide")
+	mustNoErr(t, err)
+	if top := status.Vdevs.Children[0]; top.Type != driver.VdevTypeDraid || top.NParity != 2 || len(top.Children) != 6 {
+		t.Errorf("draid vdev = %+v, want draid2 with 6 children", top)
+	}
+}
+
+func TestFakeDriver_PoolProps(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "autotrim", "on"))
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "comment", "rack 4"))
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "feature@async_destroy", "enabled"))
+
+	props, err := d.GetPoolProps(ctx, "tank", []string{"autotrim", "comment", "failmode", "cap", "feature@async_destroy"})
+	mustNoErr(t, err)
+	for name, want := range map[string]driver.PropertyInfo{
+		"autotrim":              {Value: "on", Raw: true, Source: driver.PropSourceLocal},
+		"comment":               {Value: "rack 4", Raw: "rack 4", Source: driver.PropSourceLocal},
+		"failmode":              {Value: "wait", Raw: "wait", Source: driver.PropSourceDefault},
+		"cap":                   {Value: "0%", Raw: uint64(0), Source: driver.PropSourceNone},
+		"feature@async_destroy": {Value: driver.FeatureEnabled, Raw: driver.FeatureEnabled, Source: driver.PropSourceLocal},
+	} {
+		got := props[name]
+		if got.Value != want.Value || got.Raw != want.Raw || got.Source != want.Source {
+			t.Errorf("%s = %v/%#v (%v), want %v/%#v (%v)", name, got.Value, got.Raw, got.Source, want.Value, want.Raw, want.Source)
+		}
+	}
+
+	all, err := d.GetPoolProps(ctx, "tank", nil)
+	mustNoErr(t, err)
+	for _, name := range []string{"health", "fragmentation", "autoexpand", "feature@zstd_compress"} {
+		if _, ok := all[name]; !ok {
+			t.Errorf("all properties missing %s", name)
+		}
+	}
+
+	for _, test := range []struct{ name, value string }{
+		{"size", "1G"}, {"autotrim", "maybe"}, {"bootfs", "tank/missing"}, {"feature@async_destroy", "disabled"},
+	} {
+		if err := d.SetPoolProp(ctx, "tank", test.name, test.value); errCode(err) != zfserrors.ErrCodeInval {
+			t.Errorf("SetPoolProp(%s=%s) error = %v, want EINVAL", test.name, test.value, err)
+		}
+	}
+	if _, err := d.GetPoolProps(ctx, "tank", []string{"bogus"}); !zfserrors.IsUnknownProperty(err) {
+		t.Errorf("GetPoolProps(bogus) error = %v, want unknown property", err)
+	}
+}
+
+func TestFakeDriver_PoolFeatures(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "grub2"), []byte("# boot loader\nasync_destroy\nlz4_compress\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewFakeDriver()
+	d.SetCompatibilityDirs(dir)
+
+	vdevs := []driver.VdevSpec{{Devices: []string{"/dev/ada0"}}}
+	opts := driver.CreateOptions{Properties: map[string]string{"compatibility": "missing"}}
+	if err := d.CreatePool(ctx, "tank", vdevs, opts); errCode(err) != zfserrors.ErrCodeInval {
+		t.Fatalf("CreatePool() with a missing feature-set error = %v, want %v", err, zfserrors.ErrCodeInval)
+	}
+	opts.Properties["compatibility"] = "grub2"
+	mustNoErr(t, d.CreatePool(ctx, "tank", vdevs, opts))
+	mustNoErr(t, d.ActivateFeature("tank", "lz4_compress"))
+
+	states := func() map[string]string {
+		t.Helper()
+		features, err := d.GetPoolFeatures(ctx, "tank")
+		mustNoErr(t, err)
+		states := make(map[string]string)
+		for _, feature := range features {
+			states[feature.Name] = feature.State
+		}
+		return states
+	}
+	want := map[string]string{
+		"async_destroy": driver.FeatureEnabled,
+		"lz4_compress":  driver.FeatureActive,
+		"encryption":    driver.FeatureDisabled,
+		"draid":         driver.FeatureDisabled,
+	}
+	got := states()
+	for name, state := range want {
+		if got[name] != state {
+			t.Errorf("feature %s = %s, want %s", name, got[name], state)
+		}
+	}
+
+	// Enabling a feature enables what it depends on
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "feature@encryption", "enabled"))
+	got = states()
+	for _, name := range []string{"encryption", "bookmark_v2", "bookmarks", "extensible_dataset"} {
+		if got[name] != driver.FeatureEnabled {
+			t.Errorf("feature %s = %s after enabling encryption, want enabled", name, got[name])
+		}
+	}
+	if got["lz4_compress"] != driver.FeatureActive {
+		t.Errorf("feature lz4_compress = %s, want it to stay active", got["lz4_compress"])
+	}
+
+	if err := d.SetPoolProp(ctx, "tank", "feature@draid", "enabled"); errCode(err) != zfserrors.ErrCodeNotSupported {
+		t.Errorf("SetPoolProp(feature@draid) error = %v, want %v", err, zfserrors.ErrCodeNotSupported)
+	}
+	if err := d.SetPoolProp(ctx, "tank", "compatibility", "grub2,missing"); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("SetPoolProp(compatibility) error = %v, want %v", err, zfserrors.ErrCodeInval)
+	}
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "compatibility", "off"))
+
+	allowed, err := d.LoadCompatibility(ctx, "grub2")
+	mustNoErr(t, err)
+	if !reflect.DeepEqual(allowed, []string{"async_destroy", "lz4_compress"}) {
+		t.Errorf("LoadCompatibility(grub2) = %v", allowed)
+	}
+}
+
+func TestFakeDriver_GetPoolStatus(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.AttachVdev(ctx, "tank", "/dev/ada0", "/dev/ada1", false))
+	mustNoErr(t, d.AddVdev(ctx, "tank", driver.VdevSpec{
+		Type:    driver.VdevTypeRaidz2,
+		Devices: []string{"/dev/ada2", "/dev/ada3", "/dev/ada4", "/dev/ada5"},
+	}))
+	mustNoErr(t, d.SetVdevErrors("tank", "/dev/ada1", 1, 2, 3))
+	mustNoErr(t, d.SetVdevState("tank", "/dev/ada3", VdevStateFaulted))
+
+	status, err := d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if status.Health != VdevStateDegraded || status.Vdevs.Type != driver.VdevTypeRoot {
+		t.Fatalf("GetPoolStatus() = %+v, want a degraded root", status)
+	}
+	if len(status.Vdevs.Children) != 2 {
+		t.Fatalf("top-level vdevs = %+v, want mirror and raidz2", status.Vdevs.Children)
+	}
+
+	mirror, raidz := status.Vdevs.Children[0], status.Vdevs.Children[1]
+	if mirror.Type != driver.VdevTypeMirror || len(mirror.Children) != 2 {
+		t.Errorf("first top-level vdev = %+v, want a two-way mirror", mirror)
+	}
+	if got := mirror.Children[1].Stats; got.ReadErrors != 1 || got.WriteErrors != 2 || got.ChecksumErrors != 3 {
+		t.Errorf("mirror side stats = %+v, want 1/2/3 errors", got)
+	}
+	if raidz.ID != 1 || raidz.NParity != 2 || raidz.State != VdevStateDegraded {
+		t.Errorf("second top-level vdev = %+v, want degraded raidz2 with id 1", raidz)
+	}
+	if raidz.Children[1].State != VdevStateFaulted {
+		t.Errorf("faulted leaf state = %q, want FAULTED", raidz.Children[1].State)
+	}
+
+	mustNoErr(t, d.ClearVdev(ctx, "tank", ""))
+	status, err = d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if got := status.Vdevs.Children[0].Children[1].Stats.ReadErrors; got != 0 {
+		t.Errorf("read errors after clear = %d, want 0", got)
+	}
+
+	if _, err := d.GetPoolStatus(ctx, "missing"); !zfserrors.IsPoolNotFound(err) {
+		t.Errorf("GetPoolStatus() of missing pool error = %v, want pool not found", err)
+	}
+}
+
+func TestFakeDriver_ScrubPool(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	scan := func() *driver.ScanInfo {
+		t.Helper()
+		status, err := d.GetPoolStatus(ctx, "tank")
+		mustNoErr(t, err)
+		return status.Scan
+	}
+
+	if scan() != nil {
+		t.Fatal("new pool reports a scan")
+	}
+	err := d.ScrubPool(ctx, "tank", driver.ScrubOptions{Command: driver.ScrubPause})
+	if zerr, ok := zfserrors.AsZfsError(err); !ok || zerr.Code != zfserrors.ErrCodeNotFound {
+		t.Errorf("pausing without a scrub error = %v, want ENOENT", err)
+	}
+
+	mustNoErr(t, d.ScrubPool(ctx, "tank", driver.ScrubOptions{}))
+	if got := scan(); got == nil || got.Function != driver.PoolScanScrub || got.State != driver.PoolScanStateScanning {
+		t.Fatalf("scan after start = %+v, want a running scrub", got)
+	}
+	if err := d.ScrubPool(ctx, "tank", driver.ScrubOptions{}); !zfserrors.IsBusy(err) {
+		t.Errorf("second start error = %v, want EBUSY", err)
+	}
+
+	mustNoErr(t, d.ScrubPool(ctx, "tank", driver.ScrubOptions{Command: driver.ScrubPause}))
+	if got := scan(); got.PassPaused == 0 {
+		t.Errorf("scan after pause = %+v, want paused", got)
+	}
+	mustNoErr(t, d.ScrubPool(ctx, "tank", driver.ScrubOptions{}))
+	if got := scan(); got.PassPaused != 0 || got.State != driver.PoolScanStateScanning {
+		t.Errorf("scan after resume = %+v, want running", got)
+	}
+
+	mustNoErr(t, d.ScrubPool(ctx, "tank", driver.ScrubOptions{Command: driver.ScrubCancel}))
+	if got := scan(); got.State != driver.PoolScanStateCanceled || got.EndTime == 0 {
+		t.Errorf("scan after cancel = %+v, want canceled", got)
+	}
+
+	mustNoErr(t, d.ScrubPool(ctx, "tank", driver.ScrubOptions{}))
+	mustNoErr(t, d.CompleteScan("tank"))
+	if got := scan(); got.State != driver.PoolScanStateFinished {
+		t.Errorf("scan after CompleteScan = %+v, want finished", got)
+	}
+
+	// Error scrubs need the head_errlog feature, which the fake does not enable
+	if err := d.ScrubPool(ctx, "tank", driver.ScrubOptions{ErrorScrub: true}); !zfserrors.IsNotSupported(err) {
+		t.Errorf("error scrub error = %v, want ENOTSUP", err)
+	}
+}
+
+func TestFakeDriver_WaitPool(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	waited, err := d.WaitPool(ctx, "tank", driver.WaitScrub)
+	if err != nil || waited {
+		t.Errorf("WaitPool() without a scrub = %v, %v, want false, nil", waited, err)
+	}
+
+	mustNoErr(t, d.ScrubPool(ctx, "tank", driver.ScrubOptions{}))
+
+	short, cancel := context.WithTimeout(ctx, 3*fakeWaitInterval)
+	defer cancel()
+	if _, err := d.WaitPool(short, "tank", driver.WaitScrub); err != context.DeadlineExceeded {
+		t.Errorf("WaitPool() past the deadline error = %v, want DeadlineExceeded", err)
+	}
+
+	// Other activities are never in progress on a fake pool
+	waited, err = d.WaitPool(ctx, "tank", driver.WaitTrim)
+	if err != nil || waited {
+		t.Errorf("WaitPool(trim) = %v, %v, want false, nil", waited, err)
+	}
+
+	go func() {
+		time.Sleep(2 * fakeWaitInterval)
+		d.CompleteScan("tank")
+	}()
+	waited, err = d.WaitPool(ctx, "tank", driver.WaitScrub)
+	if err != nil || !waited {
+		t.Errorf("WaitPool() until the scrub completes = %v, %v, want true, nil", waited, err)
+	}
+
+	_, err = d.WaitPool(ctx, "tank", driver.WaitActivity(99))
+	if zerr, ok := zfserrors.AsZfsError(err); !ok || zerr.Code != zfserrors.ErrCodeInval {
+		t.Errorf("WaitPool() of an unknown activity error = %v, want EINVAL", err)
+	}
+}
+
+func TestFakeDriver_Checkpoint(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	if err := d.DiscardCheckpoint(ctx, "tank"); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("DiscardCheckpoint() without checkpoint error = %v, want ENOENT", err)
+	}
+	mustNoErr(t, d.CheckpointPool(ctx, "tank"))
+	if err := d.CheckpointPool(ctx, "tank"); !zfserrors.IsExists(err) {
+		t.Errorf("second CheckpointPool() error = %v, want EEXIST", err)
+	}
+	status, err := d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if status.Checkpoint == nil || status.Checkpoint.State != driver.CheckpointStateExists || status.Checkpoint.StartTime == 0 {
+		t.Errorf("Checkpoint = %+v, want an existing checkpoint", status.Checkpoint)
+	}
+
+	// Changes after the checkpoint are lost when rewinding to it
+	mustNoErr(t, d.CreateDataset(ctx, "tank/scratch", driver.DatasetFilesystem, nil))
+	mustNoErr(t, d.SetPoolProp(ctx, "tank", "comment", "after"))
+	mustNoErr(t, d.ExportPool(ctx, "tank", driver.ExportOptions{}))
+	if _, err := d.ImportPool(ctx, "tank", driver.ImportOptions{RewindToCheckpoint: true, Rewind: true}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("ImportPool() with checkpoint and txg rewind error = %v, want EINVAL", err)
+	}
+	_, err = d.ImportPool(ctx, "tank", driver.ImportOptions{RewindToCheckpoint: true, NewName: "restored"})
+	mustNoErr(t, err)
+	if err := d.CreateDataset(ctx, "restored/scratch", driver.DatasetFilesystem, nil); err != nil {
+		t.Errorf("CreateDataset() of a dataset created after the checkpoint error = %v", err)
+	}
+	props, err := d.GetPoolProps(ctx, "restored", []string{"comment"})
+	mustNoErr(t, err)
+	if comment := props["comment"].Value; comment == "after" {
+		t.Errorf("comment = %v after rewinding to the checkpoint", comment)
+	}
+	status, err = d.GetPoolStatus(ctx, "restored")
+	mustNoErr(t, err)
+	if status.Checkpoint != nil {
+		t.Errorf("Checkpoint = %+v after rewinding to it, want nil", status.Checkpoint)
+	}
+
+	// Without a checkpoint there is nothing to rewind to
+	mustNoErr(t, d.ExportPool(ctx, "restored", driver.ExportOptions{}))
+	if _, err := d.ImportPool(ctx, "restored", driver.ImportOptions{RewindToCheckpoint: true}); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("ImportPool() to a missing checkpoint error = %v, want ENOENT", err)
+	}
+}
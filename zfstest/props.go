@@ -0,0 +1,374 @@
+package zfstest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// poolDefaults holds the default value of every settable pool property
+var poolDefaults = map[string]string{
+	"version":       "-",
+	"altroot":       "-",
+	"readonly":      "off",
+	"bootfs":        "-",
+	"cachefile":     "-",
+	"comment":       "-",
+	"compatibility": "off",
+	"ashift":        "0",
+	"failmode":      "wait",
+	"delegation":    "on",
+	"autoreplace":   "off",
+	"listsnapshots": "off",
+	"autoexpand":    "off",
+	"multihost":     "off",
+	"autotrim":      "off",
+}
+
+// datasetDefaults holds the default value of every settable native property
+var datasetDefaults = map[string]string{
+	"aclinherit":         "restricted",
+	"aclmode":            "discard",
+	"atime":              "on",
+	"canmount":           "on",
+	"casesensitivity":    "sensitive",
+	"checksum":           "on",
+	"compression":        "on",
+	"copies":             "1",
+	"dedup":              "off",
+	"devices":            "on",
+	"dnodesize":          "legacy",
+	"encryption":         "off",
+	"exec":               "on",
+	"keyformat":          "none",
+	"keylocation":        "none",
+	"logbias":            "latency",
+	"mountpoint":         "",
+	"nbmand":             "off",
+	"normalization":      "none",
+	"primarycache":       "all",
+	"quota":              "none",
+	"readonly":           "off",
+	"recordsize":         "128K",
+	"redundant_metadata": "all",
+	"refquota":           "none",
+	"refreservation":     "none",
+	"relatime":           "off",
+	"reservation":        "none",
+	"secondarycache":     "all",
+	"setuid":             "on",
+	"sharenfs":           "off",
+	"sharesmb":           "off",
+	"snapdir":            "hidden",
+	"sync":               "standard",
+	"utf8only":           "off",
+	"volmode":            "default",
+	"vscan":              "off",
+	"xattr":              "on",
+	"jailed":             "off",
+}
+
+// nonInheritableProps are settable properties that never propagate to children
+var nonInheritableProps = map[string]bool{
+	"quota":          true,
+	"reservation":    true,
+	"refquota":       true,
+	"refreservation": true,
+	"volsize":        true,
+	"volblocksize":   true,
+}
+
+// readOnlyProps are computed by the fake driver and cannot be set
+var readOnlyProps = map[string]bool{
+	"type":          true,
+	"name":          true,
+	"guid":          true,
+	"createtxg":     true,
+	"creation":      true,
+	"origin":        true,
+	"clones":        true,
+	"used":          true,
+	"available":     true,
+	"referenced":    true,
+	"compressratio": true,
+	"mounted":       true,
+	"written":       true,
+	"logicalused":   true,
+	"keystatus":     true,
+}
+
+// canonicalProp resolves the short property names accepted by zfs(8)
+func canonicalProp(name string) string {
+	canonical, _ := driver.CanonicalDatasetProp(name)
+	return canonical
+}
+
+func isUserProp(name string) bool {
+	return driver.IsUserProp(name)
+}
+
+// Helper function to compute the value of a read-only property
+func (p *fakePool) computedProp(ds *fakeDataset, name string) (string, bool) {
+	switch name {
+	case "type":
+		return ds.typ.String(), true
+	case "name":
+		return ds.name, true
+	case "guid":
+		return strconv.FormatUint(ds.guid, 10), true
+	case "createtxg":
+		return strconv.FormatUint(ds.txg, 10), true
+	case "origin":
+		return ds.origin, ds.origin != ""
+	case "clones":
+		if ds.typ != driver.DatasetSnapshot {
+			return "", false
+		}
+		return strings.Join(p.clonesOf(ds.name), ","), true
+	case "used", "referenced", "written", "logicalused":
+		return "0", true
+	case "available":
+		if ds.typ == driver.DatasetSnapshot {
+			return "", false
+		}
+		return strconv.FormatUint(p.root.capacity(), 10), true
+	case "compressratio":
+		return "1.00x", true
+	case "mounted":
+		if ds.typ != driver.DatasetFilesystem {
+			return "", false
+		}
+		return "no", true
+	case "keystatus":
+		return "", false
+	}
+	return "", false
+}
+
+// resolveProp determines the effective value and source of a property
+func (p *fakePool) resolveProp(ds *fakeDataset, requested string) (driver.PropertyInfo, bool) {
+	name := canonicalProp(requested)
+	info := driver.PropertyInfo{Name: requested}
+
+	if readOnlyProps[name] {
+		value, ok := p.computedProp(ds, name)
+		info.Value = value
+		info.Source = driver.PropSourceNone
+		return info, ok
+	}
+
+	if value, ok := ds.props[name]; ok {
+		info.Value = value
+		info.Source = driver.PropSourceLocal
+		return info, true
+	}
+
+	_, native := datasetDefaults[name]
+	if !native && !isUserProp(name) {
+		return info, false
+	}
+	if name == "mountpoint" && ds.typ == driver.DatasetVolume {
+		return info, false
+	}
+
+	if !nonInheritableProps[name] {
+		// Snapshots inherit from the dataset they belong to
+		child := snapParent(ds.name)
+		if ds.typ != driver.DatasetSnapshot {
+			child = ds.name
+		}
+		for ancestor := parentName(child, ds.typ == driver.DatasetSnapshot); ancestor != ""; ancestor = parentName(ancestor, false) {
+			other, ok := p.datasets[ancestor]
+			if !ok {
+				continue
+			}
+			value, ok := other.props[name]
+			if !ok {
+				continue
+			}
+			if name == "mountpoint" && value != "none" && value != "legacy" {
+				value = strings.TrimSuffix(value, "/") + strings.TrimPrefix(child, ancestor)
+			}
+			info.Value = value
+			info.Source = driver.PropSourceInherited
+			info.InheritedFrom = ancestor
+			return info, true
+		}
+	}
+
+	if !native {
+		return info, false
+	}
+
+	info.Value = datasetDefaults[name]
+	if name == "mountpoint" {
+		info.Value = "/" + snapParent(ds.name)
+	}
+	info.Source = driver.PropSourceDefault
+	return info, true
+}
+
+// parentName returns the parent dataset name, or the name itself when self is set
+func parentName(name string, self bool) string {
+	if self {
+		return name
+	}
+	parent, _, ok := cutLast(name, "/")
+	if !ok {
+		return ""
+	}
+	return parent
+}
+
+// propNames lists every property that has a value on the dataset
+func (p *fakePool) propNames(ds *fakeDataset) []string {
+	names := make(map[string]bool)
+	for name := range readOnlyProps {
+		names[name] = true
+	}
+	for name := range datasetDefaults {
+		names[name] = true
+	}
+	for name := range ds.props {
+		names[name] = true
+	}
+
+	// User properties set on ancestors are inherited as well
+	for ancestor := parentName(snapParent(ds.name), ds.typ == driver.DatasetSnapshot); ancestor != ""; ancestor = parentName(ancestor, false) {
+		if other, ok := p.datasets[ancestor]; ok {
+			for name := range other.props {
+				if isUserProp(name) {
+					names[name] = true
+				}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// validateSetProp applies the rules libzfs uses when a property is set
+func validateSetProp(ds *fakeDataset, name, value string) error {
+	if isUserProp(name) {
+		return driver.ValidateUserProp(ds.name, name, value)
+	}
+
+	name = canonicalProp(name)
+	if readOnlyProps[name] {
+		return invalid("set_property", ds.name, fmt.Sprintf("property %q is read-only", name))
+	}
+	if _, native := datasetDefaults[name]; !native && !nonInheritableProps[name] {
+		return invalid("set_property", ds.name, fmt.Sprintf("invalid property %q", name))
+	}
+	if ds.typ == driver.DatasetSnapshot {
+		return invalid("set_property", ds.name, "this property can not be modified for snapshots")
+	}
+	if (name == "volsize" || name == "volblocksize") && ds.typ != driver.DatasetVolume {
+		return invalid("set_property", ds.name, fmt.Sprintf("property %q does not apply to filesystems", name))
+	}
+	return nil
+}
+
+// validateInheritProp applies the rules libzfs uses when a property is
+// inherited. Reverting to the received value is allowed for every settable property.
+func validateInheritProp(ds *fakeDataset, name string, received bool) error {
+	if isUserProp(name) {
+		return driver.ValidateUserProp(ds.name, name, "")
+	}
+
+	canonical, ok := driver.CanonicalDatasetProp(name)
+	if !ok {
+		return invalid("inherit_property", ds.name, fmt.Sprintf("invalid property %q", name))
+	}
+	if readOnlyProps[canonical] || driver.IsDatasetPropReadOnly(canonical) {
+		return invalid("inherit_property", ds.name, fmt.Sprintf("property %q is read-only", canonical))
+	}
+	if nonInheritableProps[canonical] && !received {
+		return invalid("inherit_property", ds.name, fmt.Sprintf("property %q cannot be inherited", canonical))
+	}
+	return nil
+}
+
+// Naming rules
+
+func isNameChar(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("-_.: ", c))
+}
+
+// validatePoolName applies the libzfs pool naming rules
+func validatePoolName(name string) error {
+	if name == "" {
+		return invalid("validate_name", name, "pool name is empty")
+	}
+	if len(name) >= maxNameLen {
+		return zfserrors.NewZfsError("validate_name", name, zfserrors.ErrCodeNameTooLong, errnoNameLong,
+			"name is too long", nil)
+	}
+	for _, c := range name {
+		if !isNameChar(c) {
+			return invalid("validate_name", name, fmt.Sprintf("invalid character %q in pool name", c))
+		}
+	}
+	if !unicode.IsLetter(rune(name[0])) {
+		return invalid("validate_name", name, "pool name must begin with a letter")
+	}
+	if name == "mirror" || name == "raidz" || name == "draid" || name == "spare" || name == "log" {
+		return invalid("validate_name", name, "name is reserved")
+	}
+	if len(name) > 1 && name[0] == 'c' && unicode.IsDigit(rune(name[1])) {
+		return invalid("validate_name", name, "pool name is reserved for disk names")
+	}
+	return nil
+}
+
+// validateDatasetName applies the libzfs dataset and snapshot naming rules
+func validateDatasetName(name string, allowSnapshot bool) error {
+	if len(name) >= maxNameLen {
+		return zfserrors.NewZfsError("validate_name", name, zfserrors.ErrCodeNameTooLong, errnoNameLong,
+			"name is too long", nil)
+	}
+	if strings.Contains(name, "#") {
+		return invalid("validate_name", name, "bookmarks are not supported here")
+	}
+
+	path, snap, isSnapshot := strings.Cut(name, "@")
+	if isSnapshot {
+		if !allowSnapshot {
+			return invalid("validate_name", name, "snapshot delimiter '@' is not expected here")
+		}
+		if snap == "" {
+			return invalid("validate_name", name, "empty snapshot name")
+		}
+		for _, c := range snap {
+			if !isNameChar(c) {
+				return invalid("validate_name", name, fmt.Sprintf("invalid character %q in snapshot name", c))
+			}
+		}
+	}
+
+	components := strings.Split(path, "/")
+	for _, component := range components {
+		switch component {
+		case "":
+			return invalid("validate_name", name, "empty component in name")
+		case ".", "..":
+			return invalid("validate_name", name, "self or parent references are not allowed")
+		}
+		for _, c := range component {
+			if !isNameChar(c) {
+				return invalid("validate_name", name, fmt.Sprintf("invalid character %q in name", c))
+			}
+		}
+	}
+	return validatePoolName(components[0])
+}
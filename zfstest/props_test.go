@@ -0,0 +1,59 @@
+package zfstest
+
+import (
+	"testing"
+)
+
+func TestValidatePoolName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"tank", false},
+		{"tank_01.backup:a-b", false},
+		{"", true},
+		{"1tank", true},
+		{"mirror", true},
+		{"raidz", true},
+		{"c0d0", true},
+		{"tank/data", true},
+		{"tank@snap", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validatePoolName(test.name)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validatePoolName(%q) error = %v, wantErr %v", test.name, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDatasetName(t *testing.T) {
+	tests := []struct {
+		name          string
+		allowSnapshot bool
+		wantErr       bool
+	}{
+		{"tank/data", false, false},
+		{"tank/data@snap", true, false},
+		{"tank/data@snap", false, true},
+		{"tank/data@", true, true},
+		{"tank//data", false, true},
+		{"tank/data/", false, true},
+		{"tank/../data", false, true},
+		{"tank/da*ta", false, true},
+		{"tank/data#mark", true, true},
+		{"tank/a@b@c", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateDatasetName(test.name, test.allowSnapshot)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateDatasetName(%q) error = %v, wantErr %v", test.name, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,942 @@
+package zfstest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// SetVdevState forces the state of a leaf vdev, e.g. to simulate a faulted disk
+func (d *FakeDriver) SetVdevState(poolName, device, state string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaf, _ := pool.findLeaf(device)
+	if leaf == nil {
+		return vdevNotFound("set_vdev_state", poolName, device)
+	}
+	leaf.state = state
+	pool.root.refreshState()
+	return nil
+}
+
+// SetVdevErrors sets the read, write and checksum error counters of a leaf
+// vdev, as reported by GetPoolStatus until the vdev is cleared
+func (d *FakeDriver) SetVdevErrors(poolName, device string, read, write, checksum uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaf, _ := pool.findLeaf(device)
+	if leaf == nil {
+		return vdevNotFound("set_vdev_errors", poolName, device)
+	}
+	leaf.errors = [3]uint64{read, write, checksum}
+	return nil
+}
+
+// CompleteVdevActions finishes the initializing and TRIM running on the
+// leaf vdevs of a pool. Fake vdevs make no progress on their own.
+func (d *FakeDriver) CompleteVdevActions(poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	now := uint64(time.Now().Unix())
+	pool.root.walkLeaves(func(leaf *fakeVdev) {
+		for _, progress := range []*driver.VdevProgress{&leaf.initialize, &leaf.trim} {
+			if progress.State == driver.VdevActionStateActive {
+				progress.State = driver.VdevActionStateComplete
+				progress.BytesDone = progress.BytesEst
+				progress.ActionTime = now
+			}
+		}
+	})
+	return nil
+}
+
+// CompleteRemoval finishes the running removal of a top-level vdev, which
+// leaves an indirect vdev in its place. Fake removals make no progress on
+// their own.
+func (d *FakeDriver) CompleteRemoval(poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	removal := pool.removal
+	if removal == nil || removal.State != driver.PoolScanStateScanning {
+		return nil
+	}
+	top := pool.root.children[removal.Vdev]
+	pool.root.children[removal.Vdev] = &fakeVdev{
+		typ:   driver.VdevTypeIndirect,
+		class: top.class,
+		guid:  top.guid,
+		state: VdevStateOnline,
+	}
+	removal.State = driver.PoolScanStateFinished
+	removal.EndTime = uint64(time.Now().Unix())
+	removal.Copied = removal.ToCopy
+	pool.root.refreshState()
+	return nil
+}
+
+func (d *FakeDriver) AddVdev(ctx context.Context, poolName string, vdevSpec driver.VdevSpec) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkDevicesFree("add_vdev", poolName, vdevSpec.Devices); err != nil {
+		return err
+	}
+
+	typ := driver.SpecType(vdevSpec)
+	switch vdevSpec.Class {
+	case driver.VdevClassSpare, driver.VdevClassCache:
+		if typ != driver.VdevTypeDisk || len(vdevSpec.Devices) == 0 {
+			return invalid("add_vdev", poolName, fmt.Sprintf("unsupported '%s' device: %s", vdevSpec.Class, typ))
+		}
+		pool.addAux(d, vdevSpec)
+		return nil
+	}
+
+	minDevices := map[string]int{
+		driver.VdevTypeDisk:   1,
+		driver.VdevTypeMirror: 2,
+		driver.VdevTypeRaidz:  3,
+		driver.VdevTypeRaidz2: 4,
+		driver.VdevTypeRaidz3: 5,
+		driver.VdevTypeDraid:  2,
+	}
+	min, ok := minDevices[typ]
+	if !ok {
+		return unsupported("add_vdev", poolName, fmt.Sprintf("unsupported vdev type: %s", typ))
+	}
+	if len(vdevSpec.Devices) < min || (typ == driver.VdevTypeDisk && len(vdevSpec.Devices) != 1) {
+		return invalid("add_vdev", poolName, fmt.Sprintf("%s vdev requires at least %d devices, got %d",
+			typ, min, len(vdevSpec.Devices)))
+	}
+	if typ == driver.VdevTypeDraid {
+		if _, err := driver.DraidLayout(vdevSpec); err != nil {
+			return invalid("add_vdev", poolName, err.Error())
+		}
+	}
+
+	pool.root.children = append(pool.root.children, d.newVdev(vdevSpec))
+	return nil
+}
+
+func (d *FakeDriver) AttachVdev(ctx context.Context, poolName, oldDevice, newDevice string, replacing bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaf, parent := pool.findLeaf(oldDevice)
+	if leaf == nil {
+		return vdevNotFound("attach_vdev", poolName, oldDevice)
+	}
+	if err := d.checkDevicesFree("attach_vdev", poolName, []string{newDevice}); err != nil {
+		return err
+	}
+
+	if replacing {
+		leaf.path = newDevice
+		leaf.guid = d.newGUID()
+		leaf.state = VdevStateOnline
+		pool.root.refreshState()
+		return nil
+	}
+
+	switch parent.typ {
+	case driver.VdevTypeMirror:
+		parent.children = append(parent.children, d.newLeaf(newDevice))
+	case driver.VdevTypeRoot:
+		mirror := &fakeVdev{
+			typ:      driver.VdevTypeMirror,
+			guid:     d.newGUID(),
+			state:    VdevStateOnline,
+			children: []*fakeVdev{leaf, d.newLeaf(newDevice)},
+		}
+		parent.replaceChild(leaf, mirror)
+	default:
+		return unsupported("attach_vdev", poolName, fmt.Sprintf("can only attach to mirrors and top-level disks, not %s", parent.typ))
+	}
+	pool.root.refreshState()
+	return nil
+}
+
+func (d *FakeDriver) DetachVdev(ctx context.Context, poolName, device string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaf, parent := pool.findLeaf(device)
+	if leaf == nil {
+		return vdevNotFound("detach_vdev", poolName, device)
+	}
+	if parent.typ != driver.VdevTypeMirror {
+		return unsupported("detach_vdev", poolName, "only applicable to mirror and replacing vdevs")
+	}
+
+	parent.removeChild(leaf)
+	if len(parent.children) == 1 {
+		pool.root.replaceChild(parent, parent.children[0])
+	}
+	pool.root.refreshState()
+	return nil
+}
+
+func (d *FakeDriver) ReplaceVdev(ctx context.Context, poolName, oldDevice, newDevice string) error {
+	return d.AttachVdev(ctx, poolName, oldDevice, newDevice, true)
+}
+
+// RemoveVdev removes hot spares, cache and log devices right away. Other
+// top-level vdevs are marked as removing until CompleteRemoval finishes the
+// evacuation or CancelRemoval stops it.
+func (d *FakeDriver) RemoveVdev(ctx context.Context, poolName, device string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	if pool.removeAux(device) {
+		return nil
+	}
+	top := pool.root.findTop(device)
+	if top == nil {
+		return vdevNotFound("remove_vdev", poolName, device)
+	}
+	if top.typ != driver.VdevTypeDisk && top.typ != driver.VdevTypeMirror {
+		return unsupported("remove_vdev", poolName, fmt.Sprintf("cannot remove %s vdevs", top.typ))
+	}
+	if top.removing {
+		return busy("remove_vdev", poolName, "removal in progress")
+	}
+	live := 0
+	for _, child := range pool.root.children {
+		if !child.removed() && !child.removing {
+			live++
+		}
+	}
+	if live == 1 {
+		return invalid("remove_vdev", poolName, "cannot remove the only top-level vdev")
+	}
+
+	// Log vdevs leave a hole behind right away, the data of other vdevs is
+	// copied off before they turn into an indirect vdev
+	if top.class == driver.VdevClassLog {
+		pool.root.replaceChild(top, &fakeVdev{typ: driver.VdevTypeHole, state: VdevStateOnline})
+		pool.root.refreshState()
+		return nil
+	}
+	if pool.checkpoint != nil {
+		return busy("remove_vdev", poolName, "checkpoint exists")
+	}
+	if pool.inProgress(driver.WaitRemove) {
+		return busy("remove_vdev", poolName, "removal in progress")
+	}
+	top.removing = true
+	pool.removal = &driver.RemovalInfo{
+		State:     driver.PoolScanStateScanning,
+		Vdev:      uint64(pool.root.childIndex(top)),
+		StartTime: uint64(time.Now().Unix()),
+	}
+	return nil
+}
+
+func (d *FakeDriver) CancelRemoval(ctx context.Context, poolName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	if !pool.inProgress(driver.WaitRemove) {
+		return noEntry("cancel_removal", poolName, "no removal in progress")
+	}
+	pool.root.children[pool.removal.Vdev].removing = false
+	pool.removal.State = driver.PoolScanStateCanceled
+	pool.removal.EndTime = uint64(time.Now().Unix())
+	return nil
+}
+
+func (d *FakeDriver) OnlineVdev(ctx context.Context, poolName, device string, flags driver.VdevOnlineFlags) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return "", err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return "", err
+	}
+
+	leaf, _ := pool.findLeaf(device)
+	if leaf == nil {
+		return "", vdevNotFound("online_vdev", poolName, device)
+	}
+
+	if flags&driver.VdevOnlineForceFault != 0 {
+		leaf.state = VdevStateFaulted
+	} else {
+		leaf.state = VdevStateOnline
+	}
+	pool.root.refreshState()
+	return leaf.state, nil
+}
+
+func (d *FakeDriver) OfflineVdev(ctx context.Context, poolName, device string, temporary bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaf, parent := pool.findLeaf(device)
+	if leaf == nil {
+		return vdevNotFound("offline_vdev", poolName, device)
+	}
+
+	// Refuse to take the last healthy replica of a top-level vdev offline
+	healthy := 0
+	for _, sibling := range parent.children {
+		if sibling != leaf && sibling.state == VdevStateOnline {
+			healthy++
+		}
+	}
+	if parent.typ == driver.VdevTypeRoot || healthy < len(parent.children)-parent.parity() {
+		return busy("offline_vdev", poolName, fmt.Sprintf("cannot offline %s: no valid replicas", device))
+	}
+
+	leaf.state = VdevStateOffline
+	pool.root.refreshState()
+	return nil
+}
+
+func (d *FakeDriver) ClearVdev(ctx context.Context, poolName, device string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	if device == "" {
+		pool.root.clearFaults()
+	} else {
+		leaf, _ := pool.findLeaf(device)
+		if leaf == nil {
+			return vdevNotFound("clear_vdev", poolName, device)
+		}
+		leaf.clearFaults()
+	}
+	pool.root.refreshState()
+	return nil
+}
+
+func (d *FakeDriver) InitializeVdevs(ctx context.Context, poolName string, devices []string, cmd driver.VdevActionCommand) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaves, err := pool.actionLeaves("initialize_vdevs", devices)
+	if err != nil {
+		return err
+	}
+	return vdevAction("initialize_vdevs", poolName, "initialized", leaves, cmd,
+		func(leaf *fakeVdev) *driver.VdevProgress { return &leaf.initialize })
+}
+
+// TrimVdevs tracks manual TRIM per leaf vdev. Every fake device supports
+// secure TRIM, and the rate is accepted but has no effect.
+func (d *FakeDriver) TrimVdevs(ctx context.Context, poolName string, devices []string, opts driver.TrimOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return err
+	}
+
+	leaves, err := pool.actionLeaves("trim_vdevs", devices)
+	if err != nil {
+		return err
+	}
+	return vdevAction("trim_vdevs", poolName, "trimmed", leaves, opts.Command,
+		func(leaf *fakeVdev) *driver.VdevProgress { return &leaf.trim })
+}
+
+// SplitPool moves one side of every mirror into a new pool, which gets a
+// copy of the datasets. Log devices, hot spares and cache devices stay.
+func (d *FakeDriver) SplitPool(ctx context.Context, poolName, newPoolName string, opts driver.SplitOptions) (*driver.VdevInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.check(ctx); err != nil {
+		return nil, err
+	}
+
+	pool, err := d.pool(poolName)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePoolName(newPoolName); err != nil {
+		return nil, err
+	}
+	if _, exists := d.pools[newPoolName]; exists {
+		return nil, zfserrors.NewZfsError("split_pool", newPoolName, zfserrors.ErrCodeExists, errnoExist,
+			"pool already exists", nil)
+	}
+	props, err := driver.SplitProps(newPoolName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if pool.checkpoint != nil {
+		return nil, busy("split_pool", poolName, "checkpoint exists")
+	}
+
+	mirrors, sides, err := pool.splitSides(driver.SplitDevices(opts.Devices))
+	if err != nil {
+		return nil, err
+	}
+	root := &fakeVdev{typ: driver.VdevTypeRoot, path: newPoolName, guid: d.newGUID(), state: VdevStateOnline}
+	root.children = sides
+	if opts.DryRun {
+		info := root.info(0)
+		return &info, nil
+	}
+
+	for i, mirror := range mirrors {
+		mirror.removeChild(sides[i])
+		if len(mirror.children) == 1 {
+			mirror.children[0].class = mirror.class
+			pool.root.replaceChild(mirror, mirror.children[0])
+		}
+		sides[i].class = mirror.class
+	}
+	pool.root.refreshState()
+	root.refreshState()
+
+	split := &fakePool{
+		name:     pool.name,
+		guid:     root.guid,
+		state:    poolStateActive,
+		props:    copyProps(pool.props),
+		root:     root,
+		datasets: copyDatasets(pool.datasets),
+	}
+	split.rename(newPoolName)
+	delete(split.props, "altroot")
+	delete(split.props, "readonly")
+	for name, value := range props {
+		split.props[name] = value
+	}
+
+	if opts.Import || opts.AltRoot != "" {
+		d.pools[newPoolName] = split
+	} else {
+		split.state = poolStateExported
+		d.detached = append(d.detached, split)
+	}
+	return nil, nil
+}
+
+// Vdev tree helpers
+
+func (d *FakeDriver) newLeaf(path string) *fakeVdev {
+	return &fakeVdev{typ: driver.VdevTypeDisk, path: path, guid: d.newGUID(), state: VdevStateOnline}
+}
+
+// newVdev builds the top-level vdev of a validated spec
+func (d *FakeDriver) newVdev(spec driver.VdevSpec) *fakeVdev {
+	if driver.SpecType(spec) == driver.VdevTypeDisk {
+		leaf := d.newLeaf(spec.Devices[0])
+		leaf.class = spec.Class
+		return leaf
+	}
+
+	group := &fakeVdev{typ: spec.Type, class: spec.Class, guid: d.newGUID(), state: VdevStateOnline}
+	if spec.Type == driver.VdevTypeDraid {
+		group.draid, _ = driver.DraidLayout(spec)
+	}
+	for _, path := range spec.Devices {
+		group.children = append(group.children, d.newLeaf(path))
+	}
+	return group
+}
+
+// Helper function to reject devices already used by another pool
+func (d *FakeDriver) checkDevicesFree(op, poolName string, devices []string) error {
+	inUse := make(map[string]string)
+	for _, pool := range d.pools {
+		pool.walkDevices(func(leaf *fakeVdev) { inUse[leaf.path] = pool.name })
+	}
+	for _, pool := range d.detached {
+		if pool.state != poolStateDestroyed {
+			pool.walkDevices(func(leaf *fakeVdev) { inUse[leaf.path] = pool.name })
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		if owner, ok := inUse[device]; ok {
+			return busy(op, poolName, fmt.Sprintf("%s is part of pool %s", device, owner))
+		}
+		if seen[device] {
+			return invalid(op, poolName, fmt.Sprintf("%s is specified more than once", device))
+		}
+		seen[device] = true
+	}
+	return nil
+}
+
+// walkDevices calls fn for every device of the pool, spares and cache
+// devices included
+func (p *fakePool) walkDevices(fn func(*fakeVdev)) {
+	p.root.walkLeaves(fn)
+	for _, aux := range append(p.spares, p.l2cache...) {
+		fn(aux)
+	}
+}
+
+// splitSides picks the side of every mirror a split moves to the new pool:
+// the one named in devices, the last one otherwise. Log vdevs are skipped
+// and any other top-level vdev that is not a mirror fails the split.
+func (p *fakePool) splitSides(devices []string) (mirrors, sides []*fakeVdev, err error) {
+	used := make(map[string]bool)
+	for _, top := range p.root.children {
+		switch {
+		case top.typ == driver.VdevTypeHole || top.class == driver.VdevClassLog:
+			continue
+		case top.typ != driver.VdevTypeMirror:
+			return nil, nil, invalid("split_pool", p.name, "source pool must be composed only of mirrors")
+		}
+
+		side := top.children[len(top.children)-1]
+		named := 0
+		for _, child := range top.children {
+			for _, device := range devices {
+				if child.matches(device) {
+					side = child
+					used[device] = true
+					named++
+				}
+			}
+		}
+		if named > 1 {
+			return nil, nil, invalid("split_pool", p.name, "more than one device named for the same mirror")
+		}
+		mirrors = append(mirrors, top)
+		sides = append(sides, side)
+	}
+
+	for _, device := range devices {
+		if !used[device] {
+			return nil, nil, vdevNotFound("split_pool", p.name, device)
+		}
+	}
+	return mirrors, sides, nil
+}
+
+// Helper function to find a leaf vdev by path, short device name or GUID
+func (p *fakePool) findLeaf(device string) (leaf, parent *fakeVdev) {
+	var walk func(v *fakeVdev)
+	walk = func(v *fakeVdev) {
+		for _, child := range v.children {
+			if leaf != nil {
+				return
+			}
+			if len(child.children) == 0 && !child.removed() && child.matches(device) {
+				leaf, parent = child, v
+				return
+			}
+			walk(child)
+		}
+	}
+	walk(p.root)
+	return leaf, parent
+}
+
+// actionLeaves returns the leaf vdevs to initialize or trim, all of them
+// when no devices are named. Spares and cache devices are never included.
+func (p *fakePool) actionLeaves(op string, devices []string) ([]*fakeVdev, error) {
+	var leaves []*fakeVdev
+	if len(devices) == 0 {
+		p.root.walkLeaves(func(leaf *fakeVdev) {
+			leaves = append(leaves, leaf)
+		})
+		return leaves, nil
+	}
+	for _, device := range devices {
+		leaf, _ := p.findLeaf(device)
+		if leaf == nil {
+			return nil, vdevNotFound(op, p.name, device)
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+// vdevAction applies an initialize or TRIM command to the progress of the
+// leaves, checking every leaf before changing any of them
+func vdevAction(op, poolName, verb string, leaves []*fakeVdev, cmd driver.VdevActionCommand, progressOf func(*fakeVdev) *driver.VdevProgress) error {
+	for _, leaf := range leaves {
+		state := progressOf(leaf).State
+		switch cmd {
+		case driver.VdevActionStart:
+			if state == driver.VdevActionStateActive {
+				return busy(op, poolName, fmt.Sprintf("%s is currently being %s", leaf.path, verb))
+			}
+			if leaf.state != VdevStateOnline {
+				return invalid(op, poolName, fmt.Sprintf("%s is not writeable", leaf.path))
+			}
+		case driver.VdevActionSuspend, driver.VdevActionCancel:
+			if state != driver.VdevActionStateActive &&
+				!(cmd == driver.VdevActionCancel && state == driver.VdevActionStateSuspended) {
+				return noEntry(op, poolName, fmt.Sprintf("%s is not currently being %s", leaf.path, verb))
+			}
+		default:
+			return invalid(op, poolName, fmt.Sprintf("unknown command %d", cmd))
+		}
+	}
+
+	now := uint64(time.Now().Unix())
+	for _, leaf := range leaves {
+		progress := progressOf(leaf)
+		switch cmd {
+		case driver.VdevActionStart:
+			// A suspended run resumes where it stopped
+			if progress.State != driver.VdevActionStateSuspended {
+				*progress = driver.VdevProgress{BytesEst: fakeDiskSize}
+			}
+			progress.State = driver.VdevActionStateActive
+		case driver.VdevActionSuspend:
+			progress.State = driver.VdevActionStateSuspended
+		case driver.VdevActionCancel:
+			progress.State = driver.VdevActionStateCanceled
+		}
+		progress.ActionTime = now
+	}
+	return nil
+}
+
+// addAux adds the devices of a spare or cache spec to the pool
+func (p *fakePool) addAux(d *FakeDriver, spec driver.VdevSpec) {
+	for _, path := range spec.Devices {
+		dev := d.newLeaf(path)
+		dev.class = spec.Class
+		if spec.Class == driver.VdevClassSpare {
+			dev.state = VdevStateAvail
+			p.spares = append(p.spares, dev)
+		} else {
+			p.l2cache = append(p.l2cache, dev)
+		}
+	}
+}
+
+// removeAux removes a hot spare or cache device, reporting whether device
+// was one
+func (p *fakePool) removeAux(device string) bool {
+	for _, list := range []*[]*fakeVdev{&p.spares, &p.l2cache} {
+		for i, dev := range *list {
+			if dev.matches(device) {
+				*list = append((*list)[:i], (*list)[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Helper function to find the top-level vdev containing a device
+func (v *fakeVdev) findTop(device string) *fakeVdev {
+	for _, top := range v.children {
+		if top.removed() {
+			continue
+		}
+		if top.matches(device) {
+			return top
+		}
+		found := false
+		top.walkLeaves(func(leaf *fakeVdev) {
+			if leaf.matches(device) {
+				found = true
+			}
+		})
+		if found {
+			return top
+		}
+	}
+	return nil
+}
+
+func (v *fakeVdev) matches(device string) bool {
+	if device == "" {
+		return false
+	}
+	if v.path == device || v.path == "/dev/"+device {
+		return true
+	}
+	return strconv.FormatUint(v.guid, 10) == device
+}
+
+// removed reports whether the vdev is what a removed top-level vdev leaves
+// behind, which has no devices
+func (v *fakeVdev) removed() bool {
+	return v.typ == driver.VdevTypeIndirect || v.typ == driver.VdevTypeHole
+}
+
+func (v *fakeVdev) walkLeaves(fn func(*fakeVdev)) {
+	if v.removed() {
+		return
+	}
+	if len(v.children) == 0 && v.typ != driver.VdevTypeRoot {
+		fn(v)
+		return
+	}
+	for _, child := range v.children {
+		child.walkLeaves(fn)
+	}
+}
+
+func (v *fakeVdev) replaceChild(old, new *fakeVdev) {
+	for i, child := range v.children {
+		if child == old {
+			v.children[i] = new
+			return
+		}
+	}
+}
+
+func (v *fakeVdev) childIndex(child *fakeVdev) int {
+	for i, other := range v.children {
+		if other == child {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *fakeVdev) removeChild(old *fakeVdev) {
+	for i, child := range v.children {
+		if child == old {
+			v.children = append(v.children[:i], v.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// parity returns how many children of this vdev may fail without data loss
+func (v *fakeVdev) parity() int {
+	switch v.typ {
+	case driver.VdevTypeMirror:
+		return len(v.children) - 1
+	case driver.VdevTypeRaidz:
+		return 1
+	case driver.VdevTypeRaidz2:
+		return 2
+	case driver.VdevTypeRaidz3:
+		return 3
+	case driver.VdevTypeDraid:
+		return v.draid.Parity
+	default:
+		return 0
+	}
+}
+
+func (v *fakeVdev) capacity() uint64 {
+	switch v.typ {
+	case driver.VdevTypeDisk:
+		return fakeDiskSize
+	case driver.VdevTypeMirror:
+		return fakeDiskSize
+	case driver.VdevTypeRaidz, driver.VdevTypeRaidz2, driver.VdevTypeRaidz3:
+		return uint64(len(v.children)-v.parity()) * fakeDiskSize
+	case driver.VdevTypeDraid:
+		data := uint64(v.draid.Data)
+		return uint64(len(v.children)-v.draid.Spares) * fakeDiskSize * data / (data + uint64(v.draid.Parity))
+	}
+
+	// Log devices do not add to the pool size
+	var total uint64
+	for _, child := range v.children {
+		if child.class != driver.VdevClassLog {
+			total += child.capacity()
+		}
+	}
+	return total
+}
+
+// info describes the vdev and its children as they appear in a pool status
+func (v *fakeVdev) info(id int) driver.VdevInfo {
+	info := driver.VdevInfo{
+		Type:  v.typ,
+		ID:    uint64(id),
+		Path:  v.path,
+		GUID:  v.guid,
+		State: v.state,
+		Class: v.class,
+		Stats: driver.VdevStats{
+			Space:          v.capacity(),
+			DSpace:         v.capacity(),
+			ReadErrors:     v.errors[0],
+			WriteErrors:    v.errors[1],
+			ChecksumErrors: v.errors[2],
+		},
+		Initialize: v.initialize,
+		Trim:       v.trim,
+		Removing:   v.removing,
+	}
+	switch v.typ {
+	case driver.VdevTypeRaidz, driver.VdevTypeRaidz2, driver.VdevTypeRaidz3, driver.VdevTypeDraid:
+		info.NParity = uint64(v.parity())
+	}
+	for i, child := range v.children {
+		// Holes keep the IDs of later top-level vdevs but are not shown
+		if child.typ != driver.VdevTypeHole {
+			info.Children = append(info.Children, child.info(i))
+		}
+	}
+	return info
+}
+
+// auxInfo describes hot spares or cache devices
+func auxInfo(devices []*fakeVdev) []driver.VdevInfo {
+	var infos []driver.VdevInfo
+	for i, dev := range devices {
+		infos = append(infos, dev.info(i))
+	}
+	return infos
+}
+
+func (v *fakeVdev) clearFaults() {
+	if len(v.children) == 0 && v.state == VdevStateFaulted {
+		v.state = VdevStateOnline
+	}
+	v.errors = [3]uint64{}
+	for _, child := range v.children {
+		child.clearFaults()
+	}
+}
+
+// refreshState recomputes interior vdev states from their children
+func (v *fakeVdev) refreshState() {
+	if len(v.children) == 0 {
+		return
+	}
+
+	unhealthy := 0
+	for _, child := range v.children {
+		child.refreshState()
+		if child.state != VdevStateOnline {
+			unhealthy++
+		}
+	}
+
+	switch {
+	case unhealthy == 0:
+		v.state = VdevStateOnline
+	case v.typ == driver.VdevTypeRoot:
+		v.state = VdevStateDegraded
+		for _, child := range v.children {
+			if child.state != VdevStateOnline && child.state != VdevStateDegraded {
+				v.state = VdevStateUnavail
+			}
+		}
+	case unhealthy > v.parity():
+		v.state = VdevStateUnavail
+	default:
+		v.state = VdevStateDegraded
+	}
+}
+
+func copyRemoval(removal *driver.RemovalInfo) *driver.RemovalInfo {
+	if removal == nil {
+		return nil
+	}
+	c := *removal
+	return &c
+}
@@ -0,0 +1,261 @@
+package zfstest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	zfserrors "github.com/zombocoder/go-freebsd-libzfs/errors"
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+func TestFakeDriver_VdevState(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	if err := d.OfflineVdev(ctx, "tank", "/dev/ada0", false); !zfserrors.IsBusy(err) {
+		t.Errorf("OfflineVdev() of only replica error = %v, want EBUSY", err)
+	}
+
+	mustNoErr(t, d.AttachVdev(ctx, "tank", "ada0", "/dev/ada1", false))
+	mustNoErr(t, d.OfflineVdev(ctx, "tank", "/dev/ada1", false))
+
+	pools, err := d.ListPools(ctx)
+	mustNoErr(t, err)
+	if pools[0].Health != "DEGRADED" {
+		t.Errorf("Health after offline = %q, want DEGRADED", pools[0].Health)
+	}
+
+	if err := d.OfflineVdev(ctx, "tank", "/dev/ada0", false); !zfserrors.IsBusy(err) {
+		t.Errorf("OfflineVdev() of last online mirror side error = %v, want EBUSY", err)
+	}
+
+	state, err := d.OnlineVdev(ctx, "tank", "/dev/ada1", 0)
+	if err != nil || state != VdevStateOnline {
+		t.Errorf("OnlineVdev() = %q, %v, want ONLINE", state, err)
+	}
+	mustNoErr(t, d.DetachVdev(ctx, "tank", "/dev/ada1"))
+
+	if got := d.pools["tank"].root.children[0].typ; got != driver.VdevTypeDisk {
+		t.Errorf("top-level vdev after detach = %q, want disk", got)
+	}
+}
+
+func TestFakeDriver_AddRemoveVdev(t *testing.T) {
+	ctx := context.Background()
+	d := newTestPool(t)
+
+	mustNoErr(t, d.AddVdev(ctx, "tank", driver.VdevSpec{Devices: []string{"/dev/ada1"}}))
+	mustNoErr(t, d.AddVdev(ctx, "tank", driver.VdevSpec{Devices: []string{"/dev/nvd0"}, Class: driver.VdevClassLog}))
+	mustNoErr(t, d.AddVdev(ctx, "tank", driver.VdevSpec{Devices: []string{"/dev/ada2", "/dev/ada3"}, Class: driver.VdevClassSpare}))
+	mustNoErr(t, d.AddVdev(ctx, "tank", driver.VdevSpec{Devices: []string{"/dev/nvd1"}, Class: driver.VdevClassCache}))
+	if err := d.AddVdev(ctx, "tank", driver.VdevSpec{Type: driver.VdevTypeMirror, Devices: []string{"/dev/ada4", "/dev/ada5"}, Class: driver.VdevClassSpare}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("AddVdev() of a mirrored spare error = %v, want EINVAL", err)
+	}
+
+	status, err := d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if len(status.Vdevs.Children) != 3 || len(status.Spares) != 2 || len(status.L2Cache) != 1 {
+		t.Fatalf("GetPoolStatus() = %+v, want 3 top-level vdevs, 2 spares and a cache device", status)
+	}
+	if status.Removal != nil {
+		t.Errorf("Removal = %+v before any removal, want nil", status.Removal)
+	}
+
+	// Spares, cache and log devices are removed without an evacuation
+	for _, device := range []string{"/dev/ada3", "nvd1", "/dev/nvd0"} {
+		mustNoErr(t, d.RemoveVdev(ctx, "tank", device))
+	}
+	guid := strconv.FormatUint(status.Vdevs.Children[1].GUID, 10)
+	mustNoErr(t, d.RemoveVdev(ctx, "tank", guid))
+
+	status, err = d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if len(status.Vdevs.Children) != 2 || len(status.Spares) != 1 || len(status.L2Cache) != 0 {
+		t.Fatalf("GetPoolStatus() = %+v, want the removing vdev and one spare left", status)
+	}
+	if !status.Vdevs.Children[1].Removing {
+		t.Errorf("vdev 1 = %+v, want it marked as removing", status.Vdevs.Children[1])
+	}
+	if r := status.Removal; r == nil || r.State != driver.PoolScanStateScanning || r.Vdev != 1 {
+		t.Errorf("Removal = %+v, want the running removal of vdev 1", r)
+	}
+	if err := d.RemoveVdev(ctx, "tank", guid); !zfserrors.IsBusy(err) {
+		t.Errorf("RemoveVdev() during a removal error = %v, want EBUSY", err)
+	}
+
+	mustNoErr(t, d.CancelRemoval(ctx, "tank"))
+	if err := d.CancelRemoval(ctx, "tank"); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("CancelRemoval() without a removal error = %v, want ENOENT", err)
+	}
+	status, err = d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if status.Vdevs.Children[1].Removing {
+		t.Error("vdev 1 still marked as removing after CancelRemoval()")
+	}
+	if r := status.Removal; r == nil || r.State != driver.PoolScanStateCanceled || r.EndTime == 0 {
+		t.Errorf("Removal = %+v, want the canceled removal", r)
+	}
+
+	// A finished removal leaves an indirect vdev that keeps the ID
+	mustNoErr(t, d.RemoveVdev(ctx, "tank", guid))
+	mustNoErr(t, d.CompleteRemoval("tank"))
+	mustNoErr(t, d.AddVdev(ctx, "tank", driver.VdevSpec{Devices: []string{"/dev/ada4"}}))
+	status, err = d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if r := status.Removal; r == nil || r.State != driver.PoolScanStateFinished || r.Vdev != 1 || r.EndTime == 0 {
+		t.Errorf("Removal = %+v, want the finished removal of vdev 1", r)
+	}
+	if len(status.Vdevs.Children) != 3 {
+		t.Fatalf("top-level vdevs = %+v, want disk, indirect and the new disk", status.Vdevs.Children)
+	}
+	if indirect := status.Vdevs.Children[1]; indirect.Type != driver.VdevTypeIndirect || indirect.ID != 1 || indirect.Removing {
+		t.Errorf("vdev 1 = %+v, want an indirect vdev", indirect)
+	}
+	if added := status.Vdevs.Children[2]; added.ID != 3 {
+		t.Errorf("added vdev ID = %d, want 3 after the hole of the log", added.ID)
+	}
+	if err := d.RemoveVdev(ctx, "tank", guid); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("RemoveVdev() of an indirect vdev error = %v, want ENOENT", err)
+	}
+}
+
+func TestFakeDriver_SplitPool(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeDriver()
+	mustNoErr(t, d.CreatePool(ctx, "tank", []driver.VdevSpec{
+		mirror("/dev/ada0", "/dev/ada1"),
+		mirror("/dev/ada2", "/dev/ada3", "/dev/ada4"),
+		{Devices: []string{"/dev/nvd0"}, Class: driver.VdevClassLog},
+	}, driver.CreateOptions{Force: true}))
+	mustNoErr(t, d.CreateDataset(ctx, "tank/home", driver.DatasetFilesystem, nil))
+
+	for _, test := range []struct {
+		name    string
+		newPool string
+		opts    driver.SplitOptions
+		code    string
+	}{
+		{"existing pool", "tank", driver.SplitOptions{}, zfserrors.ErrCodeExists},
+		{"unknown device", "copy", driver.SplitOptions{Devices: []string{"ada9"}}, zfserrors.ErrCodeNotFound},
+		{"both sides", "copy", driver.SplitOptions{Devices: []string{"ada0", "ada1"}}, zfserrors.ErrCodeInval},
+		{"bad property", "copy", driver.SplitOptions{Properties: map[string]string{"bogus": "1"}}, zfserrors.ErrCodeInval},
+	} {
+		if _, err := d.SplitPool(ctx, "tank", test.newPool, test.opts); errCode(err) != test.code {
+			t.Errorf("SplitPool(%s) error = %v, want %v", test.name, err, test.code)
+		}
+	}
+
+	tree, err := d.SplitPool(ctx, "tank", "copy", driver.SplitOptions{Devices: []string{"ada0"}, DryRun: true})
+	mustNoErr(t, err)
+	if tree == nil || len(tree.Children) != 2 || tree.Children[0].Path != "/dev/ada0" || tree.Children[1].Path != "/dev/ada4" {
+		t.Fatalf("SplitPool() dry run = %+v, want ada0 and ada4", tree)
+	}
+	if _, err := d.GetPoolStatus(ctx, "copy"); !zfserrors.IsPoolNotFound(err) {
+		t.Errorf("GetPoolStatus() after a dry run error = %v, want pool not found", err)
+	}
+
+	tree, err = d.SplitPool(ctx, "tank", "copy", driver.SplitOptions{Devices: []string{"ada0"}, AltRoot: "/mnt"})
+	mustNoErr(t, err)
+	if tree != nil {
+		t.Errorf("SplitPool() = %+v, want no tree without a dry run", tree)
+	}
+
+	status, err := d.GetPoolStatus(ctx, "tank")
+	mustNoErr(t, err)
+	if top := status.Vdevs.Children; len(top) != 3 || top[0].Type != driver.VdevTypeDisk || top[0].Path != "/dev/ada1" || len(top[1].Children) != 2 {
+		t.Errorf("tank vdevs after split = %+v, want ada1, a two-way mirror and the log", top)
+	}
+	status, err = d.GetPoolStatus(ctx, "copy")
+	mustNoErr(t, err)
+	if top := status.Vdevs.Children; len(top) != 2 || top[0].Path != "/dev/ada0" || top[1].Path != "/dev/ada4" {
+		t.Errorf("copy vdevs = %+v, want ada0 and ada4", top)
+	}
+	props, err := d.GetPoolProps(ctx, "copy", []string{"altroot"})
+	mustNoErr(t, err)
+	if props["altroot"].Value != "/mnt" {
+		t.Errorf("altroot = %q, want /mnt", props["altroot"].Value)
+	}
+	datasets, err := d.ListDatasetsInPool(ctx, "copy", true)
+	mustNoErr(t, err)
+	if len(datasets) != 2 || datasets[1].Name != "copy/home" {
+		t.Errorf("copy datasets = %+v, want copy and copy/home", datasets)
+	}
+
+	// tank has a plain disk now, which cannot be split
+	if _, err := d.SplitPool(ctx, "tank", "other", driver.SplitOptions{}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("SplitPool() of a disk error = %v, want EINVAL", err)
+	}
+	mustNoErr(t, d.AttachVdev(ctx, "tank", "ada1", "/dev/ada5", false))
+	_, err = d.SplitPool(ctx, "tank", "other", driver.SplitOptions{})
+	mustNoErr(t, err)
+	pools, err := d.DiscoverPools(ctx, driver.DiscoverOptions{Pool: "other"})
+	mustNoErr(t, err)
+	if len(pools) != 1 || len(pools[0].Vdevs.Children) != 2 || pools[0].Vdevs.Children[0].Path != "/dev/ada5" {
+		t.Errorf("DiscoverPools() = %+v, want exported pool other with ada5 and ada3", pools)
+	}
+}
+
+func TestFakeDriver_InitializeAndTrim(t *testing.T) {
+	ctx := context.Background()
+	d := NewFakeDriver()
+	mustNoErr(t, d.CreatePool(ctx, "tank", []driver.VdevSpec{mirror("/dev/ada0", "/dev/ada1")}, driver.CreateOptions{}))
+
+	leaves := func() []driver.VdevInfo {
+		t.Helper()
+		status, err := d.GetPoolStatus(ctx, "tank")
+		mustNoErr(t, err)
+		return status.Vdevs.Children[0].Children
+	}
+
+	if err := d.InitializeVdevs(ctx, "tank", []string{"/dev/ada0"}, driver.VdevActionSuspend); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("InitializeVdevs() suspend while idle error = %v, want ENOENT", err)
+	}
+	if err := d.InitializeVdevs(ctx, "tank", []string{"/dev/ada9"}, driver.VdevActionStart); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("InitializeVdevs() of a missing device error = %v, want ENOENT", err)
+	}
+
+	// Without devices every leaf is initialized
+	mustNoErr(t, d.InitializeVdevs(ctx, "tank", nil, driver.VdevActionStart))
+	for _, leaf := range leaves() {
+		if leaf.Initialize.State != driver.VdevActionStateActive || leaf.Initialize.ActionTime == 0 || leaf.Initialize.BytesEst == 0 {
+			t.Errorf("%s Initialize = %+v, want active", leaf.Path, leaf.Initialize)
+		}
+	}
+	if err := d.InitializeVdevs(ctx, "tank", []string{"ada1"}, driver.VdevActionStart); !zfserrors.IsBusy(err) {
+		t.Errorf("second InitializeVdevs() error = %v, want EBUSY", err)
+	}
+	mustNoErr(t, d.InitializeVdevs(ctx, "tank", []string{"/dev/ada1"}, driver.VdevActionSuspend))
+	mustNoErr(t, d.CompleteVdevActions("tank"))
+	got := leaves()
+	if got[0].Initialize.State != driver.VdevActionStateComplete || got[0].Initialize.BytesDone != got[0].Initialize.BytesEst {
+		t.Errorf("ada0 Initialize = %+v, want complete", got[0].Initialize)
+	}
+	if got[1].Initialize.State != driver.VdevActionStateSuspended {
+		t.Errorf("ada1 Initialize = %+v, want suspended", got[1].Initialize)
+	}
+
+	// TRIM is tracked apart from initializing, and WaitPool waits for it
+	mustNoErr(t, d.TrimVdevs(ctx, "tank", []string{"/dev/ada0"}, driver.TrimOptions{Secure: true, Rate: 1 << 20}))
+	if got := leaves(); got[0].Trim.State != driver.VdevActionStateActive || got[1].Trim.State != driver.VdevActionStateNone {
+		t.Errorf("Trim = %+v, %+v, want only ada0 active", got[0].Trim, got[1].Trim)
+	}
+	go func() {
+		time.Sleep(2 * fakeWaitInterval)
+		d.CompleteVdevActions("tank")
+	}()
+	waited, err := d.WaitPool(ctx, "tank", driver.WaitTrim)
+	mustNoErr(t, err)
+	if !waited || leaves()[0].Trim.State != driver.VdevActionStateComplete {
+		t.Errorf("WaitPool() = %v, Trim = %+v, want to wait for a complete TRIM", waited, leaves()[0].Trim)
+	}
+	if err := d.TrimVdevs(ctx, "tank", nil, driver.TrimOptions{Command: driver.VdevActionCancel}); errCode(err) != zfserrors.ErrCodeNotFound {
+		t.Errorf("TrimVdevs() cancel while idle error = %v, want ENOENT", err)
+	}
+
+	mustNoErr(t, d.OfflineVdev(ctx, "tank", "/dev/ada1", false))
+	if err := d.TrimVdevs(ctx, "tank", nil, driver.TrimOptions{}); errCode(err) != zfserrors.ErrCodeInval {
+		t.Errorf("TrimVdevs() with an offline device error = %v, want EINVAL", err)
+	}
+}
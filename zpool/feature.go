@@ -0,0 +1,182 @@
+package zpool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// Special values of the compatibility pool property
+const (
+	CompatibilityOff    = driver.CompatibilityOff    // Every feature may be enabled, the default
+	CompatibilityLegacy = driver.CompatibilityLegacy // No feature may be enabled
+)
+
+// Feature describes a feature flag of a pool, as zpool get all lists them
+type Feature struct {
+	Name           string // Short name, e.g. async_destroy
+	GUID           string // e.g. com.delphix:async_destroy
+	State          FeatureState
+	ReadOnlyCompat bool     // The pool can still be imported read-only by software lacking it
+	Dependencies   []string // Features enabled along with it
+}
+
+// CompatibilityReport compares the features of a pool against a
+// compatibility property value
+type CompatibilityReport struct {
+	Incompatible []string // Enabled or active features the value does not allow
+	Upgradable   []string // Disabled features the value allows
+}
+
+// Compatible reports whether the pool only uses features the compatibility
+// value allows
+func (r *CompatibilityReport) Compatible() bool {
+	return len(r.Incompatible) == 0
+}
+
+// Features lists every feature this library knows and its state on a pool,
+// sorted by name
+func (c *Client) Features(ctx context.Context, poolName string) ([]Feature, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	infos, err := c.d.GetPoolFeatures(ctx, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get features of pool %s: %w", poolName, err)
+	}
+
+	features := make([]Feature, len(infos))
+	for i, info := range infos {
+		features[i] = Feature{
+			Name:           info.Name,
+			GUID:           info.GUID,
+			State:          FeatureState(info.State),
+			ReadOnlyCompat: info.ReadOnlyCompat,
+			Dependencies:   info.Dependencies,
+		}
+	}
+	return features, nil
+}
+
+// EnableFeature enables a feature of a pool and the features it depends on,
+// like zpool set feature@name=enabled. Features cannot be disabled again.
+// As with zpool set, the compatibility property is not enforced here.
+func (c *Client) EnableFeature(ctx context.Context, poolName, feature string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.SetPoolProp(ctx, poolName, FeatureProperty(feature), driver.FeatureEnabled); err != nil {
+		return fmt.Errorf("failed to enable feature %s on pool %s: %w", feature, poolName, err)
+	}
+
+	return nil
+}
+
+// Upgrade enables every disabled feature of a pool that its compatibility
+// property allows, like zpool upgrade, and returns the names of the features
+// it enabled. Pools with older software may no longer import it afterwards.
+func (c *Client) Upgrade(ctx context.Context, poolName string) ([]string, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	props, err := c.d.GetPoolProps(ctx, poolName, []string{PropertyNameCompatibility})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get compatibility of pool %s: %w", poolName, err)
+	}
+	compatibility := CompatibilityOff
+	if prop, ok := props[PropertyNameCompatibility]; ok {
+		compatibility = fmt.Sprint(prop.Value)
+	}
+	allowed, err := c.d.LoadCompatibility(ctx, compatibility)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compatibility %s of pool %s: %w", compatibility, poolName, err)
+	}
+
+	before, err := c.d.GetPoolFeatures(ctx, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get features of pool %s: %w", poolName, err)
+	}
+	disabled := make(map[string]bool)
+	for _, feature := range before {
+		// Features the kernel enables itself are left alone, as zpool does
+		if feature.State == driver.FeatureDisabled && !feature.NoUpgrade {
+			disabled[feature.Name] = true
+		}
+	}
+	for _, name := range allowed {
+		if !disabled[name] {
+			continue
+		}
+		if err := c.d.SetPoolProp(ctx, poolName, FeatureProperty(name), driver.FeatureEnabled); err != nil {
+			return nil, fmt.Errorf("failed to enable feature %s on pool %s: %w", name, poolName, err)
+		}
+	}
+
+	// Dependencies may have been enabled along with the allowed features
+	after, err := c.d.GetPoolFeatures(ctx, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get features of pool %s: %w", poolName, err)
+	}
+	enabled := []string{}
+	for _, feature := range after {
+		if feature.State != driver.FeatureDisabled && disabled[feature.Name] {
+			enabled = append(enabled, feature.Name)
+		}
+	}
+	return enabled, nil
+}
+
+// CompatibilityFeatures returns the sorted features a compatibility property
+// value allows: off, legacy, or a comma-separated list of feature-set files
+// from /etc/zfs/compatibility.d or /usr/share/zfs/compatibility.d, e.g.
+// openzfs-2.1-freebsd. With several files, a feature must be in all of them.
+func (c *Client) CompatibilityFeatures(ctx context.Context, compatibility string) ([]string, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	features, err := c.d.LoadCompatibility(ctx, compatibility)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compatibility %s: %w", compatibility, err)
+	}
+
+	return features, nil
+}
+
+// CheckCompatibility compares the features of a pool against a
+// compatibility property value, e.g. to see what an upgrade restricted to
+// openzfs-2.1-freebsd would enable, or whether the pool can still be
+// imported by that release
+func (c *Client) CheckCompatibility(ctx context.Context, poolName, compatibility string) (*CompatibilityReport, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	allowed, err := c.d.LoadCompatibility(ctx, compatibility)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compatibility %s: %w", compatibility, err)
+	}
+	features, err := c.d.GetPoolFeatures(ctx, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get features of pool %s: %w", poolName, err)
+	}
+
+	inSet := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		inSet[name] = true
+	}
+	report := &CompatibilityReport{}
+	for _, feature := range features {
+		switch {
+		case feature.State != driver.FeatureDisabled && !inSet[feature.Name]:
+			report.Incompatible = append(report.Incompatible, feature.Name)
+		case feature.State == driver.FeatureDisabled && inSet[feature.Name] && !feature.NoUpgrade:
+			report.Upgradable = append(report.Upgradable, feature.Name)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,119 @@
+package zpool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+	"github.com/zombocoder/go-freebsd-libzfs/zfstest"
+)
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, features := range map[string]string{
+		"grub2":  "async_destroy\nlz4_compress\n",
+		"larger": "async_destroy lz4_compress encryption bookmark_v2 bookmarks extensible_dataset vdev_zaps_v2\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(features), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := zfstest.NewFakeDriver()
+	d.SetCompatibilityDirs(dir)
+	d.SetFeature("vdev_zaps_v2", true)
+	opts := driver.CreateOptions{Properties: map[string]string{PropertyNameCompatibility: "grub2"}}
+	if err := d.CreatePool(ctx, "tank", []driver.VdevSpec{{Devices: []string{"/dev/ada0"}}}, opts); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	c, err := New(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+
+	// Nothing beyond the feature-set the pool was created with
+	enabled, err := c.Upgrade(ctx, "tank")
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	if len(enabled) != 0 {
+		t.Errorf("Upgrade() within grub2 = %v, want nothing", enabled)
+	}
+
+	// vdev_zaps_v2 is allowed but left to the kernel
+	if err := c.SetProperty(ctx, "tank", PropertyNameCompatibility, "larger"); err != nil {
+		t.Fatalf("SetProperty() error = %v", err)
+	}
+	enabled, err = c.Upgrade(ctx, "tank")
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	want := []string{"bookmark_v2", "bookmarks", "encryption", "extensible_dataset"}
+	if !reflect.DeepEqual(enabled, want) {
+		t.Errorf("Upgrade() = %v, want %v", enabled, want)
+	}
+
+	features, err := c.Features(ctx, "tank")
+	if err != nil {
+		t.Fatalf("Features() error = %v", err)
+	}
+	for _, feature := range features {
+		if feature.Name == "vdev_zaps_v2" && feature.State != FeatureDisabled {
+			t.Errorf("vdev_zaps_v2 = %s after Upgrade(), want disabled", feature.State)
+		}
+		if feature.Name == "large_blocks" && feature.State != FeatureDisabled {
+			t.Errorf("large_blocks = %s after Upgrade(), want it left out by the compatibility", feature.State)
+		}
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "grub2"), []byte("async_destroy\nlz4_compress\nlarge_blocks\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, d := newTestClient(t)
+	d.SetCompatibilityDirs(dir)
+	d.SetFeature("vdev_zaps_v2", true)
+
+	if _, err := c.Upgrade(ctx, "tank"); err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	report, err := c.CheckCompatibility(ctx, "tank", CompatibilityOff)
+	if err != nil {
+		t.Fatalf("CheckCompatibility(off) error = %v", err)
+	}
+	if !report.Compatible() || len(report.Upgradable) != 0 {
+		t.Errorf("CheckCompatibility(off) after Upgrade() = %+v, want compatible with nothing to upgrade", report)
+	}
+
+	report, err = c.CheckCompatibility(ctx, "tank", "grub2")
+	if err != nil {
+		t.Fatalf("CheckCompatibility(grub2) error = %v", err)
+	}
+	if report.Compatible() || len(report.Upgradable) != 0 {
+		t.Errorf("CheckCompatibility(grub2) = %+v, want incompatible", report)
+	}
+	for _, name := range report.Incompatible {
+		if name == "async_destroy" || name == "lz4_compress" || name == "large_blocks" {
+			t.Errorf("CheckCompatibility(grub2) reports %s, which grub2 allows", name)
+		}
+	}
+
+	report, err = c.CheckCompatibility(ctx, "tank", CompatibilityLegacy)
+	if err != nil {
+		t.Fatalf("CheckCompatibility(legacy) error = %v", err)
+	}
+	if len(report.Incompatible) == 0 || len(report.Upgradable) != 0 {
+		t.Errorf("CheckCompatibility(legacy) = %+v, want every enabled feature incompatible", report)
+	}
+
+	if _, err := c.CheckCompatibility(ctx, "tank", "missing"); err == nil {
+		t.Error("CheckCompatibility() with a missing feature-set should fail")
+	}
+}
@@ -0,0 +1,96 @@
+package zpool
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// HistoryOptions represents options for reading the history of a pool,
+// like the flags of zpool history
+type HistoryOptions struct {
+	Internal   bool      // Include internal events and logged ioctls, like zpool history -i
+	LongFormat bool      // Fill in who ran each command and where, like zpool history -l
+	Since      time.Time // Leave out records logged before, zero for all of them
+	Offset     uint64    // Where to continue reading, the offset a previous call returned
+}
+
+// HistoryRecord is an entry of the history of a pool
+type HistoryRecord struct {
+	Time     time.Time
+	Command  string // zfs or zpool command line, empty for internal records
+	Internal bool   // Logged by ZFS itself rather than by a command
+
+	// Internal records
+	Event     string // Internal event, e.g. create or snapshot
+	TXG       uint64 // Transaction group the event was synced in
+	Dataset   string // Dataset the event applies to
+	DatasetID uint64
+	Detail    string // e.g. the property and value set
+	Ioctl     string // Name of a logged ioctl, e.g. snapshot
+	Errno     int64  // Result of a logged ioctl
+
+	// Set with LongFormat
+	UID  *uint64 // User ID that ran the command, nil when not recorded
+	User string  // User name of UID, empty if it cannot be resolved
+	Host string
+	Zone string
+}
+
+// History returns the records of the command history of a pool, like zpool
+// history, along with the offset to pass as HistoryOptions.Offset to only
+// get the records logged after them on the next call.
+func (c *Client) History(ctx context.Context, poolName string, opts HistoryOptions) ([]HistoryRecord, uint64, error) {
+	if c.d == nil {
+		return nil, 0, fmt.Errorf("client is closed")
+	}
+
+	infos, offset, err := c.d.GetPoolHistory(ctx, poolName, opts.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get history of pool %s: %w", poolName, err)
+	}
+
+	users := make(map[uint64]string)
+	records := []HistoryRecord{}
+	for _, info := range infos {
+		record := HistoryRecord{
+			Time:      time.Unix(int64(info.Time), 0),
+			Command:   info.Command,
+			Internal:  info.Command == "",
+			Event:     info.Event,
+			TXG:       info.TXG,
+			Dataset:   info.Dataset,
+			DatasetID: info.DatasetID,
+			Detail:    info.Detail,
+			Ioctl:     info.Ioctl,
+			Errno:     info.Errno,
+		}
+		if record.Internal && !opts.Internal {
+			continue
+		}
+		if !opts.Since.IsZero() && record.Time.Before(opts.Since) {
+			continue
+		}
+
+		if opts.LongFormat {
+			record.Host, record.Zone = info.Host, info.Zone
+			if info.HasWho {
+				uid := info.Who
+				record.UID = &uid
+				name, known := users[uid]
+				if !known {
+					if u, err := user.LookupId(strconv.FormatUint(uid, 10)); err == nil {
+						name = u.Username
+					}
+					users[uid] = name
+				}
+				record.User = name
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, offset, nil
+}
@@ -0,0 +1,131 @@
+package zpool
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+	"github.com/zombocoder/go-freebsd-libzfs/zfstest"
+)
+
+// historyDriver is a fake returning fixed history records
+type historyDriver struct {
+	*zfstest.FakeDriver
+	records []driver.HistoryRecord
+}
+
+func (d historyDriver) GetPoolHistory(ctx context.Context, poolName string, offset uint64) ([]driver.HistoryRecord, uint64, error) {
+	return d.records[offset:], uint64(len(d.records)), nil
+}
+
+func TestHistory_Filter(t *testing.T) {
+	ctx := context.Background()
+	uid := uint64(os.Getuid())
+	d := historyDriver{FakeDriver: zfstest.NewFakeDriver(), records: []driver.HistoryRecord{
+		{Time: 100, Event: "create", TXG: 4, Dataset: "tank"},
+		{Time: 100, Command: "zpool create tank ada0", Who: uid, HasWho: true, Host: "host1"},
+		{Time: 200, Ioctl: "snapshot", Who: uid, HasWho: true},
+		{Time: 300, Command: "zfs snapshot tank@now", Who: uid, HasWho: true, Host: "host1"},
+		{Time: 300, Command: "zpool scrub tank"},
+	}}
+	c, err := New(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+
+	tests := []struct {
+		name     string
+		opts     HistoryOptions
+		commands []string // Command, or Event or Ioctl of internal records
+	}{
+		{name: "default", commands: []string{"zpool create tank ada0", "zfs snapshot tank@now", "zpool scrub tank"}},
+		{name: "internal", opts: HistoryOptions{Internal: true}, commands: []string{"create", "zpool create tank ada0", "snapshot", "zfs snapshot tank@now", "zpool scrub tank"}},
+		{name: "since", opts: HistoryOptions{Internal: true, Since: time.Unix(200, 0)}, commands: []string{"snapshot", "zfs snapshot tank@now", "zpool scrub tank"}},
+		{name: "offset", opts: HistoryOptions{Offset: 3}, commands: []string{"zfs snapshot tank@now", "zpool scrub tank"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, offset, err := c.History(ctx, "tank", test.opts)
+			if err != nil {
+				t.Fatalf("History() error = %v", err)
+			}
+			if offset != 5 {
+				t.Errorf("History() offset = %d, want 5", offset)
+			}
+			var got []string
+			for _, record := range records {
+				switch {
+				case record.Command != "":
+					got = append(got, record.Command)
+				case record.Event != "":
+					got = append(got, record.Event)
+				default:
+					got = append(got, record.Ioctl)
+				}
+				if record.UID != nil || record.Host != "" {
+					t.Errorf("record %+v has long format fields without LongFormat", record)
+				}
+			}
+			if !reflect.DeepEqual(got, test.commands) {
+				t.Errorf("History() = %q, want %q", got, test.commands)
+			}
+		})
+	}
+
+	records, _, err := c.History(ctx, "tank", HistoryOptions{LongFormat: true})
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	wantUser := ""
+	if u, err := user.LookupId(strconv.FormatUint(uid, 10)); err == nil {
+		wantUser = u.Username
+	}
+	if r := records[0]; r.UID == nil || *r.UID != uid || r.User != wantUser || r.Host != "host1" {
+		t.Errorf("long format record = %+v, want uid %d (%q) on host1", r, uid, wantUser)
+	}
+	if r := records[2]; r.UID != nil || r.User != "" {
+		t.Errorf("record without who = %+v, want no user", r)
+	}
+}
+
+func TestHistory_Poll(t *testing.T) {
+	ctx := context.Background()
+	c, d := newTestClient(t)
+
+	records, offset, err := c.History(ctx, "tank", HistoryOptions{Internal: true})
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(records) == 0 || records[0].Event != "create" || !records[0].Internal {
+		t.Fatalf("History() = %+v, want the create event first", records)
+	}
+
+	if err := d.LogCommand("tank", "zpool set autotrim=on tank"); err != nil {
+		t.Fatalf("LogCommand() error = %v", err)
+	}
+	if err := c.SetProperty(ctx, "tank", "autotrim", "on"); err != nil {
+		t.Fatalf("SetProperty() error = %v", err)
+	}
+	records, next, err := c.History(ctx, "tank", HistoryOptions{Offset: offset})
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Command != "zpool set autotrim=on tank" || next <= offset {
+		t.Errorf("History() from %d = %+v, %d, want only the new command", offset, records, next)
+	}
+
+	records, again, err := c.History(ctx, "tank", HistoryOptions{Offset: next})
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(records) != 0 || again != next {
+		t.Errorf("History() from %d = %+v, %d, want nothing new", next, records, again)
+	}
+}
@@ -0,0 +1,236 @@
+package zpool
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+// RemovalStatus describes the evacuation of a top-level vdev being removed
+type RemovalStatus struct {
+	State         ScanState // ScanStateScanning while data is copied off the vdev
+	VDevID        uint64    // ID of the removed top-level vdev
+	StartTime     time.Time
+	EndTime       *time.Time // Set once the removal finished or was canceled
+	Copied        uint64
+	ToCopy        uint64
+	MappingMemory uint64 // Bytes of memory the mappings of removed vdevs take
+}
+
+// OnlineOptions represents options for bringing a device online
+type OnlineOptions struct {
+	Expand bool // Grow the device to use all of its space, like zpool online -e
+}
+
+// OfflineOptions represents options for taking a device offline
+type OfflineOptions struct {
+	Temporary bool // Bring the device back online at the next import, like zpool offline -t
+}
+
+// AddVdev adds a vdev to a pool, like zpool add: a data, log, special or
+// dedup vdev, or hot spares and cache devices, depending on its Class.
+//
+// The methods taking a device accept its path, its name relative to /dev
+// or its GUID in decimal, as the zpool command does.
+func (c *Client) AddVdev(ctx context.Context, poolName string, vdev VDevSpec) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.AddVdev(ctx, poolName, driverVdevSpec(vdev)); err != nil {
+		return fmt.Errorf("failed to add vdev to pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// AttachVdev attaches newDevice to device, like zpool attach. A single disk
+// becomes a two-way mirror and a mirror gains another side. The new device
+// is resilvered, Wait with WaitResilver blocks until it is done.
+func (c *Client) AttachVdev(ctx context.Context, poolName, device, newDevice string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.AttachVdev(ctx, poolName, device, newDevice, false); err != nil {
+		return fmt.Errorf("failed to attach %s to %s in pool %s: %w", newDevice, device, poolName, err)
+	}
+
+	return nil
+}
+
+// DetachVdev detaches a device from a mirror, like zpool detach
+func (c *Client) DetachVdev(ctx context.Context, poolName, device string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.DetachVdev(ctx, poolName, device); err != nil {
+		return fmt.Errorf("failed to detach %s from pool %s: %w", device, poolName, err)
+	}
+
+	return nil
+}
+
+// ReplaceVdev replaces device with newDevice, like zpool replace. The old
+// device is detached once the new one is resilvered, Wait with WaitReplace
+// blocks until then.
+func (c *Client) ReplaceVdev(ctx context.Context, poolName, device, newDevice string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.ReplaceVdev(ctx, poolName, device, newDevice); err != nil {
+		return fmt.Errorf("failed to replace %s with %s in pool %s: %w", device, newDevice, poolName, err)
+	}
+
+	return nil
+}
+
+// RemoveVdev removes a device from a pool, like zpool remove. Hot spares,
+// cache and log devices go right away and the result is nil. The data of
+// other top-level vdevs is copied to the rest of the pool in the background;
+// the result is the progress of that evacuation, which Status.Removal
+// reports later on, and Wait with WaitRemove blocks until it is done.
+func (c *Client) RemoveVdev(ctx context.Context, poolName, device string) (*RemovalStatus, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	before, err := c.d.GetPoolStatus(ctx, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool %s: %w", poolName, err)
+	}
+	top, found := findTopLevel(before.Vdevs, device)
+
+	if err := c.d.RemoveVdev(ctx, poolName, device); err != nil {
+		return nil, fmt.Errorf("failed to remove %s from pool %s: %w", device, poolName, err)
+	}
+	if !found || top.Class == driver.VdevClassLog {
+		return nil, nil
+	}
+
+	after, err := c.d.GetPoolStatus(ctx, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool %s: %w", poolName, err)
+	}
+	if after.Removal == nil || after.Removal.Vdev != top.ID {
+		return nil, nil
+	}
+	return removalStatus(after.Removal), nil
+}
+
+// CancelRemoval stops the removal of a top-level vdev while its data is
+// still being copied off, like zpool remove -s. The vdev stays in the pool.
+func (c *Client) CancelRemoval(ctx context.Context, poolName string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.CancelRemoval(ctx, poolName); err != nil {
+		return fmt.Errorf("failed to cancel removal in pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// OnlineVdev brings a device online, like zpool online, and returns the
+// state it ended up in, e.g. ONLINE, or FAULTED if it is still unusable.
+func (c *Client) OnlineVdev(ctx context.Context, poolName, device string, opts OnlineOptions) (string, error) {
+	if c.d == nil {
+		return "", fmt.Errorf("client is closed")
+	}
+
+	var flags driver.VdevOnlineFlags
+	if opts.Expand {
+		flags |= driver.VdevOnlineExpand
+	}
+	state, err := c.d.OnlineVdev(ctx, poolName, device, flags)
+	if err != nil {
+		return "", fmt.Errorf("failed to online %s in pool %s: %w", device, poolName, err)
+	}
+
+	return state, nil
+}
+
+// OfflineVdev takes a device offline, like zpool offline. It fails when no
+// other replica of its data remains.
+func (c *Client) OfflineVdev(ctx context.Context, poolName, device string, opts OfflineOptions) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.OfflineVdev(ctx, poolName, device, opts.Temporary); err != nil {
+		return fmt.Errorf("failed to offline %s in pool %s: %w", device, poolName, err)
+	}
+
+	return nil
+}
+
+// ClearVdev clears the error counters of a device, like zpool clear, or of
+// every device in the pool when device is empty
+func (c *Client) ClearVdev(ctx context.Context, poolName, device string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.ClearVdev(ctx, poolName, device); err != nil {
+		return fmt.Errorf("failed to clear errors in pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// removalStatus converts driver removal statistics
+func removalStatus(info *driver.RemovalInfo) *RemovalStatus {
+	if info == nil {
+		return nil
+	}
+
+	removal := &RemovalStatus{
+		State:         ScanState(info.State),
+		VDevID:        info.Vdev,
+		StartTime:     time.Unix(int64(info.StartTime), 0),
+		Copied:        info.Copied,
+		ToCopy:        info.ToCopy,
+		MappingMemory: info.MappingMemory,
+	}
+	if info.State != driver.PoolScanStateScanning && info.EndTime != 0 {
+		end := time.Unix(int64(info.EndTime), 0)
+		removal.EndTime = &end
+	}
+	return removal
+}
+
+// findTopLevel returns the top-level vdev that is or contains device
+func findTopLevel(root driver.VdevInfo, device string) (driver.VdevInfo, bool) {
+	for _, top := range root.Children {
+		if containsVdev(top, device) {
+			return top, true
+		}
+	}
+	return driver.VdevInfo{}, false
+}
+
+// containsVdev reports whether vdev or one of its children is named device
+func containsVdev(vdev driver.VdevInfo, device string) bool {
+	switch {
+	case device == "":
+		return false
+	case vdev.Path != "" && (vdev.Path == device || vdev.Path == "/dev/"+device):
+		return true
+	case strconv.FormatUint(vdev.GUID, 10) == device:
+		return true
+	case len(vdev.Children) > 0 && vdev.Type+"-"+strconv.FormatUint(vdev.ID, 10) == device:
+		return true
+	}
+	for _, child := range vdev.Children {
+		if containsVdev(child, device) {
+			return true
+		}
+	}
+	return false
+}
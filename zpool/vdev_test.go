@@ -0,0 +1,140 @@
+package zpool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+)
+
+func TestFindTopLevel(t *testing.T) {
+	root := driver.VdevInfo{
+		Type: driver.VdevTypeRoot,
+		Children: []driver.VdevInfo{
+			{
+				Type: driver.VdevTypeMirror, ID: 0, GUID: 10,
+				Children: []driver.VdevInfo{
+					{Type: driver.VdevTypeDisk, Path: "/dev/ada0", GUID: 11},
+					{Type: driver.VdevTypeDisk, Path: "/dev/ada1", GUID: 12},
+				},
+			},
+			{Type: driver.VdevTypeDisk, ID: 1, Path: "/dev/ada2", GUID: 13},
+		},
+	}
+
+	tests := []struct {
+		device string
+		want   uint64
+		found  bool
+	}{
+		{device: "ada1", want: 0, found: true},
+		{device: "/dev/ada0", want: 0, found: true},
+		{device: "12", want: 0, found: true},
+		{device: "mirror-0", want: 0, found: true},
+		{device: "ada2", want: 1, found: true},
+		{device: "13", want: 1, found: true},
+		{device: "disk-1", found: false}, // Leaves are not named by type and ID
+		{device: "ada9", found: false},
+		{device: "", found: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.device, func(t *testing.T) {
+			top, found := findTopLevel(root, test.device)
+			if found != test.found || (found && top.ID != test.want) {
+				t.Errorf("findTopLevel(%q) = %d, %v, want %d, %v", test.device, top.ID, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+func TestRemoveVdev(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+
+	for _, vdev := range []VDevSpec{
+		{Devices: []string{"/dev/ada1"}},
+		{Devices: []string{"/dev/nvd0"}, Class: VDevClassLog},
+		{Devices: []string{"/dev/ada2"}, Class: VDevClassSpare},
+	} {
+		if err := c.AddVdev(ctx, "tank", vdev); err != nil {
+			t.Fatalf("AddVdev(%v) error = %v", vdev.Devices, err)
+		}
+	}
+
+	// Log devices and spares go away right away
+	for _, device := range []string{"nvd0", "ada2"} {
+		removal, err := c.RemoveVdev(ctx, "tank", device)
+		if err != nil {
+			t.Fatalf("RemoveVdev(%s) error = %v", device, err)
+		}
+		if removal != nil {
+			t.Errorf("RemoveVdev(%s) = %+v, want nil", device, removal)
+		}
+	}
+
+	removal, err := c.RemoveVdev(ctx, "tank", "ada1")
+	if err != nil {
+		t.Fatalf("RemoveVdev(ada1) error = %v", err)
+	}
+	if removal == nil || removal.VDevID != 1 || removal.State != ScanStateScanning || removal.EndTime != nil {
+		t.Errorf("RemoveVdev(ada1) = %+v, want vdev 1 being copied", removal)
+	}
+
+	if _, err := c.RemoveVdev(ctx, "tank", "ada9"); err == nil {
+		t.Error("RemoveVdev() of an unknown device should fail")
+	}
+}
+
+func TestRemovalStatus(t *testing.T) {
+	ctx := context.Background()
+	c, d := newTestClient(t)
+
+	if err := c.AddVdev(ctx, "tank", VDevSpec{Devices: []string{"/dev/ada1"}}); err != nil {
+		t.Fatalf("AddVdev() error = %v", err)
+	}
+	if _, err := c.RemoveVdev(ctx, "tank", "ada1"); err != nil {
+		t.Fatalf("RemoveVdev() error = %v", err)
+	}
+	status, err := c.GetStatus(ctx, "tank")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if !status.Config.Children[1].Removing {
+		t.Errorf("vdev 1 = %+v, want it removing", status.Config.Children[1])
+	}
+
+	if err := c.CancelRemoval(ctx, "tank"); err != nil {
+		t.Fatalf("CancelRemoval() error = %v", err)
+	}
+	status, err = c.GetStatus(ctx, "tank")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if r := status.Removal; r == nil || r.State != ScanStateCanceled || r.EndTime == nil {
+		t.Errorf("Removal after CancelRemoval() = %+v, want canceled", r)
+	}
+	if status.Config.Children[1].Removing {
+		t.Error("vdev 1 is still removing after CancelRemoval()")
+	}
+	if err := c.CancelRemoval(ctx, "tank"); err == nil {
+		t.Error("CancelRemoval() without a removal should fail")
+	}
+
+	if _, err := c.RemoveVdev(ctx, "tank", "ada1"); err != nil {
+		t.Fatalf("RemoveVdev() error = %v", err)
+	}
+	if err := d.CompleteRemoval("tank"); err != nil {
+		t.Fatalf("CompleteRemoval() error = %v", err)
+	}
+	status, err = c.GetStatus(ctx, "tank")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if r := status.Removal; r == nil || r.State != ScanStateFinished || r.VDevID != 1 {
+		t.Errorf("Removal after CompleteRemoval() = %+v, want vdev 1 finished", r)
+	}
+	if vdev := status.Config.Children[1]; vdev.Type != driver.VdevTypeIndirect || vdev.ID != 1 {
+		t.Errorf("vdev 1 = %+v, want an indirect vdev with ID 1", vdev)
+	}
+}
@@ -1,5 +1,3 @@
-//go:build freebsd
-
 package zpool
 
 import (
@@ -12,54 +10,86 @@ import (
 
 // Client provides access to ZFS pool operations
 type Client struct {
-	d driver.Driver
+	d        driver.Driver
+	sel      driver.Selection
+	injected bool // The driver came from WithDriver and belongs to the caller
 }
 
 // Option configures Client creation
 type Option func(*config)
 
 type config struct {
-	useLibzfs bool
+	mode   driver.Mode
+	driver driver.Driver
 }
 
-// WithLibZFS forces the use of libzfs driver (default)
+// WithLibZFS forces the use of libzfs driver without falling back to ioctl
+// (default)
 func WithLibZFS() Option {
 	return func(c *config) {
-		c.useLibzfs = true
+		c.mode = driver.ModeLibZFS
 	}
 }
 
-// WithIoctlOnly forces the use of ioctl-only driver
+// WithIoctlOnly forces the use of ioctl-only driver without falling back to libzfs
 func WithIoctlOnly() Option {
 	return func(c *config) {
-		c.useLibzfs = false
+		c.mode = driver.ModeIoctl
+	}
+}
+
+// WithAutoDriver tries libzfs first and falls back to the ioctl driver
+// when libzfs is not built in or cannot be initialized. With preferIoctl
+// set the order is reversed.
+func WithAutoDriver(preferIoctl bool) Option {
+	return func(c *config) {
+		if preferIoctl {
+			c.mode = driver.ModeAutoIoctl
+		} else {
+			c.mode = driver.ModeAuto
+		}
+	}
+}
+
+// WithDriver injects a driver implementation, such as the in-memory
+// driver from the zfstest package. The driver stays owned by the caller:
+// Client.Close does not close it, so it can be shared between clients.
+func WithDriver(d driver.Driver) Option {
+	return func(c *config) {
+		c.driver = d
 	}
 }
 
 // New creates a new ZFS pool client
 func New(ctx context.Context, opts ...Option) (*Client, error) {
-	cfg := config{useLibzfs: true}
+	cfg := config{mode: driver.ModeLibZFS}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
-	var d driver.Driver
-	var err error
+	if cfg.driver != nil {
+		return &Client{d: cfg.driver, sel: driver.Injected(), injected: true}, nil
+	}
 
-	d, err = driver.NewLibZFS()
+	d, sel, err := driver.Open(cfg.mode)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize libzfs driver: %w", err)
+		return nil, err
 	}
 
-	return &Client{d: d}, nil
+	return &Client{d: d, sel: sel}, nil
 }
 
-// Close releases resources held by the client
+// Close releases resources held by the client. A driver injected with
+// WithDriver is left open, only the client stops using it.
 func (c *Client) Close() error {
-	if c.d != nil {
-		return c.d.Close()
+	if c.d == nil {
+		return nil
 	}
-	return nil
+	if c.injected {
+		c.d = nil
+		return nil
+	}
+	return c.d.Close()
 }
 
 // Pool represents a ZFS storage pool
@@ -142,9 +172,10 @@ func (c *Client) Get(ctx context.Context, name string) (*Pool, error) {
 
 // DiscoverOptions represents options for pool discovery
 type DiscoverOptions struct {
-	SearchPaths      []string // Directories to search for pool devices
+	SearchPaths      []string // Directories to search for pool devices, the default when empty
+	CacheFile        string   // Read pool configs from this cachefile instead of scanning devices
 	IncludeDestroyed bool     // Include destroyed pools in results
-	PoolName         string   // Search for specific pool name only
+	PoolName         string   // Search for specific pool name or GUID only
 }
 
 // ImportablePool represents a pool that can be imported
@@ -153,19 +184,48 @@ type ImportablePool struct {
 	GUID        uint64
 	State       string
 	Health      string
-	DevicePaths []string // Devices that make up this pool
+	DevicePaths []string   // Devices that make up this pool
+	Config      VDevTree   // Root of the vdev tree as found on the devices
+	Spares      []VDevTree // Hot spares
+	L2Cache     []VDevTree // Cache devices
 }
 
-// Discover finds pools that can be imported
+// Discover scans devices for pools that can be imported, like zpool import
+// without arguments. Pools that share a name are told apart by GUID.
 func (c *Client) Discover(ctx context.Context, opts DiscoverOptions) ([]ImportablePool, error) {
 	if c.d == nil {
 		return nil, fmt.Errorf("client is closed")
 	}
 
-	// TODO: Implement pool discovery via driver
-	// This would call zpool_find_import through the driver interface
-	// For now, return empty list since it requires additional driver method
-	return []ImportablePool{}, nil
+	found, err := c.d.DiscoverPools(ctx, driver.DiscoverOptions{
+		SearchPaths: opts.SearchPaths,
+		CacheFile:   opts.CacheFile,
+		Destroyed:   opts.IncludeDestroyed,
+		Pool:        opts.PoolName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover pools: %w", err)
+	}
+
+	pools := make([]ImportablePool, 0, len(found))
+	for _, info := range found {
+		pool := ImportablePool{
+			Name:        info.Name,
+			GUID:        info.GUID,
+			State:       info.State,
+			Health:      info.Health,
+			DevicePaths: info.DevicePaths,
+			Config:      vdevTree(info.Vdevs),
+		}
+		for _, spare := range info.Spares {
+			pool.Spares = append(pool.Spares, vdevTree(spare))
+		}
+		for _, cache := range info.L2Cache {
+			pool.L2Cache = append(pool.L2Cache, vdevTree(cache))
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
 }
 
 // CreateOptions represents options for pool creation
@@ -173,11 +233,47 @@ type CreateOptions struct {
 	Properties   map[string]string // Pool properties to set
 	FsProperties map[string]string // Root filesystem properties to set
 	AltRoot      string            // Alternative root directory
-	Force        bool              // Force creation even if devices are in use
+	Force        bool              // Force creation even if devices are in use or replication levels mismatch
 }
 
-// Create creates a new ZFS pool
-func (c *Client) Create(ctx context.Context, poolName string, vdevs []string, opts CreateOptions) error {
+// VDevSpec describes one group of devices of a pool topology, like
+// "mirror ada0 ada1" or "log ada2" on the zpool create command line
+type VDevSpec struct {
+	Type    string    // VDevType* constant, disk when empty
+	Devices []string  // Device paths; paths outside /dev are file vdevs
+	Class   VDevClass // Allocation class; each spare and cache device becomes a vdev of its own
+
+	// dRAID layout, as in draid<Parity>:<Data>d:<Children>c:<Spares>s.
+	// Zero values take the zpool create defaults.
+	Parity   int // Parity level, 1 by default
+	Data     int // Data devices per redundancy group, at most 8 by default
+	Spares   int // Distributed spares
+	Children int // Expected number of devices, checked against Devices
+}
+
+// Vdev types of a VDevSpec
+const (
+	VDevTypeDisk   = driver.VdevTypeDisk
+	VDevTypeMirror = driver.VdevTypeMirror
+	VDevTypeRaidz  = driver.VdevTypeRaidz
+	VDevTypeRaidz2 = driver.VdevTypeRaidz2
+	VDevTypeRaidz3 = driver.VdevTypeRaidz3
+	VDevTypeDraid  = driver.VdevTypeDraid
+)
+
+// Disks returns a spec for each device, striping the pool across them
+func Disks(devices ...string) []VDevSpec {
+	specs := make([]VDevSpec, 0, len(devices))
+	for _, device := range devices {
+		specs = append(specs, VDevSpec{Type: VDevTypeDisk, Devices: []string{device}})
+	}
+	return specs
+}
+
+// Create creates a new ZFS pool from a topology of vdev groups. Like zpool
+// create, it refuses normal, special and dedup vdevs of different
+// replication levels, e.g. a mirror next to a single disk, unless Force is set.
+func (c *Client) Create(ctx context.Context, poolName string, vdevs []VDevSpec, opts CreateOptions) error {
 	if c.d == nil {
 		return fmt.Errorf("client is closed")
 	}
@@ -193,13 +289,31 @@ func (c *Client) Create(ctx context.Context, poolName string, vdevs []string, op
 		Force:        opts.Force,
 	}
 
-	return c.d.CreatePool(ctx, poolName, vdevs, driverOpts)
+	specs := make([]driver.VdevSpec, 0, len(vdevs))
+	for _, vdev := range vdevs {
+		specs = append(specs, driverVdevSpec(vdev))
+	}
+	return c.d.CreatePool(ctx, poolName, specs, driverOpts)
+}
+
+// driverVdevSpec converts a VDevSpec for the driver
+func driverVdevSpec(spec VDevSpec) driver.VdevSpec {
+	return driver.VdevSpec{
+		Type:     spec.Type,
+		Devices:  spec.Devices,
+		Class:    string(spec.Class),
+		Parity:   spec.Parity,
+		Data:     spec.Data,
+		Spares:   spec.Spares,
+		Children: spec.Children,
+	}
 }
 
 // Property represents a pool property with its value and metadata
 type Property[T any] struct {
 	Name     string
-	Value    T
+	Value    T   // Human readable value, as zpool get prints it
+	Raw      any // Exact value: uint64 for numbers and byte counts, bool for on/off, else string
 	Source   PropertySource
 	Received bool
 }
@@ -213,6 +327,7 @@ const (
 	PropertySourceDefault   PropertySource = "default"
 	PropertySourceTemporary PropertySource = "temporary"
 	PropertySourceReceived  PropertySource = "received"
+	PropertySourceNone      PropertySource = "none" // Read-only statistics
 )
 
 // Common pool property names
@@ -230,7 +345,7 @@ const (
 	PropertyNameFailmode      = "failmode"
 	PropertyNameListsnaps     = "listsnapshots"
 	PropertyNameAutoexpand    = "autoexpand"
-	PropertyNameDedupditto    = "dedupditto"
+	PropertyNameDedupditto    = "dedupditto" // Removed in OpenZFS 2.0
 	PropertyNameDedupratio    = "dedupratio"
 	PropertyNameFree          = "free"
 	PropertyNameAllocated     = "allocated"
@@ -239,8 +354,34 @@ const (
 	PropertyNameExpandsz      = "expandsize"
 	PropertyNameFreeing       = "freeing"
 	PropertyNameFragmentation = "fragmentation"
+	PropertyNameName          = "name"
+	PropertyNameLeaked        = "leaked"
+	PropertyNameCheckpoint    = "checkpoint"
+	PropertyNameLoadGUID      = "load_guid"
+	PropertyNameMultihost     = "multihost"
+	PropertyNameAutotrim      = "autotrim"
+	PropertyNameAshift        = "ashift"
+	PropertyNameCompatibility = "compatibility"
+	PropertyNameBcloneUsed    = "bcloneused"
+	PropertyNameBcloneSaved   = "bclonesaved"
+	PropertyNameBcloneRatio   = "bcloneratio"
 )
 
+// FeatureState is the value of a feature@ pool property
+type FeatureState string
+
+const (
+	FeatureDisabled FeatureState = driver.FeatureDisabled // Not enabled on the pool
+	FeatureEnabled  FeatureState = driver.FeatureEnabled  // Enabled but not in use yet
+	FeatureActive   FeatureState = driver.FeatureActive   // In use, on-disk format depends on it
+)
+
+// FeatureProperty returns the name of the pool property that reports the
+// state of a feature, e.g. feature@async_destroy
+func FeatureProperty(feature string) string {
+	return "feature@" + feature
+}
+
 // GetProperties retrieves multiple properties for a pool
 func (c *Client) GetProperties(ctx context.Context, poolName string, propNames ...string) (map[string]Property[any], error) {
 	if c.d == nil {
@@ -257,6 +398,7 @@ func (c *Client) GetProperties(ctx context.Context, poolName string, propNames .
 		prop := Property[any]{
 			Name:     info.Name,
 			Value:    info.Value,
+			Raw:      info.Raw,
 			Source:   PropertySource(info.Source.String()),
 			Received: info.Received,
 		}
@@ -266,6 +408,20 @@ func (c *Client) GetProperties(ctx context.Context, poolName string, propNames .
 	return properties, nil
 }
 
+// SetProperty sets a pool property, like zpool set. Features are enabled
+// by setting their feature@ property to enabled.
+func (c *Client) SetProperty(ctx context.Context, poolName, propName, propValue string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.SetPoolProp(ctx, poolName, propName, propValue); err != nil {
+		return fmt.Errorf("failed to set pool property: %w", err)
+	}
+
+	return nil
+}
+
 // GetStringProperty retrieves a string property value
 func (c *Client) GetStringProperty(ctx context.Context, poolName, propName string) (string, error) {
 	props, err := c.GetProperties(ctx, poolName, propName)
@@ -285,7 +441,8 @@ func (c *Client) GetStringProperty(ctx context.Context, poolName, propName strin
 	return fmt.Sprintf("%v", prop.Value), nil
 }
 
-// GetUint64Property retrieves a uint64 property value
+// GetUint64Property retrieves the exact value of a numeric property, such
+// as a byte count
 func (c *Client) GetUint64Property(ctx context.Context, poolName, propName string) (uint64, error) {
 	props, err := c.GetProperties(ctx, poolName, propName)
 	if err != nil {
@@ -297,7 +454,7 @@ func (c *Client) GetUint64Property(ctx context.Context, poolName, propName strin
 		return 0, fmt.Errorf("property %q not found", propName)
 	}
 
-	if val, ok := prop.Value.(uint64); ok {
+	if val, ok := prop.Raw.(uint64); ok {
 		return val, nil
 	}
 
@@ -306,22 +463,105 @@ func (c *Client) GetUint64Property(ctx context.Context, poolName, propName strin
 
 // Status represents detailed pool status information
 type Status struct {
-	Pool   Pool
-	Config VDevTree
-	Errors ErrorStats
-	Scan   *ScanStatus
+	Pool    Pool
+	Config  VDevTree   // Root vdev; log, special and dedup vdevs are top-level children
+	Spares  []VDevTree // Hot spares
+	L2Cache []VDevTree // Cache devices
+	Errors  ErrorStats
+	Scan    *ScanStatus // Last scrub or resilver, nil if none was ever run
+
+	// Last error scrub, nil if none was ever run. Its Examined and
+	// ToExamine count blocks with known errors rather than bytes.
+	ErrorScrub *ScanStatus
+
+	Checkpoint *CheckpointStatus // Pool checkpoint, nil if there is none
+	Removal    *RemovalStatus    // Last top-level vdev removal, nil if there was none
+}
+
+// CheckpointStatus describes the checkpoint of a pool
+type CheckpointStatus struct {
+	Created    time.Time
+	Space      uint64 // Bytes the checkpoint keeps from being freed
+	Discarding bool   // DiscardCheckpoint was called and the space is being freed
 }
 
 // VDevTree represents the virtual device tree structure
 type VDevTree struct {
-	Type     string
-	Path     string
+	Type     string // root, mirror, raidz, raidz2, raidz3, draid, disk, file, spare, replacing, indirect, ...
+	ID       uint64 // Position among its siblings, e.g. 0 for mirror-0
+	Path     string // Device path of leaf vdevs
 	GUID     uint64
-	State    string
+	State    string // ONLINE, DEGRADED, FAULTED, ...; AVAIL or INUSE for hot spares
+	Aux      string // Reason for the state, e.g. "cannot open"
+	Class    VDevClass
+	NParity  uint64 // Parity level of raidz and draid vdevs
 	Stats    VDevStats
 	Children []VDevTree
+
+	// Initializing and manual TRIM of leaf vdevs, nil if never started
+	Initialize *VDevProgress
+	Trim       *VDevProgress
+
+	// Removing is set on a top-level vdev while its data is copied off.
+	// Once removed it stays in the tree as an indirect vdev with the same
+	// ID, whose Mapping is the memory its remapping table takes in bytes.
+	Removing bool
+	Mapping  uint64
+}
+
+// VDevProgress describes initializing or trimming a leaf vdev
+type VDevProgress struct {
+	State     VDevActionState
+	BytesDone uint64
+	BytesEst  uint64 // Bytes to initialize or trim in total
+	Errors    uint64
+
+	// When it started, or when it was last suspended, canceled or completed
+	ActionTime time.Time
+
+	// The device does not support TRIM. Set on Trim only, which is reported
+	// even if no TRIM was ever started.
+	NotSupported bool
+}
+
+// VDevActionState is the state of initializing or trimming a leaf vdev
+type VDevActionState int
+
+const (
+	VDevActionNone      VDevActionState = driver.VdevActionStateNone
+	VDevActionActive    VDevActionState = driver.VdevActionStateActive
+	VDevActionCanceled  VDevActionState = driver.VdevActionStateCanceled
+	VDevActionSuspended VDevActionState = driver.VdevActionStateSuspended
+	VDevActionComplete  VDevActionState = driver.VdevActionStateComplete
+)
+
+func (s VDevActionState) String() string {
+	switch s {
+	case VDevActionActive:
+		return "active"
+	case VDevActionCanceled:
+		return "canceled"
+	case VDevActionSuspended:
+		return "suspended"
+	case VDevActionComplete:
+		return "complete"
+	default:
+		return "none"
+	}
 }
 
+// VDevClass is the allocation class of a top-level vdev
+type VDevClass string
+
+const (
+	VDevClassNormal  VDevClass = driver.VdevClassNormal
+	VDevClassLog     VDevClass = driver.VdevClassLog
+	VDevClassSpecial VDevClass = driver.VdevClassSpecial
+	VDevClassDedup   VDevClass = driver.VdevClassDedup
+	VDevClassSpare   VDevClass = driver.VdevClassSpare
+	VDevClassCache   VDevClass = driver.VdevClassCache
+)
+
 // VDevStats represents vdev statistics
 type VDevStats struct {
 	Alloc          uint64
@@ -330,6 +570,7 @@ type VDevStats struct {
 	ReadErrors     uint64
 	WriteErrors    uint64
 	ChecksumErrors uint64
+	SlowIOs        uint64
 }
 
 // ErrorStats represents pool error statistics
@@ -337,6 +578,7 @@ type ErrorStats struct {
 	Read  uint64
 	Write uint64
 	Cksum uint64
+	Data  uint64 // Persistent data errors, listed by zpool status -v
 }
 
 // ScanStatus represents scrub/resilver status
@@ -344,15 +586,20 @@ type ScanStatus struct {
 	Function     ScanFunction // Scrub, Resilver, etc.
 	State        ScanState    // Scanning, Finished, Canceled, etc.
 	StartTime    time.Time
-	EndTime      *time.Time
-	Examined     uint64
-	ToExamine    uint64
-	Processed    uint64
-	ToProcess    uint64
+	EndTime      *time.Time // Set once the scan has finished or was canceled
+	PausedSince  *time.Time // Set while a scrub is paused
+	Examined     uint64     // Bytes located by the scanner
+	ToExamine    uint64     // Bytes to scan
+	Issued       uint64     // Bytes checked
+	Skipped      uint64     // Bytes skipped by the scanner
+	Processed    uint64     // Bytes repaired
+	ToProcess    uint64     // Deprecated: the kernel field became Skipped in OpenZFS 2.2
 	Errors       uint64
 	PassExamined uint64
+	PassIssued   uint64
 	PassStart    time.Time
-	Rate         uint64 // bytes per second (calculated)
+	Rate         uint64        // bytes per second (calculated)
+	ETA          time.Duration // Estimated time left, zero when unknown or not running
 }
 
 // ScanFunction represents the type of scan operation
@@ -362,6 +609,7 @@ const (
 	ScanFunctionNone ScanFunction = iota
 	ScanFunctionScrub
 	ScanFunctionResilver
+	ScanFunctionErrorScrub
 )
 
 func (f ScanFunction) String() string {
@@ -370,6 +618,8 @@ func (f ScanFunction) String() string {
 		return "scrub"
 	case ScanFunctionResilver:
 		return "resilver"
+	case ScanFunctionErrorScrub:
+		return "error scrub"
 	default:
 		return "none"
 	}
@@ -383,7 +633,7 @@ const (
 	ScanStateScanning
 	ScanStateFinished
 	ScanStateCanceled
-	ScanStateSuspended
+	ScanStateSuspended // Scrub paused with PauseScrub
 )
 
 func (s ScanState) String() string {
@@ -407,48 +657,409 @@ func (c *Client) GetStatus(ctx context.Context, poolName string) (*Status, error
 		return nil, fmt.Errorf("client is closed")
 	}
 
-	// Get basic pool information
-	pool, err := c.Get(ctx, poolName)
+	info, err := c.d.GetPoolStatus(ctx, poolName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get pool %s: %w", poolName, err)
 	}
 
 	status := &Status{
-		Pool: *pool,
+		Pool: Pool{
+			Name:   info.Name,
+			GUID:   info.GUID,
+			Health: Health(info.Health),
+			State:  State(info.State),
+		},
+		Config: vdevTree(info.Vdevs),
+		Errors: ErrorStats{
+			Read:  info.Vdevs.Stats.ReadErrors,
+			Write: info.Vdevs.Stats.WriteErrors,
+			Cksum: info.Vdevs.Stats.ChecksumErrors,
+			Data:  info.DataErrors,
+		},
 	}
-
-	// TODO: Implement vdev tree parsing and scan status
-	// This requires complex nvlist parsing that we'll implement next
+	for _, spare := range info.Spares {
+		status.Spares = append(status.Spares, vdevTree(spare))
+	}
+	for _, cache := range info.L2Cache {
+		status.L2Cache = append(status.L2Cache, vdevTree(cache))
+	}
+	now := time.Now()
+	status.Scan = scanStatus(info.Scan, now)
+	status.ErrorScrub = scanStatus(info.ErrorScrub, now)
+	if ckpt := info.Checkpoint; ckpt != nil {
+		status.Checkpoint = &CheckpointStatus{
+			Created:    time.Unix(int64(ckpt.StartTime), 0),
+			Space:      ckpt.Space,
+			Discarding: ckpt.State == driver.CheckpointStateDiscarding,
+		}
+	}
+	status.Removal = removalStatus(info.Removal)
 
 	return status, nil
 }
 
-// StartScrub starts a scrub operation on a pool
-func (c *Client) StartScrub(ctx context.Context, poolName string) error {
+// scanStatus converts driver scan statistics, computing the rate and the
+// time left at now
+func scanStatus(info *driver.ScanInfo, now time.Time) *ScanStatus {
+	if info == nil {
+		return nil
+	}
+
+	scan := &ScanStatus{
+		Function:     ScanFunction(info.Function),
+		State:        ScanState(info.State),
+		StartTime:    time.Unix(int64(info.StartTime), 0),
+		Examined:     info.Examined,
+		ToExamine:    info.ToExamine,
+		Issued:       info.Issued,
+		Skipped:      info.Skipped,
+		Processed:    info.Processed,
+		ToProcess:    info.Skipped,
+		Errors:       info.Errors,
+		PassExamined: info.PassExamined,
+		PassIssued:   info.PassIssued,
+		PassStart:    time.Unix(int64(info.PassStart), 0),
+	}
+	if info.State != driver.PoolScanStateScanning && info.EndTime != 0 {
+		end := time.Unix(int64(info.EndTime), 0)
+		scan.EndTime = &end
+	}
+	if info.State == driver.PoolScanStateScanning && info.PassPaused != 0 {
+		paused := time.Unix(int64(info.PassPaused), 0)
+		scan.PausedSince = &paused
+		scan.State = ScanStateSuspended
+	}
+	scan.Rate, scan.ETA = info.Progress(now)
+	return scan
+}
+
+// vdevTree converts a driver vdev and its children
+func vdevTree(info driver.VdevInfo) VDevTree {
+	tree := VDevTree{
+		Type:    info.Type,
+		ID:      info.ID,
+		Path:    info.Path,
+		GUID:    info.GUID,
+		State:   info.State,
+		Aux:     info.Aux,
+		Class:   VDevClass(info.Class),
+		NParity: info.NParity,
+		Stats:   VDevStats(info.Stats),
+
+		Initialize: vdevProgress(info.Initialize),
+		Trim:       vdevProgress(info.Trim),
+		Removing:   info.Removing,
+		Mapping:    info.Mapping,
+	}
+	for _, child := range info.Children {
+		tree.Children = append(tree.Children, vdevTree(child))
+	}
+	return tree
+}
+
+// vdevProgress converts driver initialize or TRIM progress, nil when there
+// is nothing to report
+func vdevProgress(info driver.VdevProgress) *VDevProgress {
+	if info.State == driver.VdevActionStateNone && !info.NotSupported {
+		return nil
+	}
+	progress := &VDevProgress{
+		State:        VDevActionState(info.State),
+		BytesDone:    info.BytesDone,
+		BytesEst:     info.BytesEst,
+		Errors:       info.Errors,
+		NotSupported: info.NotSupported,
+	}
+	if info.ActionTime != 0 {
+		progress.ActionTime = time.Unix(int64(info.ActionTime), 0)
+	}
+	return progress
+}
+
+// ScrubCommand selects what Scrub does
+type ScrubCommand int
+
+const (
+	ScrubStart  ScrubCommand = iota // Start a scrub, or resume a paused one
+	ScrubPause                      // Pause the running scrub
+	ScrubCancel                     // Stop the running scrub
+)
+
+// ScrubOptions represents options for scrub control
+type ScrubOptions struct {
+	Command ScrubCommand
+
+	// Only scrub the blocks listed in the persistent error log, like
+	// zpool scrub -e. Requires the head_errlog feature.
+	ErrorScrub bool
+}
+
+// Scrub starts, pauses, resumes or cancels a scrub, like zpool scrub
+func (c *Client) Scrub(ctx context.Context, poolName string, opts ScrubOptions) error {
 	if c.d == nil {
 		return fmt.Errorf("client is closed")
 	}
 
-	// TODO: Implement scrub start via driver
-	return fmt.Errorf("StartScrub not implemented yet")
+	err := c.d.ScrubPool(ctx, poolName, driver.ScrubOptions{
+		Command:    driver.ScrubCommand(opts.Command),
+		ErrorScrub: opts.ErrorScrub,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scrub pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// StartScrub starts a scrub operation on a pool
+func (c *Client) StartScrub(ctx context.Context, poolName string) error {
+	return c.Scrub(ctx, poolName, ScrubOptions{Command: ScrubStart})
+}
+
+// PauseScrub pauses the running scrub of a pool, ResumeScrub continues it
+// where it left off
+func (c *Client) PauseScrub(ctx context.Context, poolName string) error {
+	return c.Scrub(ctx, poolName, ScrubOptions{Command: ScrubPause})
+}
+
+// ResumeScrub resumes a paused scrub. Unlike StartScrub it never starts a
+// new scrub.
+func (c *Client) ResumeScrub(ctx context.Context, poolName string) error {
+	status, err := c.GetStatus(ctx, poolName)
+	if err != nil {
+		return err
+	}
+	if status.Scan == nil || status.Scan.Function != ScanFunctionScrub || status.Scan.State != ScanStateSuspended {
+		return fmt.Errorf("pool %s has no paused scrub", poolName)
+	}
+
+	return c.Scrub(ctx, poolName, ScrubOptions{Command: ScrubStart})
 }
 
 // StopScrub stops a running scrub operation on a pool
 func (c *Client) StopScrub(ctx context.Context, poolName string) error {
+	return c.Scrub(ctx, poolName, ScrubOptions{Command: ScrubCancel})
+}
+
+// Checkpoint takes a checkpoint of a pool, like zpool checkpoint. Until it
+// is discarded, the pool can be returned to this state by importing it with
+// RewindToCheckpoint. A pool has at most one checkpoint, and devices cannot
+// be removed while it exists.
+func (c *Client) Checkpoint(ctx context.Context, poolName string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.CheckpointPool(ctx, poolName); err != nil {
+		return fmt.Errorf("failed to checkpoint pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// DiscardCheckpoint discards the checkpoint of a pool, like zpool
+// checkpoint -d. The space is freed in the background, Wait with
+// WaitCheckpointDiscard blocks until it is done.
+func (c *Client) DiscardCheckpoint(ctx context.Context, poolName string) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	if err := c.d.DiscardCheckpoint(ctx, poolName); err != nil {
+		return fmt.Errorf("failed to discard checkpoint of pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// VDevActionCommand selects what Initialize and Trim do
+type VDevActionCommand int
+
+const (
+	VDevActionStart   VDevActionCommand = iota // Start, or resume a suspended one
+	VDevActionCancel                           // Stop and discard the progress
+	VDevActionSuspend                          // Stop, keeping the progress to resume from
+)
+
+// InitializeOptions represents options for initializing vdevs
+type InitializeOptions struct {
+	Command VDevActionCommand
+	Devices []string // Leaf vdevs by path or GUID, every leaf of the pool when empty
+}
+
+// Initialize starts, suspends or cancels writing a pattern to the
+// unallocated space of leaf vdevs, like zpool initialize. Progress is
+// reported per vdev in VDevTree.Initialize, and Wait with WaitInitialize
+// blocks until it is done.
+func (c *Client) Initialize(ctx context.Context, poolName string, opts InitializeOptions) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	err := c.d.InitializeVdevs(ctx, poolName, opts.Devices, driver.VdevActionCommand(opts.Command))
+	if err != nil {
+		return fmt.Errorf("failed to initialize vdevs of pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// TrimOptions represents options for trimming vdevs
+type TrimOptions struct {
+	Command VDevActionCommand
+
+	// Leaf vdevs by path or GUID. When empty every leaf of the pool is
+	// trimmed, skipping devices that do not support TRIM.
+	Devices []string
+
+	Secure bool   // Use secure TRIM, which fails on devices that do not support it
+	Rate   uint64 // Bytes per second to trim each vdev at, 0 for no limit
+}
+
+// Trim starts, suspends or cancels a manual TRIM of leaf vdevs, like zpool
+// trim. Progress is reported per vdev in VDevTree.Trim, and Wait with
+// WaitTrim blocks until it is done.
+func (c *Client) Trim(ctx context.Context, poolName string, opts TrimOptions) error {
+	if c.d == nil {
+		return fmt.Errorf("client is closed")
+	}
+
+	err := c.d.TrimVdevs(ctx, poolName, opts.Devices, driver.TrimOptions{
+		Command: driver.VdevActionCommand(opts.Command),
+		Secure:  opts.Secure,
+		Rate:    opts.Rate,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to trim vdevs of pool %s: %w", poolName, err)
+	}
+
+	return nil
+}
+
+// WaitActivity is a pool activity Wait can block on, like zpool wait -t
+type WaitActivity int
+
+const (
+	WaitCheckpointDiscard WaitActivity = WaitActivity(driver.WaitCheckpointDiscard) // Checkpoint discard
+	WaitFree              WaitActivity = WaitActivity(driver.WaitFree)              // Freeing of destroyed datasets
+	WaitInitialize        WaitActivity = WaitActivity(driver.WaitInitialize)        // Vdev initialization
+	WaitReplace           WaitActivity = WaitActivity(driver.WaitReplace)           // Device replacement
+	WaitRemove            WaitActivity = WaitActivity(driver.WaitRemove)            // Device removal
+	WaitResilver          WaitActivity = WaitActivity(driver.WaitResilver)          // Resilver
+	WaitScrub             WaitActivity = WaitActivity(driver.WaitScrub)             // Scrub, paused scrubs are not waited for
+	WaitTrim              WaitActivity = WaitActivity(driver.WaitTrim)              // Manual TRIM
+	WaitRaidzExpand       WaitActivity = WaitActivity(driver.WaitRaidzExpand)       // RAID-Z expansion
+)
+
+func (a WaitActivity) String() string {
+	return driver.WaitActivity(a).String()
+}
+
+// WaitOptions represents optional settings for Wait
+type WaitOptions struct {
+	// Progress receives a snapshot of the pool status every Interval
+	// while Wait blocks. Snapshots are dropped when the channel is not
+	// ready, and Wait never closes it.
+	Progress chan<- WaitProgress
+	Interval time.Duration // Defaults to one second
+}
+
+// WaitProgress is a progress snapshot sent by Wait. Status.Scan holds the
+// progress of scrubs and resilvers.
+type WaitProgress struct {
+	Activity WaitActivity
+	Status   *Status
+}
+
+// Wait blocks until an activity on the pool is done, like zpool wait. It
+// returns right away when the activity is not in progress. When ctx is
+// canceled Wait returns an error wrapping ctx.Err(), the activity itself
+// keeps running. Progress snapshots are only sent when WaitOptions are
+// given; a failure to read one ends the wait with its error.
+func (c *Client) Wait(ctx context.Context, poolName string, activity WaitActivity, opts ...WaitOptions) error {
 	if c.d == nil {
 		return fmt.Errorf("client is closed")
 	}
 
-	// TODO: Implement scrub stop via driver
-	return fmt.Errorf("StopScrub not implemented yet")
+	var o WaitOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.d.WaitPool(waitCtx, poolName, driver.WaitActivity(activity))
+		done <- err
+	}()
+
+	var tick <-chan time.Time
+	if o.Progress != nil {
+		interval := o.Interval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("failed to wait for %s on pool %s: %w", activity, poolName, err)
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for %s on pool %s: %w", activity, poolName, ctx.Err())
+		case <-tick:
+			status, err := c.GetStatus(waitCtx, poolName)
+			if err != nil {
+				return fmt.Errorf("failed to get progress of %s on pool %s: %w", activity, poolName, err)
+			}
+			select {
+			case o.Progress <- WaitProgress{Activity: activity, Status: status}:
+			default:
+			}
+		}
+	}
 }
 
 // ImportOptions represents options for pool import operations
 type ImportOptions struct {
-	NewName   string // Optional new name for the pool
-	AltRoot   string // Alternative root directory
-	Force     bool   // Force import even if pool appears active
-	Destroyed bool   // Import destroyed pool
+	NewName     string            // Optional new name for the pool
+	AltRoot     string            // Alternative root directory, also sets cachefile=none
+	Force       bool              // Force import even if pool appears active
+	Destroyed   bool              // Import destroyed pool
+	ReadOnly    bool              // Import the pool read-only
+	Properties  map[string]string // Pool properties to set on import
+	SearchPaths []string          // Directories to search for pool devices, the default when empty
+	CacheFile   string            // Read the pool config from this cachefile instead of scanning devices
+
+	// Recovery of pools that cannot be opened, see Recover
+	Rewind        bool   // Discard the last transactions if needed to open the pool, zpool import -F
+	DryRun        bool   // With Rewind, only report what would be discarded, -n
+	ExtremeRewind bool   // With Rewind, search every txg instead of the last few, -X
+	MaxTxg        uint64 // Rewind to this txg or earlier, implies Rewind and ExtremeRewind, -T
+	MissingLog    bool   // Import even if a log device is missing, losing its records, -m
+
+	// Return the pool to its checkpoint, discarding everything written
+	// since, --rewind-to-checkpoint. Cannot be combined with Rewind.
+	RewindToCheckpoint bool
+}
+
+// RewindReport describes what recovering a damaged pool discards
+type RewindReport struct {
+	Needed     bool          // The pool cannot be opened at its latest state
+	Possible   bool          // An earlier state the pool can be opened at was found
+	Imported   bool          // The pool opened without rewinding during a dry run and was imported
+	RewindTo   time.Time     // Time of the state the pool returns to
+	Discarded  time.Duration // Transactions written after RewindTo that are lost
+	DataErrors uint64        // Data errors found while verifying that state
+	MetaErrors uint64        // Metadata errors found while verifying that state
 }
 
 // ExportOptions represents options for pool export operations
@@ -457,18 +1068,79 @@ type ExportOptions struct {
 	Message string // Optional message for export
 }
 
-// Import imports a pool that was previously exported or is available for import
+// SplitOptions represents options for splitting a mirrored pool
+type SplitOptions struct {
+	Devices    []string          // Mirror sides to move, at most one per mirror; the last side of the others
+	AltRoot    string            // Alternative root directory of the new pool, implies Import
+	Properties map[string]string // Properties of the new pool
+	Import     bool              // Import the new pool instead of leaving it exported
+	DryRun     bool              // Only return the vdev tree the new pool would get
+}
+
+// Import imports a pool that was previously exported or is available for
+// import. The pool is selected by name, or by GUID in decimal when several
+// importable pools share a name.
 func (c *Client) Import(ctx context.Context, poolName string, opts ImportOptions) error {
 	if c.d == nil {
 		return fmt.Errorf("client is closed")
 	}
 
-	return c.d.ImportPool(ctx, poolName, driver.ImportOptions{
-		NewName:   opts.NewName,
-		AltRoot:   opts.AltRoot,
-		Force:     opts.Force,
-		Destroyed: opts.Destroyed,
+	_, err := c.importPool(ctx, poolName, opts)
+	return err
+}
+
+// Recover imports a pool that cannot be opened by rewinding it to an
+// earlier consistent state, like zpool import -F. With DryRun the pool is
+// not imported and the report tells how much would be discarded; a pool that
+// opens as is needs no rewind and is reported as such. A rewind that is
+// carried out returns a nil report.
+func (c *Client) Recover(ctx context.Context, poolName string, opts ImportOptions) (*RewindReport, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	opts.Rewind = true
+	return c.importPool(ctx, poolName, opts)
+}
+
+// importPool imports a pool and converts the rewind report of a dry run
+func (c *Client) importPool(ctx context.Context, poolName string, opts ImportOptions) (*RewindReport, error) {
+	info, err := c.d.ImportPool(ctx, poolName, driver.ImportOptions{
+		NewName:       opts.NewName,
+		AltRoot:       opts.AltRoot,
+		Force:         opts.Force,
+		Destroyed:     opts.Destroyed,
+		ReadOnly:      opts.ReadOnly,
+		Properties:    opts.Properties,
+		SearchPaths:   opts.SearchPaths,
+		CacheFile:     opts.CacheFile,
+		Rewind:        opts.Rewind,
+		DryRun:        opts.DryRun,
+		ExtremeRewind: opts.ExtremeRewind,
+		MaxTxg:        opts.MaxTxg,
+		MissingLog:    opts.MissingLog,
+
+		RewindToCheckpoint: opts.RewindToCheckpoint,
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import pool %s: %w", poolName, err)
+	}
+	if info == nil {
+		return nil, nil
+	}
+
+	report := &RewindReport{
+		Needed:     info.Needed,
+		Possible:   info.Possible,
+		Imported:   info.Imported,
+		Discarded:  time.Duration(info.Discarded) * time.Second,
+		DataErrors: info.DataErrors,
+		MetaErrors: info.MetaErrors,
+	}
+	if info.Possible {
+		report.RewindTo = time.Unix(int64(info.RewindTime), 0)
+	}
+	return report, nil
 }
 
 // Export exports a pool, making it available for import on other systems
@@ -483,6 +1155,36 @@ func (c *Client) Export(ctx context.Context, poolName string, opts ExportOptions
 	})
 }
 
+// Split detaches one side of every mirror of a pool and makes a new pool
+// of them, like zpool split. The new pool holds a copy of all the data and
+// is left exported unless Import or AltRoot is set. Every top-level vdev
+// other than a log must be a mirror.
+//
+// With DryRun nothing changes and the root of the vdev tree the new pool
+// would get is returned; otherwise the result is nil.
+func (c *Client) Split(ctx context.Context, poolName, newPoolName string, opts SplitOptions) (*VDevTree, error) {
+	if c.d == nil {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	info, err := c.d.SplitPool(ctx, poolName, newPoolName, driver.SplitOptions{
+		Devices:    opts.Devices,
+		AltRoot:    opts.AltRoot,
+		Properties: opts.Properties,
+		Import:     opts.Import,
+		DryRun:     opts.DryRun,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to split pool %s into %s: %w", poolName, newPoolName, err)
+	}
+	if info == nil {
+		return nil, nil
+	}
+
+	tree := vdevTree(*info)
+	return &tree, nil
+}
+
 // Destroy permanently destroys a pool and all its data
 func (c *Client) Destroy(ctx context.Context, poolName string) error {
 	if c.d == nil {
@@ -499,3 +1201,10 @@ func (c *Client) RuntimeInfo(ctx context.Context) (impl, zfsVersion, kernelVersi
 	}
 	return c.d.RuntimeInfo(ctx)
 }
+
+// Backend reports which driver implementation the client uses ("libzfs",
+// "ioctl", "stub", or "custom" for a driver passed to WithDriver) and why
+// it was selected
+func (c *Client) Backend() (impl, reason string) {
+	return c.sel.Impl, c.sel.Reason
+}
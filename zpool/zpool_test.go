@@ -0,0 +1,330 @@
+package zpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zombocoder/go-freebsd-libzfs/internal/driver"
+	"github.com/zombocoder/go-freebsd-libzfs/zfstest"
+)
+
+// newTestClient returns a client on a fake driver with a single-disk pool
+// named tank
+func newTestClient(t *testing.T) (*Client, *zfstest.FakeDriver) {
+	t.Helper()
+
+	ctx := context.Background()
+	d := zfstest.NewFakeDriver()
+	if err := d.CreatePool(ctx, "tank", []driver.VdevSpec{{Devices: []string{"/dev/ada0"}}}, driver.CreateOptions{}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	c, err := New(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, d
+}
+
+func TestClose_InjectedDriver(t *testing.T) {
+	ctx := context.Background()
+	c, d := newTestClient(t)
+	other, err := New(ctx, WithDriver(d))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := c.List(ctx); err == nil {
+		t.Error("List() on a closed client should fail")
+	}
+	// The shared driver stays usable by other clients
+	if _, err := other.List(ctx); err != nil {
+		t.Errorf("List() on another client after Close() error = %v", err)
+	}
+}
+
+func TestScanStatus(t *testing.T) {
+	now := time.Unix(2000, 0)
+	tests := []struct {
+		name        string
+		info        *driver.ScanInfo
+		state       ScanState
+		rate        uint64
+		eta         time.Duration
+		pausedSince int64
+		endTime     int64
+	}{
+		{
+			name: "running scrub",
+			info: &driver.ScanInfo{
+				Function: driver.PoolScanScrub, State: driver.PoolScanStateScanning,
+				StartTime: 1000, PassStart: 1000, PassSpentPaused: 500,
+				ToExamine: 10000, Issued: 5000, PassIssued: 5000,
+			},
+			state: ScanStateScanning,
+			rate:  10,
+			eta:   500 * time.Second,
+		},
+		{
+			name: "paused scrub",
+			info: &driver.ScanInfo{
+				Function: driver.PoolScanScrub, State: driver.PoolScanStateScanning,
+				StartTime: 1000, PassStart: 1000, PassPaused: 1500,
+				ToExamine: 10000, Issued: 5000, PassIssued: 5000,
+			},
+			state:       ScanStateSuspended,
+			pausedSince: 1500,
+		},
+		{
+			// pass_error_scrub_pause is in seconds, like pass_scrub_pause
+			name: "paused error scrub",
+			info: &driver.ScanInfo{
+				Function: driver.PoolScanErrorScrub, State: driver.PoolScanStateScanning,
+				StartTime: 1000, PassStart: 1000, PassPaused: 1600,
+				ToExamine: 100, Examined: 50,
+			},
+			state:       ScanStateSuspended,
+			pausedSince: 1600,
+		},
+		{
+			name: "finished scrub",
+			info: &driver.ScanInfo{
+				Function: driver.PoolScanScrub, State: driver.PoolScanStateFinished,
+				StartTime: 1000, EndTime: 1800, ToExamine: 10000, Issued: 10000,
+			},
+			state:   ScanStateFinished,
+			endTime: 1800,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scan := scanStatus(test.info, now)
+			if scan.State != test.state {
+				t.Errorf("State = %v, want %v", scan.State, test.state)
+			}
+			if scan.Rate != test.rate || scan.ETA != test.eta {
+				t.Errorf("Rate, ETA = %d, %v, want %d, %v", scan.Rate, scan.ETA, test.rate, test.eta)
+			}
+			switch {
+			case test.pausedSince == 0 && scan.PausedSince != nil:
+				t.Errorf("PausedSince = %v, want nil", scan.PausedSince)
+			case test.pausedSince != 0 && (scan.PausedSince == nil || !scan.PausedSince.Equal(time.Unix(test.pausedSince, 0))):
+				t.Errorf("PausedSince = %v, want %v", scan.PausedSince, time.Unix(test.pausedSince, 0))
+			}
+			switch {
+			case test.endTime == 0 && scan.EndTime != nil:
+				t.Errorf("EndTime = %v, want nil", scan.EndTime)
+			case test.endTime != 0 && (scan.EndTime == nil || !scan.EndTime.Equal(time.Unix(test.endTime, 0))):
+				t.Errorf("EndTime = %v, want %v", scan.EndTime, time.Unix(test.endTime, 0))
+			}
+		})
+	}
+
+	if scanStatus(nil, now) != nil {
+		t.Error("scanStatus(nil) should be nil")
+	}
+}
+
+func TestResumeScrub(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+
+	if err := c.ResumeScrub(ctx, "tank"); err == nil {
+		t.Error("ResumeScrub() without a scrub should fail")
+	}
+	if err := c.StartScrub(ctx, "tank"); err != nil {
+		t.Fatalf("StartScrub() error = %v", err)
+	}
+	if err := c.ResumeScrub(ctx, "tank"); err == nil {
+		t.Error("ResumeScrub() of a running scrub should fail")
+	}
+
+	if err := c.PauseScrub(ctx, "tank"); err != nil {
+		t.Fatalf("PauseScrub() error = %v", err)
+	}
+	status, err := c.GetStatus(ctx, "tank")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if status.Scan.State != ScanStateSuspended || status.Scan.PausedSince == nil {
+		t.Errorf("Scan after PauseScrub() = %+v, want suspended", status.Scan)
+	}
+
+	if err := c.ResumeScrub(ctx, "tank"); err != nil {
+		t.Fatalf("ResumeScrub() error = %v", err)
+	}
+	status, err = c.GetStatus(ctx, "tank")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if status.Scan.State != ScanStateScanning || status.Scan.PausedSince != nil {
+		t.Errorf("Scan after ResumeScrub() = %+v, want scanning", status.Scan)
+	}
+}
+
+// statusErrorDriver is a fake whose pool status cannot be read
+type statusErrorDriver struct {
+	*zfstest.FakeDriver
+}
+
+func (d statusErrorDriver) GetPoolStatus(ctx context.Context, poolName string) (*driver.PoolStatus, error) {
+	return nil, errors.New("status unavailable")
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	c, d := newTestClient(t)
+
+	// Nothing is running
+	if err := c.Wait(ctx, "tank", WaitScrub); err != nil {
+		t.Fatalf("Wait() without a scrub error = %v", err)
+	}
+
+	if err := c.StartScrub(ctx, "tank"); err != nil {
+		t.Fatalf("StartScrub() error = %v", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := c.Wait(timeout, "tank", WaitScrub); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() past the deadline error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	progress := make(chan WaitProgress, 1)
+	go func() {
+		<-progress
+		d.CompleteScan("tank")
+	}()
+	if err := c.Wait(ctx, "tank", WaitScrub, WaitOptions{Progress: progress, Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Wait() with progress error = %v", err)
+	}
+}
+
+func TestWait_ProgressError(t *testing.T) {
+	ctx := context.Background()
+	_, d := newTestClient(t)
+	c, err := New(ctx, WithDriver(statusErrorDriver{d}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := c.StartScrub(ctx, "tank"); err != nil {
+		t.Fatalf("StartScrub() error = %v", err)
+	}
+
+	progress := make(chan WaitProgress, 1)
+	err = c.Wait(ctx, "tank", WaitScrub, WaitOptions{Progress: progress, Interval: 10 * time.Millisecond})
+	if err == nil {
+		t.Fatal("Wait() should fail when progress cannot be read")
+	}
+	if len(progress) != 0 {
+		t.Error("Wait() sent progress it could not read")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	c, d := newTestClient(t)
+
+	if err := c.Export(ctx, "tank", ExportOptions{}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	report, err := c.Recover(ctx, "tank", ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Recover() dry run of an intact pool error = %v", err)
+	}
+	if report == nil || report.Needed || !report.RewindTo.IsZero() {
+		t.Errorf("Recover() dry run of an intact pool = %+v, want no rewind needed", report)
+	}
+
+	if err := d.DamagePool("tank", 90*time.Second); err != nil {
+		t.Fatalf("DamagePool() error = %v", err)
+	}
+	if err := c.Import(ctx, "tank", ImportOptions{}); err == nil {
+		t.Fatal("Import() of a damaged pool should fail")
+	}
+
+	before := time.Now().Add(-90 * time.Second).Truncate(time.Second)
+	report, err = c.Recover(ctx, "tank", ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Recover() dry run error = %v", err)
+	}
+	if report == nil || !report.Needed || !report.Possible || report.Imported {
+		t.Fatalf("Recover() dry run = %+v, want a possible rewind", report)
+	}
+	if report.Discarded != 90*time.Second {
+		t.Errorf("Discarded = %v, want %v", report.Discarded, 90*time.Second)
+	}
+	if report.RewindTo.Before(before) || report.RewindTo.After(time.Now().Add(-89*time.Second)) {
+		t.Errorf("RewindTo = %v, want about %v", report.RewindTo, before)
+	}
+
+	report, err = c.Recover(ctx, "tank", ImportOptions{})
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if report != nil {
+		t.Errorf("Recover() = %+v, want nil once the pool is imported", report)
+	}
+	if _, err := c.Get(ctx, "tank"); err != nil {
+		t.Errorf("Get() after Recover() error = %v", err)
+	}
+}
+
+func TestGetUint64Property(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+
+	size, err := c.GetUint64Property(ctx, "tank", PropertyNameSize)
+	if err != nil {
+		t.Fatalf("GetUint64Property(size) error = %v", err)
+	}
+	if size == 0 {
+		t.Error("GetUint64Property(size) = 0, want the size of the disk")
+	}
+	props, err := c.GetProperties(ctx, "tank", PropertyNameSize)
+	if err != nil {
+		t.Fatalf("GetProperties() error = %v", err)
+	}
+	if prop := props[PropertyNameSize]; prop.Raw != size {
+		t.Errorf("size Raw = %#v, want %d", prop.Raw, size)
+	} else if _, ok := prop.Value.(string); !ok {
+		t.Errorf("size Value = %#v, want the string zpool get prints", prop.Value)
+	}
+
+	if _, err := c.GetUint64Property(ctx, "tank", PropertyNameFailmode); err == nil {
+		t.Error("GetUint64Property(failmode) should fail, it is not a number")
+	}
+}
+
+func TestGetProperties_Raw(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+
+	if err := c.SetProperty(ctx, "tank", PropertyNameAutotrim, "on"); err != nil {
+		t.Fatalf("SetProperty() error = %v", err)
+	}
+	feature := FeatureProperty("async_destroy")
+	props, err := c.GetProperties(ctx, "tank", PropertyNameAutotrim, PropertyNameFailmode, feature)
+	if err != nil {
+		t.Fatalf("GetProperties() error = %v", err)
+	}
+
+	want := map[string]any{
+		PropertyNameAutotrim: true,
+		PropertyNameFailmode: "wait",
+		feature:              string(FeatureEnabled),
+	}
+	for name, raw := range want {
+		if got := props[name].Raw; got != raw {
+			t.Errorf("%s Raw = %#v, want %#v", name, got, raw)
+		}
+	}
+	if props[PropertyNameAutotrim].Value != "on" {
+		t.Errorf("autotrim Value = %#v, want on", props[PropertyNameAutotrim].Value)
+	}
+}